@@ -1,25 +1,150 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"log"
+	"os"
+	"time"
 
+	"github.com/GauravMakhijani/notes/internal/config"
 	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/internal/jwt"
 	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/GauravMakhijani/notes/internal/storage"
 	"github.com/urfave/negroni"
 )
 
 func main() {
-	store := database.NewStore()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+
+	var store database.Storer
+	switch cfg.Database.Driver {
+	case "postgres":
+		store = database.NewStore(cfg.Database.DSN)
+	case "sqlite":
+		store = database.NewSQLiteStore(cfg.Database.SQLitePath)
+	case "memory":
+		store = database.NewMemoryStore()
+	}
+
 	if err := store.AutoMigrate(); err != nil {
 		log.Println(err)
 		panic("Failed to migrate database")
 	}
 
-	service := service.NewService(store)
-	appRouter := initRouter(service)
+	keyring, err := jwt.LoadKeyring(cfg.JWT, cfg.Env == config.EnvDev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	jwt.SetKeyring(keyring)
+	jwt.SetAccessTokenTTL(cfg.JWT.AccessTokenTTL)
+
+	blobs, err := newBlobStore(cfg.Attachments.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bus := events.NewBus(cfg.Events.LogSize)
+	service := service.NewService(store, blobs, bus, cfg)
+	if cfg.Revisions.MaxAge > 0 {
+		go pruneRevisions(service, time.Hour)
+	}
+	if cfg.Trash.Retention > 0 {
+		go purgeTrash(service, time.Hour)
+	}
+	go removePurgedAttachments(service, time.Hour)
+	go deliverWebhooks(service, time.Second)
+	// imports do not survive a restart since their files are temporary
+	if failed, err := service.RecoverImportJobs(context.Background()); err != nil {
+		log.Printf("Failed to recover import jobs: %s", err)
+	} else if failed > 0 {
+		log.Printf("Marked %d interrupted import jobs as failed", failed)
+	}
+	appRouter := initRouter(cfg, service)
 	server := negroni.Classic()
 	server.UseHandler(appRouter)
-	log.Println("Starting server on port 8080")
-	server.Run(":8080")
+	log.Printf("Starting server on port %d (%s mode)", cfg.Server.Port, cfg.Env)
+	server.Run(cfg.Addr())
 	return
 }
+
+// pruneRevisions periodically drops note revisions past their maximum age,
+// which are otherwise only pruned when their note changes
+func pruneRevisions(service service.Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		pruned, err := service.PruneRevisions(context.Background())
+		if err != nil {
+			log.Printf("Failed to prune note revisions: %s", err)
+			continue
+		}
+		if pruned > 0 {
+			log.Printf("Pruned %d note revisions", pruned)
+		}
+	}
+}
+
+// purgeTrash periodically deletes the notes that have been in the trash
+// for longer than the retention period
+func purgeTrash(service service.Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		purged, err := service.PurgeTrash(context.Background())
+		if err != nil {
+			log.Printf("Failed to purge the trash: %s", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d notes from the trash", purged)
+		}
+	}
+}
+
+// removePurgedAttachments periodically retries removing the blobs of
+// deleted attachments, which is otherwise done right after they are
+// deleted
+func removePurgedAttachments(service service.Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		removed, err := service.RemovePurgedAttachments(context.Background())
+		if err != nil {
+			log.Printf("Failed to remove deleted attachments: %s", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d deleted attachments", removed)
+		}
+	}
+}
+
+// deliverWebhooks attempts the webhook deliveries that are due every
+// interval. Deliveries are queued in the database, so those pending when
+// the server stops are sent once it is back.
+func deliverWebhooks(service service.Service, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := service.DeliverWebhooks(context.Background()); err != nil {
+			log.Printf("Failed to deliver webhooks: %s", err)
+		}
+	}
+}
+
+// newBlobStore opens the blob store attachments are kept in
+func newBlobStore(cfg config.StorageConfig) (storage.BlobStore, error) {
+	if cfg.Driver == "s3" {
+		return storage.NewS3Store(context.Background(), storage.S3Options{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			UseSSL:          cfg.S3.UseSSL,
+		})
+	}
+	return storage.NewLocalStore(cfg.Path)
+}
@@ -3,35 +3,158 @@ package main
 import (
 	"net/http"
 
+	"github.com/GauravMakhijani/notes/internal/config"
 	"github.com/GauravMakhijani/notes/internal/handler"
+	"github.com/GauravMakhijani/notes/internal/jwt"
 	"github.com/GauravMakhijani/notes/internal/middleware"
 	"github.com/GauravMakhijani/notes/internal/service"
 	"github.com/gorilla/mux"
 )
 
-func initRouter(service service.Service) *mux.Router {
+func initRouter(cfg *config.Config, service service.Service) *mux.Router {
 
 	router := mux.NewRouter()
-	router.Use(middleware.RateLimiter)
+	router.Use(middleware.ClientIP(cfg.Server.TrustProxyHeaders, cfg.Server.ProxyHops))
+	router.Use(middleware.RateLimiter(config.RateLimitPolicy{
+		RequestsPerSecond: cfg.RateLimit.RequestsPerSecond,
+		Burst:             cfg.RateLimit.Burst,
+	}, cfg.RateLimit.IdleTimeout))
+	authenticated := middleware.SetMiddleWareAuthentication(service)
+	// event streams and WebSockets also take a ticket, browsers being
+	// unable to set an Authorization header on them
+	streamAuthenticated := middleware.SetMiddleWareStreamAuthentication(service)
+
+	// rateLimited applies the route group's limit, if one is configured, on
+	// top of the default limit
+	rateLimited := func(group string) func(http.Handler) http.Handler {
+		policy, ok := cfg.RateLimit.Policy(group)
+		if !ok {
+			return func(next http.Handler) http.Handler { return next }
+		}
+		return middleware.RateLimiter(policy, cfg.RateLimit.IdleTimeout)
+	}
 
 	//Auth router
 	authRouter := router.PathPrefix("/api/auth").Subrouter()
 
-	authRouter.HandleFunc("/signup", handler.SignUpHanler(service)).Methods(http.MethodPost)
-	authRouter.HandleFunc("/login", handler.LoginHandler(service)).Methods(http.MethodPost)
-	authRouter.HandleFunc("/ping", middleware.SetMiddleWareAuthentication(PingHandler())).Methods(http.MethodGet)
+	loginLimited := rateLimited("login")
+	authRouter.Handle("/signup", loginLimited(handler.SignUpHanler(service))).Methods(http.MethodPost)
+	authRouter.Handle("/login", loginLimited(handler.LoginHandler(service))).Methods(http.MethodPost)
+	authRouter.HandleFunc("/refresh", handler.RefreshTokenHandler(service)).Methods(http.MethodPost)
+	authRouter.HandleFunc("/logout", authenticated(handler.LogoutHandler(service))).Methods(http.MethodPost)
+	authRouter.HandleFunc("/ticket", authenticated(handler.TicketHandler(service))).Methods(http.MethodPost)
+	authRouter.HandleFunc("/ping", authenticated(PingHandler())).Methods(http.MethodGet)
+
+	//Admin router
+	adminRouter := router.PathPrefix("/api/admin").Subrouter()
+	adminRouter.HandleFunc("/users/{username}/unlock", authenticated(handler.UnlockAccountHandler(service))).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/ips/{ip}/unlock", authenticated(handler.UnlockIPHandler(service))).Methods(http.MethodPost)
+	adminRouter.HandleFunc("/audit-events", authenticated(handler.ListAuditEventsHandler(service))).Methods(http.MethodGet)
+
+	//JWKS for services verifying our access tokens
+	router.HandleFunc("/.well-known/jwks.json", handler.JWKSHandler(jwt.DefaultKeyring())).Methods(http.MethodGet)
 
 	//Notes router
 	notesRouter := router.PathPrefix("/api/notes").Subrouter()
-	notesRouter.HandleFunc("", middleware.SetMiddleWareAuthentication(handler.CreateNoteHandler(service))).Methods(http.MethodPost)
-	notesRouter.HandleFunc("", middleware.SetMiddleWareAuthentication(handler.ListNotesHandler(service))).Methods(http.MethodGet)
-	notesRouter.HandleFunc("/{note_id}", middleware.SetMiddleWareAuthentication(handler.GetNoteByIDHandler(service))).Methods(http.MethodGet)
-	notesRouter.HandleFunc("/{note_id}", middleware.SetMiddleWareAuthentication(handler.DeleteNoteHandler(service))).Methods(http.MethodDelete)
-	notesRouter.HandleFunc("/{note_id}", middleware.SetMiddleWareAuthentication(handler.UpdateNoteHandler(service))).Methods(http.MethodPut)
-	notesRouter.HandleFunc("/{note_id}/share", middleware.SetMiddleWareAuthentication(handler.ShareNoteHandler(service))).Methods(http.MethodPost)
+	notesRouter.Use(rateLimited("notes"))
+	notesRouter.HandleFunc("", authenticated(handler.CreateNoteHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("", authenticated(handler.ListNotesHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/batch", authenticated(handler.BatchNotesHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}", authenticated(handler.GetNoteByIDHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}", authenticated(handler.DeleteNoteHandler(service))).Methods(http.MethodDelete)
+	notesRouter.HandleFunc("/{note_id}", authenticated(handler.UpdateNoteHandler(service))).Methods(http.MethodPut)
+	notesRouter.HandleFunc("/{note_id}/move", authenticated(handler.MoveNoteHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/restore", authenticated(handler.RestoreNoteHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/share", authenticated(handler.ShareNoteHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/shares", authenticated(handler.ListNoteSharesHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/shares/{username}", authenticated(handler.RevokeNoteShareHandler(service))).Methods(http.MethodDelete)
+	notesRouter.HandleFunc("/{note_id}/links", authenticated(handler.CreatePublicLinkHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/links", authenticated(handler.ListPublicLinksHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/links/{link_id}", authenticated(handler.RevokePublicLinkHandler(service))).Methods(http.MethodDelete)
+	notesRouter.HandleFunc("/{note_id}/attachments", authenticated(handler.UploadAttachmentHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/attachments", authenticated(handler.ListAttachmentsHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/attachments/{attachment_id}", authenticated(handler.DownloadAttachmentHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/attachments/{attachment_id}", authenticated(handler.DeleteAttachmentHandler(service))).Methods(http.MethodDelete)
+	notesRouter.HandleFunc("/{note_id}/tags", authenticated(handler.AddNoteTagsHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/tags/{tag}", authenticated(handler.RemoveNoteTagHandler(service))).Methods(http.MethodDelete)
+	notesRouter.HandleFunc("/{note_id}/revisions", authenticated(handler.ListNoteRevisionsHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/revisions/diff", authenticated(handler.DiffNoteRevisionsHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/revisions/{number:[0-9]+}", authenticated(handler.GetNoteRevisionHandler(service))).Methods(http.MethodGet)
+	notesRouter.HandleFunc("/{note_id}/revisions/{number:[0-9]+}/restore", authenticated(handler.RestoreNoteRevisionHandler(service))).Methods(http.MethodPost)
+	notesRouter.HandleFunc("/{note_id}/collab", streamAuthenticated(handler.CollabHandler(service, cfg.Events.KeepAlive, cfg.Server.AllowedOrigins))).Methods(http.MethodGet)
+
+	//Tags router
+	tagsRouter := router.PathPrefix("/api/tags").Subrouter()
+	tagsRouter.Use(rateLimited("notes"))
+	tagsRouter.HandleFunc("", authenticated(handler.ListTagsHandler(service))).Methods(http.MethodGet)
+	tagsRouter.HandleFunc("/merge", authenticated(handler.MergeTagsHandler(service))).Methods(http.MethodPost)
+	tagsRouter.HandleFunc("/{tag}", authenticated(handler.RenameTagHandler(service))).Methods(http.MethodPatch)
+	tagsRouter.HandleFunc("/{tag}", authenticated(handler.DeleteTagHandler(service))).Methods(http.MethodDelete)
+
+	//Trash router
+	trashRouter := router.PathPrefix("/api/trash").Subrouter()
+	trashRouter.Use(rateLimited("notes"))
+	trashRouter.HandleFunc("", authenticated(handler.ListTrashHandler(service))).Methods(http.MethodGet)
+	trashRouter.HandleFunc("/{note_id}", authenticated(handler.PurgeNoteHandler(service))).Methods(http.MethodDelete)
+
+	//Notebooks router
+	notebooksRouter := router.PathPrefix("/api/notebooks").Subrouter()
+	notebooksRouter.Use(rateLimited("notes"))
+	notebooksRouter.HandleFunc("", authenticated(handler.CreateNotebookHandler(service))).Methods(http.MethodPost)
+	notebooksRouter.HandleFunc("", authenticated(handler.ListNotebooksHandler(service))).Methods(http.MethodGet)
+	notebooksRouter.HandleFunc("/{notebook_id}", authenticated(handler.RenameNotebookHandler(service))).Methods(http.MethodPatch)
+	notebooksRouter.HandleFunc("/{notebook_id}", authenticated(handler.DeleteNotebookHandler(service))).Methods(http.MethodDelete)
+	notebooksRouter.HandleFunc("/{notebook_id}/move", authenticated(handler.MoveNotebookHandler(service))).Methods(http.MethodPost)
+
+	//Groups router
+	groupsRouter := router.PathPrefix("/api/groups").Subrouter()
+	groupsRouter.Use(rateLimited("notes"))
+	groupsRouter.HandleFunc("", authenticated(handler.CreateGroupHandler(service))).Methods(http.MethodPost)
+	groupsRouter.HandleFunc("", authenticated(handler.ListGroupsHandler(service))).Methods(http.MethodGet)
+	groupsRouter.HandleFunc("/{group_id}", authenticated(handler.GetGroupHandler(service))).Methods(http.MethodGet)
+	groupsRouter.HandleFunc("/{group_id}/members", authenticated(handler.AddGroupMemberHandler(service))).Methods(http.MethodPost)
+	groupsRouter.HandleFunc("/{group_id}/members/{username}", authenticated(handler.UpdateGroupMemberHandler(service))).Methods(http.MethodPatch)
+	groupsRouter.HandleFunc("/{group_id}/members/{username}", authenticated(handler.RemoveGroupMemberHandler(service))).Methods(http.MethodDelete)
+
+	//Shared notes router
+	sharedRouter := router.PathPrefix("/api/shared").Subrouter()
+	sharedRouter.Use(rateLimited("notes"))
+	sharedRouter.HandleFunc("/incoming", authenticated(handler.ListIncomingSharesHandler(service))).Methods(http.MethodGet)
+	sharedRouter.HandleFunc("/outgoing", authenticated(handler.ListOutgoingSharesHandler(service))).Methods(http.MethodGet)
+
+	//Public links, served without authentication
+	publicRouter := router.PathPrefix("/p").Subrouter()
+	publicRouter.Use(rateLimited("public"))
+	publicRouter.HandleFunc("/{token}", handler.OpenPublicLinkHandler(service)).Methods(http.MethodGet, http.MethodPost)
+
+	//Attachment quota
+	router.Handle("/api/attachments/usage", rateLimited("notes")(authenticated(handler.AttachmentUsageHandler(service)))).Methods(http.MethodGet)
+
+	//Export
+	router.Handle("/api/export", rateLimited("notes")(authenticated(handler.ExportNotesHandler(service)))).Methods(http.MethodGet)
+
+	//Import router
+	importRouter := router.PathPrefix("/api/import").Subrouter()
+	importRouter.Use(rateLimited("notes"))
+	importRouter.HandleFunc("", authenticated(handler.StartImportHandler(service))).Methods(http.MethodPost)
+	importRouter.HandleFunc("", authenticated(handler.ListImportJobsHandler(service))).Methods(http.MethodGet)
+	importRouter.HandleFunc("/{job_id}", authenticated(handler.GetImportJobHandler(service))).Methods(http.MethodGet)
+
+	//Events
+	router.Handle("/api/events", rateLimited("notes")(streamAuthenticated(handler.EventsHandler(service, cfg.Events.KeepAlive, cfg.Server.AllowedOrigins)))).Methods(http.MethodGet)
+
+	//Webhooks router
+	webhooksRouter := router.PathPrefix("/api/webhooks").Subrouter()
+	webhooksRouter.Use(rateLimited("notes"))
+	webhooksRouter.HandleFunc("", authenticated(handler.CreateWebhookHandler(service))).Methods(http.MethodPost)
+	webhooksRouter.HandleFunc("", authenticated(handler.ListWebhooksHandler(service))).Methods(http.MethodGet)
+	webhooksRouter.HandleFunc("/{webhook_id}", authenticated(handler.GetWebhookHandler(service))).Methods(http.MethodGet)
+	webhooksRouter.HandleFunc("/{webhook_id}", authenticated(handler.UpdateWebhookHandler(service))).Methods(http.MethodPatch)
+	webhooksRouter.HandleFunc("/{webhook_id}", authenticated(handler.DeleteWebhookHandler(service))).Methods(http.MethodDelete)
+	webhooksRouter.HandleFunc("/{webhook_id}/deliveries", authenticated(handler.ListWebhookDeliveriesHandler(service))).Methods(http.MethodGet)
 
 	//Search router
-	router.HandleFunc("/api/search", middleware.SetMiddleWareAuthentication(handler.SearchNotesHandler(service))).Methods(http.MethodGet)
+	router.Handle("/api/search", rateLimited("search")(authenticated(handler.SearchNotesHandler(service)))).Methods(http.MethodGet)
 	return router
 }
 
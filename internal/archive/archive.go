@@ -0,0 +1,80 @@
+// Package archive reads and writes the formats notes are exported in: a
+// JSON document holding every note and its attachments, and a zip of
+// Markdown files with YAML front matter. Evernote ENEX files can be read
+// too.
+//
+// Writers stream: each note is written as soon as it is handed over, and
+// attachments are copied from their readers without being buffered.
+// Readers likewise hand over one note at a time.
+package archive
+
+import (
+	"io"
+	"time"
+)
+
+// Version is the version of the JSON export format
+const Version = 1
+
+// Note is a note as exported
+type Note struct {
+	ID          string       `json:"id,omitempty"`
+	Title       string       `json:"title"`
+	Body        string       `json:"body"`
+	Format      string       `json:"format,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+	Tags        []string     `json:"tags"`
+	SharedWith  []Share      `json:"shared_with,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Share is a user a note is shared with
+type Share struct {
+	Username string `json:"username" yaml:"username"`
+	Role     string `json:"role" yaml:"role"`
+}
+
+// Attachment is a file attached to a note
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum,omitempty"`
+	// Data holds the contents of attachments read from an export
+	Data []byte `json:"data,omitempty"`
+	// Open returns the contents of attachments being exported
+	Open func() (io.ReadCloser, error) `json:"-"`
+}
+
+// FrontMatter is the YAML header of an exported Markdown file
+type FrontMatter struct {
+	Title      string    `yaml:"title"`
+	Format     string    `yaml:"format,omitempty"`
+	Created    time.Time `yaml:"created"`
+	Updated    time.Time `yaml:"updated"`
+	Tags       []string  `yaml:"tags"`
+	SharedWith []Share   `yaml:"shared_with,omitempty"`
+	// Attachments are the paths of the note's attachments within the
+	// archive, relative to the Markdown file
+	Attachments []string `yaml:"attachments,omitempty"`
+}
+
+// Writer writes notes to an export
+type Writer interface {
+	WriteNote(note *Note) error
+	// Close finishes the export without closing the underlying writer
+	Close() error
+}
+
+// Item is an entry read from an import. Err is set instead of Note when the
+// entry could not be read.
+type Item struct {
+	// Name tells the entry apart in reports, such as its path in a zip
+	Name string
+	Note *Note
+	Err  error
+}
+
+// maxNoteSize is the largest note body read from an import, in bytes
+const maxNoteSize = 10 << 20
@@ -0,0 +1,73 @@
+package archive
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readItems returns the items a reader hands over, and the error it ends
+// with
+func readItems(read func(fn func(Item) error) error) ([]Item, error) {
+	var items []Item
+	err := read(func(item Item) error {
+		items = append(items, item)
+		return nil
+	})
+	return items, err
+}
+
+func openFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// checkFailed checks that the item failed with an error mentioning want
+func checkFailed(t *testing.T, item Item, want string) {
+	t.Helper()
+	if item.Err == nil || item.Note != nil {
+		t.Errorf("%s: note %+v, error %v, want it to fail", item.Name, item.Note, item.Err)
+		return
+	}
+	if !strings.Contains(item.Err.Error(), want) {
+		t.Errorf("%s: error %q, want it to mention %q", item.Name, item.Err, want)
+	}
+}
+
+func checkNote(t *testing.T, item Item, want *Note) {
+	t.Helper()
+	if item.Err != nil {
+		t.Errorf("%s: %v", item.Name, item.Err)
+		return
+	}
+	got := *item.Note
+	// zip attachments open lazily, zip times are in a zone of their own
+	got.Attachments = append([]Attachment(nil), got.Attachments...)
+	for i := range got.Attachments {
+		got.Attachments[i].Open = nil
+	}
+	if got.CreatedAt.Equal(want.CreatedAt) {
+		got.CreatedAt = want.CreatedAt
+	}
+	if got.UpdatedAt.Equal(want.UpdatedAt) {
+		got.UpdatedAt = want.UpdatedAt
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("%s:\ngot  %+v\nwant %+v", item.Name, &got, want)
+	}
+}
+
+func date(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// enexTimeLayout is the layout of times in ENEX files
+const enexTimeLayout = "20060102T150405Z"
+
+// enexNote is a note as stored in an Evernote export
+type enexNote struct {
+	Title     string         `xml:"title"`
+	Content   string         `xml:"content"`
+	Created   string         `xml:"created"`
+	Updated   string         `xml:"updated"`
+	Tags      []string       `xml:"tag"`
+	Resources []enexResource `xml:"resource"`
+}
+
+type enexResource struct {
+	Data     string `xml:"data"`
+	Mime     string `xml:"mime"`
+	Filename string `xml:"resource-attributes>file-name"`
+}
+
+// ReadENEX reads an Evernote export, handing each note to fn with its
+// content converted from ENML to Markdown. Resources become attachments.
+func ReadENEX(r io.Reader, fn func(Item) error) error {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	for i := 0; ; {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+		var note enexNote
+		if err := decoder.DecodeElement(&note, &start); err != nil {
+			return err
+		}
+		item := Item{Name: fmt.Sprintf("note %d", i)}
+		if title := strings.TrimSpace(note.Title); title != "" {
+			item.Name = fmt.Sprintf("note %d (%s)", i, title)
+		}
+		item.Note, item.Err = note.convert()
+		if err := fn(item); err != nil {
+			return err
+		}
+		i++
+	}
+}
+
+func (n *enexNote) convert() (*Note, error) {
+	if len(n.Content) > maxNoteSize {
+		return nil, fmt.Errorf("note is larger than %d bytes", maxNoteSize)
+	}
+	body, err := enmlToMarkdown(n.Content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content: %w", err)
+	}
+	note := &Note{
+		Title:  strings.TrimSpace(n.Title),
+		Body:   body,
+		Format: "markdown",
+		Tags:   n.Tags,
+	}
+	if n.Created != "" {
+		if note.CreatedAt, err = time.Parse(enexTimeLayout, n.Created); err != nil {
+			return nil, fmt.Errorf("invalid created time %q", n.Created)
+		}
+	}
+	if n.Updated != "" {
+		if note.UpdatedAt, err = time.Parse(enexTimeLayout, n.Updated); err != nil {
+			return nil, fmt.Errorf("invalid updated time %q", n.Updated)
+		}
+	}
+	for i, resource := range n.Resources {
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(resource.Data), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid data in resource %d", i)
+		}
+		filename := resource.Filename
+		if filename == "" {
+			filename = fmt.Sprintf("resource-%d", i+1)
+		}
+		note.Attachments = append(note.Attachments, Attachment{
+			Filename:    filename,
+			ContentType: resource.Mime,
+			Size:        int64(len(data)),
+			Data:        data,
+		})
+	}
+	return note, nil
+}
+
+// enmlToMarkdown converts the ENML of a note to Markdown, keeping headings,
+// lists, checkboxes and links and dropping any other markup
+func enmlToMarkdown(content string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	decoder.AutoClose = xml.HTMLAutoClose
+
+	var (
+		out    strings.Builder
+		line   strings.Builder
+		prefix string
+		depth  int
+		hrefs  []string
+	)
+	// flush ends the current line, collapsing its whitespace. List items
+	// are kept together while other blocks become paragraphs.
+	flush := func() {
+		text := strings.Join(strings.Fields(line.String()), " ")
+		line.Reset()
+		defer func() { prefix = "" }()
+		if text == "" {
+			return
+		}
+		out.WriteString(prefix + text)
+		if depth > 0 {
+			out.WriteString("\n")
+		} else {
+			out.WriteString("\n\n")
+		}
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch name := strings.ToLower(t.Name.Local); name {
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				flush()
+				prefix = strings.Repeat("#", int(name[1]-'0')) + " "
+			case "ul", "ol":
+				flush()
+				depth++
+			case "li":
+				flush()
+				prefix = strings.Repeat("  ", max(depth-1, 0)) + "- "
+			case "en-todo":
+				if attr(t, "checked") == "true" {
+					line.WriteString("[x] ")
+				} else {
+					line.WriteString("[ ] ")
+				}
+			case "a":
+				hrefs = append(hrefs, attr(t, "href"))
+				line.WriteString("[")
+			case "br", "div", "p", "blockquote", "pre", "table", "tr", "hr":
+				flush()
+			case "td", "th":
+				line.WriteString(" ")
+			}
+		case xml.EndElement:
+			switch strings.ToLower(t.Name.Local) {
+			case "ul", "ol":
+				flush()
+				if depth--; depth == 0 {
+					out.WriteString("\n")
+				}
+			case "a":
+				if len(hrefs) > 0 {
+					line.WriteString("](" + hrefs[len(hrefs)-1] + ")")
+					hrefs = hrefs[:len(hrefs)-1]
+				}
+			case "h1", "h2", "h3", "h4", "h5", "h6", "li", "div", "p", "blockquote", "pre", "tr":
+				flush()
+			}
+		case xml.CharData:
+			line.Write(t)
+		}
+	}
+	flush()
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if strings.EqualFold(a.Name.Local, name) {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadENEX(t *testing.T) {
+	f := openFixture(t, "notes.enex")
+	items, err := readItems(func(fn func(Item) error) error { return ReadENEX(f, fn) })
+	if err != nil {
+		t.Fatalf("ReadENEX: %v", err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("%d items, want 4", len(items))
+	}
+
+	if items[0].Name != "note 0 (Groceries)" {
+		t.Errorf("item named %q", items[0].Name)
+	}
+	checkNote(t, items[0], &Note{
+		Title: "Groceries",
+		Body: "# Shopping\n\n" +
+			"Buy these at the market:\n\n" +
+			"- [x] milk\n" +
+			"- [ ] eggs\n" +
+			"  - free range\n\n" +
+			"See [recipes](https://example.com/recipes) & more\n\n" +
+			"next line",
+		Format:    "markdown",
+		CreatedAt: date("2024-01-02T03:04:05Z"),
+		UpdatedAt: date("2024-02-03T04:05:06Z"),
+		Tags:      []string{"home", "shopping"},
+		Attachments: []Attachment{
+			{Filename: "list.txt", ContentType: "text/plain", Size: 5, Data: []byte("hello")},
+			{Filename: "resource-2", ContentType: "image/png", Size: 2, Data: []byte("hi")},
+		},
+	})
+	checkFailed(t, items[1], "invalid created time")
+	checkFailed(t, items[2], "invalid data in resource 0")
+	if items[3].Name != "note 3" {
+		t.Errorf("untitled item named %q", items[3].Name)
+	}
+	checkNote(t, items[3], &Note{Body: "Untitled table\n\na b", Format: "markdown"})
+}
+
+func TestReadENEXNoteSize(t *testing.T) {
+	content := "<en-note>" + strings.Repeat("a", maxNoteSize) + "</en-note>"
+	enex := "<en-export><note><title>Large</title><content><![CDATA[" + content + "]]></content></note>" +
+		"<note><title>Small</title><content><![CDATA[<en-note>small</en-note>]]></content></note></en-export>"
+	items, err := readItems(func(fn func(Item) error) error { return ReadENEX(strings.NewReader(enex), fn) })
+	if err != nil || len(items) != 2 {
+		t.Fatalf("ReadENEX = %d items, %v, want 2", len(items), err)
+	}
+	checkFailed(t, items[0], "larger than")
+	if items[1].Err != nil || items[1].Note.Body != "small" {
+		t.Errorf("note after a large one: %+v, %v", items[1].Note, items[1].Err)
+	}
+}
+
+func TestReadENEXMalformed(t *testing.T) {
+	enex := "<en-export><note><title>One</title><content>one</content></note><note><title>Two</ti"
+	items, err := readItems(func(fn func(Item) error) error { return ReadENEX(strings.NewReader(enex), fn) })
+	if err == nil || err == io.EOF {
+		t.Fatalf("truncated export read without an error")
+	}
+	if len(items) != 1 || items[0].Note == nil || items[0].Note.Title != "One" {
+		t.Errorf("items before the truncation: %+v", items)
+	}
+}
+
+func TestENMLToMarkdown(t *testing.T) {
+	tests := []struct {
+		enml string
+		want string
+	}{
+		{"<en-note>plain</en-note>", "plain"},
+		{"<en-note><h2>Title</h2><p>one</p><p>two</p></en-note>", "## Title\n\none\n\ntwo"},
+		{"<en-note><ol><li>one</li><li>two</li></ol>after</en-note>", "- one\n- two\n\nafter"},
+		{`<en-note><div><en-todo checked="false"/>open</div></en-note>`, "[ ] open"},
+		{`<en-note><a href="https://example.com">a <b>bold</b> link</a></en-note>`, "[a bold link](https://example.com)"},
+		{"<en-note>caf&eacute; &lt;b&gt; &#169;</en-note>", "café <b> ©"},
+		{"<en-note><div>unclosed<br>line</en-note>", "unclosed\n\nline"},
+		{"<en-note><script>alert(1)</script><span style=\"color:red\">text</span></en-note>", "alert(1)text"},
+	}
+	for _, tt := range tests {
+		got, err := enmlToMarkdown(tt.enml)
+		if err != nil || got != tt.want {
+			t.Errorf("enmlToMarkdown(%q) = %q, %v, want %q", tt.enml, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// jsonWriter writes a JSON document of the form
+//
+//	{"version": 1, "exported_at": "...", "notes": [...]}
+//
+// with the contents of attachments base64 encoded in their data field
+type jsonWriter struct {
+	w     io.Writer
+	count int
+}
+
+// NewJSONWriter starts a JSON export
+func NewJSONWriter(w io.Writer, exportedAt time.Time) (Writer, error) {
+	header, err := json.Marshal(exportedAt)
+	if err != nil {
+		return nil, err
+	}
+	_, err = fmt.Fprintf(w, `{"version":%d,"exported_at":%s,"notes":[`, Version, header)
+	return &jsonWriter{w: w}, err
+}
+
+func (j *jsonWriter) WriteNote(note *Note) error {
+	if j.count > 0 {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.count++
+
+	// the attachments are appended to the note object by hand so that
+	// their contents can be streamed
+	withoutAttachments := *note
+	withoutAttachments.Attachments = nil
+	if err := j.writeOpenObject(withoutAttachments); err != nil {
+		return err
+	}
+	if len(note.Attachments) > 0 {
+		if _, err := io.WriteString(j.w, `,"attachments":[`); err != nil {
+			return err
+		}
+		for i := range note.Attachments {
+			if i > 0 {
+				if _, err := io.WriteString(j.w, ","); err != nil {
+					return err
+				}
+			}
+			if err := j.writeAttachment(&note.Attachments[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(j.w, "]"); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(j.w, "}")
+	return err
+}
+
+func (j *jsonWriter) writeAttachment(attachment *Attachment) error {
+	metadata := *attachment
+	metadata.Data = nil
+	if err := j.writeOpenObject(metadata); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(j.w, `,"data":"`); err != nil {
+		return err
+	}
+
+	body, err := attachment.Contents()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	encoder := base64.NewEncoder(base64.StdEncoding, j.w)
+	if _, err := io.Copy(encoder, body); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, `"}`)
+	return err
+}
+
+// writeOpenObject writes v, which must encode to a non-empty JSON object,
+// leaving the object open for more fields
+func (j *jsonWriter) writeOpenObject(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = bytes.TrimSuffix(data, []byte("}"))
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Close() error {
+	_, err := io.WriteString(j.w, "]}\n")
+	return err
+}
+
+// Contents opens the attachment, whether it is being exported or was read
+// from an import
+func (a *Attachment) Contents() (io.ReadCloser, error) {
+	if a.Open != nil {
+		return a.Open()
+	}
+	return io.NopCloser(bytes.NewReader(a.Data)), nil
+}
+
+// ReadJSON reads a JSON export, handing each note to fn. Notes that do not
+// match the format are reported as failed items; malformed JSON ends the
+// import.
+func ReadJSON(r io.Reader, fn func(Item) error) error {
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case "version":
+			var version int
+			if err := decoder.Decode(&version); err != nil {
+				return err
+			}
+			if version > Version {
+				return fmt.Errorf("export format version %d is not supported", version)
+			}
+		case "notes":
+			if err := expectDelim(decoder, '['); err != nil {
+				return err
+			}
+			for i := 0; decoder.More(); i++ {
+				item := Item{Name: fmt.Sprintf("notes[%d]", i)}
+				// only malformed JSON ends the import, a note that does
+				// not decode is skipped
+				var raw json.RawMessage
+				if err := decoder.Decode(&raw); err != nil {
+					return err
+				}
+				var note Note
+				err := json.Unmarshal(raw, &note)
+				var typeErr *json.UnmarshalTypeError
+				switch {
+				case errors.As(err, &typeErr):
+					item.Err = fmt.Errorf("invalid %s", typeErr.Field)
+				case err != nil:
+					item.Err = fmt.Errorf("invalid note: %w", err)
+				case len(note.Body) > maxNoteSize:
+					item.Err = fmt.Errorf("note is larger than %d bytes", maxNoteSize)
+				default:
+					item.Note = &note
+				}
+				if err := fn(item); err != nil {
+					return err
+				}
+			}
+			if err := expectDelim(decoder, ']'); err != nil {
+				return err
+			}
+		default:
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return err
+			}
+		}
+	}
+	return expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("malformed export: expected %s", delim)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadJSON(t *testing.T) {
+	f := openFixture(t, "export.json")
+	items, err := readItems(func(fn func(Item) error) error { return ReadJSON(f, fn) })
+	if err != nil {
+		t.Fatalf("ReadJSON: %v", err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("%d items, want 4", len(items))
+	}
+
+	checkNote(t, items[0], &Note{
+		ID:          "8c4c7a4e-6a0f-4c1e-9f3b-2f0a6f1f7c11",
+		Title:       "Groceries",
+		Body:        "# Shopping\n\n- [ ] milk",
+		Format:      "markdown",
+		CreatedAt:   date("2024-01-02T03:04:05Z"),
+		UpdatedAt:   date("2024-02-03T04:05:06+01:00"),
+		Tags:        []string{"home", "shopping"},
+		SharedWith:  []Share{{Username: "bob", Role: "editor"}},
+		Attachments: []Attachment{{Filename: "list.txt", ContentType: "text/plain", Size: 5, Data: []byte("hello")}},
+	})
+	if items[1].Name != "notes[1]" {
+		t.Errorf("item named %q", items[1].Name)
+	}
+	checkFailed(t, items[1], "invalid title")
+	checkNote(t, items[2], &Note{Title: "Plain", Body: "just text", CreatedAt: date("2024-01-05T00:00:00Z"), UpdatedAt: date("2024-01-05T00:00:00Z")})
+	checkFailed(t, items[3], "invalid note")
+}
+
+func TestReadJSONNoteSize(t *testing.T) {
+	export := `{"version":1,"notes":[{"title":"Large","body":"` + strings.Repeat("a", maxNoteSize+1) + `"},{"title":"Limit","body":"` + strings.Repeat("a", maxNoteSize) + `"}]}`
+	items, err := readItems(func(fn func(Item) error) error { return ReadJSON(strings.NewReader(export), fn) })
+	if err != nil || len(items) != 2 {
+		t.Fatalf("ReadJSON = %d items, %v, want 2", len(items), err)
+	}
+	checkFailed(t, items[0], "larger than")
+	if items[1].Err != nil {
+		t.Errorf("note of the largest size: %v", items[1].Err)
+	}
+}
+
+func TestReadJSONMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		export string
+		items  int
+	}{
+		{"not an object", `[]`, 0},
+		{"newer version", `{"version":2,"notes":[]}`, 0},
+		{"notes not a list", `{"version":1,"notes":{}}`, 0},
+		{"truncated", `{"version":1,"notes":[{"title":"One","body":""},{"title":"Tw`, 1},
+		{"syntax error in a note", `{"version":1,"notes":[{"title":"One","body":""},{"title":}]}`, 1},
+		{"unclosed", `{"version":1,"notes":[]`, 0},
+	}
+	for _, tt := range tests {
+		items, err := readItems(func(fn func(Item) error) error { return ReadJSON(strings.NewReader(tt.export), fn) })
+		if err == nil {
+			t.Errorf("%s: read without an error", tt.name)
+		}
+		if len(items) != tt.items {
+			t.Errorf("%s: %d items before the error, want %d", tt.name, len(items), tt.items)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	notes := []*Note{
+		{
+			Title:       "Groceries",
+			Body:        "milk \"and\" eggs\n",
+			Format:      "plain",
+			CreatedAt:   date("2024-01-02T03:04:05Z"),
+			UpdatedAt:   date("2024-02-03T04:05:06Z"),
+			Tags:        []string{"home"},
+			Attachments: []Attachment{{Filename: "list.txt", Size: 5, Data: []byte("hello")}, {Filename: "empty", Data: []byte{}}},
+		},
+		{Title: "Second", Tags: []string{}},
+	}
+	var buf bytes.Buffer
+	w, err := NewJSONWriter(&buf, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, note := range notes {
+		if err := w.WriteNote(note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !json.Valid(buf.Bytes()) {
+		t.Fatalf("export is not valid JSON: %s", buf.String())
+	}
+
+	items, err := readItems(func(fn func(Item) error) error { return ReadJSON(&buf, fn) })
+	if err != nil || len(items) != 2 {
+		t.Fatalf("ReadJSON = %d items, %v", len(items), err)
+	}
+	for i, note := range notes {
+		checkNote(t, items[i], note)
+	}
+}
@@ -0,0 +1,159 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxSlugLength is the longest file name derived from a title, in bytes
+const maxSlugLength = 80
+
+// markdownWriter writes a zip with one Markdown file per note, named after
+// its title. The attachments of a note go into a directory of the same
+// name next to it.
+type markdownWriter struct {
+	zip *zip.Writer
+	// used holds the names taken so far. Slugs are lower case, so names
+	// stay distinct on filesystems that ignore case.
+	used map[string]bool
+}
+
+// NewMarkdownWriter starts a zip export of Markdown files
+func NewMarkdownWriter(w io.Writer) Writer {
+	return &markdownWriter{zip: zip.NewWriter(w), used: make(map[string]bool)}
+}
+
+func (m *markdownWriter) WriteNote(note *Note) error {
+	name := m.uniqueName(slug(note.Title))
+
+	frontMatter := FrontMatter{
+		Title:      note.Title,
+		Format:     note.Format,
+		Created:    note.CreatedAt.UTC(),
+		Updated:    note.UpdatedAt.UTC(),
+		Tags:       note.Tags,
+		SharedWith: note.SharedWith,
+	}
+	if frontMatter.Tags == nil {
+		frontMatter.Tags = []string{}
+	}
+	attachmentNames := make(map[string]bool, len(note.Attachments))
+	paths := make([]string, len(note.Attachments))
+	for i, attachment := range note.Attachments {
+		filename := uniqueFilename(attachment.Filename, attachmentNames)
+		paths[i] = name + "/" + filename
+		frontMatter.Attachments = append(frontMatter.Attachments, paths[i])
+	}
+
+	file, err := m.zip.CreateHeader(&zip.FileHeader{Name: name + ".md", Method: zip.Deflate, Modified: note.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, "---\n"); err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(file)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(frontMatter); err != nil {
+		return err
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(file, "---\n\n%s", note.Body); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(note.Body, "\n") {
+		if _, err := io.WriteString(file, "\n"); err != nil {
+			return err
+		}
+	}
+
+	for i := range note.Attachments {
+		if err := m.writeAttachment(paths[i], &note.Attachments[i], note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *markdownWriter) writeAttachment(name string, attachment *Attachment, note *Note) error {
+	// text compresses well, most other attachments already are compressed
+	method := zip.Store
+	if strings.HasPrefix(attachment.ContentType, "text/") {
+		method = zip.Deflate
+	}
+	file, err := m.zip.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: note.UpdatedAt})
+	if err != nil {
+		return err
+	}
+	body, err := attachment.Contents()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = io.Copy(file, body)
+	return err
+}
+
+func (m *markdownWriter) Close() error {
+	return m.zip.Close()
+}
+
+// uniqueName returns base, or base with a number appended, such that the
+// name is not taken yet, and takes it
+func (m *markdownWriter) uniqueName(base string) string {
+	name := base
+	for i := 2; m.used[name]; i++ {
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	m.used[name] = true
+	return name
+}
+
+// uniqueFilename keeps the attachment filenames of a note distinct by
+// numbering repeated names before their extension
+func uniqueFilename(filename string, used map[string]bool) string {
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "." || filename == "/" || filename == ".." {
+		filename = "attachment"
+	}
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	name := filename
+	for i := 2; used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// slug turns a title into a file name made of letters, digits and dashes
+func slug(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			if b.Len()+len(string(r)) > maxSlugLength {
+				break
+			}
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "untitled"
+	}
+	return b.String()
+}
@@ -0,0 +1,218 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// importedFrontMatter is the front matter read from Markdown files, which
+// accepts the keys other tools commonly use besides the ones exported
+type importedFrontMatter struct {
+	Title       string     `yaml:"title"`
+	Format      string     `yaml:"format"`
+	Created     *timestamp `yaml:"created"`
+	CreatedAt   *timestamp `yaml:"created_at"`
+	Date        *timestamp `yaml:"date"`
+	Updated     *timestamp `yaml:"updated"`
+	UpdatedAt   *timestamp `yaml:"updated_at"`
+	Tags        tagList    `yaml:"tags"`
+	Attachments []string   `yaml:"attachments"`
+}
+
+// timestamp accepts RFC 3339 times as well as plain dates and times
+type timestamp struct {
+	time.Time
+}
+
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+func (t *timestamp) UnmarshalYAML(value *yaml.Node) error {
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.Parse(layout, value.Value); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("line %d: invalid time %q", value.Line, value.Value)
+}
+
+// tagList accepts a list of tags or a comma separated string
+type tagList []string
+
+func (t *tagList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		for _, tag := range strings.Split(value.Value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				*t = append(*t, tag)
+			}
+		}
+		return nil
+	}
+	var tags []string
+	if err := value.Decode(&tags); err != nil {
+		return err
+	}
+	*t = tags
+	return nil
+}
+
+// ReadMarkdownZip reads a zip of Markdown files, handing each to fn as a
+// note. Front matter is optional; without a title the first heading or the
+// file name is used. Attachments listed in the front matter are read from
+// the zip, relative to the Markdown file.
+func ReadMarkdownZip(r io.ReaderAt, size int64, fn func(Item) error) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[path.Clean(file.Name)] = file
+	}
+
+	for _, file := range archive.File {
+		if !isMarkdownFile(file) {
+			continue
+		}
+		note, err := readMarkdownFile(file, files)
+		if err := fn(Item{Name: file.Name, Note: note, Err: err}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMarkdownFile tells Markdown files apart from attachments and from the
+// metadata some archivers add
+func isMarkdownFile(file *zip.File) bool {
+	if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "__MACOSX/") || strings.HasPrefix(path.Base(file.Name), ".") {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(file.Name))
+	return ext == ".md" || ext == ".markdown"
+}
+
+func readMarkdownFile(file *zip.File, files map[string]*zip.File) (*Note, error) {
+	f, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxNoteSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxNoteSize {
+		return nil, fmt.Errorf("note is larger than %d bytes", maxNoteSize)
+	}
+
+	header, body, err := splitFrontMatter(data)
+	if err != nil {
+		return nil, err
+	}
+	var frontMatter importedFrontMatter
+	if err := yaml.Unmarshal(header, &frontMatter); err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	note := &Note{
+		Title:  frontMatter.Title,
+		Body:   strings.Trim(string(body), "\r\n"),
+		Format: frontMatter.Format,
+		Tags:   frontMatter.Tags,
+	}
+	if note.Format == "" {
+		note.Format = "markdown"
+	}
+	if note.Title == "" {
+		note.Title = firstHeading(note.Body)
+	}
+	if note.Title == "" {
+		note.Title = strings.TrimSuffix(path.Base(file.Name), path.Ext(file.Name))
+	}
+	note.CreatedAt = firstTime(frontMatter.Created, frontMatter.CreatedAt, frontMatter.Date)
+	note.UpdatedAt = firstTime(frontMatter.Updated, frontMatter.UpdatedAt)
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = file.Modified
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = file.Modified
+	}
+
+	dir := path.Dir(file.Name)
+	for _, name := range frontMatter.Attachments {
+		note.Attachments = append(note.Attachments, zipAttachment(files, path.Join(dir, name)))
+	}
+	return note, nil
+}
+
+// zipAttachment returns the attachment stored in the zip under the name,
+// which fails to open when there is no such file
+func zipAttachment(files map[string]*zip.File, name string) Attachment {
+	attachment := Attachment{Filename: path.Base(name)}
+	file, ok := files[name]
+	if !ok {
+		attachment.Open = func() (io.ReadCloser, error) {
+			return nil, fmt.Errorf("%s is not in the archive", name)
+		}
+		return attachment
+	}
+	attachment.Size = int64(file.UncompressedSize64)
+	attachment.Open = file.Open
+	return attachment
+}
+
+// splitFrontMatter separates the YAML front matter, delimited by lines of
+// three dashes, from the body. Files without front matter are all body.
+func splitFrontMatter(data []byte) ([]byte, []byte, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	normalized := bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(normalized, []byte("---\n")) {
+		return nil, data, nil
+	}
+	rest := normalized[len("---\n"):]
+	for _, closing := range []string{"---", "..."} {
+		if bytes.HasPrefix(rest, []byte(closing+"\n")) {
+			return nil, rest[len(closing)+1:], nil
+		}
+		if end := bytes.Index(rest, []byte("\n"+closing+"\n")); end >= 0 {
+			return rest[:end+1], rest[end+len(closing)+2:], nil
+		}
+		if bytes.HasSuffix(rest, []byte("\n"+closing)) {
+			return rest[:len(rest)-len(closing)], nil, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("front matter is not closed")
+}
+
+// firstHeading returns the text of the first level one heading
+func firstHeading(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(line[2:])
+		}
+	}
+	return ""
+}
+
+func firstTime(times ...*timestamp) time.Time {
+	for _, t := range times {
+		if t != nil && !t.IsZero() {
+			return t.Time
+		}
+	}
+	return time.Time{}
+}
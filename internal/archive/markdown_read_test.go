@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// zipFile is a file of a zip fixture
+type zipFile struct {
+	name    string
+	content string
+}
+
+// modified is the modification time of the files in zip fixtures
+var modified = date("2023-06-07T08:09:10Z")
+
+func buildZip(t *testing.T, files []zipFile) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(f, file.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func readZip(t *testing.T, files []zipFile) []Item {
+	t.Helper()
+	r := buildZip(t, files)
+	items, err := readItems(func(fn func(Item) error) error { return ReadMarkdownZip(r, r.Size(), fn) })
+	if err != nil {
+		t.Fatalf("ReadMarkdownZip: %v", err)
+	}
+	return items
+}
+
+func TestReadMarkdownZip(t *testing.T) {
+	items := readZip(t, []zipFile{
+		{"notes/groceries.md", "---\ntitle: Groceries\nformat: plain\ncreated: 2024-01-02\nupdated_at: 2024-02-03T04:05:06+01:00\ntags: home, shopping ,\nattachments:\n  - groceries/list.txt\n  - groceries/missing.png\n---\n\nmilk\neggs\n"},
+		{"notes/groceries/list.txt", "hello"},
+		{"notes/recipes.markdown", "---\ndate: 2024-01-05 18:30\ntags:\n  - cooking\n  - dinner\n...\n# Pasta\n\nBoil water."},
+		{"Journal.MD", "\xef\xbb\xbf---\r\ntitle: Windows\r\ncreated_at: 2024-01-06T07:08:09\r\n---\r\n\r\ntext\r\n"},
+		{"untitled.md", "no heading, no front matter"},
+		{"empty-front-matter.md", "---\n---\nbody"},
+		{"__MACOSX/._untitled.md", "resource fork"},
+		{".hidden.md", "hidden"},
+		{"readme.txt", "not markdown"},
+		{"folder.md/", ""},
+	})
+	if len(items) != 5 {
+		t.Fatalf("%d items, want 5: %+v", len(items), items)
+	}
+
+	checkNote(t, items[0], &Note{
+		Title:     "Groceries",
+		Body:      "milk\neggs",
+		Format:    "plain",
+		CreatedAt: date("2024-01-02T00:00:00Z"),
+		UpdatedAt: date("2024-02-03T04:05:06+01:00"),
+		Tags:      []string{"home", "shopping"},
+		Attachments: []Attachment{
+			{Filename: "list.txt", Size: 5},
+			{Filename: "missing.png"},
+		},
+	})
+	if items[0].Err == nil {
+		attachments := items[0].Note.Attachments
+		if body, err := attachments[0].Contents(); err != nil {
+			t.Errorf("opening an attachment: %v", err)
+		} else if content, _ := io.ReadAll(body); string(content) != "hello" {
+			t.Errorf("attachment reads %q", content)
+		}
+		if _, err := attachments[1].Contents(); err == nil {
+			t.Error("attachment missing from the archive opened")
+		}
+	}
+
+	// without updated the file's modification time is used
+	checkNote(t, items[1], &Note{
+		Title:     "Pasta",
+		Body:      "# Pasta\n\nBoil water.",
+		Format:    "markdown",
+		CreatedAt: date("2024-01-05T18:30:00Z"),
+		UpdatedAt: modified,
+		Tags:      []string{"cooking", "dinner"},
+	})
+	checkNote(t, items[2], &Note{
+		Title:     "Windows",
+		Body:      "text",
+		Format:    "markdown",
+		CreatedAt: date("2024-01-06T07:08:09Z"),
+		UpdatedAt: modified,
+	})
+	checkNote(t, items[3], &Note{Title: "untitled", Body: "no heading, no front matter", Format: "markdown", CreatedAt: modified, UpdatedAt: modified})
+	checkNote(t, items[4], &Note{Title: "empty-front-matter", Body: "body", Format: "markdown", CreatedAt: modified, UpdatedAt: modified})
+}
+
+func TestReadMarkdownZipFailures(t *testing.T) {
+	items := readZip(t, []zipFile{
+		{"bad-date.md", "---\ncreated: next tuesday\n---\nbody"},
+		{"bad-yaml.md", "---\ntitle: [unclosed\n---\nbody"},
+		{"unclosed.md", "---\ntitle: Unclosed\nbody"},
+		{"large.md", strings.Repeat("a", maxNoteSize+1)},
+		{"good.md", "# Good"},
+	})
+	if len(items) != 5 {
+		t.Fatalf("%d items, want 5", len(items))
+	}
+	checkFailed(t, items[0], `invalid time "next tuesday"`)
+	checkFailed(t, items[1], "invalid front matter")
+	checkFailed(t, items[2], "front matter is not closed")
+	checkFailed(t, items[3], "larger than")
+	if items[4].Err != nil || items[4].Note.Title != "Good" {
+		t.Errorf("note after failed ones: %+v, %v", items[4].Note, items[4].Err)
+	}
+
+	// exactly the largest size is accepted
+	items = readZip(t, []zipFile{{"limit.md", strings.Repeat("a", maxNoteSize)}})
+	if items[0].Err != nil {
+		t.Errorf("note of the largest size: %v", items[0].Err)
+	}
+}
+
+func TestReadMarkdownZipNotAZip(t *testing.T) {
+	r := strings.NewReader("not a zip")
+	if _, err := readItems(func(fn func(Item) error) error { return ReadMarkdownZip(r, r.Size(), fn) }); err == nil {
+		t.Error("read a file that is not a zip")
+	}
+}
+
+func TestMarkdownRoundTrip(t *testing.T) {
+	note := &Note{
+		Title:     "Groceries / weekly",
+		Body:      "# Shopping\n\n- milk",
+		Format:    "markdown",
+		CreatedAt: date("2024-01-02T03:04:05Z"),
+		UpdatedAt: date("2024-02-03T04:05:06Z"),
+		Tags:      []string{"home"},
+		Attachments: []Attachment{
+			{Filename: "list.txt", ContentType: "text/plain", Size: 5, Data: []byte("hello")},
+		},
+	}
+	var buf bytes.Buffer
+	w := NewMarkdownWriter(&buf)
+	if err := w.WriteNote(note); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bytes.NewReader(buf.Bytes())
+	items, err := readItems(func(fn func(Item) error) error { return ReadMarkdownZip(r, r.Size(), fn) })
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ReadMarkdownZip = %d items, %v", len(items), err)
+	}
+	got := items[0].Note
+	if got == nil {
+		t.Fatalf("exported note failed to read: %v", items[0].Err)
+	}
+	if got.Title != note.Title || got.Body != note.Body || got.Format != note.Format ||
+		!got.CreatedAt.Equal(note.CreatedAt) || !got.UpdatedAt.Equal(note.UpdatedAt.In(time.UTC)) ||
+		strings.Join(got.Tags, ",") != "home" || len(got.Attachments) != 1 || got.Attachments[0].Size != 5 {
+		t.Errorf("read back %+v, want %+v", got, note)
+	}
+}
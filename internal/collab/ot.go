@@ -0,0 +1,270 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Operation is an edit to a whole document: a sequence of components that
+// retain, insert or delete text, which together span the document the
+// edit applies to. Positions and lengths count Unicode code points.
+//
+// In JSON an operation is an array in which a positive number retains that
+// many code points, a negative number deletes that many and a string is
+// inserted, such as [3, "abc", -2, 4].
+type Operation []Component
+
+// Component is one step of an operation. Exactly one field is set.
+type Component struct {
+	Retain int
+	Delete int
+	Insert string
+}
+
+// errBaseLength is returned when an operation does not span the document it
+// is applied or transformed against
+var errBaseLength = errors.New("the operation does not match the length of the document")
+
+// BaseLen is the length of the documents the operation applies to
+func (o Operation) BaseLen() int {
+	n := 0
+	for _, c := range o {
+		n += c.Retain + c.Delete
+	}
+	return n
+}
+
+// Apply returns the document changed by the operation
+func (o Operation) Apply(doc []rune) ([]rune, error) {
+	if o.BaseLen() != len(doc) {
+		return nil, errBaseLength
+	}
+	result := make([]rune, 0, len(doc))
+	pos := 0
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			result = append(result, doc[pos:pos+c.Retain]...)
+			pos += c.Retain
+		case c.Delete > 0:
+			pos += c.Delete
+		default:
+			result = append(result, []rune(c.Insert)...)
+		}
+	}
+	return result, nil
+}
+
+// TransformIndex moves a position in the document the operation applies to
+// onto the document it produces. Text inserted at the position goes before
+// it.
+func (o Operation) TransformIndex(index int) int {
+	newIndex := index
+	pos := 0
+	for _, c := range o {
+		if pos > index {
+			break
+		}
+		switch {
+		case c.Retain > 0:
+			pos += c.Retain
+		case c.Delete > 0:
+			newIndex -= min(c.Delete, index-pos)
+			pos += c.Delete
+		default:
+			newIndex += len([]rune(c.Insert))
+		}
+	}
+	return newIndex
+}
+
+// Transform takes two operations made concurrently on the same document
+// and returns a' and b' such that applying a then b' gives the same
+// document as applying b then a'. When both insert at the same position the
+// text of a goes first.
+func Transform(a, b Operation) (Operation, Operation, error) {
+	if a.BaseLen() != b.BaseLen() {
+		return nil, nil, errBaseLength
+	}
+
+	var aPrime, bPrime builder
+	i, j := 0, 0
+	// ca and cb are what is left of the components at i and j
+	var ca, cb Component
+	if len(a) > 0 {
+		ca = a[0]
+	}
+	if len(b) > 0 {
+		cb = b[0]
+	}
+	nextA := func() {
+		i++
+		ca = Component{}
+		if i < len(a) {
+			ca = a[i]
+		}
+	}
+	nextB := func() {
+		j++
+		cb = Component{}
+		if j < len(b) {
+			cb = b[j]
+		}
+	}
+
+	for i < len(a) || j < len(b) {
+		if i < len(a) && ca.Insert != "" {
+			aPrime.insert(ca.Insert)
+			bPrime.retain(len([]rune(ca.Insert)))
+			nextA()
+			continue
+		}
+		if j < len(b) && cb.Insert != "" {
+			aPrime.retain(len([]rune(cb.Insert)))
+			bPrime.insert(cb.Insert)
+			nextB()
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			// unreachable given equal base lengths
+			return nil, nil, errBaseLength
+		}
+
+		n := min(ca.Retain+ca.Delete, cb.Retain+cb.Delete)
+		switch {
+		case ca.Retain > 0 && cb.Retain > 0:
+			aPrime.retain(n)
+			bPrime.retain(n)
+		case ca.Delete > 0 && cb.Retain > 0:
+			aPrime.delete(n)
+		case ca.Retain > 0 && cb.Delete > 0:
+			bPrime.delete(n)
+		}
+		// when both delete the text is gone either way
+
+		if ca.Retain > 0 {
+			ca.Retain -= n
+		} else {
+			ca.Delete -= n
+		}
+		if cb.Retain > 0 {
+			cb.Retain -= n
+		} else {
+			cb.Delete -= n
+		}
+		if ca.Retain == 0 && ca.Delete == 0 {
+			nextA()
+		}
+		if cb.Retain == 0 && cb.Delete == 0 {
+			nextB()
+		}
+	}
+	return aPrime.op, bPrime.op, nil
+}
+
+// Diff returns an operation turning a into b, replacing what lies between
+// their common prefix and suffix
+func Diff(a, b []rune) Operation {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var op builder
+	op.retain(prefix)
+	op.delete(len(a) - prefix - suffix)
+	op.insert(string(b[prefix : len(b)-suffix]))
+	op.retain(suffix)
+	return op.op
+}
+
+// builder appends components to an operation, merging those of the same
+// kind and dropping empty ones
+type builder struct {
+	op Operation
+}
+
+func (b *builder) retain(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Retain > 0 {
+		b.op[last].Retain += n
+		return
+	}
+	b.op = append(b.op, Component{Retain: n})
+}
+
+func (b *builder) delete(n int) {
+	if n <= 0 {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Delete > 0 {
+		b.op[last].Delete += n
+		return
+	}
+	b.op = append(b.op, Component{Delete: n})
+}
+
+func (b *builder) insert(s string) {
+	if s == "" {
+		return
+	}
+	if last := len(b.op) - 1; last >= 0 && b.op[last].Insert != "" {
+		b.op[last].Insert += s
+		return
+	}
+	b.op = append(b.op, Component{Insert: s})
+}
+
+// MarshalJSON encodes the operation as an array of numbers and strings
+func (o Operation) MarshalJSON() ([]byte, error) {
+	parts := make([]interface{}, 0, len(o))
+	for _, c := range o {
+		switch {
+		case c.Retain > 0:
+			parts = append(parts, c.Retain)
+		case c.Delete > 0:
+			parts = append(parts, -c.Delete)
+		default:
+			parts = append(parts, c.Insert)
+		}
+	}
+	return json.Marshal(parts)
+}
+
+// UnmarshalJSON decodes an array of numbers and strings. Zero lengths and
+// empty inserts are rejected.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	var op builder
+	for _, part := range parts {
+		var insert string
+		if err := json.Unmarshal(part, &insert); err == nil {
+			if insert == "" {
+				return errors.New("inserts must not be empty")
+			}
+			op.insert(insert)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(part, &n); err != nil || n == 0 {
+			return fmt.Errorf("invalid operation component %s", part)
+		}
+		if n > 0 {
+			op.retain(n)
+		} else {
+			op.delete(-n)
+		}
+	}
+	*o = op.op
+	return nil
+}
@@ -0,0 +1,153 @@
+package collab
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// parseOp decodes an operation written as JSON, such as [1, "x", -2]
+func parseOp(t *testing.T, s string) Operation {
+	t.Helper()
+	var op Operation
+	if err := json.Unmarshal([]byte(s), &op); err != nil {
+		t.Fatalf("parsing %s: %v", s, err)
+	}
+	return op
+}
+
+func apply(t *testing.T, op Operation, doc string) string {
+	t.Helper()
+	result, err := op.Apply([]rune(doc))
+	if err != nil {
+		t.Fatalf("applying %v to %q: %v", op, doc, err)
+	}
+	return string(result)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		doc  string
+		op   string
+		want string
+	}{
+		{"hello", `[5, " world"]`, "hello world"},
+		{"hello", `["oh, ", 5]`, "oh, hello"},
+		{"hello world", `[5, -6]`, "hello"},
+		{"hello", `[1, -3, "ipp", 1]`, "hippo"},
+		{"", `["new"]`, "new"},
+		{"héllo", `[1, -1, "e", 3]`, "hello"},
+	}
+	for _, tt := range tests {
+		if got := apply(t, parseOp(t, tt.op), tt.doc); got != tt.want {
+			t.Errorf("%s applied to %q = %q, want %q", tt.op, tt.doc, got, tt.want)
+		}
+	}
+
+	if _, err := parseOp(t, `[3, "x"]`).Apply([]rune("hello")); err == nil {
+		t.Error("applying an operation of the wrong length succeeded")
+	}
+}
+
+func TestTransformConverges(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		a    string
+		b    string
+		want string
+	}{
+		{"inserts at the same index", "abc", `[1, "X", 2]`, `[1, "Y", 2]`, "aXYbc"},
+		{"inserts at the same index, reversed", "abc", `[1, "Y", 2]`, `[1, "X", 2]`, "aYXbc"},
+		{"inserts at the start", "abc", `["X", 3]`, `["Y", 3]`, "XYabc"},
+		{"inserts at the end", "abc", `[3, "X"]`, `[3, "Y"]`, "abcXY"},
+		{"inserts apart", "abcdef", `[1, "X", 5]`, `[4, "Y", 2]`, "aXbcdYef"},
+		{"insert before a delete", "abcdef", `[1, "X", 5]`, `[3, -2, 1]`, "aXbcf"},
+		{"insert inside a delete", "abcdef", `[3, "X", 3]`, `[1, -4, 1]`, "aXf"},
+		{"insert at the end of a delete", "abcdef", `[5, "X", 1]`, `[1, -4, 1]`, "aXf"},
+		{"same deletes", "abcdef", `[1, -2, 3]`, `[1, -2, 3]`, "adef"},
+		{"overlapping deletes", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"nested deletes", "abcdef", `[-6]`, `[2, -2, 2]`, ""},
+		{"replacements", "abcdef", `[1, -2, "XY", 3]`, `[2, -2, "Z", 2]`, "aXYZef"},
+		{"delete everything and insert", "abc", `[-3, "new"]`, `[1, "X", 2]`, "Xnew"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := parseOp(t, tt.a), parseOp(t, tt.b)
+			aPrime, bPrime, err := Transform(a, b)
+			if err != nil {
+				t.Fatalf("Transform: %v", err)
+			}
+			ab := apply(t, bPrime, apply(t, a, tt.doc))
+			ba := apply(t, aPrime, apply(t, b, tt.doc))
+			if ab != ba {
+				t.Fatalf("diverged: a then b' gives %q, b then a' gives %q", ab, ba)
+			}
+			if ab != tt.want {
+				t.Fatalf("converged on %q, want %q", ab, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Transform(parseOp(t, `[3]`), parseOp(t, `[4]`)); err == nil {
+		t.Error("transforming operations on documents of different lengths succeeded")
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		op    string
+		index int
+		want  int
+	}{
+		{`[2, "XY", 3]`, 1, 1},
+		{`[2, "XY", 3]`, 2, 4},
+		{`[2, "XY", 3]`, 4, 6},
+		{`[1, -2, 2]`, 0, 0},
+		{`[1, -2, 2]`, 2, 1},
+		{`[1, -2, 2]`, 3, 1},
+		{`[1, -2, 2]`, 5, 3},
+		{`[-5, "new"]`, 3, 0},
+		{`["new", -5]`, 3, 3},
+	}
+	for _, tt := range tests {
+		if got := parseOp(t, tt.op).TransformIndex(tt.index); got != tt.want {
+			t.Errorf("%s moves %d to %d, want %d", tt.op, tt.index, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct{ a, b string }{
+		{"hello", "hello"},
+		{"hello", "help"},
+		{"hello", "oh hello there"},
+		{"abc", ""},
+		{"", "abc"},
+		{"aaa", "aaaa"},
+		{"naïve", "native"},
+	}
+	for _, tt := range tests {
+		op := Diff([]rune(tt.a), []rune(tt.b))
+		if got := apply(t, op, tt.a); got != tt.b {
+			t.Errorf("Diff(%q, %q) = %v, which gives %q", tt.a, tt.b, op, got)
+		}
+	}
+}
+
+func TestOperationJSON(t *testing.T) {
+	op := parseOp(t, `[3, "ab", "c", -2, -1, 4]`)
+	data, err := json.Marshal(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `[3,"abc",-3,4]` {
+		t.Errorf("encoded as %s, want adjacent components merged", data)
+	}
+
+	for _, invalid := range []string{`[0]`, `[""]`, `[1.5]`, `[true]`, `{}`} {
+		var op Operation
+		if err := json.Unmarshal([]byte(invalid), &op); err == nil {
+			t.Errorf("decoding %s succeeded", invalid)
+		}
+	}
+}
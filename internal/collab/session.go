@@ -0,0 +1,542 @@
+// Package collab runs live editing sessions in which several users edit
+// the body of a note at once. The server orders the edits of a session:
+// an edit made against an older revision is transformed over the edits
+// applied since, so that every client converges on the same text. The
+// session saves its text back to the note periodically and merges in
+// changes made to the note outside of it.
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Message types
+const (
+	// TypeInit is sent to a client when it joins, with the text, its
+	// revision and the other participants
+	TypeInit = "init"
+	// TypeOp carries an edit, from a client based on the revision it
+	// names, and to clients as the edit that produced the revision
+	TypeOp = "op"
+	// TypeAck tells a client that its edit produced the revision
+	TypeAck = "ack"
+	// TypeCursor carries a participant's cursor or selection
+	TypeCursor = "cursor"
+	// TypeJoin and TypeLeave tell the participants who comes and goes
+	TypeJoin  = "join"
+	TypeLeave = "leave"
+	// TypeSaved tells the participants the note was saved at a version
+	TypeSaved = "saved"
+	// TypeError reports a message that could not be handled
+	TypeError = "error"
+)
+
+// clientBuffer is how many messages may wait for a client. A client that
+// falls further behind is dropped and has to join again.
+const clientBuffer = 256
+
+// maxHistory is how many edits a session keeps for transforming edits
+// based on older revisions. A client further behind has to join again.
+const maxHistory = 1000
+
+var (
+	// ErrStale is returned by Store.Save when the note changed since the
+	// version being saved over
+	ErrStale = errors.New("the note changed since it was read")
+	// ErrGone is returned by the Store when the note no longer exists
+	ErrGone = errors.New("the note was deleted")
+	// ErrNoAccess is returned by Store.Access when the user can no longer
+	// read the note
+	ErrNoAccess = errors.New("the note was deleted or is no longer shared with you")
+)
+
+// Snapshot is the body of a note at a version
+type Snapshot struct {
+	Content string
+	Version int
+}
+
+// Store reads and writes the note a session edits
+type Store interface {
+	// Load returns the current body of the note
+	Load() (Snapshot, error)
+	// Save writes the body as a change by the author if the note is still
+	// at the version, returning the body and version saved
+	Save(authorID, content string, version int) (Snapshot, error)
+	// Access reports whether the user may still edit the note, or
+	// ErrNoAccess when they can no longer read it
+	Access(userID string) (canEdit bool, err error)
+}
+
+// Message is exchanged with clients as JSON
+type Message struct {
+	Type string `json:"type"`
+	// Rev is the revision a client's edit or cursor is based on. In
+	// messages to clients it is the session's current revision.
+	Rev int `json:"rev"`
+	// ClientID is the participant a message is about, unset for edits
+	// merged from outside the session
+	ClientID     string        `json:"client_id,omitempty"`
+	Op           Operation     `json:"op,omitempty"`
+	Cursor       *Cursor       `json:"cursor,omitempty"`
+	Text         *string       `json:"text,omitempty"`
+	Version      int           `json:"version,omitempty"`
+	Participant  *Participant  `json:"participant,omitempty"`
+	Participants []Participant `json:"participants,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// Cursor is a selection from Anchor to Head, a caret when they are equal
+type Cursor struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// Participant is a client taking part in a session
+type Participant struct {
+	ClientID string  `json:"client_id"`
+	UserID   string  `json:"user_id"`
+	Username string  `json:"username"`
+	CanEdit  bool    `json:"can_edit"`
+	Cursor   *Cursor `json:"cursor,omitempty"`
+}
+
+// Hub holds the sessions open on notes
+type Hub struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+	// opening holds a channel for each note whose session is being loaded,
+	// closed once the load is over. Loads happen outside of mu, so that a
+	// slow one only holds up the joins of its own note.
+	opening      map[string]chan struct{}
+	saveInterval time.Duration
+}
+
+// NewHub creates a hub whose sessions save their text every saveInterval
+// while it changes
+func NewHub(saveInterval time.Duration) *Hub {
+	return &Hub{
+		sessions:     make(map[string]*session),
+		opening:      make(map[string]chan struct{}),
+		saveInterval: saveInterval,
+	}
+}
+
+// Join adds the participant to the session on the note, opening it from
+// the store if there is none. The session ends once its last client
+// leaves.
+func (h *Hub) Join(noteID string, participant Participant, store Store) (*Client, error) {
+	h.mu.Lock()
+	for {
+		if s, ok := h.sessions[noteID]; ok {
+			defer h.mu.Unlock()
+			return s.join(participant), nil
+		}
+		loading, ok := h.opening[noteID]
+		if !ok {
+			break
+		}
+		// another join is loading the note; its session is joined once
+		// it is open, or the note loaded again if that failed
+		h.mu.Unlock()
+		<-loading
+		h.mu.Lock()
+	}
+	loading := make(chan struct{})
+	h.opening[noteID] = loading
+	h.mu.Unlock()
+
+	snapshot, err := store.Load()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.opening, noteID)
+	close(loading)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{
+		noteID:  noteID,
+		hub:     h,
+		store:   store,
+		text:    []rune(snapshot.Content),
+		saved:   snapshot,
+		clients: make(map[*Client]bool),
+		done:    make(chan struct{}),
+	}
+	h.sessions[noteID] = s
+	go s.run(h.saveInterval)
+	return s.join(participant), nil
+}
+
+// session is the live state of a note being edited
+type session struct {
+	noteID string
+	hub    *Hub
+	store  Store
+
+	mu   sync.Mutex
+	text []rune
+	rev  int
+	// history holds the latest edits, history[i] having produced revision
+	// rev-len(history)+i+1
+	history []Operation
+	// saved is the body last loaded or saved, and unsaved the edits
+	// applied to it since, which together give text
+	saved   Snapshot
+	unsaved []Operation
+	// author is the user whose edit was applied last, who the next save
+	// is credited to
+	author     string
+	clients    map[*Client]bool
+	lastClient int
+	// done is closed when the last client leaves
+	done chan struct{}
+}
+
+func (s *session) join(participant Participant) *Client {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastClient++
+	participant.ClientID = strconv.Itoa(s.lastClient)
+	participant.Cursor = nil
+	c := &Client{session: s, participant: participant, messages: make(chan Message, clientBuffer)}
+
+	// messages get copies, since participants change while messages wait
+	text, self := string(s.text), c.participant
+	init := Message{Type: TypeInit, Rev: s.rev, Text: &text, Version: s.saved.Version, Participant: &self}
+	for other := range s.clients {
+		init.Participants = append(init.Participants, other.participant)
+	}
+	c.send(init)
+	s.broadcast(Message{Type: TypeJoin, Rev: s.rev, ClientID: participant.ClientID, Participant: &participant}, nil)
+	s.clients[c] = true
+	return c
+}
+
+// leave removes the client, ending the session when it was the last one
+func (s *session) leave(c *Client) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.clients[c] {
+		return
+	}
+	delete(s.clients, c)
+	c.drop()
+	s.broadcast(Message{Type: TypeLeave, Rev: s.rev, ClientID: c.participant.ClientID}, nil)
+	if len(s.clients) == 0 {
+		delete(s.hub.sessions, s.noteID)
+		close(s.done)
+	}
+}
+
+// receive handles a message from the client
+func (s *session) receive(c *Client, msg Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.clients[c] || c.dropped {
+		return
+	}
+	switch msg.Type {
+	case TypeOp:
+		if err := s.edit(c, msg.Rev, msg.Op); err != nil {
+			c.send(Message{Type: TypeError, Rev: s.rev, Error: err.Error()})
+		}
+	case TypeCursor:
+		if err := s.moveCursor(c, msg.Rev, msg.Cursor); err != nil {
+			c.send(Message{Type: TypeError, Rev: s.rev, Error: err.Error()})
+		}
+	default:
+		c.send(Message{Type: TypeError, Rev: s.rev, Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// edit applies the client's edit, made at revision rev, as the next
+// revision
+func (s *session) edit(c *Client, rev int, op Operation) error {
+	if !c.participant.CanEdit {
+		return errors.New("only editors can change the note")
+	}
+	concurrent, err := s.since(rev)
+	if err != nil {
+		return err
+	}
+	for _, other := range concurrent {
+		if op, _, err = Transform(op, other); err != nil {
+			return err
+		}
+	}
+	if err := s.apply(op); err != nil {
+		return err
+	}
+
+	s.author = c.participant.UserID
+	c.send(Message{Type: TypeAck, Rev: s.rev})
+	s.broadcast(Message{Type: TypeOp, Rev: s.rev, ClientID: c.participant.ClientID, Op: op}, c)
+	return nil
+}
+
+// apply makes the edit the next revision and moves the cursors over it
+func (s *session) apply(op Operation) error {
+	text, err := op.Apply(s.text)
+	if err != nil {
+		return err
+	}
+	s.text = text
+	s.rev++
+	s.history = append(s.history, op)
+	if len(s.history) > maxHistory {
+		s.history = s.history[len(s.history)-maxHistory:]
+	}
+	s.unsaved = append(s.unsaved, op)
+
+	for c := range s.clients {
+		// cursors are replaced rather than changed since messages waiting
+		// to be sent share them
+		if cursor := c.participant.Cursor; cursor != nil {
+			c.participant.Cursor = &Cursor{Anchor: op.TransformIndex(cursor.Anchor), Head: op.TransformIndex(cursor.Head)}
+		}
+	}
+	return nil
+}
+
+// moveCursor sets the client's cursor, placed at revision rev
+func (s *session) moveCursor(c *Client, rev int, cursor *Cursor) error {
+	if cursor == nil {
+		return errors.New("cursor is required")
+	}
+	concurrent, err := s.since(rev)
+	if err != nil {
+		return err
+	}
+	moved := *cursor
+	for _, op := range concurrent {
+		moved.Anchor = op.TransformIndex(moved.Anchor)
+		moved.Head = op.TransformIndex(moved.Head)
+	}
+	moved.Anchor = max(0, min(moved.Anchor, len(s.text)))
+	moved.Head = max(0, min(moved.Head, len(s.text)))
+
+	c.participant.Cursor = &moved
+	s.broadcast(Message{Type: TypeCursor, Rev: s.rev, ClientID: c.participant.ClientID, Cursor: &moved}, c)
+	return nil
+}
+
+// since returns the edits applied after revision rev
+func (s *session) since(rev int) ([]Operation, error) {
+	oldest := s.rev - len(s.history)
+	if rev < oldest || rev > s.rev {
+		return nil, fmt.Errorf("revision %d is not known to the session, join again", rev)
+	}
+	return s.history[rev-oldest:], nil
+}
+
+// broadcast sends the message to every client but one
+func (s *session) broadcast(msg Message, except *Client) {
+	for c := range s.clients {
+		if c != except {
+			c.send(msg)
+		}
+	}
+}
+
+// run saves the session every interval, and a last time once it ends
+func (s *session) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			s.save()
+			return
+		case <-ticker.C:
+			s.checkAccess()
+			s.save()
+		}
+	}
+}
+
+// checkAccess applies changes to the participants' access to the note,
+// dropping those who lost it
+func (s *session) checkAccess() {
+	s.mu.Lock()
+	participants := make(map[*Client]string, len(s.clients))
+	for c := range s.clients {
+		participants[c] = c.participant.UserID
+	}
+	s.mu.Unlock()
+
+	for c, userID := range participants {
+		canEdit, err := s.store.Access(userID)
+		if err != nil && !errors.Is(err, ErrNoAccess) {
+			logrus.Errorf("error checking access to note %s\nError: %s", s.noteID, err.Error())
+			continue
+		}
+
+		s.mu.Lock()
+		switch {
+		case !s.clients[c]:
+		case err != nil:
+			c.send(Message{Type: TypeError, Rev: s.rev, Error: err.Error()})
+			c.drop()
+		case canEdit != c.participant.CanEdit:
+			c.participant.CanEdit = canEdit
+			participant := c.participant
+			s.broadcast(Message{Type: TypeJoin, Rev: s.rev, ClientID: participant.ClientID, Participant: &participant}, nil)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// save writes the text to the note if it changed. Changes made to the
+// note outside of the session in the meantime are first merged into the
+// session as an edit of their own.
+func (s *session) save() {
+	for attempt := 0; attempt < 3; attempt++ {
+		s.mu.Lock()
+		if len(s.unsaved) == 0 {
+			s.mu.Unlock()
+			// nothing to save, but the note may have changed
+			if err := s.merge(); err != nil {
+				s.fail(err)
+			}
+			return
+		}
+		content, version, author := string(s.text), s.saved.Version, s.author
+		pending := len(s.unsaved)
+		s.mu.Unlock()
+
+		// edits keep being applied while the note is written; only this
+		// goroutine changes saved
+		saved, err := s.store.Save(author, content, version)
+		if err == nil {
+			s.mu.Lock()
+			s.saved = saved
+			s.unsaved = s.unsaved[pending:]
+			s.broadcast(Message{Type: TypeSaved, Rev: s.rev, Version: saved.Version}, nil)
+			s.mu.Unlock()
+			return
+		}
+		if !errors.Is(err, ErrStale) {
+			s.fail(err)
+			return
+		}
+		if err := s.merge(); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// merge brings changes made to the note outside of the session into it
+func (s *session) merge() error {
+	current, err := s.store.Load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current.Version == s.saved.Version {
+		return nil
+	}
+	if current.Content == s.saved.Content {
+		s.saved = current
+		return nil
+	}
+	// the outside change applies to the saved body; transforming it over
+	// the unsaved edits brings it onto the text, and them onto the
+	// current body
+	op := Diff([]rune(s.saved.Content), []rune(current.Content))
+	unsaved := make([]Operation, len(s.unsaved))
+	for i, edit := range s.unsaved {
+		if op, unsaved[i], err = Transform(op, edit); err != nil {
+			return err
+		}
+	}
+	if err := s.apply(op); err != nil {
+		return err
+	}
+	s.saved = current
+	s.unsaved = unsaved
+	s.broadcast(Message{Type: TypeOp, Rev: s.rev, Op: op}, nil)
+	return nil
+}
+
+// fail handles an error saving the session. The session ends for good
+// once the note is gone; otherwise saving is retried on the next tick.
+func (s *session) fail(err error) {
+	if !errors.Is(err, ErrGone) {
+		logrus.Errorf("error saving the editing session of note %s\nError: %s", s.noteID, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsaved = nil
+	for c := range s.clients {
+		c.send(Message{Type: TypeError, Rev: s.rev, Error: err.Error()})
+		c.drop()
+	}
+}
+
+// Client is a participant's connection to a session
+type Client struct {
+	session     *session
+	participant Participant
+	messages    chan Message
+	// dropped is set once messages is closed
+	dropped bool
+}
+
+// Messages returns the channel the client's messages are delivered on. It
+// is closed when the client leaves or is dropped from the session, such as
+// when it falls too far behind or loses access to the note.
+func (c *Client) Messages() <-chan Message {
+	return c.messages
+}
+
+// Receive handles a message from the client. Replies, including errors,
+// are delivered on Messages.
+func (c *Client) Receive(msg Message) {
+	c.session.receive(c, msg)
+}
+
+// Leave removes the client from the session
+func (c *Client) Leave() {
+	c.session.leave(c)
+}
+
+// send queues the message, dropping the client when it is too far behind.
+// The session's lock is held.
+func (c *Client) send(msg Message) {
+	if c.dropped {
+		return
+	}
+	select {
+	case c.messages <- msg:
+	default:
+		c.drop()
+	}
+}
+
+// drop stops delivering messages to the client. It stays in the session
+// until it leaves. The session's lock is held.
+func (c *Client) drop() {
+	if !c.dropped {
+		c.dropped = true
+		close(c.messages)
+	}
+}
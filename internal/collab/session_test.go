@@ -0,0 +1,169 @@
+package collab
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore is a Store over a note body held in memory. Load blocks until
+// loadable is closed, when set.
+type memoryStore struct {
+	mu       sync.Mutex
+	snapshot Snapshot
+	loadable chan struct{}
+}
+
+func (m *memoryStore) Load() (Snapshot, error) {
+	if m.loadable != nil {
+		<-m.loadable
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.snapshot, nil
+}
+
+func (m *memoryStore) Save(authorID, content string, version int) (Snapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if version != m.snapshot.Version {
+		return Snapshot{}, ErrStale
+	}
+	m.snapshot = Snapshot{Content: content, Version: version + 1}
+	return m.snapshot, nil
+}
+
+func (m *memoryStore) Access(userID string) (bool, error) {
+	return true, nil
+}
+
+// next returns the client's next message, failing the test if none comes
+func next(t *testing.T, c *Client) Message {
+	t.Helper()
+	select {
+	case msg, ok := <-c.Messages():
+		if !ok {
+			t.Fatal("client was dropped")
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("no message")
+	}
+	return Message{}
+}
+
+func expect(t *testing.T, c *Client, msgType string) Message {
+	t.Helper()
+	msg := next(t, c)
+	if msg.Type != msgType {
+		t.Fatalf("got a %s message %+v, want %s", msg.Type, msg, msgType)
+	}
+	return msg
+}
+
+func TestSessionOrdersConcurrentEdits(t *testing.T) {
+	hub := NewHub(time.Hour)
+	store := &memoryStore{snapshot: Snapshot{Content: "abc", Version: 1}}
+	alice, err := hub.Join("note", Participant{UserID: "alice", CanEdit: true}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Leave()
+	expect(t, alice, TypeInit)
+	bob, err := hub.Join("note", Participant{UserID: "bob", CanEdit: true}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Leave()
+	expect(t, bob, TypeInit)
+	expect(t, alice, TypeJoin)
+
+	// both insert at the same index of revision 0; alice's edit reaches
+	// the server first, so bob's is transformed over it and goes first
+	aliceOp, bobOp := parseOp(t, `[1, "X", 2]`), parseOp(t, `[1, "Y", 2]`)
+	aliceDoc, bobDoc := apply(t, aliceOp, "abc"), apply(t, bobOp, "abc")
+	alice.Receive(Message{Type: TypeOp, Rev: 0, Op: aliceOp})
+	bob.Receive(Message{Type: TypeOp, Rev: 0, Op: bobOp})
+
+	if ack := expect(t, alice, TypeAck); ack.Rev != 1 {
+		t.Fatalf("alice's edit acknowledged as revision %d, want 1", ack.Rev)
+	}
+	fromBob := expect(t, alice, TypeOp)
+	aliceDoc = apply(t, fromBob.Op, aliceDoc)
+
+	// bob's edit is still pending when alice's arrives, so bob transforms
+	// it the way the server did
+	fromAlice := expect(t, bob, TypeOp)
+	_, fromAliceOverBob, err := Transform(bobOp, fromAlice.Op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobDoc = apply(t, fromAliceOverBob, bobDoc)
+	if ack := expect(t, bob, TypeAck); ack.Rev != 2 {
+		t.Fatalf("bob's edit acknowledged as revision %d, want 2", ack.Rev)
+	}
+
+	if aliceDoc != "aYXbc" || bobDoc != "aYXbc" {
+		t.Fatalf("alice has %q and bob %q, want both at aYXbc", aliceDoc, bobDoc)
+	}
+
+	// a cursor placed at revision 0 is moved over both edits
+	alice.Receive(Message{Type: TypeCursor, Rev: 0, Cursor: &Cursor{Anchor: 1, Head: 3}})
+	cursor := expect(t, bob, TypeCursor)
+	if *cursor.Cursor != (Cursor{Anchor: 3, Head: 5}) {
+		t.Fatalf("alice's cursor is at %+v, want 3-5, text inserted at a cursor going before it", *cursor.Cursor)
+	}
+
+	carol, err := hub.Join("note", Participant{UserID: "carol"}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer carol.Leave()
+	init := expect(t, carol, TypeInit)
+	if *init.Text != "aYXbc" || init.Rev != 2 {
+		t.Fatalf("carol joined at revision %d with %q, want revision 2 with aYXbc", init.Rev, *init.Text)
+	}
+
+	carol.Receive(Message{Type: TypeOp, Rev: 2, Op: parseOp(t, `[-5]`)})
+	expect(t, carol, TypeError)
+}
+
+func TestJoinDoesNotWaitForOtherNotes(t *testing.T) {
+	hub := NewHub(time.Hour)
+	slow := &memoryStore{snapshot: Snapshot{Content: "slow", Version: 1}, loadable: make(chan struct{})}
+	fast := &memoryStore{snapshot: Snapshot{Content: "fast", Version: 1}}
+
+	joined := make(chan *Client, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			c, err := hub.Join("slow", Participant{UserID: "alice"}, slow)
+			if err != nil {
+				t.Error(err)
+			}
+			joined <- c
+		}()
+	}
+
+	done := make(chan *Client)
+	go func() {
+		c, err := hub.Join("fast", Participant{UserID: "bob"}, fast)
+		if err != nil {
+			t.Error(err)
+		}
+		done <- c
+	}()
+	select {
+	case c := <-done:
+		c.Leave()
+	case <-time.After(time.Second):
+		t.Fatal("joining a note waited for another note to load")
+	}
+
+	close(slow.loadable)
+	first, second := <-joined, <-joined
+	defer first.Leave()
+	defer second.Leave()
+	if first.session != second.session {
+		t.Fatal("joins waiting on the same load opened separate sessions")
+	}
+}
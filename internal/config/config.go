@@ -0,0 +1,847 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// EnvDev is the development mode, which allows insecure defaults
+	EnvDev = "dev"
+	// EnvProd is the production mode, and the default so that a deployment
+	// that forgets to set one does not run with insecure defaults
+	EnvProd = "prod"
+
+	// DefaultSigningKey is the JWT signing key used when none is configured.
+	// It is only accepted in dev mode.
+	DefaultSigningKey = "secret"
+)
+
+// Config holds the runtime configuration of the notes service
+type Config struct {
+	Env       string          `yaml:"env" toml:"env"`
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Database  DatabaseConfig  `yaml:"database" toml:"database"`
+	JWT       JWTConfig       `yaml:"jwt" toml:"jwt"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Revisions RevisionConfig  `yaml:"revisions" toml:"revisions"`
+	Trash     TrashConfig     `yaml:"trash" toml:"trash"`
+
+	Attachments AttachmentConfig `yaml:"attachments" toml:"attachments"`
+	Import      ImportConfig     `yaml:"import" toml:"import"`
+	Events      EventsConfig     `yaml:"events" toml:"events"`
+	Collab      CollabConfig     `yaml:"collab" toml:"collab"`
+	Webhooks    WebhooksConfig   `yaml:"webhooks" toml:"webhooks"`
+}
+
+type ServerConfig struct {
+	Port int `yaml:"port" toml:"port"`
+	// TrustProxyHeaders takes the client IP from X-Forwarded-For or
+	// X-Real-IP. Only enable it behind a proxy that sets these headers.
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers" toml:"trust_proxy_headers"`
+	// ProxyHops is how many proxies in front of the server append to
+	// X-Forwarded-For. The client IP is the entry that many from the
+	// right; entries left of it are whatever the client sent.
+	ProxyHops int `yaml:"proxy_hops" toml:"proxy_hops"`
+	// AllowedOrigins are the origins, besides the server's own, whose pages
+	// may open WebSockets, e.g. https://notes.example.com
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"`
+}
+
+type DatabaseConfig struct {
+	// Driver selects the storage backend: postgres, sqlite or memory
+	Driver     string `yaml:"driver" toml:"driver"`
+	DSN        string `yaml:"dsn" toml:"dsn"`
+	SQLitePath string `yaml:"sqlite_path" toml:"sqlite_path"`
+}
+
+type JWTConfig struct {
+	// Algorithm is the signing algorithm: HS256, RS256 or EdDSA
+	Algorithm string `yaml:"algorithm" toml:"algorithm"`
+	// KeyID is the kid of the signing key. Asymmetric keys default to
+	// their RFC 7638 thumbprint.
+	KeyID string `yaml:"key_id" toml:"key_id"`
+	// SigningKey is the shared secret used with HS256
+	SigningKey string `yaml:"signing_key" toml:"signing_key"`
+	// PrivateKeyFile is a PEM encoded RSA or Ed25519 private key used with
+	// RS256 and EdDSA
+	PrivateKeyFile string `yaml:"private_key_file" toml:"private_key_file"`
+	// VerificationKeyFiles are PEM encoded keys, typically retired signing
+	// keys, that tokens may still be verified with. Entries are either a
+	// path or kid=path.
+	VerificationKeyFiles []string `yaml:"verification_key_files" toml:"verification_key_files"`
+
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	// TicketTTL is how long a ticket, which browsers pass in the URL of
+	// event streams and WebSockets since they cannot set headers there,
+	// stays valid
+	TicketTTL time.Duration `yaml:"ticket_ttl" toml:"ticket_ttl"`
+}
+
+type AuthConfig struct {
+	// AdminUsers are usernames granted admin rights in addition to users
+	// flagged as admins in the database
+	AdminUsers []string      `yaml:"admin_users" toml:"admin_users"`
+	Lockout    LockoutConfig `yaml:"lockout" toml:"lockout"`
+}
+
+// LockoutConfig configures brute-force protection on login. Failures are
+// counted per username and per client IP.
+type LockoutConfig struct {
+	// Store keeps lockout state in the "database" or in "memory"
+	Store string `yaml:"store" toml:"store"`
+	// MaxFailures is the number of failures after which a username is locked
+	MaxFailures int `yaml:"max_failures" toml:"max_failures"`
+	// MaxFailuresPerIP is the number of failures after which an IP is locked
+	MaxFailuresPerIP int `yaml:"max_failures_per_ip" toml:"max_failures_per_ip"`
+	// Duration is how long a lockout lasts
+	Duration time.Duration `yaml:"duration" toml:"duration"`
+	// Window is how long failures are remembered after the last one
+	Window time.Duration `yaml:"window" toml:"window"`
+	// BackoffBase is the delay enforced after the first failure. It doubles
+	// with every further failure up to BackoffMax.
+	BackoffBase time.Duration `yaml:"backoff_base" toml:"backoff_base"`
+	BackoffMax  time.Duration `yaml:"backoff_max" toml:"backoff_max"`
+}
+
+// RateLimitConfig configures the per-client rate limits. Clients are keyed
+// by user ID when authenticated and by IP address otherwise.
+type RateLimitConfig struct {
+	// RequestsPerSecond and Burst are the limits applied to every request
+	RequestsPerSecond float64 `yaml:"requests_per_second" toml:"requests_per_second"`
+	Burst             int     `yaml:"burst" toml:"burst"`
+	// IdleTimeout is how long a client's bucket is kept after its last request
+	IdleTimeout time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// Routes holds additional limits for route groups (login, notes,
+	// search, public), applied on top of the default limit. Those set
+	// in a config file, the environment or flags are merged over the
+	// defaults group by group; a group given a rate of 0 has its limit
+	// removed.
+	Routes map[string]RateLimitPolicy `yaml:"routes" toml:"routes"`
+}
+
+type RateLimitPolicy struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second" toml:"requests_per_second"`
+	Burst             int     `yaml:"burst" toml:"burst"`
+}
+
+// RevisionConfig configures how much note history is kept. The latest
+// revision of a note is always kept.
+type RevisionConfig struct {
+	// MaxCount is the number of revisions kept per note, 0 for no limit
+	MaxCount int `yaml:"max_count" toml:"max_count"`
+	// MaxAge is how long revisions are kept, 0 for no limit
+	MaxAge time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+// TrashConfig configures how long deleted notes can be restored
+type TrashConfig struct {
+	// Retention is how long deleted notes stay in the trash before they
+	// are purged, 0 to keep them until purged by hand
+	Retention time.Duration `yaml:"retention" toml:"retention"`
+}
+
+// AttachmentConfig configures the files that can be attached to notes
+type AttachmentConfig struct {
+	// MaxSize is the largest file accepted, in bytes
+	MaxSize int64 `yaml:"max_size" toml:"max_size"`
+	// Quota is the total size of the attachments a user may upload, in
+	// bytes, 0 for no limit
+	Quota int64 `yaml:"quota" toml:"quota"`
+	// ContentTypes are the accepted media types. An entry such as image/*
+	// accepts every subtype.
+	ContentTypes []string      `yaml:"content_types" toml:"content_types"`
+	Storage      StorageConfig `yaml:"storage" toml:"storage"`
+}
+
+// StorageConfig selects where the contents of attachments are kept
+type StorageConfig struct {
+	// Driver is local or s3
+	Driver string `yaml:"driver" toml:"driver"`
+	// Path is the directory the local driver keeps files in
+	Path string   `yaml:"path" toml:"path"`
+	S3   S3Config `yaml:"s3" toml:"s3"`
+}
+
+// ImportConfig configures bulk imports of notes
+type ImportConfig struct {
+	// MaxSize is the largest import file accepted, in bytes
+	MaxSize int64 `yaml:"max_size" toml:"max_size"`
+	// Workers is the number of imports run at the same time, further
+	// imports waiting for one to finish
+	Workers int `yaml:"workers" toml:"workers"`
+}
+
+// EventsConfig configures the stream of note changes pushed to clients
+type EventsConfig struct {
+	// LogSize is how many recent events are kept for clients resuming
+	// with Last-Event-ID
+	LogSize int `yaml:"log_size" toml:"log_size"`
+	// KeepAlive is how often an idle stream is written to so that proxies
+	// do not close it
+	KeepAlive time.Duration `yaml:"keep_alive" toml:"keep_alive"`
+}
+
+// CollabConfig configures live editing sessions
+type CollabConfig struct {
+	// SaveInterval is how often a session saves its text to the note
+	// while it changes. Edits since the last save are lost if the server
+	// stops.
+	SaveInterval time.Duration `yaml:"save_interval" toml:"save_interval"`
+}
+
+// WebhooksConfig configures the delivery of note events to webhooks
+type WebhooksConfig struct {
+	// Timeout bounds a single delivery attempt
+	Timeout time.Duration `yaml:"timeout" toml:"timeout"`
+	// MaxAttempts is how often a delivery is tried before it is given up
+	MaxAttempts int `yaml:"max_attempts" toml:"max_attempts"`
+	// RetryBase is the wait after the first failed attempt, doubling with
+	// every further one up to RetryMax
+	RetryBase time.Duration `yaml:"retry_base" toml:"retry_base"`
+	RetryMax  time.Duration `yaml:"retry_max" toml:"retry_max"`
+	// DisableAfter is how many attempts in a row may fail, across
+	// deliveries, before the webhook is disabled
+	DisableAfter int `yaml:"disable_after" toml:"disable_after"`
+	// AllowedNetworks are CIDR ranges webhooks may be delivered to even
+	// though they are loopback, private or link-local, which are refused
+	// otherwise, e.g. 127.0.0.0/8 for receivers on the same host
+	AllowedNetworks []string `yaml:"allowed_networks" toml:"allowed_networks"`
+}
+
+// Networks returns the parsed AllowedNetworks, skipping invalid ones,
+// which Validate reports
+func (c *WebhooksConfig) Networks() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range c.AllowedNetworks {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			networks = append(networks, network)
+		}
+	}
+	return networks
+}
+
+// S3Config configures an S3 compatible object store such as AWS S3 or
+// MinIO
+type S3Config struct {
+	// Endpoint is the host and optional port, e.g. localhost:9000
+	Endpoint        string `yaml:"endpoint" toml:"endpoint"`
+	Region          string `yaml:"region" toml:"region"`
+	Bucket          string `yaml:"bucket" toml:"bucket"`
+	AccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
+	UseSSL          bool   `yaml:"use_ssl" toml:"use_ssl"`
+}
+
+// Default returns the configuration used when nothing else is provided
+func Default() *Config {
+	return &Config{
+		Env: EnvProd,
+		Server: ServerConfig{
+			Port:      8080,
+			ProxyHops: 1,
+		},
+		Database: DatabaseConfig{
+			Driver:     "postgres",
+			DSN:        "host=localhost port=5432 user=postgres dbname=notes sslmode=disable password=postgres",
+			SQLitePath: "notes.db",
+		},
+		JWT: JWTConfig{
+			Algorithm:       "HS256",
+			SigningKey:      DefaultSigningKey,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+			TicketTTL:       time.Minute,
+		},
+		Auth: AuthConfig{
+			Lockout: LockoutConfig{
+				Store:            "database",
+				MaxFailures:      5,
+				MaxFailuresPerIP: 20,
+				Duration:         15 * time.Minute,
+				Window:           15 * time.Minute,
+				BackoffBase:      time.Second,
+				BackoffMax:       30 * time.Second,
+			},
+		},
+		RateLimit: RateLimitConfig{
+			RequestsPerSecond: 10,
+			Burst:             20,
+			IdleTimeout:       10 * time.Minute,
+			Routes: map[string]RateLimitPolicy{
+				// login and signup are the targets of credential stuffing
+				"login": {RequestsPerSecond: 0.2, Burst: 5},
+				// public link passwords can be guessed without an account
+				"public": {RequestsPerSecond: 1, Burst: 10},
+			},
+		},
+		Revisions: RevisionConfig{
+			MaxCount: 100,
+		},
+		Trash: TrashConfig{
+			Retention: 30 * 24 * time.Hour,
+		},
+		Attachments: AttachmentConfig{
+			MaxSize: 10 << 20,
+			Quota:   100 << 20,
+			// no SVG or HTML, which can carry scripts
+			ContentTypes: []string{
+				"image/png", "image/jpeg", "image/gif", "image/webp",
+				"application/pdf", "text/plain", "text/markdown", "text/csv",
+			},
+			Storage: StorageConfig{
+				Driver: "local",
+				Path:   "attachments",
+				S3: S3Config{
+					Region: "us-east-1",
+					Bucket: "notes-attachments",
+					UseSSL: true,
+				},
+			},
+		},
+		Import: ImportConfig{
+			MaxSize: 256 << 20,
+			Workers: 2,
+		},
+		Events: EventsConfig{
+			LogSize:   1000,
+			KeepAlive: 30 * time.Second,
+		},
+		Collab: CollabConfig{
+			SaveInterval: 5 * time.Second,
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			RetryBase:    30 * time.Second,
+			RetryMax:     time.Hour,
+			DisableAfter: 20,
+		},
+	}
+}
+
+// Policy returns the extra limit configured for the route group
+func (c *RateLimitConfig) Policy(group string) (RateLimitPolicy, bool) {
+	policy, ok := c.Routes[group]
+	return policy, ok
+}
+
+// Addr returns the address the HTTP server listens on
+func (c *Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Server.Port)
+}
+
+// setting describes a single option that can be set from the environment
+// or the command line
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"env", "NOTES_ENV", "run mode: dev or prod", func(c *Config, v string) error {
+		c.Env = v
+		return nil
+	}},
+	{"port", "NOTES_PORT", "port the HTTP server listens on", func(c *Config, v string) error {
+		return parseInt(v, &c.Server.Port)
+	}},
+	{"trust-proxy-headers", "NOTES_TRUST_PROXY_HEADERS", "take the client IP from X-Forwarded-For/X-Real-IP", func(c *Config, v string) error {
+		return parseBool(v, &c.Server.TrustProxyHeaders)
+	}},
+	{"proxy-hops", "NOTES_PROXY_HOPS", "number of proxies appending to X-Forwarded-For in front of the server", func(c *Config, v string) error {
+		return parseInt(v, &c.Server.ProxyHops)
+	}},
+	{"allowed-origins", "NOTES_ALLOWED_ORIGINS", "comma separated origins, besides the server's own, allowed to open WebSockets", func(c *Config, v string) error {
+		c.Server.AllowedOrigins = splitList(v)
+		return nil
+	}},
+	{"driver", "NOTES_DB_DRIVER", "storage backend to use: postgres, sqlite or memory", func(c *Config, v string) error {
+		c.Database.Driver = v
+		return nil
+	}},
+	{"dsn", "NOTES_DB_DSN", "postgres connection string", func(c *Config, v string) error {
+		c.Database.DSN = v
+		return nil
+	}},
+	{"sqlite-path", "NOTES_SQLITE_PATH", "path of the sqlite database file when driver is sqlite", func(c *Config, v string) error {
+		c.Database.SQLitePath = v
+		return nil
+	}},
+	{"jwt-algorithm", "NOTES_JWT_ALGORITHM", "access token signing algorithm: HS256, RS256 or EdDSA", func(c *Config, v string) error {
+		c.JWT.Algorithm = v
+		return nil
+	}},
+	{"jwt-key-id", "NOTES_JWT_KEY_ID", "kid of the access token signing key", func(c *Config, v string) error {
+		c.JWT.KeyID = v
+		return nil
+	}},
+	{"jwt-signing-key", "NOTES_JWT_SIGNING_KEY", "secret used to sign access tokens with HS256", func(c *Config, v string) error {
+		c.JWT.SigningKey = v
+		return nil
+	}},
+	{"jwt-private-key-file", "NOTES_JWT_PRIVATE_KEY_FILE", "PEM private key used to sign access tokens with RS256 or EdDSA", func(c *Config, v string) error {
+		c.JWT.PrivateKeyFile = v
+		return nil
+	}},
+	{"jwt-verification-key-files", "NOTES_JWT_VERIFICATION_KEY_FILES", "comma separated PEM keys, as path or kid=path, that access tokens may still be verified with", func(c *Config, v string) error {
+		c.JWT.VerificationKeyFiles = splitList(v)
+		return nil
+	}},
+	{"access-token-ttl", "NOTES_ACCESS_TOKEN_TTL", "lifetime of access tokens, e.g. 15m", func(c *Config, v string) error {
+		return parseDuration(v, &c.JWT.AccessTokenTTL)
+	}},
+	{"refresh-token-ttl", "NOTES_REFRESH_TOKEN_TTL", "lifetime of refresh tokens, e.g. 720h", func(c *Config, v string) error {
+		return parseDuration(v, &c.JWT.RefreshTokenTTL)
+	}},
+	{"ticket-ttl", "NOTES_TICKET_TTL", "lifetime of event stream and WebSocket tickets, e.g. 1m", func(c *Config, v string) error {
+		return parseDuration(v, &c.JWT.TicketTTL)
+	}},
+	{"admin-users", "NOTES_ADMIN_USERS", "comma separated usernames granted admin rights", func(c *Config, v string) error {
+		c.Auth.AdminUsers = splitList(v)
+		return nil
+	}},
+	{"lockout-store", "NOTES_LOCKOUT_STORE", "where login lockout state is kept: database or memory", func(c *Config, v string) error {
+		c.Auth.Lockout.Store = v
+		return nil
+	}},
+	{"lockout-max-failures", "NOTES_LOCKOUT_MAX_FAILURES", "failed logins after which a username is locked", func(c *Config, v string) error {
+		return parseInt(v, &c.Auth.Lockout.MaxFailures)
+	}},
+	{"lockout-max-failures-per-ip", "NOTES_LOCKOUT_MAX_FAILURES_PER_IP", "failed logins after which a client IP is locked", func(c *Config, v string) error {
+		return parseInt(v, &c.Auth.Lockout.MaxFailuresPerIP)
+	}},
+	{"lockout-duration", "NOTES_LOCKOUT_DURATION", "how long a lockout lasts", func(c *Config, v string) error {
+		return parseDuration(v, &c.Auth.Lockout.Duration)
+	}},
+	{"rate-limit-rps", "NOTES_RATE_LIMIT_RPS", "requests per second allowed by the rate limiter", func(c *Config, v string) error {
+		return parseFloat(v, &c.RateLimit.RequestsPerSecond)
+	}},
+	{"rate-limit-burst", "NOTES_RATE_LIMIT_BURST", "burst size allowed by the rate limiter", func(c *Config, v string) error {
+		return parseInt(v, &c.RateLimit.Burst)
+	}},
+	{"rate-limit-idle-timeout", "NOTES_RATE_LIMIT_IDLE_TIMEOUT", "how long an idle client's rate limit bucket is kept", func(c *Config, v string) error {
+		return parseDuration(v, &c.RateLimit.IdleTimeout)
+	}},
+	{"rate-limit-routes", "NOTES_RATE_LIMIT_ROUTES", "comma separated per route group limits as group=rps:burst, e.g. login=0.2:5, with a rate of 0 removing the group's limit", func(c *Config, v string) error {
+		routes := make(map[string]RateLimitPolicy)
+		for _, entry := range splitList(v) {
+			group, limits, ok := strings.Cut(entry, "=")
+			rps, burst, ok2 := strings.Cut(limits, ":")
+			if !ok || !ok2 {
+				return fmt.Errorf("expected group=rps:burst, got %q", entry)
+			}
+			var policy RateLimitPolicy
+			if err := parseFloat(rps, &policy.RequestsPerSecond); err != nil {
+				return err
+			}
+			if err := parseInt(burst, &policy.Burst); err != nil {
+				return err
+			}
+			routes[group] = policy
+		}
+		c.RateLimit.Routes = mergeRoutes(c.RateLimit.Routes, routes)
+		return nil
+	}},
+	{"revisions-max-count", "NOTES_REVISIONS_MAX_COUNT", "revisions kept per note, 0 for no limit", func(c *Config, v string) error {
+		return parseInt(v, &c.Revisions.MaxCount)
+	}},
+	{"revisions-max-age", "NOTES_REVISIONS_MAX_AGE", "how long note revisions are kept, e.g. 2160h, 0 for no limit", func(c *Config, v string) error {
+		return parseDuration(v, &c.Revisions.MaxAge)
+	}},
+	{"trash-retention", "NOTES_TRASH_RETENTION", "how long deleted notes are kept in the trash, e.g. 720h, 0 to keep them", func(c *Config, v string) error {
+		return parseDuration(v, &c.Trash.Retention)
+	}},
+	{"attachment-max-size", "NOTES_ATTACHMENT_MAX_SIZE", "largest attachment accepted, in bytes", func(c *Config, v string) error {
+		return parseInt64(v, &c.Attachments.MaxSize)
+	}},
+	{"attachment-quota", "NOTES_ATTACHMENT_QUOTA", "total size of the attachments a user may upload, in bytes, 0 for no limit", func(c *Config, v string) error {
+		return parseInt64(v, &c.Attachments.Quota)
+	}},
+	{"attachment-content-types", "NOTES_ATTACHMENT_CONTENT_TYPES", "comma separated media types accepted as attachments, e.g. image/*,application/pdf", func(c *Config, v string) error {
+		c.Attachments.ContentTypes = splitList(v)
+		return nil
+	}},
+	{"storage-driver", "NOTES_STORAGE_DRIVER", "where attachments are stored: local or s3", func(c *Config, v string) error {
+		c.Attachments.Storage.Driver = v
+		return nil
+	}},
+	{"storage-path", "NOTES_STORAGE_PATH", "directory attachments are stored in when the storage driver is local", func(c *Config, v string) error {
+		c.Attachments.Storage.Path = v
+		return nil
+	}},
+	{"s3-endpoint", "NOTES_S3_ENDPOINT", "host and port of the S3 compatible object store", func(c *Config, v string) error {
+		c.Attachments.Storage.S3.Endpoint = v
+		return nil
+	}},
+	{"s3-region", "NOTES_S3_REGION", "region of the attachment bucket", func(c *Config, v string) error {
+		c.Attachments.Storage.S3.Region = v
+		return nil
+	}},
+	{"s3-bucket", "NOTES_S3_BUCKET", "bucket attachments are stored in, created if missing", func(c *Config, v string) error {
+		c.Attachments.Storage.S3.Bucket = v
+		return nil
+	}},
+	{"s3-access-key-id", "NOTES_S3_ACCESS_KEY_ID", "access key of the object store", func(c *Config, v string) error {
+		c.Attachments.Storage.S3.AccessKeyID = v
+		return nil
+	}},
+	{"s3-secret-access-key", "NOTES_S3_SECRET_ACCESS_KEY", "secret key of the object store", func(c *Config, v string) error {
+		c.Attachments.Storage.S3.SecretAccessKey = v
+		return nil
+	}},
+	{"s3-use-ssl", "NOTES_S3_USE_SSL", "connect to the object store over HTTPS", func(c *Config, v string) error {
+		return parseBool(v, &c.Attachments.Storage.S3.UseSSL)
+	}},
+	{"import-max-size", "NOTES_IMPORT_MAX_SIZE", "largest import file accepted, in bytes", func(c *Config, v string) error {
+		return parseInt64(v, &c.Import.MaxSize)
+	}},
+	{"import-workers", "NOTES_IMPORT_WORKERS", "number of imports run at the same time", func(c *Config, v string) error {
+		return parseInt(v, &c.Import.Workers)
+	}},
+	{"events-log-size", "NOTES_EVENTS_LOG_SIZE", "recent note events kept for clients resuming their stream", func(c *Config, v string) error {
+		return parseInt(v, &c.Events.LogSize)
+	}},
+	{"events-keep-alive", "NOTES_EVENTS_KEEP_ALIVE", "how often idle event streams and editing sessions are written to, e.g. 30s", func(c *Config, v string) error {
+		return parseDuration(v, &c.Events.KeepAlive)
+	}},
+	{"collab-save-interval", "NOTES_COLLAB_SAVE_INTERVAL", "how often live editing sessions save their text, e.g. 5s", func(c *Config, v string) error {
+		return parseDuration(v, &c.Collab.SaveInterval)
+	}},
+	{"webhook-timeout", "NOTES_WEBHOOK_TIMEOUT", "how long a webhook delivery attempt may take, e.g. 10s", func(c *Config, v string) error {
+		return parseDuration(v, &c.Webhooks.Timeout)
+	}},
+	{"webhook-max-attempts", "NOTES_WEBHOOK_MAX_ATTEMPTS", "how often a webhook delivery is tried before it is given up", func(c *Config, v string) error {
+		return parseInt(v, &c.Webhooks.MaxAttempts)
+	}},
+	{"webhook-retry-base", "NOTES_WEBHOOK_RETRY_BASE", "wait before retrying a failed webhook delivery, doubled on every retry, e.g. 30s", func(c *Config, v string) error {
+		return parseDuration(v, &c.Webhooks.RetryBase)
+	}},
+	{"webhook-retry-max", "NOTES_WEBHOOK_RETRY_MAX", "longest wait between webhook delivery attempts, e.g. 1h", func(c *Config, v string) error {
+		return parseDuration(v, &c.Webhooks.RetryMax)
+	}},
+	{"webhook-disable-after", "NOTES_WEBHOOK_DISABLE_AFTER", "failed delivery attempts in a row after which a webhook is disabled", func(c *Config, v string) error {
+		return parseInt(v, &c.Webhooks.DisableAfter)
+	}},
+	{"webhook-allowed-networks", "NOTES_WEBHOOK_ALLOWED_NETWORKS", "comma separated CIDR ranges webhooks may reach although loopback, private or link-local", func(c *Config, v string) error {
+		c.Webhooks.AllowedNetworks = splitList(v)
+		return nil
+	}},
+}
+
+// Load builds the configuration from, in increasing order of precedence,
+// the built-in defaults, a YAML or TOML config file, NOTES_* environment
+// variables and command-line flags. The config file is given by the -config
+// flag or the NOTES_CONFIG environment variable. The result is validated
+// before it is returned.
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("notes", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv("NOTES_CONFIG"), "path of a YAML or TOML config file")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.apply(cfg, v); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", s.env, err)
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag != f.Name || flagErr != nil {
+				continue
+			}
+			if err := s.apply(cfg, *values[s.flag]); err != nil {
+				flagErr = fmt.Errorf("invalid value for -%s: %w", s.flag, err)
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile overlays the values from the given config file, choosing the
+// format from the file extension
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+
+	// decoding into the default routes would keep every default group, so
+	// the file's are decoded on their own and merged
+	routes := c.RateLimit.Routes
+	c.RateLimit.Routes = nil
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	default:
+		return fmt.Errorf("unsupported config file format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	c.RateLimit.Routes = mergeRoutes(routes, c.RateLimit.Routes)
+	return nil
+}
+
+// mergeRoutes returns the route group limits with those of overrides
+// replacing them, removing the groups overridden with a rate of 0
+func mergeRoutes(routes, overrides map[string]RateLimitPolicy) map[string]RateLimitPolicy {
+	merged := make(map[string]RateLimitPolicy, len(routes)+len(overrides))
+	for group, policy := range routes {
+		merged[group] = policy
+	}
+	for group, policy := range overrides {
+		if policy.RequestsPerSecond == 0 {
+			delete(merged, group)
+			continue
+		}
+		merged[group] = policy
+	}
+	return merged
+}
+
+// Validate checks that the configuration is usable and safe to run with
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Env != EnvDev && c.Env != EnvProd {
+		errs = append(errs, fmt.Errorf("env must be %q or %q, got %q", EnvDev, EnvProd, c.Env))
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", c.Server.Port))
+	}
+	if c.Server.ProxyHops < 1 {
+		errs = append(errs, fmt.Errorf("proxy hops must be at least 1, got %d", c.Server.ProxyHops))
+	}
+	for _, origin := range c.Server.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("allowed origin %q must be a scheme and host, e.g. https://notes.example.com", origin))
+		}
+	}
+
+	switch c.Database.Driver {
+	case "postgres":
+		if c.Database.DSN == "" {
+			errs = append(errs, errors.New("dsn is required for the postgres driver"))
+		}
+	case "sqlite":
+		if c.Database.SQLitePath == "" {
+			errs = append(errs, errors.New("sqlite_path is required for the sqlite driver"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("unknown driver %q, expected postgres, sqlite or memory", c.Database.Driver))
+	}
+
+	switch c.JWT.Algorithm {
+	case "HS256":
+		if c.JWT.SigningKey == "" {
+			errs = append(errs, errors.New("jwt signing key must not be empty"))
+		} else if c.JWT.SigningKey == DefaultSigningKey && c.Env != EnvDev {
+			errs = append(errs, errors.New("refusing to start with the default jwt signing key outside dev mode"))
+		}
+	case "RS256", "EdDSA":
+		// dev mode generates a throwaway key when none is configured
+		if c.JWT.PrivateKeyFile == "" && c.Env != EnvDev {
+			errs = append(errs, fmt.Errorf("jwt private key file is required for %s outside dev mode", c.JWT.Algorithm))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown jwt algorithm %q, expected HS256, RS256 or EdDSA", c.JWT.Algorithm))
+	}
+
+	if c.JWT.AccessTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("access token ttl must be positive, got %s", c.JWT.AccessTokenTTL))
+	}
+	if c.JWT.RefreshTokenTTL <= c.JWT.AccessTokenTTL {
+		errs = append(errs, fmt.Errorf("refresh token ttl (%s) must be longer than the access token ttl (%s)", c.JWT.RefreshTokenTTL, c.JWT.AccessTokenTTL))
+	}
+	if c.JWT.TicketTTL <= 0 {
+		errs = append(errs, fmt.Errorf("ticket ttl must be positive, got %s", c.JWT.TicketTTL))
+	}
+
+	lockout := c.Auth.Lockout
+	if lockout.Store != "database" && lockout.Store != "memory" {
+		errs = append(errs, fmt.Errorf("lockout store must be database or memory, got %q", lockout.Store))
+	}
+	if lockout.MaxFailures < 1 || lockout.MaxFailuresPerIP < 1 {
+		errs = append(errs, errors.New("lockout max failures must be at least 1"))
+	}
+	if lockout.Duration <= 0 || lockout.Window <= 0 || lockout.BackoffBase < 0 || lockout.BackoffMax < lockout.BackoffBase {
+		errs = append(errs, errors.New("lockout durations must be positive and backoff_max must not be below backoff_base"))
+	}
+
+	if c.RateLimit.RequestsPerSecond <= 0 {
+		errs = append(errs, fmt.Errorf("rate limit requests per second must be positive, got %v", c.RateLimit.RequestsPerSecond))
+	}
+	if c.RateLimit.Burst < 1 {
+		errs = append(errs, fmt.Errorf("rate limit burst must be at least 1, got %d", c.RateLimit.Burst))
+	}
+	if c.RateLimit.IdleTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("rate limit idle timeout must be positive, got %s", c.RateLimit.IdleTimeout))
+	}
+	for group, policy := range c.RateLimit.Routes {
+		if policy.RequestsPerSecond <= 0 || policy.Burst < 1 {
+			errs = append(errs, fmt.Errorf("rate limit for route group %q needs a positive rate and a burst of at least 1", group))
+		}
+	}
+
+	if c.Revisions.MaxCount < 0 || c.Revisions.MaxAge < 0 {
+		errs = append(errs, errors.New("revision max count and max age must not be negative"))
+	}
+	if c.Trash.Retention < 0 {
+		errs = append(errs, errors.New("trash retention must not be negative"))
+	}
+
+	attachments := c.Attachments
+	if attachments.MaxSize < 1 || attachments.Quota < 0 {
+		errs = append(errs, errors.New("attachment max size must be positive and the quota must not be negative"))
+	}
+	if len(attachments.ContentTypes) == 0 {
+		errs = append(errs, errors.New("at least one attachment content type must be accepted"))
+	}
+	for _, contentType := range attachments.ContentTypes {
+		if major, minor, ok := strings.Cut(contentType, "/"); !ok || major == "" || major == "*" || minor == "" {
+			errs = append(errs, fmt.Errorf("invalid attachment content type %q, expected type/subtype or type/*", contentType))
+		}
+	}
+	switch storage := attachments.Storage; storage.Driver {
+	case "local":
+		if storage.Path == "" {
+			errs = append(errs, errors.New("storage path is required for the local storage driver"))
+		}
+	case "s3":
+		if storage.S3.Endpoint == "" || storage.S3.Bucket == "" {
+			errs = append(errs, errors.New("s3 endpoint and bucket are required for the s3 storage driver"))
+		}
+		if storage.S3.AccessKeyID == "" || storage.S3.SecretAccessKey == "" {
+			errs = append(errs, errors.New("s3 access key id and secret access key are required for the s3 storage driver"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage driver %q, expected local or s3", storage.Driver))
+	}
+
+	if c.Import.MaxSize < 1 || c.Import.Workers < 1 {
+		errs = append(errs, errors.New("import max size and workers must be positive"))
+	}
+	if c.Events.LogSize < 1 || c.Events.KeepAlive <= 0 {
+		errs = append(errs, errors.New("events log size and keep alive must be positive"))
+	}
+	if c.Collab.SaveInterval <= 0 {
+		errs = append(errs, errors.New("collab save interval must be positive"))
+	}
+	if webhooks := c.Webhooks; webhooks.Timeout <= 0 || webhooks.MaxAttempts < 1 || webhooks.RetryBase <= 0 || webhooks.DisableAfter < 1 {
+		errs = append(errs, errors.New("webhook timeout, max attempts, retry base and disable after must be positive"))
+	} else if webhooks.RetryMax < webhooks.RetryBase {
+		errs = append(errs, errors.New("webhook retry max must be at least retry base"))
+	}
+	for _, cidr := range c.Webhooks.AllowedNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			errs = append(errs, fmt.Errorf("webhook allowed network %q must be a CIDR range, e.g. 127.0.0.0/8", cidr))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func parseInt(v string, dst *int) error {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func parseInt64(v string, dst *int64) error {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func parseFloat(v string, dst *float64) error {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return err
+	}
+	*dst = f
+	return nil
+}
+
+func parseDuration(v string, dst *time.Duration) error {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return err
+	}
+	*dst = d
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseBool(v string, dst *bool) error {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	*dst = b
+	return nil
+}
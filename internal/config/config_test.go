@@ -0,0 +1,138 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes a config file into a temporary directory and returns
+// its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "notes.yaml", `
+env: dev
+server:
+  port: 8081
+database:
+  driver: sqlite
+  sqlite_path: file.db
+rate_limit:
+  burst: 30
+  idle_timeout: 5m
+`)
+	t.Setenv("NOTES_PORT", "8082")
+	t.Setenv("NOTES_SQLITE_PATH", "env.db")
+	t.Setenv("NOTES_RATE_LIMIT_BURST", "40")
+
+	cfg, err := Load([]string{"-config", path, "-port", "8083"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"default", cfg.JWT.AccessTokenTTL, 15 * time.Minute},
+		{"file over default", cfg.Database.Driver, "sqlite"},
+		{"file over default", cfg.RateLimit.IdleTimeout, 5 * time.Minute},
+		{"env over file", cfg.Database.SQLitePath, "env.db"},
+		{"env over file", cfg.RateLimit.Burst, 40},
+		{"flag over env", cfg.Server.Port, 8083},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "notes.toml", `
+env = "dev"
+
+[server]
+port = 9000
+`)
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Env != EnvDev {
+		t.Errorf("got port %d in %s mode, want 9000 in dev", cfg.Server.Port, cfg.Env)
+	}
+
+	if _, err := Load([]string{"-config", writeFile(t, "notes.json", "{}")}); err == nil {
+		t.Error("loaded a config file of an unsupported format")
+	}
+}
+
+func TestLoadInvalidValue(t *testing.T) {
+	t.Setenv("NOTES_PORT", "eighty")
+	if _, err := Load([]string{"-env", "dev"}); err == nil || !strings.Contains(err.Error(), "NOTES_PORT") {
+		t.Errorf("got %v, want an error naming NOTES_PORT", err)
+	}
+}
+
+func TestDefaultSigningKeyRefusedInProd(t *testing.T) {
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "default jwt signing key") {
+		t.Errorf("prod mode with the default signing key: got %v, want it refused", err)
+	}
+	if _, err := Load([]string{"-env", "dev"}); err != nil {
+		t.Errorf("dev mode with the default signing key: %v", err)
+	}
+	if _, err := Load([]string{"-jwt-signing-key", "a real secret"}); err != nil {
+		t.Errorf("prod mode with a signing key: %v", err)
+	}
+}
+
+func TestRouteLimitsMerge(t *testing.T) {
+	path := writeFile(t, "notes.yaml", `
+env: dev
+rate_limit:
+  routes:
+    login:
+      requests_per_second: 0
+    notes:
+      requests_per_second: 5
+      burst: 10
+`)
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.RateLimit.Policy("login"); ok {
+		t.Error("login limit kept although the file removed it")
+	}
+	if policy, ok := cfg.RateLimit.Policy("public"); !ok || policy != (RateLimitPolicy{RequestsPerSecond: 1, Burst: 10}) {
+		t.Errorf("public limit is %+v, want the default kept", policy)
+	}
+	if policy, ok := cfg.RateLimit.Policy("notes"); !ok || policy != (RateLimitPolicy{RequestsPerSecond: 5, Burst: 10}) {
+		t.Errorf("notes limit is %+v, want the file's", policy)
+	}
+
+	cfg, err = Load([]string{"-config", path, "-rate-limit-routes", "public=0:0,login=2:4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cfg.RateLimit.Policy("public"); ok {
+		t.Error("public limit kept although the flag removed it")
+	}
+	if policy, _ := cfg.RateLimit.Policy("login"); policy != (RateLimitPolicy{RequestsPerSecond: 2, Burst: 4}) {
+		t.Errorf("login limit is %+v, want the flag's", policy)
+	}
+	if _, ok := cfg.RateLimit.Policy("notes"); !ok {
+		t.Error("notes limit from the file dropped by the flag")
+	}
+}
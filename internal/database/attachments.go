@@ -0,0 +1,92 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// ErrQuotaExceeded is returned when an attachment would take its uploader
+// over their storage quota
+var ErrQuotaExceeded = errors.New("attachment quota exceeded")
+
+// CreateAttachment records an uploaded attachment, unless the uploader's
+// attachments would then take up more than quota bytes. A quota of 0 means
+// no limit.
+func (s *store) CreateAttachment(attachment *models.Attachment, quota int64) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if quota > 0 {
+			used, err := attachmentUsage(tx, attachment.UserID)
+			if err != nil {
+				return err
+			}
+			if used+attachment.Size > quota {
+				return ErrQuotaExceeded
+			}
+		}
+		return tx.Create(attachment).Error
+	})
+}
+
+// ListAttachments returns the attachments of the note, oldest first
+func (s *store) ListAttachments(noteID string) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	err := s.db.Where("note_id = ? AND purged_at IS NULL", noteID).Order("created_at, id").Find(&attachments).Error
+	return attachments, err
+}
+
+// GetAttachment fetches an attachment of the note
+func (s *store) GetAttachment(noteID, id string) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := s.db.Where("id = ? AND note_id = ? AND purged_at IS NULL", id, noteID).First(&attachment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// PurgeAttachment marks an attachment of the note as deleted, leaving its
+// blob to be removed
+func (s *store) PurgeAttachment(noteID, id string, now time.Time) error {
+	result := s.db.Model(&models.Attachment{}).
+		Where("id = ? AND note_id = ? AND purged_at IS NULL", id, noteID).
+		Update("purged_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// ListPurgedAttachments returns up to limit deleted attachments whose blobs
+// are still to be removed
+func (s *store) ListPurgedAttachments(limit int) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	err := s.db.Where("purged_at IS NOT NULL").Order("purged_at").Limit(limit).Find(&attachments).Error
+	return attachments, err
+}
+
+// DeletePurgedAttachment removes the record of a deleted attachment once
+// its blob is gone
+func (s *store) DeletePurgedAttachment(id string) error {
+	return s.db.Where("id = ? AND purged_at IS NOT NULL", id).Delete(&models.Attachment{}).Error
+}
+
+// AttachmentUsage returns the total size of the attachments uploaded by the
+// user, including those of notes in the trash
+func (s *store) AttachmentUsage(userID string) (int64, error) {
+	return attachmentUsage(s.db, userID)
+}
+
+func attachmentUsage(tx *gorm.DB, userID string) (int64, error) {
+	var used int64
+	err := tx.Model(&models.Attachment{}).
+		Where("user_id = ? AND purged_at IS NULL", userID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error
+	return used, err
+}
@@ -1,28 +1,141 @@
 package database
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"github.com/GauravMakhijani/notes/models"
 	"github.com/sirupsen/logrus"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrVersionConflict is returned when a note changed since the version an
+// update was based on
+var ErrVersionConflict = errors.New("note version conflict")
+
 // Storer represents the database operations interface
 type Storer interface {
+	LockoutStore
+
 	AutoMigrate() error
+	// Transaction runs fn against a store whose changes are only kept if
+	// fn returns nil. Transactions nest, so that a failed inner one only
+	// undoes its own changes.
+	Transaction(fn func(tx Storer) error) error
+
 	CreateNewUser(user *models.User) error
 	GetUserByUsername(username string) (*models.User, error)
+	GetUserByID(id string) (*models.User, error)
 
 	// Note related methods
 	CreateNewNote(note *models.Note) (*models.Note, error)
 	GetNoteByID(userId, id string) (*models.Note, error)
-	ListNotes(userID string) ([]*models.Note, error)
-	DeleteNoteByID(userId, id string) error
-	UpdateNoteByID(userId, id string, note *models.Note) (*models.Note, error)
-	ShareNoteWithUser(noteID string, fromUserID string, toUsersID []string) error
-	SearchNotes(userID, query string) ([]*models.Note, error)
+	GetNote(id string) (*models.Note, error)
+	ListNotes(query NoteQuery) (*NotePage, error)
+	DeleteNoteByID(id string) error
+	GetDeletedNote(id string) (*models.Note, error)
+	RestoreNote(id string) (*models.Note, error)
+	PurgeNote(id string) error
+	PurgeDeletedNotes(before time.Time) (int64, error)
+	UpdateNoteByID(authorID, id string, version int, note *models.Note) (*models.Note, error)
+	SearchNotes(query NoteQuery) (*NotePage, error)
+
+	// Share related methods
+	ShareNoteWithUser(noteID string, fromUserID string, toUsersID []string, role string) error
+	GetNoteShare(noteID, toUserID string) (*models.SharedNote, error)
+	ListNoteShares(noteID string) ([]*ShareDetail, error)
+	ListIncomingShares(userID string) ([]*ShareDetail, error)
+	ListOutgoingShares(userID string) ([]*ShareDetail, error)
+	RevokeNoteShare(noteID, toUsername string) error
+
+	// Notebook related methods
+	CreateNotebook(notebook *models.Notebook) error
+	GetNotebook(userID, id string) (*models.Notebook, error)
+	ListNotebooks(userID string) ([]*NotebookCount, error)
+	NotebookSubtree(userID, id string) ([]string, error)
+	RenameNotebook(userID, id, name string) (*models.Notebook, error)
+	MoveNotebook(userID, id string, parentID *string) (*models.Notebook, error)
+	DeleteNotebook(userID, id string) (int64, error)
+	MoveNote(noteID string, notebookID *string) (*models.Note, error)
+
+	// Group related methods
+	CreateGroup(group *models.Group, ownerID string) error
+	ListUserGroups(userID string) ([]*GroupMembership, error)
+	GetGroup(id string) (*models.Group, error)
+	GetMembership(groupID, userID string) (*models.Membership, error)
+	ListGroupMembers(groupID string) ([]*GroupMember, error)
+	AddGroupMember(groupID, userID, role string) error
+	UpdateGroupMember(groupID, userID, role string) error
+	RemoveGroupMember(groupID, userID string) error
+
+	// Attachment related methods
+	CreateAttachment(attachment *models.Attachment, quota int64) error
+	ListAttachments(noteID string) ([]*models.Attachment, error)
+	GetAttachment(noteID, id string) (*models.Attachment, error)
+	PurgeAttachment(noteID, id string, now time.Time) error
+	ListPurgedAttachments(limit int) ([]*models.Attachment, error)
+	DeletePurgedAttachment(id string) error
+	AttachmentUsage(userID string) (int64, error)
+
+	// Public link related methods
+	CreatePublicLink(link *models.PublicLink) error
+	ListPublicLinks(noteID string, now time.Time) ([]*models.PublicLink, error)
+	GetPublicLinkByHash(tokenHash string) (*models.PublicLink, error)
+	RecordPublicLinkView(id string, now time.Time) (bool, error)
+	RevokePublicLink(noteID, id string, now time.Time) error
+
+	// Tag related methods
+	AddNoteTags(userID, noteID string, names []string) ([]models.Tag, error)
+	RemoveNoteTags(userID, noteID string, names []string) ([]models.Tag, error)
+	SetNoteTags(userID, noteID string, names []string) ([]models.Tag, error)
+	ListTags(userID string) ([]*TagUsage, error)
+	RenameTag(userID, name, newName string) (*models.Tag, error)
+	MergeTags(userID string, sources []string, target string) (*models.Tag, error)
+	DeleteTag(userID, name string) error
+
+	// Revision related methods
+	ListNoteRevisions(noteID string) ([]*models.NoteRevision, error)
+	GetNoteRevision(noteID string, number int) (*models.NoteRevision, error)
+	RestoreNoteRevision(authorID, noteID string, number int) (*models.Note, error)
+	PruneNoteRevisions(noteID string, keep int, before time.Time) (int64, error)
+
+	// Token related methods
+	CreateRefreshToken(token *models.RefreshToken) error
+	GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error)
+	RevokeRefreshToken(id string) (bool, error)
+	RevokeRefreshTokenFamily(familyID string) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti string) (bool, error)
+
+	// Import related methods
+	CreateImportJob(job *models.ImportJob) error
+	GetImportJob(userID, id string) (*models.ImportJob, error)
+	ListImportJobs(userID string) ([]*models.ImportJob, error)
+	UpdateImportJob(job *models.ImportJob) error
+	AddImportItems(items []*models.ImportItem) error
+	ListImportItems(jobID string) ([]*models.ImportItem, error)
+	FailInterruptedImportJobs(now time.Time) (int64, error)
+	ListNoteTitles(userID string) ([]string, error)
+
+	// Webhook related methods
+	CreateWebhook(hook *models.Webhook) error
+	GetWebhook(userID, id string) (*models.Webhook, error)
+	ListWebhooks(userID string) ([]*models.Webhook, error)
+	ListActiveWebhooks(userIDs []string) ([]*models.Webhook, error)
+	UpdateWebhook(hook *models.Webhook) error
+	DeleteWebhook(userID, id string) error
+	RecordWebhookAttempt(id string, succeeded bool, disableAfter int, now time.Time) (bool, error)
+	AddWebhookDeliveries(deliveries []*models.WebhookDelivery) error
+	ListDueWebhookDeliveries(now time.Time, exclude []string, perWebhook, limit int) ([]*DueWebhookDelivery, error)
+	UpdateWebhookDelivery(delivery *models.WebhookDelivery) error
+	ListWebhookDeliveries(webhookID string, limit int) ([]*models.WebhookDelivery, error)
+
+	// Audit related methods
+	CreateAuditEvent(event *models.AuditEvent) error
+	ListAuditEvents(limit int) ([]*models.AuditEvent, error)
 }
 
 // store is the concrete implementation of the Storer interface
@@ -30,9 +143,9 @@ type store struct {
 	db *gorm.DB
 }
 
-// NewStore creates a new instance of the database store
-func NewStore() Storer {
-	dsn := "host=localhost port=5432 user=postgres dbname=notes sslmode=disable password=postgres"
+// NewStore creates a new instance of the database store connected to the
+// postgres database described by dsn
+func NewStore(dsn string) Storer {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
 	if err != nil {
 		log.Println(err)
@@ -44,7 +157,34 @@ func NewStore() Storer {
 
 // AutoMigrate performs automatic migration of database tables
 func (s *store) AutoMigrate() error {
-	return s.db.AutoMigrate(&models.User{}, &models.Note{}, &models.SharedNote{})
+	if err := dedupeShares(s.db); err != nil {
+		return err
+	}
+
+	err := s.db.AutoMigrate(&models.User{}, &models.Note{}, &models.SharedNote{}, &models.PublicLink{}, &models.Attachment{}, &models.Group{}, &models.Membership{}, &models.Notebook{}, &models.Tag{}, &models.NoteTag{}, &models.NoteRevision{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.LoginAttempt{}, &models.AuditEvent{}, &models.ImportJob{}, &models.ImportItem{}, &models.Webhook{}, &models.WebhookDelivery{})
+	if err != nil {
+		return err
+	}
+	if err := migrateDeletedFlag(s.db); err != nil {
+		return err
+	}
+
+	if s.db.Dialector.Name() == "postgres" {
+		for _, stmt := range postgresSearchSetup {
+			if err := s.db.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Transaction runs fn in a database transaction, committed if fn returns
+// nil and rolled back otherwise. Nested transactions use savepoints.
+func (s *store) Transaction(fn func(tx Storer) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&store{db: tx})
+	})
 }
 
 // CreateNewUser creates a new user in the database
@@ -62,9 +202,25 @@ func (s *store) GetUserByUsername(username string) (*models.User, error) {
 	return &user, nil
 }
 
-// CreateNewNote creates a new note in the database
+// GetUserByID fetches the user from the database by ID
+func (s *store) GetUserByID(id string) (*models.User, error) {
+	var user models.User
+	err := s.db.Where("id = ?", id).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateNewNote creates a new note in the database along with its first
+// revision
 func (s *store) CreateNewNote(note *models.Note) (*models.Note, error) {
-	err := s.db.Create(note).Error
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(note).Error; err != nil {
+			return err
+		}
+		return writeRevision(tx, note, note.UserID, nil)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -74,41 +230,45 @@ func (s *store) CreateNewNote(note *models.Note) (*models.Note, error) {
 // GetNoteByID fetches the note from the database by ID
 func (s *store) GetNoteByID(userId, id string) (*models.Note, error) {
 	var note models.Note
-	err := s.db.Where("id = ? AND user_id = ? AND is_deleted = ?", id, userId, false).First(&note).Error
+	err := s.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", id, userId).First(&note).Error
 	if err != nil {
 		return nil, err
 	}
+	if err := s.attachTags(&note); err != nil {
+		return nil, err
+	}
 	return &note, nil
 }
 
-// ListNotes fetches all the notes from the database for the given user
-func (s *store) ListNotes(userID string) ([]*models.Note, error) {
-	var notes []*models.Note
-	err := s.db.Where("user_id = ? AND is_deleted = ?", userID, false).Find(&notes).Error
+// GetNote fetches a note by ID whoever owns it. Callers check that the user
+// may access it.
+func (s *store) GetNote(id string) (*models.Note, error) {
+	var note models.Note
+	err := s.db.Where("id = ? AND deleted_at IS NULL", id).First(&note).Error
 	if err != nil {
 		return nil, err
 	}
-	// add shared notes also to the list
-	var sharedNotes []*models.SharedNote
-	err = s.db.Where("to_user_id = ?", userID).Find(&sharedNotes).Error
-	if err != nil {
+	if err := s.attachTags(&note); err != nil {
 		return nil, err
 	}
-	for _, sharedNote := range sharedNotes {
-		note, err := s.GetNoteByID(sharedNote.FromUserID, sharedNote.NoteID)
-		if err != nil {
-			logrus.Errorf("error getting note by id\nError: %s", err.Error())
-			continue
-		}
-		notes = append(notes, note)
-	}
+	return &note, nil
+}
 
-	return notes, nil
+// ListNotes fetches a page of the notes the user owns or that were shared
+// with them
+func (s *store) ListNotes(query NoteQuery) (*NotePage, error) {
+	page, err := findPage(s.db, query)
+	if err != nil {
+		return nil, err
+	}
+	return page, s.attachTags(page.Notes...)
 }
 
-func (s *store) DeleteNoteByID(userId, id string) error {
+// DeleteNoteByID soft deletes the note. Callers check that the user may
+// delete it.
+func (s *store) DeleteNoteByID(id string) error {
 
-	err := s.db.Model(&models.Note{}).Where("id = ? AND user_id = ? AND is_deleted = ?", id, userId, false).Update("is_deleted", true).Error
+	err := s.db.Model(&models.Note{}).Where("id = ? AND deleted_at IS NULL", id).Update("deleted_at", time.Now()).Error
 	if err != nil {
 		logrus.Errorf("error deleting note\nError: %s", err.Error())
 		return err
@@ -116,12 +276,51 @@ func (s *store) DeleteNoteByID(userId, id string) error {
 	return nil
 }
 
-func (s *store) UpdateNoteByID(userId, id string, note *models.Note) (*models.Note, error) {
-	err := s.db.Where("id = ? AND user_id = ? AND is_deleted = ?", id, userId, false).Updates(note).Error
+// UpdateNoteByID updates the non-empty fields of the note and records the
+// result as a new revision by the given author, who need not be the owner.
+// Unless version is 0, the update only happens if the note is still at that
+// version, otherwise ErrVersionConflict is returned.
+func (s *store) UpdateNoteByID(authorID, id string, version int, note *models.Note) (*models.Note, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var current models.Note
+		err := tx.Where("id = ? AND deleted_at IS NULL", id).First(&current).Error
+		if err != nil {
+			return err
+		}
+		if version != 0 && current.Version != version {
+			return ErrVersionConflict
+		}
+		if err := ensureBaseRevision(tx, &current); err != nil {
+			return err
+		}
+
+		changes := map[string]interface{}{"version": gorm.Expr("version + 1")}
+		if note.Title != "" {
+			changes["title"] = note.Title
+		}
+		if note.Content != "" {
+			changes["content"] = note.Content
+		}
+		if note.Format != "" {
+			changes["format"] = note.Format
+		}
+		// the version condition catches writes that raced with ours
+		result := tx.Model(&current).Where("version = ?", current.Version).Updates(changes)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		if err := tx.First(&current, "id = ?", id).Error; err != nil {
+			return err
+		}
+		return writeRevision(tx, &current, authorID, nil)
+	})
 	if err != nil {
 		return nil, err
 	}
-	note, err = s.GetNoteByID(userId, id)
+	note, err = s.GetNote(id)
 	if err != nil {
 		return nil, err
 	}
@@ -129,36 +328,67 @@ func (s *store) UpdateNoteByID(userId, id string, note *models.Note) (*models.No
 	return note, nil
 }
 
-// ShareNoteWithUser shares the note with the given user
-func (s *store) ShareNoteWithUser(noteID string, fromUserID string, toUsersName []string) error {
-	var sharedNote []*models.SharedNote
-	for _, toUserName := range toUsersName {
-		toUser, err := s.GetUserByUsername(toUserName)
-		if err != nil {
-			logrus.Errorf("error getting user by username\nError: %s", err.Error())
-			continue
-		}
-		sharedNote = append(sharedNote, &models.SharedNote{
-			NoteID:     noteID,
-			FromUserID: fromUserID,
-			ToUserID:   toUser.ID,
-		})
+// CreateRefreshToken stores a newly issued refresh token
+func (s *store) CreateRefreshToken(token *models.RefreshToken) error {
+	return s.db.Create(token).Error
+}
+
+// GetRefreshTokenByHash fetches the refresh token with the given hash
+func (s *store) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := s.db.Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// RevokeRefreshToken marks the refresh token as revoked, reporting whether it
+// was still active. Only one of several concurrent callers can win.
+func (s *store) RevokeRefreshToken(id string) (bool, error) {
+	result := s.db.Model(&models.RefreshToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevokeRefreshTokenFamily revokes every active refresh token in the family
+func (s *store) RevokeRefreshTokenFamily(familyID string) error {
+	return s.db.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAccessToken adds the access token's jti to the denylist, pruning
+// entries for tokens that have expired on their own
+func (s *store) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	err := s.db.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error
+	if err != nil {
+		logrus.Errorf("error pruning revoked tokens\nError: %s", err.Error())
 	}
-	err := s.db.Create(sharedNote).Error
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+// IsAccessTokenRevoked reports whether the access token's jti is on the denylist
+func (s *store) IsAccessTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
 	if err != nil {
-		return err
+		return false, err
 	}
+	return count > 0, nil
+}
 
-	return nil
+// CreateAuditEvent records an audit event
+func (s *store) CreateAuditEvent(event *models.AuditEvent) error {
+	return s.db.Create(event).Error
 }
 
-func (s *store) SearchNotes(userID, query string) ([]*models.Note, error) {
-	var notes []*models.Note
-	// get all the notes for the user from the database matching the query and not deleted query should be in title or content
-	err := s.db.Where("user_id = ? AND is_deleted = ? AND (title LIKE ? OR content LIKE ?)", userID, false, "%"+query+"%", "%"+query+"%").Find(&notes).Error
-	if err != nil && err != gorm.ErrRecordNotFound {
+// ListAuditEvents fetches the most recent audit events, newest first
+func (s *store) ListAuditEvents(limit int) ([]*models.AuditEvent, error) {
+	var events []*models.AuditEvent
+	err := s.db.Order("created_at DESC").Limit(limit).Find(&events).Error
+	if err != nil {
 		return nil, err
 	}
-
-	return notes, nil
+	return events, nil
 }
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// ErrMemberExists is returned when adding a user to a group they are
+// already a member of
+var ErrMemberExists = errors.New("already a member of the group")
+
+// GroupMembership is a group along with the role of the user it was listed
+// for and the number of members
+type GroupMembership struct {
+	models.Group
+	Role        string
+	MemberCount int64
+}
+
+// GroupMember is a membership with the member's username
+type GroupMember struct {
+	models.Membership
+	Username string
+}
+
+// CreateGroup creates the group with the given user as its owner
+func (s *store) CreateGroup(group *models.Group, ownerID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(group).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{GroupID: group.ID, UserID: ownerID, Role: models.GroupRoleOwner}).Error
+	})
+}
+
+// ListUserGroups returns the groups the user is a member of, sorted by name
+func (s *store) ListUserGroups(userID string) ([]*GroupMembership, error) {
+	var groups []*GroupMembership
+	memberCount := s.db.Model(&models.Membership{}).Select("COUNT(*)").Where("memberships.group_id = groups.id")
+	err := s.db.Model(&models.Group{}).
+		Select("groups.*, mine.role AS role, (?) AS member_count", memberCount).
+		Joins("JOIN memberships mine ON mine.group_id = groups.id AND mine.user_id = ?", userID).
+		Order("groups.name, groups.id").
+		Scan(&groups).Error
+	return groups, err
+}
+
+// GetGroup fetches the group by ID
+func (s *store) GetGroup(id string) (*models.Group, error) {
+	var group models.Group
+	if err := s.db.Where("id = ?", id).First(&group).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetMembership fetches the membership of the user in the group
+func (s *store) GetMembership(groupID, userID string) (*models.Membership, error) {
+	var membership models.Membership
+	if err := s.db.Where("group_id = ? AND user_id = ?", groupID, userID).First(&membership).Error; err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// ListGroupMembers returns the members of the group in the order they
+// joined
+func (s *store) ListGroupMembers(groupID string) ([]*GroupMember, error) {
+	var members []*GroupMember
+	err := s.db.Model(&models.Membership{}).
+		Select("memberships.*, users.username").
+		Joins("JOIN users ON users.id = memberships.user_id").
+		Where("memberships.group_id = ?", groupID).
+		Order("memberships.created_at, users.username").
+		Scan(&members).Error
+	return members, err
+}
+
+// AddGroupMember adds the user to the group in the given role
+func (s *store) AddGroupMember(groupID, userID, role string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Membership{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrMemberExists
+		}
+		return tx.Create(&models.Membership{GroupID: groupID, UserID: userID, Role: role}).Error
+	})
+}
+
+// UpdateGroupMember changes the role of a member of the group
+func (s *store) UpdateGroupMember(groupID, userID, role string) error {
+	result := s.db.Model(&models.Membership{}).Where("group_id = ? AND user_id = ?", groupID, userID).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RemoveGroupMember removes the user from the group. Their access to the
+// group's notes ends with it.
+func (s *store) RemoveGroupMember(groupID, userID string) error {
+	result := s.db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.Membership{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// CreateImportJob records a new import job
+func (s *store) CreateImportJob(job *models.ImportJob) error {
+	return s.db.Create(job).Error
+}
+
+// GetImportJob fetches an import job of the user
+func (s *store) GetImportJob(userID, id string) (*models.ImportJob, error) {
+	var job models.ImportJob
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// ListImportJobs returns the user's import jobs, newest first
+func (s *store) ListImportJobs(userID string) ([]*models.ImportJob, error) {
+	var jobs []*models.ImportJob
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC, id").Find(&jobs).Error
+	return jobs, err
+}
+
+// UpdateImportJob saves the status and counts of an import job
+func (s *store) UpdateImportJob(job *models.ImportJob) error {
+	return s.db.Save(job).Error
+}
+
+// AddImportItems records the outcome of items of an import job
+func (s *store) AddImportItems(items []*models.ImportItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+	return s.db.Create(&items).Error
+}
+
+// ListImportItems returns the items of an import job in import order
+func (s *store) ListImportItems(jobID string) ([]*models.ImportItem, error) {
+	var items []*models.ImportItem
+	err := s.db.Where("job_id = ?", jobID).Order("position").Find(&items).Error
+	return items, err
+}
+
+// FailInterruptedImportJobs marks the import jobs left unfinished, such as
+// by a restart, as failed and returns how many there were
+func (s *store) FailInterruptedImportJobs(now time.Time) (int64, error) {
+	result := s.db.Model(&models.ImportJob{}).
+		Where("status IN ?", []string{models.ImportPending, models.ImportRunning}).
+		Updates(map[string]interface{}{
+			"status":      models.ImportFailed,
+			"error":       "import was interrupted",
+			"finished_at": now,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// ListNoteTitles returns the titles of the notes the user owns outside of
+// groups, leaving out those in the trash
+func (s *store) ListNoteTitles(userID string) ([]string, error) {
+	var titles []string
+	err := s.db.Model(&models.Note{}).
+		Where("user_id = ? AND group_id IS NULL AND deleted_at IS NULL", userID).
+		Pluck("title", &titles).Error
+	return titles, err
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// CreatePublicLink stores a new public link to a note
+func (s *store) CreatePublicLink(link *models.PublicLink) error {
+	return s.db.Create(link).Error
+}
+
+// ListPublicLinks returns the links to the note that can still be opened,
+// newest first
+func (s *store) ListPublicLinks(noteID string, now time.Time) ([]*models.PublicLink, error) {
+	var links []*models.PublicLink
+	err := s.db.Where("note_id = ? AND revoked_at IS NULL", noteID).
+		Where("expires_at IS NULL OR expires_at > ?", now).
+		Where("max_views IS NULL OR view_count < max_views").
+		Order("created_at DESC").
+		Find(&links).Error
+	return links, err
+}
+
+// GetPublicLinkByHash fetches the public link with the given token hash
+func (s *store) GetPublicLinkByHash(tokenHash string) (*models.PublicLink, error) {
+	var link models.PublicLink
+	err := s.db.Where("token_hash = ?", tokenHash).First(&link).Error
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// RecordPublicLinkView counts a view of the link, reporting false without
+// counting when the link has no views left
+func (s *store) RecordPublicLinkView(id string, now time.Time) (bool, error) {
+	result := s.db.Model(&models.PublicLink{}).
+		Where("id = ? AND (max_views IS NULL OR view_count < max_views)", id).
+		UpdateColumns(map[string]interface{}{
+			"view_count":       gorm.Expr("view_count + 1"),
+			"last_accessed_at": now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// RevokePublicLink revokes a link to the note
+func (s *store) RevokePublicLink(noteID, id string, now time.Time) error {
+	result := s.db.Model(&models.PublicLink{}).
+		Where("id = ? AND note_id = ? AND revoked_at IS NULL", id, noteID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
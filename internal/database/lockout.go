@@ -0,0 +1,128 @@
+package database
+
+import (
+	"sync"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockoutStore persists failed login tracking. Keys are "user:<name>" or
+// "ip:<addr>".
+type LockoutStore interface {
+	GetLoginAttempt(key string) (*models.LoginAttempt, error)
+	RecordLoginFailure(key string, at time.Time, window time.Duration) (*models.LoginAttempt, error)
+	LockLoginKey(key string, until time.Time) error
+	ClearLoginAttempts(key string) error
+}
+
+// GetLoginAttempt fetches the failed login state for the key
+func (s *store) GetLoginAttempt(key string) (*models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	err := s.db.Where("key = ?", key).First(&attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// RecordLoginFailure atomically counts a failed login for the key. Failures
+// older than window no longer count and the tally starts again.
+func (s *store) RecordLoginFailure(key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	attempt := &models.LoginAttempt{Key: key, Failures: 1, LastFailureAt: at}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("CASE WHEN login_attempts.last_failure_at < ? THEN 1 ELSE login_attempts.failures + 1 END", at.Add(-window)),
+			"last_failure_at": at,
+			"updated_at":      at,
+		}),
+	}).Create(attempt).Error
+	if err != nil {
+		return nil, err
+	}
+	return s.GetLoginAttempt(key)
+}
+
+// LockLoginKey locks the key until the given time
+func (s *store) LockLoginKey(key string, until time.Time) error {
+	return s.db.Model(&models.LoginAttempt{}).Where("key = ?", key).Update("locked_until", until).Error
+}
+
+// ClearLoginAttempts forgets the failures and any lock on the key
+func (s *store) ClearLoginAttempts(key string) error {
+	return s.db.Where("key = ?", key).Delete(&models.LoginAttempt{}).Error
+}
+
+// memoryLockoutStore is an in-memory implementation of LockoutStore. It can
+// be used on its own to keep lockout state out of the database.
+type memoryLockoutStore struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+// NewMemoryLockoutStore creates a new, empty in-memory lockout store
+func NewMemoryLockoutStore() LockoutStore {
+	return newMemoryLockoutStore()
+}
+
+func newMemoryLockoutStore() *memoryLockoutStore {
+	return &memoryLockoutStore{attempts: make(map[string]*models.LoginAttempt)}
+}
+
+// GetLoginAttempt fetches the failed login state for the key
+func (m *memoryLockoutStore) GetLoginAttempt(key string) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	attempt := *a
+	return &attempt, nil
+}
+
+// RecordLoginFailure counts a failed login for the key. Failures older than
+// window no longer count and the tally starts again.
+func (m *memoryLockoutStore) RecordLoginFailure(key string, at time.Time, window time.Duration) (*models.LoginAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attempts[key]
+	if !ok {
+		a = &models.LoginAttempt{Key: key}
+		m.attempts[key] = a
+	}
+	if a.LastFailureAt.Before(at.Add(-window)) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = at
+	a.UpdatedAt = at
+
+	attempt := *a
+	return &attempt, nil
+}
+
+// LockLoginKey locks the key until the given time
+func (m *memoryLockoutStore) LockLoginKey(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attempts[key]; ok {
+		a.LockedUntil = &until
+	}
+	return nil
+}
+
+// ClearLoginAttempts forgets the failures and any lock on the key
+func (m *memoryLockoutStore) ClearLoginAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+	return nil
+}
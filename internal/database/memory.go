@@ -0,0 +1,1932 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// memoryStore is an in-memory implementation of the Storer interface.
+// It is safe for concurrent use and mirrors the behaviour of the SQL backed
+// store, including soft deletes, so it can stand in for it in tests and
+// lightweight deployments.
+type memoryStore struct {
+	*memoryLockoutStore
+
+	mu          sync.RWMutex
+	users       map[string]*models.User
+	notes       map[string]*models.Note
+	sharedNotes map[string]*models.SharedNote
+	links       map[string]*models.PublicLink
+	attachments map[string]*models.Attachment
+	groups      map[string]*models.Group
+	notebooks   map[string]*models.Notebook
+	// memberships maps a group ID to its memberships by user ID
+	memberships map[string]map[string]*models.Membership
+	tags        map[string]*models.Tag
+	// noteTags maps a note ID to the IDs of its tags
+	noteTags map[string]map[string]bool
+	// revisions maps a note ID to its revisions, oldest first
+	revisions map[string][]*models.NoteRevision
+
+	refreshTokens map[string]*models.RefreshToken
+	revokedTokens map[string]time.Time
+
+	importJobs map[string]*models.ImportJob
+	// importItems maps an import job ID to its items in import order
+	importItems map[string][]*models.ImportItem
+
+	webhooks          map[string]*models.Webhook
+	webhookDeliveries map[string]*models.WebhookDelivery
+
+	auditEvents []*models.AuditEvent
+}
+
+// NewMemoryStore creates a new, empty in-memory store
+func NewMemoryStore() Storer {
+	return &memoryStore{
+		memoryLockoutStore: newMemoryLockoutStore(),
+
+		users:       make(map[string]*models.User),
+		notes:       make(map[string]*models.Note),
+		sharedNotes: make(map[string]*models.SharedNote),
+		links:       make(map[string]*models.PublicLink),
+		attachments: make(map[string]*models.Attachment),
+		groups:      make(map[string]*models.Group),
+		notebooks:   make(map[string]*models.Notebook),
+		memberships: make(map[string]map[string]*models.Membership),
+		tags:        make(map[string]*models.Tag),
+		noteTags:    make(map[string]map[string]bool),
+		revisions:   make(map[string][]*models.NoteRevision),
+
+		refreshTokens: make(map[string]*models.RefreshToken),
+		revokedTokens: make(map[string]time.Time),
+
+		importJobs:  make(map[string]*models.ImportJob),
+		importItems: make(map[string][]*models.ImportItem),
+
+		webhooks:          make(map[string]*models.Webhook),
+		webhookDeliveries: make(map[string]*models.WebhookDelivery),
+	}
+}
+
+// AutoMigrate is a no-op for the in-memory store
+func (m *memoryStore) AutoMigrate() error {
+	return nil
+}
+
+// Transaction runs fn against a copy of the store, which replaces the
+// store's contents if fn returns nil. Other writers wait for the
+// transaction to finish.
+func (m *memoryStore) Transaction(fn func(tx Storer) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := m.clone()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.adopt(tx)
+	return nil
+}
+
+// clone deep copies the contents of the store. The caller holds the lock.
+func (m *memoryStore) clone() *memoryStore {
+	c := &memoryStore{
+		memoryLockoutStore: m.memoryLockoutStore,
+
+		users:       cloneMap(m.users),
+		notes:       cloneMap(m.notes),
+		sharedNotes: cloneMap(m.sharedNotes),
+		links:       cloneMap(m.links),
+		attachments: cloneMap(m.attachments),
+		groups:      cloneMap(m.groups),
+		notebooks:   cloneMap(m.notebooks),
+		memberships: make(map[string]map[string]*models.Membership, len(m.memberships)),
+		tags:        cloneMap(m.tags),
+		noteTags:    make(map[string]map[string]bool, len(m.noteTags)),
+		revisions:   make(map[string][]*models.NoteRevision, len(m.revisions)),
+
+		refreshTokens: cloneMap(m.refreshTokens),
+		revokedTokens: make(map[string]time.Time, len(m.revokedTokens)),
+
+		importJobs:  cloneMap(m.importJobs),
+		importItems: make(map[string][]*models.ImportItem, len(m.importItems)),
+
+		webhooks:          cloneMap(m.webhooks),
+		webhookDeliveries: cloneMap(m.webhookDeliveries),
+
+		auditEvents: cloneSlice(m.auditEvents),
+	}
+	for id, memberships := range m.memberships {
+		c.memberships[id] = cloneMap(memberships)
+	}
+	for id, tags := range m.noteTags {
+		c.noteTags[id] = make(map[string]bool, len(tags))
+		for tagID := range tags {
+			c.noteTags[id][tagID] = true
+		}
+	}
+	for id, revisions := range m.revisions {
+		c.revisions[id] = cloneSlice(revisions)
+	}
+	for jti, expiresAt := range m.revokedTokens {
+		c.revokedTokens[jti] = expiresAt
+	}
+	for id, items := range m.importItems {
+		c.importItems[id] = cloneSlice(items)
+	}
+	return c
+}
+
+// adopt replaces the contents of the store with those of a committed
+// transaction. The caller holds the lock.
+func (m *memoryStore) adopt(tx *memoryStore) {
+	m.users = tx.users
+	m.notes = tx.notes
+	m.sharedNotes = tx.sharedNotes
+	m.links = tx.links
+	m.attachments = tx.attachments
+	m.groups = tx.groups
+	m.notebooks = tx.notebooks
+	m.memberships = tx.memberships
+	m.tags = tx.tags
+	m.noteTags = tx.noteTags
+	m.revisions = tx.revisions
+	m.refreshTokens = tx.refreshTokens
+	m.revokedTokens = tx.revokedTokens
+	m.importJobs = tx.importJobs
+	m.importItems = tx.importItems
+	m.webhooks = tx.webhooks
+	m.webhookDeliveries = tx.webhookDeliveries
+	m.auditEvents = tx.auditEvents
+}
+
+// cloneMap copies the map along with the values it points to
+func cloneMap[K comparable, V any](src map[K]*V) map[K]*V {
+	dst := make(map[K]*V, len(src))
+	for k, v := range src {
+		copied := *v
+		dst[k] = &copied
+	}
+	return dst
+}
+
+// cloneSlice copies the slice along with the values it points to
+func cloneSlice[V any](src []*V) []*V {
+	dst := make([]*V, len(src))
+	for i, v := range src {
+		copied := *v
+		dst[i] = &copied
+	}
+	return dst
+}
+
+// CreateNewUser creates a new user in the store
+func (m *memoryStore) CreateNewUser(user *models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user.Username == "" {
+		return errors.New("username is required")
+	}
+	for _, u := range m.users {
+		if u.Username == user.Username {
+			return errors.New("username already exists")
+		}
+	}
+
+	if user.ID == "" {
+		user.ID = models.NewID()
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	stored := *user
+	m.users[user.ID] = &stored
+	return nil
+}
+
+// GetUserByUsername fetches the user from the store by username
+func (m *memoryStore) GetUserByUsername(username string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.userByUsername(username)
+}
+
+func (m *memoryStore) userByUsername(username string) (*models.User, error) {
+	for _, u := range m.users {
+		if u.Username == username {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// GetUserByID fetches the user from the store by ID
+func (m *memoryStore) GetUserByID(id string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, ok := m.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	user := *u
+	return &user, nil
+}
+
+// CreateNewNote creates a new note in the store
+func (m *memoryStore) CreateNewNote(note *models.Note) (*models.Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if note.ID == "" {
+		note.ID = models.NewID()
+	}
+	now := time.Now()
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = now
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = now
+	}
+	if note.Version == 0 {
+		note.Version = 1
+	}
+	stored := *note
+	m.notes[note.ID] = &stored
+	m.writeRevision(&stored, note.UserID, nil)
+	return note, nil
+}
+
+// GetNoteByID fetches the note from the store by ID
+func (m *memoryStore) GetNoteByID(userId, id string) (*models.Note, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.noteByID(userId, id)
+}
+
+func (m *memoryStore) noteByID(userId, id string) (*models.Note, error) {
+	n, ok := m.notes[id]
+	if !ok || n.UserID != userId || n.DeletedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return m.note(id)
+}
+
+// GetNote fetches a note by ID whoever owns it. Callers check that the user
+// may access it.
+func (m *memoryStore) GetNote(id string) (*models.Note, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.note(id)
+}
+
+func (m *memoryStore) note(id string) (*models.Note, error) {
+	n, ok := m.notes[id]
+	if !ok || n.DeletedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	note := *n
+	note.Tags = m.tagsOf(n.ID)
+	return &note, nil
+}
+
+// ListNotes fetches a page of the notes the user owns or that were shared
+// with them
+func (m *memoryStore) ListNotes(query NoteQuery) (*NotePage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return pageInMemory(m.visibleNotes(query), nil, query)
+}
+
+// visibleNotes returns copies of the notes in the query's scope that match
+// its filters
+func (m *memoryStore) visibleNotes(query NoteQuery) []*models.Note {
+	sharedWithMe := make(map[string]bool)
+	for _, sharedNote := range m.sharedNotes {
+		if sharedNote.ToUserID == query.UserID {
+			sharedWithMe[sharedNote.NoteID] = true
+		}
+	}
+
+	var notes []*models.Note
+	for _, n := range m.notes {
+		owned := n.UserID == query.UserID && n.GroupID == nil
+		var membership *models.Membership
+		if n.GroupID != nil {
+			membership = m.memberships[*n.GroupID][query.UserID]
+		}
+		inGroup := membership != nil
+		switch {
+		case query.Trashed:
+			groupAdmin := inGroup && (membership.Role == models.GroupRoleOwner || membership.Role == models.GroupRoleAdmin)
+			if !owned && !groupAdmin {
+				continue
+			}
+		case query.Scope == ScopeOwned:
+			if !owned {
+				continue
+			}
+		case query.Scope == ScopeShared:
+			if !sharedWithMe[n.ID] {
+				continue
+			}
+		case query.Scope == ScopeGroups:
+			if !inGroup {
+				continue
+			}
+		default:
+			if !owned && !sharedWithMe[n.ID] && !inGroup {
+				continue
+			}
+		}
+		if query.GroupID != "" && (n.GroupID == nil || *n.GroupID != query.GroupID) {
+			continue
+		}
+		if len(query.NotebookIDs) > 0 && !inNotebooks(n, query.NotebookIDs) {
+			continue
+		}
+		if !matchesQuery(n, query) {
+			continue
+		}
+		tags := m.tagsOf(n.ID)
+		if len(query.Tags) > 0 {
+			names := make(map[string]bool, len(tags))
+			for _, tag := range tags {
+				names[tag.Name] = true
+			}
+			if !hasTags(names, query) {
+				continue
+			}
+		}
+		note := *n
+		note.Tags = tags
+		notes = append(notes, &note)
+	}
+	return notes
+}
+
+// DeleteNoteByID soft deletes the note. Callers check that the user may
+// delete it.
+func (m *memoryStore) DeleteNoteByID(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notes[id]
+	if !ok || n.DeletedAt != nil {
+		return nil
+	}
+	now := time.Now()
+	n.DeletedAt = &now
+	n.UpdatedAt = now
+	return nil
+}
+
+// GetDeletedNote fetches a note in the trash by ID whoever owns it.
+// Callers check that the user may access it.
+func (m *memoryStore) GetDeletedNote(id string) (*models.Note, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n, ok := m.notes[id]
+	if !ok || n.DeletedAt == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	note := *n
+	note.Tags = m.tagsOf(n.ID)
+	return &note, nil
+}
+
+// RestoreNote takes the note out of the trash
+func (m *memoryStore) RestoreNote(id string) (*models.Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notes[id]
+	if !ok || n.DeletedAt == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	n.DeletedAt = nil
+	n.UpdatedAt = time.Now()
+	return m.note(id)
+}
+
+// PurgeNote permanently deletes a note in the trash along with its shares,
+// tags, revisions and public links. Its attachments are marked as deleted
+// for their blobs to be removed.
+func (m *memoryStore) PurgeNote(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notes[id]
+	if !ok || n.DeletedAt == nil {
+		return gorm.ErrRecordNotFound
+	}
+	m.purgeNote(id)
+	return nil
+}
+
+// PurgeDeletedNotes permanently deletes the notes that were moved to the
+// trash before the given time, returning how many were deleted
+func (m *memoryStore) PurgeDeletedNotes(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, n := range m.notes {
+		if n.DeletedAt != nil && n.DeletedAt.Before(before) {
+			m.purgeNote(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// purgeNote deletes the note and everything that refers to it, except for
+// attachments which are only marked as deleted
+func (m *memoryStore) purgeNote(id string) {
+	now := time.Now()
+	for _, a := range m.attachments {
+		if a.NoteID == id && a.PurgedAt == nil {
+			a.PurgedAt = &now
+		}
+	}
+	for shareID, s := range m.sharedNotes {
+		if s.NoteID == id {
+			delete(m.sharedNotes, shareID)
+		}
+	}
+	for linkID, l := range m.links {
+		if l.NoteID == id {
+			delete(m.links, linkID)
+		}
+	}
+	delete(m.noteTags, id)
+	delete(m.revisions, id)
+	delete(m.notes, id)
+}
+
+// UpdateNoteByID updates the non-empty fields of the note and records the
+// result as a new revision by the given author, who need not be the owner.
+// Unless version is 0, the update only happens if the note is still at that
+// version, otherwise ErrVersionConflict is returned.
+func (m *memoryStore) UpdateNoteByID(authorID, id string, version int, note *models.Note) (*models.Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notes[id]
+	if ok && n.DeletedAt == nil {
+		if version != 0 && n.Version != version {
+			return nil, ErrVersionConflict
+		}
+		n.Version++
+		if note.Title != "" {
+			n.Title = note.Title
+		}
+		if note.Content != "" {
+			n.Content = note.Content
+		}
+		if note.Format != "" {
+			n.Format = note.Format
+		}
+		n.UpdatedAt = time.Now()
+		m.writeRevision(n, authorID, nil)
+	}
+
+	return m.note(id)
+}
+
+// ShareNoteWithUser shares the note with the given users in the given
+// role. Users the note is already shared with get the new role, and the
+// owner is skipped. If any username does not exist nothing is shared.
+func (m *memoryStore) ShareNoteWithUser(noteID string, fromUserID string, toUsersName []string, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var users []models.User
+	for _, toUserName := range toUsersName {
+		if toUser, err := m.userByUsername(toUserName); err == nil {
+			users = append(users, *toUser)
+		}
+	}
+	if missing := missingUsernames(toUsersName, users); len(missing) > 0 {
+		return &UnknownUsersError{Usernames: missing}
+	}
+
+	now := time.Now()
+	for _, toUser := range users {
+		if toUser.ID == fromUserID {
+			continue
+		}
+		if existing := m.noteShare(noteID, toUser.ID); existing != nil {
+			existing.Role = role
+			existing.UpdatedAt = now
+			continue
+		}
+		sharedNote := &models.SharedNote{
+			ID:         models.NewID(),
+			NoteID:     noteID,
+			FromUserID: fromUserID,
+			ToUserID:   toUser.ID,
+			Role:       role,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		m.sharedNotes[sharedNote.ID] = sharedNote
+	}
+
+	return nil
+}
+
+// GetNoteShare fetches the share of the note with the given user
+func (m *memoryStore) GetNoteShare(noteID, toUserID string) (*models.SharedNote, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := m.noteShare(noteID, toUserID)
+	if s == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	share := *s
+	return &share, nil
+}
+
+func (m *memoryStore) noteShare(noteID, toUserID string) *models.SharedNote {
+	for _, s := range m.sharedNotes {
+		if s.NoteID == noteID && s.ToUserID == toUserID {
+			return s
+		}
+	}
+	return nil
+}
+
+// shareDetails returns the shares of notes that are not deleted that pass
+// the filter, newest first
+func (m *memoryStore) shareDetails(keep func(share *models.SharedNote, note *models.Note) bool) []*ShareDetail {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	shares := []*ShareDetail{}
+	for _, s := range m.sharedNotes {
+		note, ok := m.notes[s.NoteID]
+		if !ok || note.DeletedAt != nil || !keep(s, note) {
+			continue
+		}
+		detail := &ShareDetail{SharedNote: *s, NoteTitle: note.Title}
+		if from, ok := m.users[s.FromUserID]; ok {
+			detail.FromUsername = from.Username
+		}
+		if to, ok := m.users[s.ToUserID]; ok {
+			detail.ToUsername = to.Username
+		}
+		shares = append(shares, detail)
+	}
+	sortShares(shares)
+	return shares
+}
+
+// ListNoteShares returns the shares of the note
+func (m *memoryStore) ListNoteShares(noteID string) ([]*ShareDetail, error) {
+	return m.shareDetails(func(s *models.SharedNote, _ *models.Note) bool {
+		return s.NoteID == noteID
+	}), nil
+}
+
+// ListIncomingShares returns the shares of notes with the user
+func (m *memoryStore) ListIncomingShares(userID string) ([]*ShareDetail, error) {
+	return m.shareDetails(func(s *models.SharedNote, _ *models.Note) bool {
+		return s.ToUserID == userID
+	}), nil
+}
+
+// ListOutgoingShares returns the shares of the user's notes with others
+func (m *memoryStore) ListOutgoingShares(userID string) ([]*ShareDetail, error) {
+	return m.shareDetails(func(_ *models.SharedNote, note *models.Note) bool {
+		return note.UserID == userID
+	}), nil
+}
+
+// RevokeNoteShare removes the share of the note with the user of the given
+// username
+func (m *memoryStore) RevokeNoteShare(noteID, toUsername string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	toUser, err := m.userByUsername(toUsername)
+	if err != nil {
+		return err
+	}
+	s := m.noteShare(noteID, toUser.ID)
+	if s == nil {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.sharedNotes, s.ID)
+	return nil
+}
+
+// SearchNotes fetches a page of the notes visible to the user that match
+// the full-text query
+func (m *memoryStore) SearchNotes(query NoteQuery) (*NotePage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if query.Search == nil {
+		return pageInMemory(m.visibleNotes(query), nil, query)
+	}
+	return searchInMemory(m.visibleNotes(query), query)
+}
+
+// tagsOf returns copies of the tags of the note sorted by name
+func (m *memoryStore) tagsOf(noteID string) []models.Tag {
+	tags := []models.Tag{}
+	for tagID := range m.noteTags[noteID] {
+		tags = append(tags, *m.tags[tagID])
+	}
+	sortTags(tags)
+	return tags
+}
+
+func (m *memoryStore) tagByName(userID, name string) *models.Tag {
+	for _, t := range m.tags {
+		if t.UserID == userID && t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// ensureTag returns the user's tag with the given name, creating it if
+// needed
+func (m *memoryStore) ensureTag(userID, name string, now time.Time) *models.Tag {
+	if t := m.tagByName(userID, name); t != nil {
+		return t
+	}
+	t := &models.Tag{ID: models.NewID(), UserID: userID, Name: name, CreatedAt: now, UpdatedAt: now}
+	m.tags[t.ID] = t
+	return t
+}
+
+// ownedNote returns the user's note if it exists and is not deleted
+func (m *memoryStore) ownedNote(userID, noteID string) (*models.Note, error) {
+	n, ok := m.notes[noteID]
+	if !ok || n.UserID != userID || n.DeletedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return n, nil
+}
+
+// AddNoteTags tags the user's note, creating tags that do not exist yet,
+// and returns all of its tags
+func (m *memoryStore) AddNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.ownedNote(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if m.noteTags[noteID] == nil {
+		m.noteTags[noteID] = make(map[string]bool)
+	}
+	for _, name := range names {
+		m.noteTags[noteID][m.ensureTag(userID, name, now).ID] = true
+	}
+	n.UpdatedAt = now
+	n.Version++
+	return m.tagsOf(noteID), nil
+}
+
+// RemoveNoteTags removes tags from the user's note and returns the ones
+// left. The tags themselves are kept.
+func (m *memoryStore) RemoveNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.ownedNote(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if t := m.tagByName(userID, name); t != nil {
+			delete(m.noteTags[noteID], t.ID)
+		}
+	}
+	n.UpdatedAt = time.Now()
+	n.Version++
+	return m.tagsOf(noteID), nil
+}
+
+// SetNoteTags replaces the tags of the user's note. It goes along with a
+// create or update of the note, so it does not move the note's version.
+func (m *memoryStore) SetNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.ownedNote(userID, noteID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tagIDs := make(map[string]bool, len(names))
+	for _, name := range names {
+		tagIDs[m.ensureTag(userID, name, now).ID] = true
+	}
+	m.noteTags[noteID] = tagIDs
+	return m.tagsOf(noteID), nil
+}
+
+// ListTags returns the user's tags sorted by name with the number of
+// notes, not counting deleted ones, that carry each
+func (m *memoryStore) ListTags(userID string) ([]*TagUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for noteID, tagIDs := range m.noteTags {
+		if n, ok := m.notes[noteID]; !ok || n.DeletedAt != nil {
+			continue
+		}
+		for tagID := range tagIDs {
+			counts[tagID]++
+		}
+	}
+
+	usage := []*TagUsage{}
+	for _, t := range m.tags {
+		if t.UserID == userID {
+			usage = append(usage, &TagUsage{Tag: *t, NoteCount: counts[t.ID]})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	return usage, nil
+}
+
+// RenameTag renames one of the user's tags
+func (m *memoryStore) RenameTag(userID, name, newName string) (*models.Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tagByName(userID, name)
+	if t == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if newName != name {
+		if m.tagByName(userID, newName) != nil {
+			return nil, ErrTagExists
+		}
+		t.Name = newName
+		t.UpdatedAt = time.Now()
+	}
+	tag := *t
+	return &tag, nil
+}
+
+// MergeTags moves the notes of the source tags to the target tag, created
+// if needed, and deletes the sources
+func (m *memoryStore) MergeTags(userID string, sources []string, target string) (*models.Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var from []*models.Tag
+	for _, name := range sources {
+		if t := m.tagByName(userID, name); t != nil && name != target {
+			from = append(from, t)
+		}
+	}
+	if len(from) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	into := m.ensureTag(userID, target, time.Now())
+	for _, t := range from {
+		for _, tagIDs := range m.noteTags {
+			if tagIDs[t.ID] {
+				delete(tagIDs, t.ID)
+				tagIDs[into.ID] = true
+			}
+		}
+		delete(m.tags, t.ID)
+	}
+	tag := *into
+	return &tag, nil
+}
+
+// DeleteTag removes one of the user's tags from all notes and deletes it
+func (m *memoryStore) DeleteTag(userID, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := m.tagByName(userID, name)
+	if t == nil {
+		return gorm.ErrRecordNotFound
+	}
+	for _, tagIDs := range m.noteTags {
+		delete(tagIDs, t.ID)
+	}
+	delete(m.tags, t.ID)
+	return nil
+}
+
+// writeRevision records the current title and content of the note as its
+// next revision
+func (m *memoryStore) writeRevision(note *models.Note, authorID string, restoredFrom *int) {
+	revisions := m.revisions[note.ID]
+	number := 1
+	if len(revisions) > 0 {
+		number = revisions[len(revisions)-1].Number + 1
+	}
+	m.revisions[note.ID] = append(revisions, &models.NoteRevision{
+		ID:           models.NewID(),
+		NoteID:       note.ID,
+		Number:       number,
+		AuthorID:     authorID,
+		Title:        note.Title,
+		Content:      note.Content,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    note.UpdatedAt,
+	})
+}
+
+// ListNoteRevisions returns the revisions of the note, newest first
+func (m *memoryStore) ListNoteRevisions(noteID string) ([]*models.NoteRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := m.revisions[noteID]
+	list := make([]*models.NoteRevision, 0, len(revisions))
+	for i := len(revisions) - 1; i >= 0; i-- {
+		revision := *revisions[i]
+		list = append(list, &revision)
+	}
+	return list, nil
+}
+
+// GetNoteRevision fetches a revision of the note by number
+func (m *memoryStore) GetNoteRevision(noteID string, number int) (*models.NoteRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.noteRevision(noteID, number)
+}
+
+func (m *memoryStore) noteRevision(noteID string, number int) (*models.NoteRevision, error) {
+	for _, r := range m.revisions[noteID] {
+		if r.Number == number {
+			revision := *r
+			return &revision, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// RestoreNoteRevision sets the note back to the title and content of an
+// earlier revision, recorded as a new revision by the given author
+func (m *memoryStore) RestoreNoteRevision(authorID, noteID string, number int) (*models.Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notes[noteID]
+	if !ok || n.DeletedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	revision, err := m.noteRevision(noteID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	n.Title = revision.Title
+	n.Content = revision.Content
+	n.UpdatedAt = time.Now()
+	n.Version++
+	m.writeRevision(n, authorID, &number)
+	return m.note(noteID)
+}
+
+// PruneNoteRevisions deletes the revisions of the note, or of every note
+// when noteID is empty, beyond the newest keep ones or created before the
+// given time. A zero keep or time disables that limit. The latest revision
+// of a note is never deleted.
+func (m *memoryStore) PruneNoteRevisions(noteID string, keep int, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned int64
+	for id, revisions := range m.revisions {
+		if noteID != "" && id != noteID {
+			continue
+		}
+		latest := revisions[len(revisions)-1].Number
+		kept := revisions[:0]
+		for _, r := range revisions {
+			tooMany := keep > 0 && r.Number <= latest-keep
+			tooOld := !before.IsZero() && r.CreatedAt.Before(before) && r.Number < latest
+			if tooMany || tooOld {
+				pruned++
+				continue
+			}
+			kept = append(kept, r)
+		}
+		m.revisions[id] = kept
+	}
+	return pruned, nil
+}
+
+// inNotebooks reports whether the note is filed in one of the notebooks
+func inNotebooks(n *models.Note, ids []string) bool {
+	if n.NotebookID == nil {
+		return false
+	}
+	for _, id := range ids {
+		if *n.NotebookID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// userNotebooks returns the user's notebooks
+func (m *memoryStore) userNotebooks(userID string) []*models.Notebook {
+	var notebooks []*models.Notebook
+	for _, nb := range m.notebooks {
+		if nb.UserID == userID {
+			notebooks = append(notebooks, nb)
+		}
+	}
+	return notebooks
+}
+
+func (m *memoryStore) notebook(userID, id string) (*models.Notebook, error) {
+	nb, ok := m.notebooks[id]
+	if !ok || nb.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	notebook := *nb
+	return &notebook, nil
+}
+
+// CreateNotebook stores a new notebook
+func (m *memoryStore) CreateNotebook(notebook *models.Notebook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if notebook.ID == "" {
+		notebook.ID = models.NewID()
+	}
+	now := time.Now()
+	notebook.CreatedAt, notebook.UpdatedAt = now, now
+	stored := *notebook
+	m.notebooks[notebook.ID] = &stored
+	return nil
+}
+
+// GetNotebook fetches one of the user's notebooks
+func (m *memoryStore) GetNotebook(userID, id string) (*models.Notebook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.notebook(userID, id)
+}
+
+// ListNotebooks returns the user's notebooks sorted by name, each with the
+// number of notes filed directly in it
+func (m *memoryStore) ListNotebooks(userID string) ([]*NotebookCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, n := range m.notes {
+		if n.NotebookID != nil && n.DeletedAt == nil {
+			counts[*n.NotebookID]++
+		}
+	}
+	notebooks := []*NotebookCount{}
+	for _, nb := range m.userNotebooks(userID) {
+		notebooks = append(notebooks, &NotebookCount{Notebook: *nb, NoteCount: counts[nb.ID]})
+	}
+	sort.Slice(notebooks, func(i, j int) bool {
+		if notebooks[i].Name != notebooks[j].Name {
+			return notebooks[i].Name < notebooks[j].Name
+		}
+		return notebooks[i].ID < notebooks[j].ID
+	})
+	return notebooks, nil
+}
+
+// NotebookSubtree returns the ID of one of the user's notebooks followed by
+// those of its descendants
+func (m *memoryStore) NotebookSubtree(userID, id string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return subtree(m.userNotebooks(userID), id), nil
+}
+
+// RenameNotebook renames one of the user's notebooks
+func (m *memoryStore) RenameNotebook(userID, id, name string) (*models.Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.notebook(userID, id); err != nil {
+		return nil, err
+	}
+	nb := m.notebooks[id]
+	nb.Name = name
+	nb.UpdatedAt = time.Now()
+	return m.notebook(userID, id)
+}
+
+// MoveNotebook moves one of the user's notebooks under another of their
+// notebooks, or to the top level when parentID is nil
+func (m *memoryStore) MoveNotebook(userID, id string, parentID *string) (*models.Notebook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.notebook(userID, id); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		if _, err := m.notebook(userID, *parentID); err != nil {
+			return nil, err
+		}
+		if createsCycle(m.userNotebooks(userID), id, *parentID) {
+			return nil, ErrNotebookCycle
+		}
+	}
+	nb := m.notebooks[id]
+	nb.ParentID = parentID
+	nb.UpdatedAt = time.Now()
+	return m.notebook(userID, id)
+}
+
+// DeleteNotebook deletes one of the user's notebooks with its descendants,
+// moving the notes filed in them to the trash. Notes restored from the
+// trash come back outside of any notebook. It returns the number of notes
+// moved to the trash.
+func (m *memoryStore) DeleteNotebook(userID, id string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.notebook(userID, id); err != nil {
+		return 0, err
+	}
+	ids := subtree(m.userNotebooks(userID), id)
+
+	var trashed int64
+	now := time.Now()
+	for _, n := range m.notes {
+		if n.NotebookID == nil || !inNotebooks(n, ids) {
+			continue
+		}
+		if n.DeletedAt == nil {
+			deletedAt := now
+			n.DeletedAt = &deletedAt
+			n.UpdatedAt = now
+			trashed++
+		}
+		n.NotebookID = nil
+	}
+	for _, id := range ids {
+		delete(m.notebooks, id)
+	}
+	return trashed, nil
+}
+
+// MoveNote files the note in a notebook, or in none when notebookID is nil.
+// Callers check that the user may move the note and owns the notebook.
+func (m *memoryStore) MoveNote(noteID string, notebookID *string) (*models.Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, ok := m.notes[noteID]
+	if !ok || n.DeletedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	n.NotebookID = notebookID
+	return m.note(noteID)
+}
+
+// CreateGroup creates the group with the given user as its owner
+func (m *memoryStore) CreateGroup(group *models.Group, ownerID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if group.ID == "" {
+		group.ID = models.NewID()
+	}
+	now := time.Now()
+	group.CreatedAt, group.UpdatedAt = now, now
+	stored := *group
+	m.groups[group.ID] = &stored
+	m.memberships[group.ID] = map[string]*models.Membership{
+		ownerID: {GroupID: group.ID, UserID: ownerID, Role: models.GroupRoleOwner, CreatedAt: now, UpdatedAt: now},
+	}
+	return nil
+}
+
+// ListUserGroups returns the groups the user is a member of, sorted by name
+func (m *memoryStore) ListUserGroups(userID string) ([]*GroupMembership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	groups := []*GroupMembership{}
+	for id, members := range m.memberships {
+		mine, ok := members[userID]
+		if !ok {
+			continue
+		}
+		groups = append(groups, &GroupMembership{Group: *m.groups[id], Role: mine.Role, MemberCount: int64(len(members))})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Name != groups[j].Name {
+			return groups[i].Name < groups[j].Name
+		}
+		return groups[i].ID < groups[j].ID
+	})
+	return groups, nil
+}
+
+// GetGroup fetches the group by ID
+func (m *memoryStore) GetGroup(id string) (*models.Group, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	g, ok := m.groups[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	group := *g
+	return &group, nil
+}
+
+// GetMembership fetches the membership of the user in the group
+func (m *memoryStore) GetMembership(groupID, userID string) (*models.Membership, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mb, ok := m.memberships[groupID][userID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	membership := *mb
+	return &membership, nil
+}
+
+// ListGroupMembers returns the members of the group in the order they
+// joined
+func (m *memoryStore) ListGroupMembers(groupID string) ([]*GroupMember, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	members := []*GroupMember{}
+	for userID, mb := range m.memberships[groupID] {
+		member := &GroupMember{Membership: *mb}
+		if u, ok := m.users[userID]; ok {
+			member.Username = u.Username
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].CreatedAt.Equal(members[j].CreatedAt) {
+			return members[i].CreatedAt.Before(members[j].CreatedAt)
+		}
+		return members[i].Username < members[j].Username
+	})
+	return members, nil
+}
+
+// AddGroupMember adds the user to the group in the given role
+func (m *memoryStore) AddGroupMember(groupID, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members, ok := m.memberships[groupID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if _, ok := members[userID]; ok {
+		return ErrMemberExists
+	}
+	now := time.Now()
+	members[userID] = &models.Membership{GroupID: groupID, UserID: userID, Role: role, CreatedAt: now, UpdatedAt: now}
+	return nil
+}
+
+// UpdateGroupMember changes the role of a member of the group
+func (m *memoryStore) UpdateGroupMember(groupID, userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mb, ok := m.memberships[groupID][userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	mb.Role = role
+	mb.UpdatedAt = time.Now()
+	return nil
+}
+
+// RemoveGroupMember removes the user from the group. Their access to the
+// group's notes ends with it.
+func (m *memoryStore) RemoveGroupMember(groupID, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.memberships[groupID][userID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.memberships[groupID], userID)
+	return nil
+}
+
+// CreateAttachment records an uploaded attachment, unless the uploader's
+// attachments would then take up more than quota bytes. A quota of 0 means
+// no limit.
+func (m *memoryStore) CreateAttachment(attachment *models.Attachment, quota int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if quota > 0 && m.attachmentUsage(attachment.UserID)+attachment.Size > quota {
+		return ErrQuotaExceeded
+	}
+	if attachment.ID == "" {
+		attachment.ID = models.NewID()
+	}
+	if attachment.CreatedAt.IsZero() {
+		attachment.CreatedAt = time.Now()
+	}
+	stored := *attachment
+	m.attachments[attachment.ID] = &stored
+	return nil
+}
+
+// ListAttachments returns the attachments of the note, oldest first
+func (m *memoryStore) ListAttachments(noteID string) ([]*models.Attachment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attachments := []*models.Attachment{}
+	for _, a := range m.attachments {
+		if a.NoteID == noteID && a.PurgedAt == nil {
+			attachment := *a
+			attachments = append(attachments, &attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments, nil
+}
+
+// GetAttachment fetches an attachment of the note
+func (m *memoryStore) GetAttachment(noteID, id string) (*models.Attachment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	a, ok := m.attachments[id]
+	if !ok || a.NoteID != noteID || a.PurgedAt != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	attachment := *a
+	return &attachment, nil
+}
+
+// PurgeAttachment marks an attachment of the note as deleted, leaving its
+// blob to be removed
+func (m *memoryStore) PurgeAttachment(noteID, id string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ok := m.attachments[id]
+	if !ok || a.NoteID != noteID || a.PurgedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	a.PurgedAt = &now
+	return nil
+}
+
+// ListPurgedAttachments returns up to limit deleted attachments whose blobs
+// are still to be removed
+func (m *memoryStore) ListPurgedAttachments(limit int) ([]*models.Attachment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	attachments := []*models.Attachment{}
+	for _, a := range m.attachments {
+		if a.PurgedAt != nil {
+			attachment := *a
+			attachments = append(attachments, &attachment)
+		}
+	}
+	sort.Slice(attachments, func(i, j int) bool { return attachments[i].PurgedAt.Before(*attachments[j].PurgedAt) })
+	if len(attachments) > limit {
+		attachments = attachments[:limit]
+	}
+	return attachments, nil
+}
+
+// DeletePurgedAttachment removes the record of a deleted attachment once
+// its blob is gone
+func (m *memoryStore) DeletePurgedAttachment(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if a, ok := m.attachments[id]; ok && a.PurgedAt != nil {
+		delete(m.attachments, id)
+	}
+	return nil
+}
+
+// AttachmentUsage returns the total size of the attachments uploaded by the
+// user, including those of notes in the trash
+func (m *memoryStore) AttachmentUsage(userID string) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.attachmentUsage(userID), nil
+}
+
+func (m *memoryStore) attachmentUsage(userID string) int64 {
+	var used int64
+	for _, a := range m.attachments {
+		if a.UserID == userID && a.PurgedAt == nil {
+			used += a.Size
+		}
+	}
+	return used
+}
+
+// CreatePublicLink stores a new public link to a note
+func (m *memoryStore) CreatePublicLink(link *models.PublicLink) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range m.links {
+		if l.TokenHash == link.TokenHash {
+			return errors.New("public link already exists")
+		}
+	}
+	if link.ID == "" {
+		link.ID = models.NewID()
+	}
+	if link.CreatedAt.IsZero() {
+		link.CreatedAt = time.Now()
+	}
+	stored := *link
+	m.links[link.ID] = &stored
+	return nil
+}
+
+// ListPublicLinks returns the links to the note that can still be opened,
+// newest first
+func (m *memoryStore) ListPublicLinks(noteID string, now time.Time) ([]*models.PublicLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	links := []*models.PublicLink{}
+	for _, l := range m.links {
+		if l.NoteID != noteID || l.RevokedAt != nil ||
+			(l.ExpiresAt != nil && !l.ExpiresAt.After(now)) ||
+			(l.MaxViews != nil && l.ViewCount >= *l.MaxViews) {
+			continue
+		}
+		link := *l
+		links = append(links, &link)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.After(links[j].CreatedAt) })
+	return links, nil
+}
+
+// GetPublicLinkByHash fetches the public link with the given token hash
+func (m *memoryStore) GetPublicLinkByHash(tokenHash string) (*models.PublicLink, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, l := range m.links {
+		if l.TokenHash == tokenHash {
+			link := *l
+			return &link, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// RecordPublicLinkView counts a view of the link, reporting false without
+// counting when the link has no views left
+func (m *memoryStore) RecordPublicLinkView(id string, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[id]
+	if !ok || (l.MaxViews != nil && l.ViewCount >= *l.MaxViews) {
+		return false, nil
+	}
+	l.ViewCount++
+	l.LastAccessedAt = &now
+	return true, nil
+}
+
+// RevokePublicLink revokes a link to the note
+func (m *memoryStore) RevokePublicLink(noteID, id string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.links[id]
+	if !ok || l.NoteID != noteID || l.RevokedAt != nil {
+		return gorm.ErrRecordNotFound
+	}
+	l.RevokedAt = &now
+	return nil
+}
+
+// CreateRefreshToken stores a newly issued refresh token
+func (m *memoryStore) CreateRefreshToken(token *models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, t := range m.refreshTokens {
+		if t.TokenHash == token.TokenHash {
+			return errors.New("refresh token already exists")
+		}
+	}
+	if token.ID == "" {
+		token.ID = models.NewID()
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	stored := *token
+	m.refreshTokens[token.ID] = &stored
+	return nil
+}
+
+// GetRefreshTokenByHash fetches the refresh token with the given hash
+func (m *memoryStore) GetRefreshTokenByHash(tokenHash string) (*models.RefreshToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, t := range m.refreshTokens {
+		if t.TokenHash == tokenHash {
+			token := *t
+			return &token, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// RevokeRefreshToken marks the refresh token as revoked, reporting whether it
+// was still active
+func (m *memoryStore) RevokeRefreshToken(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.refreshTokens[id]
+	if !ok || t.RevokedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	t.RevokedAt = &now
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every active refresh token in the family
+func (m *memoryStore) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range m.refreshTokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			revokedAt := now
+			t.RevokedAt = &revokedAt
+		}
+	}
+	return nil
+}
+
+// RevokeAccessToken adds the access token's jti to the denylist, pruning
+// entries for tokens that have expired on their own
+func (m *memoryStore) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for id, exp := range m.revokedTokens {
+		if exp.Before(now) {
+			delete(m.revokedTokens, id)
+		}
+	}
+	m.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+// IsAccessTokenRevoked reports whether the access token's jti is on the denylist
+func (m *memoryStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.revokedTokens[jti]
+	return ok, nil
+}
+
+// CreateImportJob records a new import job
+func (m *memoryStore) CreateImportJob(job *models.ImportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job.ID == "" {
+		job.ID = models.NewID()
+	}
+	now := time.Now()
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = now
+	}
+	if job.UpdatedAt.IsZero() {
+		job.UpdatedAt = now
+	}
+	if job.Status == "" {
+		job.Status = models.ImportPending
+	}
+	stored := *job
+	m.importJobs[job.ID] = &stored
+	return nil
+}
+
+// GetImportJob fetches an import job of the user
+func (m *memoryStore) GetImportJob(userID, id string) (*models.ImportJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	j, ok := m.importJobs[id]
+	if !ok || j.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	job := *j
+	return &job, nil
+}
+
+// ListImportJobs returns the user's import jobs, newest first
+func (m *memoryStore) ListImportJobs(userID string) ([]*models.ImportJob, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := []*models.ImportJob{}
+	for _, j := range m.importJobs {
+		if j.UserID == userID {
+			job := *j
+			jobs = append(jobs, &job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].CreatedAt.Equal(jobs[j].CreatedAt) {
+			return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// UpdateImportJob saves the status and counts of an import job
+func (m *memoryStore) UpdateImportJob(job *models.ImportJob) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.importJobs[job.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	job.UpdatedAt = time.Now()
+	stored := *job
+	m.importJobs[job.ID] = &stored
+	return nil
+}
+
+// AddImportItems records the outcome of items of an import job
+func (m *memoryStore) AddImportItems(items []*models.ImportItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range items {
+		if item.ID == "" {
+			item.ID = models.NewID()
+		}
+		stored := *item
+		m.importItems[item.JobID] = append(m.importItems[item.JobID], &stored)
+	}
+	return nil
+}
+
+// ListImportItems returns the items of an import job in import order
+func (m *memoryStore) ListImportItems(jobID string) ([]*models.ImportItem, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := make([]*models.ImportItem, 0, len(m.importItems[jobID]))
+	for _, i := range m.importItems[jobID] {
+		item := *i
+		items = append(items, &item)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Position < items[j].Position })
+	return items, nil
+}
+
+// FailInterruptedImportJobs marks the import jobs left unfinished, such as
+// by a restart, as failed and returns how many there were
+func (m *memoryStore) FailInterruptedImportJobs(now time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, job := range m.importJobs {
+		if job.Status == models.ImportPending || job.Status == models.ImportRunning {
+			job.Status = models.ImportFailed
+			job.Error = "import was interrupted"
+			finishedAt := now
+			job.FinishedAt = &finishedAt
+			job.UpdatedAt = now
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ListNoteTitles returns the titles of the notes the user owns outside of
+// groups, leaving out those in the trash
+func (m *memoryStore) ListNoteTitles(userID string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	titles := []string{}
+	for _, n := range m.notes {
+		if n.UserID == userID && n.GroupID == nil && n.DeletedAt == nil {
+			titles = append(titles, n.Title)
+		}
+	}
+	return titles, nil
+}
+
+// CreateWebhook records a new webhook
+func (m *memoryStore) CreateWebhook(hook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if hook.ID == "" {
+		hook.ID = models.NewID()
+	}
+	now := time.Now()
+	if hook.CreatedAt.IsZero() {
+		hook.CreatedAt = now
+	}
+	hook.UpdatedAt = now
+	stored := *hook
+	m.webhooks[hook.ID] = &stored
+	return nil
+}
+
+// GetWebhook fetches a webhook of the user
+func (m *memoryStore) GetWebhook(userID, id string) (*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	w, ok := m.webhooks[id]
+	if !ok || w.UserID != userID {
+		return nil, gorm.ErrRecordNotFound
+	}
+	hook := *w
+	return &hook, nil
+}
+
+// ListWebhooks returns the user's webhooks, oldest first
+func (m *memoryStore) ListWebhooks(userID string) ([]*models.Webhook, error) {
+	return m.listWebhooks(func(w *models.Webhook) bool { return w.UserID == userID })
+}
+
+// ListActiveWebhooks returns the webhooks of the given users that are not
+// disabled
+func (m *memoryStore) ListActiveWebhooks(userIDs []string) ([]*models.Webhook, error) {
+	users := make(map[string]bool, len(userIDs))
+	for _, userID := range userIDs {
+		users[userID] = true
+	}
+	return m.listWebhooks(func(w *models.Webhook) bool { return users[w.UserID] && w.DisabledAt == nil })
+}
+
+func (m *memoryStore) listWebhooks(match func(w *models.Webhook) bool) ([]*models.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hooks := []*models.Webhook{}
+	for _, w := range m.webhooks {
+		if match(w) {
+			hook := *w
+			hooks = append(hooks, &hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		if !hooks[i].CreatedAt.Equal(hooks[j].CreatedAt) {
+			return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+		}
+		return hooks[i].ID < hooks[j].ID
+	})
+	return hooks, nil
+}
+
+// UpdateWebhook saves the settings of a webhook
+func (m *memoryStore) UpdateWebhook(hook *models.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhooks[hook.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	hook.UpdatedAt = time.Now()
+	stored := *hook
+	m.webhooks[hook.ID] = &stored
+	return nil
+}
+
+// DeleteWebhook deletes a webhook of the user along with its deliveries
+func (m *memoryStore) DeleteWebhook(userID, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.webhooks[id]
+	if !ok || w.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+	delete(m.webhooks, id)
+	for deliveryID, d := range m.webhookDeliveries {
+		if d.WebhookID == id {
+			delete(m.webhookDeliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// RecordWebhookAttempt counts a delivery attempt towards the webhook's
+// consecutive failures, which a success resets. The webhook is disabled
+// when a failure brings them to disableAfter, in which case disabled is
+// true.
+func (m *memoryStore) RecordWebhookAttempt(id string, succeeded bool, disableAfter int, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w, ok := m.webhooks[id]
+	if !ok {
+		return false, nil
+	}
+	if succeeded {
+		w.ConsecutiveFailures = 0
+		return false, nil
+	}
+	w.ConsecutiveFailures++
+	if w.DisabledAt != nil || w.ConsecutiveFailures < disableAfter {
+		return false, nil
+	}
+	disabledAt := now
+	w.DisabledAt = &disabledAt
+	w.DisabledReason = "too many failed deliveries"
+	return true, nil
+}
+
+// AddWebhookDeliveries queues deliveries
+func (m *memoryStore) AddWebhookDeliveries(deliveries []*models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, delivery := range deliveries {
+		if delivery.ID == "" {
+			delivery.ID = models.NewID()
+		}
+		if delivery.Status == "" {
+			delivery.Status = models.WebhookDeliveryPending
+		}
+		delivery.CreatedAt = now
+		delivery.UpdatedAt = now
+		stored := *delivery
+		m.webhookDeliveries[delivery.ID] = &stored
+	}
+	return nil
+}
+
+// ListDueWebhookDeliveries returns up to limit pending deliveries to active
+// webhooks whose next attempt is due, oldest first. Each webhook gets at
+// most its perWebhook oldest deliveries in, and the webhooks in exclude get
+// none.
+func (m *memoryStore) ListDueWebhookDeliveries(now time.Time, exclude []string, perWebhook, limit int) ([]*DueWebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	excluded := make(map[string]bool, len(exclude))
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+	deliveries := []*DueWebhookDelivery{}
+	for _, d := range m.webhookDeliveries {
+		w, ok := m.webhooks[d.WebhookID]
+		if !ok || w.DisabledAt != nil || excluded[w.ID] || d.Status != models.WebhookDeliveryPending || d.NextAttemptAt.After(now) {
+			continue
+		}
+		deliveries = append(deliveries, &DueWebhookDelivery{WebhookDelivery: *d, URL: w.URL, Secret: w.Secret})
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		a, b := deliveries[i], deliveries[j]
+		if !a.NextAttemptAt.Equal(b.NextAttemptAt) {
+			return a.NextAttemptAt.Before(b.NextAttemptAt)
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	perWebhookDue := make(map[string]int)
+	capped := deliveries[:0]
+	for _, d := range deliveries {
+		if perWebhookDue[d.WebhookID] < perWebhook && len(capped) < limit {
+			perWebhookDue[d.WebhookID]++
+			capped = append(capped, d)
+		}
+	}
+	return capped, nil
+}
+
+// UpdateWebhookDelivery saves the outcome of a delivery attempt
+func (m *memoryStore) UpdateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.webhookDeliveries[delivery.ID]; !ok {
+		return gorm.ErrRecordNotFound
+	}
+	delivery.UpdatedAt = time.Now()
+	stored := *delivery
+	m.webhookDeliveries[delivery.ID] = &stored
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries to a webhook, newest
+// first
+func (m *memoryStore) ListWebhookDeliveries(webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	deliveries := []*models.WebhookDelivery{}
+	for _, d := range m.webhookDeliveries {
+		if d.WebhookID == webhookID {
+			delivery := *d
+			deliveries = append(deliveries, &delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// CreateAuditEvent records an audit event
+func (m *memoryStore) CreateAuditEvent(event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if event.ID == "" {
+		event.ID = models.NewID()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	stored := *event
+	m.auditEvents = append(m.auditEvents, &stored)
+	return nil
+}
+
+// ListAuditEvents fetches the most recent audit events, newest first
+func (m *memoryStore) ListAuditEvents(limit int) ([]*models.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]*models.AuditEvent, 0, limit)
+	for i := len(m.auditEvents) - 1; i >= 0 && len(events) < limit; i-- {
+		event := *m.auditEvents[i]
+		events = append(events, &event)
+	}
+	return events, nil
+}
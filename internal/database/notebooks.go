@@ -0,0 +1,174 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// ErrNotebookCycle is returned when moving a notebook into itself or one of
+// its descendants
+var ErrNotebookCycle = errors.New("notebook cannot be moved into itself")
+
+// NotebookCount is a notebook with the number of notes filed directly in
+// it, not counting deleted ones
+type NotebookCount struct {
+	models.Notebook
+	NoteCount int64
+}
+
+// subtree returns the ID of the notebook followed by those of all of its
+// descendants among the given notebooks
+func subtree(notebooks []*models.Notebook, rootID string) []string {
+	children := make(map[string][]string, len(notebooks))
+	for _, nb := range notebooks {
+		if nb.ParentID != nil {
+			children[*nb.ParentID] = append(children[*nb.ParentID], nb.ID)
+		}
+	}
+	ids := []string{rootID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// createsCycle reports whether making parentID the parent of the notebook
+// would put it inside itself
+func createsCycle(notebooks []*models.Notebook, id, parentID string) bool {
+	for _, descendant := range subtree(notebooks, id) {
+		if descendant == parentID {
+			return true
+		}
+	}
+	return false
+}
+
+// userNotebooks returns all of the user's notebooks
+func userNotebooks(tx *gorm.DB, userID string) ([]*models.Notebook, error) {
+	var notebooks []*models.Notebook
+	err := tx.Where("user_id = ?", userID).Find(&notebooks).Error
+	return notebooks, err
+}
+
+// CreateNotebook stores a new notebook
+func (s *store) CreateNotebook(notebook *models.Notebook) error {
+	return s.db.Create(notebook).Error
+}
+
+// GetNotebook fetches one of the user's notebooks
+func (s *store) GetNotebook(userID, id string) (*models.Notebook, error) {
+	var notebook models.Notebook
+	if err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&notebook).Error; err != nil {
+		return nil, err
+	}
+	return &notebook, nil
+}
+
+// ListNotebooks returns the user's notebooks sorted by name, each with the
+// number of notes filed directly in it
+func (s *store) ListNotebooks(userID string) ([]*NotebookCount, error) {
+	var notebooks []*NotebookCount
+	err := s.db.Model(&models.Notebook{}).
+		Select("notebooks.*, COUNT(notes.id) AS note_count").
+		Joins("LEFT JOIN notes ON notes.notebook_id = notebooks.id AND notes.deleted_at IS NULL").
+		Where("notebooks.user_id = ?", userID).
+		Group("notebooks.id").
+		Order("notebooks.name, notebooks.id").
+		Scan(&notebooks).Error
+	return notebooks, err
+}
+
+// NotebookSubtree returns the ID of one of the user's notebooks followed by
+// those of its descendants
+func (s *store) NotebookSubtree(userID, id string) ([]string, error) {
+	notebooks, err := userNotebooks(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return subtree(notebooks, id), nil
+}
+
+// RenameNotebook renames one of the user's notebooks
+func (s *store) RenameNotebook(userID, id, name string) (*models.Notebook, error) {
+	result := s.db.Model(&models.Notebook{}).Where("id = ? AND user_id = ?", id, userID).Update("name", name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.GetNotebook(userID, id)
+}
+
+// MoveNotebook moves one of the user's notebooks under another of their
+// notebooks, or to the top level when parentID is nil
+func (s *store) MoveNotebook(userID, id string, parentID *string) (*models.Notebook, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		notebooks, err := userNotebooks(tx, userID)
+		if err != nil {
+			return err
+		}
+		found := map[string]bool{}
+		for _, nb := range notebooks {
+			found[nb.ID] = true
+		}
+		if !found[id] || (parentID != nil && !found[*parentID]) {
+			return gorm.ErrRecordNotFound
+		}
+		if parentID != nil && createsCycle(notebooks, id, *parentID) {
+			return ErrNotebookCycle
+		}
+		return tx.Model(&models.Notebook{}).Where("id = ?", id).Update("parent_id", parentID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetNotebook(userID, id)
+}
+
+// DeleteNotebook deletes one of the user's notebooks with its descendants,
+// moving the notes filed in them to the trash. Notes restored from the
+// trash come back outside of any notebook. It returns the number of notes
+// moved to the trash.
+func (s *store) DeleteNotebook(userID, id string) (int64, error) {
+	var trashed int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND user_id = ?", id, userID).First(&models.Notebook{}).Error; err != nil {
+			return err
+		}
+		notebooks, err := userNotebooks(tx, userID)
+		if err != nil {
+			return err
+		}
+		ids := subtree(notebooks, id)
+
+		result := tx.Model(&models.Note{}).Where("notebook_id IN ? AND deleted_at IS NULL", ids).
+			Updates(map[string]interface{}{"deleted_at": time.Now(), "notebook_id": nil})
+		if result.Error != nil {
+			return result.Error
+		}
+		trashed = result.RowsAffected
+		// notes that were already in the trash lose their notebook too
+		if err := tx.Model(&models.Note{}).Where("notebook_id IN ?", ids).Update("notebook_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.Notebook{}).Error
+	})
+	return trashed, err
+}
+
+// MoveNote files the note in a notebook, or in none when notebookID is nil.
+// Callers check that the user may move the note and owns the notebook.
+func (s *store) MoveNote(noteID string, notebookID *string) (*models.Note, error) {
+	result := s.db.Model(&models.Note{}).Where("id = ? AND deleted_at IS NULL", noteID).UpdateColumn("notebook_id", notebookID)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.GetNote(noteID)
+}
@@ -0,0 +1,345 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/search"
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// Note scopes
+const (
+	ScopeAll    = "all"
+	ScopeOwned  = "owned"
+	ScopeShared = "shared"
+	ScopeGroups = "groups"
+)
+
+// Note sort keys and orders
+const (
+	SortCreatedAt = "created_at"
+	SortUpdatedAt = "updated_at"
+	SortTitle     = "title"
+	// SortRelevance orders search results by rank
+	SortRelevance = "relevance"
+
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// NoteQuery selects, orders and pages the notes visible to a user
+type NoteQuery struct {
+	UserID string
+	// Scope limits the notes to those the user owns, those shared with
+	// them, those of their groups, or all of these
+	Scope string
+	// GroupID, when set, keeps only the notes of that group
+	GroupID string
+	// NotebookIDs, when set, keeps only the notes filed in these notebooks
+	NotebookIDs []string
+	// Trashed selects the deleted notes the user may restore or purge
+	// instead of the visible ones. Scope does not apply to them.
+	Trashed bool
+	// Search, when set, keeps only notes matching the full-text query
+	Search *search.Query
+	// Tags keeps only notes carrying all (TagModeAll) or any (TagModeAny)
+	// of the tags
+	Tags    []string
+	TagMode string
+
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+
+	Sort  string
+	Order string
+	Limit int
+	// After is the position of the last note of the previous page
+	After *Cursor
+	// WithTotal asks for the number of matching notes across all pages
+	WithTotal bool
+}
+
+// Cursor is a keyset position: the sort value and ID of a note
+type Cursor struct {
+	Value string
+	ID    string
+}
+
+// NotePage is one page of notes
+type NotePage struct {
+	Notes []*models.Note
+	// Hits holds the rank and highlights of each note, in the same order,
+	// for search results
+	Hits []SearchHit
+	// Next is nil on the last page
+	Next  *Cursor
+	Total *int64
+}
+
+// sortValue returns the value of the sort key for the note, formatted so
+// that it round trips through a Cursor
+func sortValue(note *models.Note, rank float64, sortKey string) string {
+	switch sortKey {
+	case SortCreatedAt:
+		return note.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case SortTitle:
+		return note.Title
+	case SortRelevance:
+		return strconv.FormatFloat(rank, 'g', -1, 64)
+	default:
+		return note.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+// cursorValue converts the cursor value back to the type of the sort column
+func cursorValue(c *Cursor, sortKey string) (interface{}, error) {
+	switch sortKey {
+	case SortTitle:
+		return c.Value, nil
+	case SortRelevance:
+		rank, err := strconv.ParseFloat(c.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		return rank, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, c.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	// sqlite compares timestamps as text, in the zone they were written in
+	return t.Local(), nil
+}
+
+// scoped restricts a notes query to the notes visible to the user. Notes
+// the user wrote for a group are only visible while they are a member.
+func scoped(db *gorm.DB, q NoteQuery) *gorm.DB {
+	sharedWithMe := db.Session(&gorm.Session{NewDB: true}).Model(&models.SharedNote{}).Select("note_id").Where("to_user_id = ?", q.UserID)
+	myGroups := db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).Select("group_id").Where("user_id = ?", q.UserID)
+	switch q.Scope {
+	case ScopeOwned:
+		return db.Where("notes.user_id = ? AND notes.group_id IS NULL", q.UserID)
+	case ScopeShared:
+		return db.Where("notes.id IN (?)", sharedWithMe)
+	case ScopeGroups:
+		return db.Where("notes.group_id IN (?)", myGroups)
+	default:
+		return db.Where("(notes.user_id = ? AND notes.group_id IS NULL) OR notes.id IN (?) OR notes.group_id IN (?)", q.UserID, sharedWithMe, myGroups)
+	}
+}
+
+// trashScoped restricts a notes query to the notes the user may restore or
+// purge: their own and those of groups they administer
+func trashScoped(db *gorm.DB, q NoteQuery) *gorm.DB {
+	adminGroups := db.Session(&gorm.Session{NewDB: true}).Model(&models.Membership{}).Select("group_id").
+		Where("user_id = ? AND role IN ?", q.UserID, []string{models.GroupRoleOwner, models.GroupRoleAdmin})
+	return db.Where("(notes.user_id = ? AND notes.group_id IS NULL) OR notes.group_id IN (?)", q.UserID, adminGroups)
+}
+
+// filtered applies the scope, tag and date range filters of the query
+func filtered(db *gorm.DB, q NoteQuery) *gorm.DB {
+	tx := db.Model(&models.Note{})
+	if q.Trashed {
+		tx = tx.Where("notes.deleted_at IS NOT NULL").Where(trashScoped(db.Session(&gorm.Session{NewDB: true}), q))
+	} else {
+		tx = tx.Where("notes.deleted_at IS NULL").Where(scoped(db.Session(&gorm.Session{NewDB: true}), q))
+	}
+	if q.GroupID != "" {
+		tx = tx.Where("notes.group_id = ?", q.GroupID)
+	}
+	if len(q.NotebookIDs) > 0 {
+		tx = tx.Where("notes.notebook_id IN ?", q.NotebookIDs)
+	}
+	if len(q.Tags) > 0 {
+		tx = tx.Where("notes.id IN (?)", tagged(db.Session(&gorm.Session{NewDB: true}), q))
+	}
+	if q.CreatedAfter != nil {
+		tx = tx.Where("notes.created_at >= ?", q.CreatedAfter.Local())
+	}
+	if q.CreatedBefore != nil {
+		tx = tx.Where("notes.created_at < ?", q.CreatedBefore.Local())
+	}
+	if q.UpdatedAfter != nil {
+		tx = tx.Where("notes.updated_at >= ?", q.UpdatedAfter.Local())
+	}
+	if q.UpdatedBefore != nil {
+		tx = tx.Where("notes.updated_at < ?", q.UpdatedBefore.Local())
+	}
+	return tx
+}
+
+// findPage runs the query, returning one page of notes ordered by the sort
+// key with the ID as tie breaker
+func findPage(db *gorm.DB, q NoteQuery) (*NotePage, error) {
+	page := &NotePage{}
+	if q.WithTotal {
+		var total int64
+		if err := filtered(db, q).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	op, dir := ">", "ASC"
+	if q.Order == OrderDesc {
+		op, dir = "<", "DESC"
+	}
+	column := "notes." + q.Sort
+
+	tx := filtered(db, q)
+	if q.After != nil {
+		value, err := cursorValue(q.After, q.Sort)
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where(fmt.Sprintf("%s %s ? OR (%s = ? AND notes.id %s ?)", column, op, column, op), value, value, q.After.ID)
+	}
+
+	// fetch one extra row to learn whether there is a next page
+	var notes []*models.Note
+	err := tx.Order(fmt.Sprintf("%s %s, notes.id %s", column, dir, dir)).Limit(q.Limit + 1).Find(&notes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return paginate(page, notes, nil, q), nil
+}
+
+// paginate trims the extra row fetched past the limit and sets the cursor
+// of the next page. hits is nil unless the notes are search results.
+func paginate(page *NotePage, notes []*models.Note, hits []SearchHit, q NoteQuery) *NotePage {
+	if len(notes) > q.Limit {
+		notes = notes[:q.Limit]
+		last, rank := notes[len(notes)-1], 0.0
+		if hits != nil {
+			hits = hits[:q.Limit]
+			rank = hits[len(hits)-1].Rank
+		}
+		page.Next = &Cursor{Value: sortValue(last, rank, q.Sort), ID: last.ID}
+	}
+	page.Notes = notes
+	page.Hits = hits
+	return page
+}
+
+// matchesQuery reports whether the note passes the trash and date filters
+// of the query. Scope, tags and search are left to the caller.
+func matchesQuery(n *models.Note, q NoteQuery) bool {
+	if (n.DeletedAt != nil) != q.Trashed {
+		return false
+	}
+	if q.CreatedAfter != nil && n.CreatedAt.Before(*q.CreatedAfter) {
+		return false
+	}
+	if q.CreatedBefore != nil && !n.CreatedAt.Before(*q.CreatedBefore) {
+		return false
+	}
+	if q.UpdatedAfter != nil && n.UpdatedAt.Before(*q.UpdatedAfter) {
+		return false
+	}
+	if q.UpdatedBefore != nil && !n.UpdatedAt.Before(*q.UpdatedBefore) {
+		return false
+	}
+	return true
+}
+
+// pageInMemory orders, filters by cursor and pages notes that already
+// match the query, mirroring findPage. hits is nil unless the notes are
+// search results.
+func pageInMemory(notes []*models.Note, hits []SearchHit, q NoteQuery) (*NotePage, error) {
+	page := &NotePage{}
+	if q.WithTotal {
+		total := int64(len(notes))
+		page.Total = &total
+	}
+
+	rank := func(i int) float64 {
+		if hits == nil {
+			return 0
+		}
+		return hits[i].Rank
+	}
+	// compare orders a note and its rank against another, ID breaking ties
+	compare := func(a *models.Note, aRank float64, b *models.Note, bRank float64) int {
+		var cmp int
+		switch q.Sort {
+		case SortTitle:
+			cmp = strings.Compare(a.Title, b.Title)
+		case SortCreatedAt:
+			cmp = a.CreatedAt.Compare(b.CreatedAt)
+		case SortRelevance:
+			cmp = cmpFloat(aRank, bRank)
+		default:
+			cmp = a.UpdatedAt.Compare(b.UpdatedAt)
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(a.ID, b.ID)
+		}
+		if q.Order == OrderDesc {
+			return -cmp
+		}
+		return cmp
+	}
+
+	order := make([]int, len(notes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return compare(notes[order[i]], rank(order[i]), notes[order[j]], rank(order[j])) < 0
+	})
+
+	if q.After != nil {
+		value, err := cursorValue(q.After, q.Sort)
+		if err != nil {
+			return nil, err
+		}
+		pivot, pivotRank := &models.Note{ID: q.After.ID}, 0.0
+		switch v := value.(type) {
+		case string:
+			pivot.Title = v
+		case time.Time:
+			pivot.CreatedAt, pivot.UpdatedAt = v, v
+		case float64:
+			pivotRank = v
+		}
+		start := sort.Search(len(order), func(i int) bool {
+			return compare(pivot, pivotRank, notes[order[i]], rank(order[i])) < 0
+		})
+		order = order[start:]
+	}
+
+	if len(order) > q.Limit+1 {
+		order = order[:q.Limit+1]
+	}
+	sorted := make([]*models.Note, len(order))
+	var sortedHits []SearchHit
+	if hits != nil {
+		sortedHits = make([]SearchHit, len(order))
+	}
+	for i, idx := range order {
+		sorted[i] = notes[idx]
+		if hits != nil {
+			sortedHits[i] = hits[idx]
+		}
+	}
+	return paginate(page, sorted, sortedHits, q), nil
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
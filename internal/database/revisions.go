@@ -0,0 +1,120 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// writeRevision records the current title and content of the note as its
+// next revision
+func writeRevision(tx *gorm.DB, note *models.Note, authorID string, restoredFrom *int) error {
+	var last int
+	err := tx.Model(&models.NoteRevision{}).Where("note_id = ?", note.ID).Select("COALESCE(MAX(number), 0)").Scan(&last).Error
+	if err != nil {
+		return err
+	}
+	return tx.Create(&models.NoteRevision{
+		NoteID:       note.ID,
+		Number:       last + 1,
+		AuthorID:     authorID,
+		Title:        note.Title,
+		Content:      note.Content,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    note.UpdatedAt,
+	}).Error
+}
+
+// ensureBaseRevision records the note as it is before a change when it has
+// no history yet, which is the case for notes written before revisions
+// existed
+func ensureBaseRevision(tx *gorm.DB, note *models.Note) error {
+	var count int64
+	if err := tx.Model(&models.NoteRevision{}).Where("note_id = ?", note.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return writeRevision(tx, note, note.UserID, nil)
+}
+
+// ListNoteRevisions returns the revisions of the note, newest first
+func (s *store) ListNoteRevisions(noteID string) ([]*models.NoteRevision, error) {
+	var revisions []*models.NoteRevision
+	err := s.db.Where("note_id = ?", noteID).Order("number DESC").Find(&revisions).Error
+	return revisions, err
+}
+
+// GetNoteRevision fetches a revision of the note by number
+func (s *store) GetNoteRevision(noteID string, number int) (*models.NoteRevision, error) {
+	var revision models.NoteRevision
+	err := s.db.Where("note_id = ? AND number = ?", noteID, number).First(&revision).Error
+	if err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
+
+// RestoreNoteRevision sets the note back to the title and content of an
+// earlier revision, recorded as a new revision by the given author
+func (s *store) RestoreNoteRevision(authorID, noteID string, number int) (*models.Note, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var note models.Note
+		if err := tx.Where("id = ? AND deleted_at IS NULL", noteID).First(&note).Error; err != nil {
+			return err
+		}
+		var revision models.NoteRevision
+		if err := tx.Where("note_id = ? AND number = ?", noteID, number).First(&revision).Error; err != nil {
+			return err
+		}
+
+		err := tx.Model(&note).Updates(map[string]interface{}{
+			"title":   revision.Title,
+			"content": revision.Content,
+			"version": gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&note, "id = ?", noteID).Error; err != nil {
+			return err
+		}
+		return writeRevision(tx, &note, authorID, &number)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetNote(noteID)
+}
+
+// PruneNoteRevisions deletes the revisions of the note, or of every note
+// when noteID is empty, beyond the newest keep ones or created before the
+// given time. A zero keep or time disables that limit. The latest revision
+// of a note is never deleted.
+func (s *store) PruneNoteRevisions(noteID string, keep int, before time.Time) (int64, error) {
+	const latest = "(SELECT MAX(r.number) FROM note_revisions r WHERE r.note_id = note_revisions.note_id)"
+
+	var conds []string
+	var args []interface{}
+	if keep > 0 {
+		conds = append(conds, "number <= "+latest+" - ?")
+		args = append(args, keep)
+	}
+	if !before.IsZero() {
+		conds = append(conds, "(created_at < ? AND number < "+latest+")")
+		args = append(args, before.Local())
+	}
+	if len(conds) == 0 {
+		return 0, nil
+	}
+
+	tx := s.db.Where("("+strings.Join(conds, " OR ")+")", args...)
+	if noteID != "" {
+		tx = tx.Where("note_id = ?", noteID)
+	}
+	result := tx.Delete(&models.NoteRevision{})
+	return result.RowsAffected, result.Error
+}
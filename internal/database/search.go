@@ -0,0 +1,150 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/GauravMakhijani/notes/internal/search"
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// SearchHit is the relevance rank and highlighted excerpts of a note
+// matching a search. Highlights are marked with search.MarkStart and
+// search.MarkEnd.
+type SearchHit struct {
+	Rank           float64
+	TitleHighlight string
+	Snippet        string
+}
+
+// snippetWords is the approximate length of search snippets
+const snippetWords = 30
+
+// postgresSearchSetup adds a weighted tsvector column, title above content,
+// and the GIN index that full-text search runs on
+var postgresSearchSetup = []string{
+	`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(content, '')), 'B')
+	) STORED`,
+	`CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)`,
+}
+
+// headlineOptions configure ts_headline to mark matches the same way as
+// search.Query.Highlight
+var (
+	titleHeadlineOptions   = fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", search.MarkStart, search.MarkEnd)
+	snippetHeadlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d, ShortWord=2", search.MarkStart, search.MarkEnd, snippetWords, snippetWords/2)
+)
+
+// SearchNotes fetches a page of the notes visible to the user that match
+// the full-text query. Postgres uses the search_vector index; other
+// dialects evaluate the query in Go.
+func (s *store) SearchNotes(query NoteQuery) (*NotePage, error) {
+	page, err := s.searchNotes(query)
+	if err != nil {
+		return nil, err
+	}
+	return page, s.attachTags(page.Notes...)
+}
+
+func (s *store) searchNotes(query NoteQuery) (*NotePage, error) {
+	if query.Search == nil {
+		return findPage(s.db, query)
+	}
+	if s.db.Dialector.Name() != "postgres" {
+		var notes []*models.Note
+		if err := filtered(s.db, query).Find(&notes).Error; err != nil {
+			return nil, err
+		}
+		return searchInMemory(notes, query)
+	}
+
+	tsquery := query.Search.TSQuery()
+	matching := func() *gorm.DB {
+		return filtered(s.db, query).Where("notes.search_vector @@ to_tsquery('english', ?)", tsquery)
+	}
+
+	page := &NotePage{}
+	if query.WithTotal {
+		var total int64
+		if err := matching().Count(&total).Error; err != nil {
+			return nil, err
+		}
+		page.Total = &total
+	}
+
+	ranked := matching().Select("notes.*, ts_rank_cd(notes.search_vector, to_tsquery('english', ?)) AS rank", tsquery)
+
+	op, dir := ">", "ASC"
+	if query.Order == OrderDesc {
+		op, dir = "<", "DESC"
+	}
+	column := "ranked." + query.Sort
+	if query.Sort == SortRelevance {
+		column = "ranked.rank"
+	}
+	orderBy := fmt.Sprintf("%s %s, ranked.id %s", column, dir, dir)
+
+	paged := s.db.Table("(?) AS ranked", ranked)
+	if query.After != nil {
+		value, err := cursorValue(query.After, query.Sort)
+		if err != nil {
+			return nil, err
+		}
+		paged = paged.Where(fmt.Sprintf("%s %s ? OR (%s = ? AND ranked.id %s ?)", column, op, column, op), value, value, query.After.ID)
+	}
+	paged = paged.Order(orderBy).Limit(query.Limit + 1)
+
+	// headlines are costly, so only compute them for the rows of the page
+	var rows []struct {
+		models.Note
+		Rank           float64
+		TitleHighlight string
+		Snippet        string
+	}
+	err := s.db.Table("(?) AS ranked", paged).
+		Select("ranked.*, ts_headline('english', ranked.title, to_tsquery('english', ?), ?) AS title_highlight, ts_headline('english', ranked.content, to_tsquery('english', ?), ?) AS snippet",
+			tsquery, titleHeadlineOptions, tsquery, snippetHeadlineOptions).
+		Order(orderBy).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]*models.Note, len(rows))
+	hits := make([]SearchHit, len(rows))
+	for i := range rows {
+		notes[i] = &rows[i].Note
+		hits[i] = SearchHit{Rank: rows[i].Rank, TitleHighlight: rows[i].TitleHighlight, Snippet: rows[i].Snippet}
+	}
+	return paginate(page, notes, hits, query), nil
+}
+
+// searchInMemory ranks and pages the notes matching the full-text query,
+// for backends without full-text search
+func searchInMemory(candidates []*models.Note, query NoteQuery) (*NotePage, error) {
+	var notes []*models.Note
+	var hits []SearchHit
+	for _, note := range candidates {
+		rank, ok := query.Search.Match(note.Title, note.Content)
+		if !ok {
+			continue
+		}
+		notes = append(notes, note)
+		hits = append(hits, SearchHit{Rank: rank})
+	}
+	if hits == nil {
+		hits = []SearchHit{}
+	}
+
+	page, err := pageInMemory(notes, hits, query)
+	if err != nil {
+		return nil, err
+	}
+	for i, note := range page.Notes {
+		page.Hits[i].TitleHighlight = query.Search.Highlight(note.Title)
+		page.Hits[i].Snippet = query.Search.Snippet(note.Content, snippetWords)
+	}
+	return page, nil
+}
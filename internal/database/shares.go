@@ -0,0 +1,158 @@
+package database
+
+import (
+	"sort"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UnknownUsersError is returned when a note is shared with usernames that
+// do not exist. Nothing is shared in that case.
+type UnknownUsersError struct {
+	Usernames []string
+}
+
+func (e *UnknownUsersError) Error() string {
+	return "unknown users"
+}
+
+// ShareDetail is a share with the note title and the usernames of both
+// sides
+type ShareDetail struct {
+	models.SharedNote
+	NoteTitle    string
+	FromUsername string
+	ToUsername   string
+}
+
+// dedupeShares removes repeated shares of a note with the same user, which
+// older versions could create, keeping the first. It runs before the
+// unique index on shares is created.
+func dedupeShares(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.SharedNote{}) {
+		return nil
+	}
+	return db.Exec(`DELETE FROM shared_notes WHERE EXISTS (
+		SELECT 1 FROM shared_notes kept
+		WHERE kept.note_id = shared_notes.note_id AND kept.to_user_id = shared_notes.to_user_id
+		AND (kept.created_at < shared_notes.created_at OR (kept.created_at = shared_notes.created_at AND kept.id < shared_notes.id)))`).Error
+}
+
+// ShareNoteWithUser shares the note with the given users in the given
+// role. Users the note is already shared with get the new role, and the
+// owner is skipped. If any username does not exist nothing is shared.
+func (s *store) ShareNoteWithUser(noteID string, fromUserID string, toUsersName []string, role string) error {
+	if len(toUsersName) == 0 {
+		return nil
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var users []models.User
+		if err := tx.Where("username IN ?", toUsersName).Find(&users).Error; err != nil {
+			return err
+		}
+		if missing := missingUsernames(toUsersName, users); len(missing) > 0 {
+			return &UnknownUsersError{Usernames: missing}
+		}
+
+		var shares []*models.SharedNote
+		for _, user := range users {
+			if user.ID == fromUserID {
+				continue
+			}
+			shares = append(shares, &models.SharedNote{
+				NoteID:     noteID,
+				FromUserID: fromUserID,
+				ToUserID:   user.ID,
+				Role:       role,
+			})
+		}
+		if len(shares) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "note_id"}, {Name: "to_user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role", "updated_at"}),
+		}).Create(shares).Error
+	})
+}
+
+// missingUsernames returns the usernames that none of the users has,
+// sorted
+func missingUsernames(usernames []string, users []models.User) []string {
+	found := make(map[string]bool, len(users))
+	for _, user := range users {
+		found[user.Username] = true
+	}
+	var missing []string
+	for _, username := range usernames {
+		if !found[username] {
+			missing = append(missing, username)
+			found[username] = true
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// GetNoteShare fetches the share of the note with the given user
+func (s *store) GetNoteShare(noteID, toUserID string) (*models.SharedNote, error) {
+	var share models.SharedNote
+	err := s.db.Where("note_id = ? AND to_user_id = ?", noteID, toUserID).First(&share).Error
+	if err != nil {
+		return nil, err
+	}
+	return &share, nil
+}
+
+// shareDetails selects shares of notes that are not deleted along with
+// the note title and usernames, newest first
+func (s *store) shareDetails() *gorm.DB {
+	return s.db.Table("shared_notes").
+		Select("shared_notes.*, notes.title AS note_title, from_users.username AS from_username, to_users.username AS to_username").
+		Joins("JOIN notes ON notes.id = shared_notes.note_id AND notes.deleted_at IS NULL").
+		Joins("JOIN users from_users ON from_users.id = shared_notes.from_user_id").
+		Joins("JOIN users to_users ON to_users.id = shared_notes.to_user_id").
+		Order("shared_notes.created_at DESC")
+}
+
+// ListNoteShares returns the shares of the note
+func (s *store) ListNoteShares(noteID string) ([]*ShareDetail, error) {
+	var shares []*ShareDetail
+	err := s.shareDetails().Where("shared_notes.note_id = ?", noteID).Scan(&shares).Error
+	return shares, err
+}
+
+// ListIncomingShares returns the shares of notes with the user
+func (s *store) ListIncomingShares(userID string) ([]*ShareDetail, error) {
+	var shares []*ShareDetail
+	err := s.shareDetails().Where("shared_notes.to_user_id = ?", userID).Scan(&shares).Error
+	return shares, err
+}
+
+// ListOutgoingShares returns the shares of the user's notes with others
+func (s *store) ListOutgoingShares(userID string) ([]*ShareDetail, error) {
+	var shares []*ShareDetail
+	err := s.shareDetails().Where("notes.user_id = ?", userID).Scan(&shares).Error
+	return shares, err
+}
+
+// RevokeNoteShare removes the share of the note with the user of the given
+// username
+func (s *store) RevokeNoteShare(noteID, toUsername string) error {
+	toUserIDs := s.db.Model(&models.User{}).Select("id").Where("username = ?", toUsername)
+	result := s.db.Where("note_id = ? AND to_user_id IN (?)", noteID, toUserIDs).Delete(&models.SharedNote{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// sortShares orders shares newest first
+func sortShares(shares []*ShareDetail) {
+	sort.Slice(shares, func(i, j int) bool { return shares[i].CreatedAt.After(shares[j].CreatedAt) })
+}
@@ -0,0 +1,30 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// NewSQLiteStore creates a new instance of the database store backed by an
+// embedded SQLite database at the given path. Use ":memory:" for a throwaway
+// database that lives only as long as the process.
+func NewSQLiteStore(path string) Storer {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		log.Println(err)
+		panic("failed to open sqlite database")
+	}
+
+	// SQLite allows a single writer at a time, and every connection to
+	// ":memory:" opens its own private database, so share one connection.
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Println(err)
+		panic("failed to open sqlite database")
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return &store{db: db}
+}
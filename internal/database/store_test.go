@@ -0,0 +1,409 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/search"
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// eachStore runs the test against every backend that works without an
+// external server, so that they keep behaving alike
+func eachStore(t *testing.T, test func(t *testing.T, s Storer)) {
+	backends := map[string]func() Storer{
+		"memory": NewMemoryStore,
+		"sqlite": func() Storer { return NewSQLiteStore(":memory:") },
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			s := open()
+			if err := s.AutoMigrate(); err != nil {
+				t.Fatalf("migrating: %v", err)
+			}
+			test(t, s)
+		})
+	}
+}
+
+func createUser(t *testing.T, s Storer, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, PasswordHash: "hash"}
+	if err := s.CreateNewUser(user); err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user
+}
+
+func createNote(t *testing.T, s Storer, userID, title, content string) *models.Note {
+	t.Helper()
+	note, err := s.CreateNewNote(&models.Note{UserID: userID, Title: title, Content: content, Format: models.NoteFormatPlain})
+	if err != nil {
+		t.Fatalf("creating note %q: %v", title, err)
+	}
+	return note
+}
+
+func noteQuery(userID, scope string) NoteQuery {
+	return NoteQuery{UserID: userID, Scope: scope, Sort: SortCreatedAt, Order: OrderAsc, Limit: 50}
+}
+
+func titles(page *NotePage) []string {
+	var titles []string
+	for _, note := range page.Notes {
+		titles = append(titles, note.Title)
+	}
+	return titles
+}
+
+func TestUsers(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+
+		byName, err := s.GetUserByUsername("alice")
+		if err != nil || byName.ID != alice.ID {
+			t.Fatalf("GetUserByUsername = %v, %v, want user %s", byName, err, alice.ID)
+		}
+		byID, err := s.GetUserByID(alice.ID)
+		if err != nil || byID.Username != "alice" {
+			t.Fatalf("GetUserByID = %v, %v, want alice", byID, err)
+		}
+		if _, err := s.GetUserByUsername("nobody"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("GetUserByUsername of an unknown user: got %v, want ErrRecordNotFound", err)
+		}
+		if err := s.CreateNewUser(&models.User{Username: "alice", PasswordHash: "hash"}); err == nil {
+			t.Fatal("creating a second alice succeeded, want an error")
+		}
+	})
+}
+
+func TestNoteLifecycle(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		bob := createUser(t, s, "bob")
+		note := createNote(t, s, alice.ID, "Groceries", "milk")
+		if note.ID == "" || note.Version != 1 {
+			t.Fatalf("created note has ID %q and version %d, want an ID and version 1", note.ID, note.Version)
+		}
+
+		got, err := s.GetNoteByID(alice.ID, note.ID)
+		if err != nil || got.Title != "Groceries" || got.Content != "milk" {
+			t.Fatalf("GetNoteByID = %+v, %v", got, err)
+		}
+		if _, err := s.GetNoteByID(bob.ID, note.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("GetNoteByID by another user: got %v, want ErrRecordNotFound", err)
+		}
+
+		updated, err := s.UpdateNoteByID(alice.ID, note.ID, 1, &models.Note{Content: "milk, eggs"})
+		if err != nil {
+			t.Fatalf("UpdateNoteByID: %v", err)
+		}
+		if updated.Version != 2 || updated.Title != "Groceries" || updated.Content != "milk, eggs" {
+			t.Fatalf("updated note = version %d %q %q, want version 2 with the title kept", updated.Version, updated.Title, updated.Content)
+		}
+		if _, err := s.UpdateNoteByID(alice.ID, note.ID, 1, &models.Note{Content: "stale"}); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("update at a stale version: got %v, want ErrVersionConflict", err)
+		}
+		revisions, err := s.ListNoteRevisions(note.ID)
+		if err != nil || len(revisions) != 2 {
+			t.Fatalf("ListNoteRevisions = %d revisions, %v, want 2", len(revisions), err)
+		}
+
+		if err := s.DeleteNoteByID(note.ID); err != nil {
+			t.Fatalf("DeleteNoteByID: %v", err)
+		}
+		if _, err := s.GetNote(note.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("GetNote of a deleted note: got %v, want ErrRecordNotFound", err)
+		}
+		if _, err := s.GetDeletedNote(note.ID); err != nil {
+			t.Fatalf("GetDeletedNote: %v", err)
+		}
+		page, err := s.ListNotes(noteQuery(alice.ID, ScopeAll))
+		if err != nil || len(page.Notes) != 0 {
+			t.Fatalf("ListNotes after delete = %v, %v, want none", titles(page), err)
+		}
+
+		if _, err := s.RestoreNote(note.ID); err != nil {
+			t.Fatalf("RestoreNote: %v", err)
+		}
+		if _, err := s.GetNoteByID(alice.ID, note.ID); err != nil {
+			t.Fatalf("GetNoteByID after restore: %v", err)
+		}
+
+		if err := s.DeleteNoteByID(note.ID); err != nil {
+			t.Fatalf("DeleteNoteByID: %v", err)
+		}
+		if err := s.PurgeNote(note.ID); err != nil {
+			t.Fatalf("PurgeNote: %v", err)
+		}
+		if _, err := s.GetDeletedNote(note.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("GetDeletedNote of a purged note: got %v, want ErrRecordNotFound", err)
+		}
+	})
+}
+
+func TestSharing(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		bob := createUser(t, s, "bob")
+		note := createNote(t, s, alice.ID, "Plans", "")
+
+		var unknown *UnknownUsersError
+		err := s.ShareNoteWithUser(note.ID, alice.ID, []string{"bob", "carol"}, models.RoleViewer)
+		if !errors.As(err, &unknown) || len(unknown.Usernames) != 1 || unknown.Usernames[0] != "carol" {
+			t.Fatalf("sharing with an unknown user: got %v, want UnknownUsersError for carol", err)
+		}
+		if _, err := s.GetNoteShare(note.ID, bob.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("failed share left a share behind: %v", err)
+		}
+
+		if err := s.ShareNoteWithUser(note.ID, alice.ID, []string{"bob", "alice"}, models.RoleViewer); err != nil {
+			t.Fatalf("ShareNoteWithUser: %v", err)
+		}
+		if err := s.ShareNoteWithUser(note.ID, alice.ID, []string{"bob"}, models.RoleEditor); err != nil {
+			t.Fatalf("ShareNoteWithUser again: %v", err)
+		}
+		share, err := s.GetNoteShare(note.ID, bob.ID)
+		if err != nil || share.Role != models.RoleEditor {
+			t.Fatalf("GetNoteShare = %+v, %v, want the editor role", share, err)
+		}
+		shares, err := s.ListNoteShares(note.ID)
+		if err != nil || len(shares) != 1 {
+			t.Fatalf("ListNoteShares = %d shares, %v, want only bob's", len(shares), err)
+		}
+
+		page, err := s.ListNotes(noteQuery(bob.ID, ScopeShared))
+		if err != nil || len(page.Notes) != 1 || page.Notes[0].ID != note.ID {
+			t.Fatalf("bob's shared notes = %v, %v, want Plans", titles(page), err)
+		}
+		page, err = s.ListNotes(noteQuery(bob.ID, ScopeOwned))
+		if err != nil || len(page.Notes) != 0 {
+			t.Fatalf("bob's owned notes = %v, %v, want none", titles(page), err)
+		}
+
+		if err := s.RevokeNoteShare(note.ID, "bob"); err != nil {
+			t.Fatalf("RevokeNoteShare: %v", err)
+		}
+		if err := s.RevokeNoteShare(note.ID, "bob"); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("revoking twice: got %v, want ErrRecordNotFound", err)
+		}
+		page, err = s.ListNotes(noteQuery(bob.ID, ScopeAll))
+		if err != nil || len(page.Notes) != 0 {
+			t.Fatalf("bob's notes after revoke = %v, %v, want none", titles(page), err)
+		}
+	})
+}
+
+func TestSearchNotes(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		bob := createUser(t, s, "bob")
+		createNote(t, s, alice.ID, "Groceries", "milk and bread")
+		createNote(t, s, alice.ID, "Bread recipe", "flour, water, salt")
+		createNote(t, s, alice.ID, "Holidays", "beach")
+		createNote(t, s, bob.ID, "Bob's bread", "rye")
+
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"bread", []string{"Bread recipe", "Groceries"}},
+			{"milk bread", []string{"Groceries"}},
+			{`"milk and"`, []string{"Groceries"}},
+			{"bread -milk", []string{"Bread recipe"}},
+			{"rye", nil},
+		}
+		for _, tt := range tests {
+			q, err := search.Parse(tt.query)
+			if err != nil {
+				t.Fatalf("parsing %q: %v", tt.query, err)
+			}
+			query := noteQuery(alice.ID, ScopeAll)
+			query.Search, query.Sort, query.Order = q, SortTitle, OrderAsc
+			page, err := s.SearchNotes(query)
+			if err != nil {
+				t.Fatalf("searching %q: %v", tt.query, err)
+			}
+			if got := titles(page); !equalStrings(got, tt.want) {
+				t.Errorf("searching %q = %v, want %v", tt.query, got, tt.want)
+			}
+			if len(page.Hits) != len(page.Notes) {
+				t.Errorf("searching %q returned %d hits for %d notes", tt.query, len(page.Hits), len(page.Notes))
+			}
+		}
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		failure := errors.New("failure")
+
+		err := s.Transaction(func(tx Storer) error {
+			createNote(t, tx, alice.ID, "Rolled back", "")
+			if page, err := tx.ListNotes(noteQuery(alice.ID, ScopeAll)); err != nil || len(page.Notes) != 1 {
+				t.Errorf("note not visible inside its transaction: %v, %v", titles(page), err)
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("Transaction = %v, want the error of fn", err)
+		}
+		page, err := s.ListNotes(noteQuery(alice.ID, ScopeAll))
+		if err != nil || len(page.Notes) != 0 {
+			t.Fatalf("notes after rollback = %v, %v, want none", titles(page), err)
+		}
+
+		err = s.Transaction(func(tx Storer) error {
+			createNote(t, tx, alice.ID, "Kept", "")
+			inner := tx.Transaction(func(tx Storer) error {
+				createNote(t, tx, alice.ID, "Undone", "")
+				return failure
+			})
+			if !errors.Is(inner, failure) {
+				t.Errorf("inner Transaction = %v, want the error of fn", inner)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Transaction: %v", err)
+		}
+		page, err = s.ListNotes(noteQuery(alice.ID, ScopeAll))
+		if err != nil || !equalStrings(titles(page), []string{"Kept"}) {
+			t.Fatalf("notes after a failed inner transaction = %v, %v, want [Kept]", titles(page), err)
+		}
+	})
+}
+
+// TestMemoryTransactionIsolated checks that a memory transaction works on
+// a copy: changes to what it read do not reach the store unless it commits
+func TestMemoryTransactionIsolated(t *testing.T) {
+	s := NewMemoryStore()
+	alice := createUser(t, s, "alice")
+	note := createNote(t, s, alice.ID, "Original", "")
+
+	s.Transaction(func(tx Storer) error {
+		tx.UpdateNoteByID(alice.ID, note.ID, 0, &models.Note{Title: "Changed"})
+		tx.DeleteNoteByID(note.ID)
+		return errors.New("failure")
+	})
+
+	got, err := s.GetNote(note.ID)
+	if err != nil {
+		t.Fatalf("note deleted by a rolled back transaction: %v", err)
+	}
+	if got.Title != "Original" || got.Version != 1 {
+		t.Fatalf("note after rollback = %q version %d, want Original version 1", got.Title, got.Version)
+	}
+	revisions, err := s.ListNoteRevisions(note.ID)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("revisions after rollback = %d, %v, want 1", len(revisions), err)
+	}
+}
+
+func TestListNotesPagination(t *testing.T) {
+	// sqlite compares timestamps as text in the zone they were written in,
+	// which must not trip up cursors, whose times are UTC
+	local := time.Local
+	time.Local = time.FixedZone("UTC+5", 5*60*60)
+	defer func() { time.Local = local }()
+
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		start := time.Date(2024, 3, 1, 23, 30, 0, 123456789, time.Local)
+		// ties on every sort key, across pages of 2
+		notes := []struct {
+			title   string
+			created time.Duration
+			updated time.Duration
+		}{
+			{"b", 0, time.Hour},
+			{"a", 0, time.Hour},
+			{"a", time.Microsecond, 0},
+			{"c", time.Millisecond, time.Hour},
+			{"a", time.Millisecond, 2 * time.Hour},
+			{"B", time.Hour, time.Millisecond},
+			{"c", 0, 0},
+		}
+		var created []*models.Note
+		for _, n := range notes {
+			note, err := s.CreateNewNote(&models.Note{
+				UserID:    alice.ID,
+				Title:     n.title,
+				Format:    models.NoteFormatPlain,
+				CreatedAt: start.Add(n.created),
+				UpdatedAt: start.Add(n.updated),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			created = append(created, note)
+		}
+
+		for _, sortKey := range []string{SortCreatedAt, SortUpdatedAt, SortTitle} {
+			for _, order := range []string{OrderAsc, OrderDesc} {
+				want := make([]*models.Note, len(created))
+				copy(want, created)
+				sort.Slice(want, func(i, j int) bool {
+					a, b := sortValue(want[i], 0, sortKey), sortValue(want[j], 0, sortKey)
+					if a == b {
+						a, b = want[i].ID, want[j].ID
+					}
+					if order == OrderDesc {
+						return a > b
+					}
+					return a < b
+				})
+
+				q := NoteQuery{UserID: alice.ID, Scope: ScopeOwned, Sort: sortKey, Order: order, Limit: 2, WithTotal: true}
+				var got []string
+				for pages := 0; ; pages++ {
+					if pages > len(created) {
+						t.Fatalf("%s %s: paging does not end", sortKey, order)
+					}
+					page, err := s.ListNotes(q)
+					if err != nil {
+						t.Fatalf("%s %s: %v", sortKey, order, err)
+					}
+					if page.Total == nil || *page.Total != int64(len(created)) {
+						t.Fatalf("%s %s: total %v, want %d", sortKey, order, page.Total, len(created))
+					}
+					for _, note := range page.Notes {
+						got = append(got, note.ID)
+					}
+					if page.Next == nil {
+						break
+					}
+					q.After = page.Next
+				}
+
+				var wantIDs []string
+				for _, note := range want {
+					wantIDs = append(wantIDs, note.ID)
+				}
+				if !equalStrings(got, wantIDs) {
+					t.Errorf("paging by %s %s gave %v, want %v", sortKey, order, got, wantIDs)
+				}
+			}
+		}
+
+		if _, err := s.ListNotes(NoteQuery{UserID: alice.ID, Sort: SortCreatedAt, Limit: 2, After: &Cursor{Value: "yesterday"}}); err == nil {
+			t.Error("listing after an invalid cursor succeeded")
+		}
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tag filter modes
+const (
+	// TagModeAll keeps notes carrying every tag of the filter
+	TagModeAll = "and"
+	// TagModeAny keeps notes carrying at least one tag of the filter
+	TagModeAny = "or"
+)
+
+// ErrTagExists is returned when renaming a tag to a name the user already
+// uses
+var ErrTagExists = errors.New("tag already exists")
+
+// TagUsage is a tag and the number of notes carrying it
+type TagUsage struct {
+	models.Tag
+	NoteCount int64
+}
+
+// attachTags loads the tags of the notes, sorted by name
+func (s *store) attachTags(notes ...*models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	ids := make([]string, len(notes))
+	byID := make(map[string][]*models.Note, len(notes))
+	for i, note := range notes {
+		ids[i] = note.ID
+		byID[note.ID] = append(byID[note.ID], note)
+		note.Tags = []models.Tag{}
+	}
+
+	var rows []struct {
+		NoteID string
+		models.Tag
+	}
+	err := s.db.Table("tags").
+		Select("note_tags.note_id, tags.*").
+		Joins("JOIN note_tags ON note_tags.tag_id = tags.id").
+		Where("note_tags.note_id IN ?", ids).
+		Order("tags.name").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		for _, note := range byID[row.NoteID] {
+			note.Tags = append(note.Tags, row.Tag)
+		}
+	}
+	return nil
+}
+
+// ownedNote checks that the note exists, is not deleted and belongs to the
+// user
+func ownedNote(tx *gorm.DB, userID, noteID string) error {
+	var note models.Note
+	return tx.Select("id").Where("id = ? AND user_id = ? AND deleted_at IS NULL", noteID, userID).First(&note).Error
+}
+
+// ensureTags returns the user's tags with the given names, creating the
+// missing ones
+func ensureTags(tx *gorm.DB, userID string, names []string) ([]models.Tag, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	tags := make([]models.Tag, len(names))
+	for i, name := range names {
+		tags[i] = models.Tag{UserID: userID, Name: name}
+	}
+	// a concurrent request may create the same tag, which is fine
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	tags = nil
+	err := tx.Where("user_id = ? AND name IN ?", userID, names).Find(&tags).Error
+	return tags, err
+}
+
+// noteTags returns the tags of the note sorted by name
+func noteTags(tx *gorm.DB, noteID string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	err := tx.Joins("JOIN note_tags ON note_tags.tag_id = tags.id").
+		Where("note_tags.note_id = ?", noteID).
+		Order("tags.name").
+		Find(&tags).Error
+	return tags, err
+}
+
+// linkTags attaches the tags to the note
+func linkTags(tx *gorm.DB, noteID string, tags []models.Tag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	now := time.Now()
+	links := make([]models.NoteTag, len(tags))
+	for i, tag := range tags {
+		links[i] = models.NoteTag{NoteID: noteID, TagID: tag.ID, CreatedAt: now}
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&links).Error
+}
+
+// touchNote marks the note updated, moving it to a new version
+func touchNote(tx *gorm.DB, noteID string) error {
+	return tx.Model(&models.Note{}).Where("id = ?", noteID).UpdateColumns(map[string]interface{}{
+		"updated_at": time.Now(),
+		"version":    gorm.Expr("version + 1"),
+	}).Error
+}
+
+// AddNoteTags tags the user's note, creating tags that do not exist yet,
+// and returns all of its tags
+func (s *store) AddNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	var result []models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ownedNote(tx, userID, noteID); err != nil {
+			return err
+		}
+		tags, err := ensureTags(tx, userID, names)
+		if err != nil {
+			return err
+		}
+		if err := linkTags(tx, noteID, tags); err != nil {
+			return err
+		}
+		if err := touchNote(tx, noteID); err != nil {
+			return err
+		}
+		result, err = noteTags(tx, noteID)
+		return err
+	})
+	return result, err
+}
+
+// RemoveNoteTags removes tags from the user's note and returns the ones
+// left. The tags themselves are kept.
+func (s *store) RemoveNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	var result []models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ownedNote(tx, userID, noteID); err != nil {
+			return err
+		}
+		tagIDs := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Tag{}).Select("id").Where("user_id = ? AND name IN ?", userID, names)
+		if err := tx.Where("note_id = ? AND tag_id IN (?)", noteID, tagIDs).Delete(&models.NoteTag{}).Error; err != nil {
+			return err
+		}
+		if err := touchNote(tx, noteID); err != nil {
+			return err
+		}
+		var err error
+		result, err = noteTags(tx, noteID)
+		return err
+	})
+	return result, err
+}
+
+// SetNoteTags replaces the tags of the user's note. It goes along with a
+// create or update of the note, so it does not move the note's version.
+func (s *store) SetNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	var result []models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := ownedNote(tx, userID, noteID); err != nil {
+			return err
+		}
+		tags, err := ensureTags(tx, userID, names)
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("note_id = ?", noteID).Delete(&models.NoteTag{}).Error; err != nil {
+			return err
+		}
+		if err := linkTags(tx, noteID, tags); err != nil {
+			return err
+		}
+		result, err = noteTags(tx, noteID)
+		return err
+	})
+	return result, err
+}
+
+// ListTags returns the user's tags sorted by name with the number of
+// notes, not counting deleted ones, that carry each
+func (s *store) ListTags(userID string) ([]*TagUsage, error) {
+	var usage []*TagUsage
+	err := s.db.Model(&models.Tag{}).
+		Select("tags.*, COUNT(notes.id) AS note_count").
+		Joins("LEFT JOIN note_tags ON note_tags.tag_id = tags.id").
+		Joins("LEFT JOIN notes ON notes.id = note_tags.note_id AND notes.deleted_at IS NULL").
+		Where("tags.user_id = ?", userID).
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&usage).Error
+	return usage, err
+}
+
+// RenameTag renames one of the user's tags
+func (s *store) RenameTag(userID, name, newName string) (*models.Tag, error) {
+	var tag models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND name = ?", userID, name).First(&tag).Error; err != nil {
+			return err
+		}
+		if newName == name {
+			return nil
+		}
+		var taken int64
+		if err := tx.Model(&models.Tag{}).Where("user_id = ? AND name = ?", userID, newName).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return ErrTagExists
+		}
+		tag.Name = newName
+		return tx.Model(&tag).Update("name", newName).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
+
+// MergeTags moves the notes of the source tags to the target tag, created
+// if needed, and deletes the sources
+func (s *store) MergeTags(userID string, sources []string, target string) (*models.Tag, error) {
+	var into models.Tag
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var from []models.Tag
+		if err := tx.Where("user_id = ? AND name IN ? AND name <> ?", userID, sources, target).Find(&from).Error; err != nil {
+			return err
+		}
+		if len(from) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		tags, err := ensureTags(tx, userID, []string{target})
+		if err != nil {
+			return err
+		}
+		into = tags[0]
+
+		fromIDs := make([]string, len(from))
+		for i, tag := range from {
+			fromIDs[i] = tag.ID
+		}
+		err = tx.Exec("INSERT INTO note_tags (note_id, tag_id, created_at) SELECT note_id, ?, ? FROM note_tags WHERE tag_id IN ? ON CONFLICT DO NOTHING", into.ID, time.Now(), fromIDs).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id IN ?", fromIDs).Delete(&models.NoteTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", fromIDs).Delete(&models.Tag{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &into, nil
+}
+
+// DeleteTag removes one of the user's tags from all notes and deletes it
+func (s *store) DeleteTag(userID, name string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var tag models.Tag
+		if err := tx.Where("user_id = ? AND name = ?", userID, name).First(&tag).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tag_id = ?", tag.ID).Delete(&models.NoteTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+}
+
+// tagged restricts a notes query to the notes carrying the tags of the
+// query
+func tagged(db *gorm.DB, q NoteQuery) *gorm.DB {
+	withTags := db.Table("note_tags").
+		Select("note_tags.note_id").
+		Joins("JOIN tags ON tags.id = note_tags.tag_id").
+		Where("tags.name IN ?", q.Tags)
+	if q.TagMode == TagModeAll {
+		withTags = withTags.Group("note_tags.note_id").Having("COUNT(DISTINCT tags.name) = ?", len(q.Tags))
+	}
+	return withTags
+}
+
+// hasTags reports whether a note with the given tag names passes the tag
+// filter of the query
+func hasTags(names map[string]bool, q NoteQuery) bool {
+	if len(q.Tags) == 0 {
+		return true
+	}
+	for _, name := range q.Tags {
+		switch {
+		case names[name] && q.TagMode != TagModeAll:
+			return true
+		case !names[name] && q.TagMode == TagModeAll:
+			return false
+		}
+	}
+	return q.TagMode == TagModeAll
+}
+
+// sortTags orders tags by name
+func sortTags(tags []models.Tag) {
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// migrateDeletedFlag moves notes deleted before DeletedAt existed to the
+// trash, dated by their last update, and drops the old is_deleted flag
+func migrateDeletedFlag(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Note{}, "is_deleted") {
+		return nil
+	}
+	err := db.Exec("UPDATE notes SET deleted_at = updated_at WHERE is_deleted = ? AND deleted_at IS NULL", true).Error
+	if err != nil {
+		return err
+	}
+	return db.Migrator().DropColumn(&models.Note{}, "is_deleted")
+}
+
+// GetDeletedNote fetches a note in the trash by ID whoever owns it.
+// Callers check that the user may access it.
+func (s *store) GetDeletedNote(id string) (*models.Note, error) {
+	var note models.Note
+	err := s.db.Where("id = ? AND deleted_at IS NOT NULL", id).First(&note).Error
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachTags(&note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// RestoreNote takes the note out of the trash
+func (s *store) RestoreNote(id string) (*models.Note, error) {
+	result := s.db.Model(&models.Note{}).Where("id = ? AND deleted_at IS NOT NULL", id).Update("deleted_at", nil)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return s.GetNote(id)
+}
+
+// PurgeNote permanently deletes a note in the trash along with its shares,
+// tags, revisions and public links. Its attachments are marked as deleted
+// for their blobs to be removed.
+func (s *store) PurgeNote(id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.Note{}).Where("id = ? AND deleted_at IS NOT NULL", id).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return purgeNotes(tx, []string{id})
+	})
+}
+
+// PurgeDeletedNotes permanently deletes the notes that were moved to the
+// trash before the given time, returning how many were deleted
+func (s *store) PurgeDeletedNotes(before time.Time) (int64, error) {
+	var purged int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		if err := tx.Model(&models.Note{}).Where("deleted_at < ?", before).Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		purged = int64(len(ids))
+		if len(ids) == 0 {
+			return nil
+		}
+		return purgeNotes(tx, ids)
+	})
+	return purged, err
+}
+
+// purgeNotes deletes the notes and every row that refers to them, except
+// for attachments which are only marked as deleted
+func purgeNotes(tx *gorm.DB, ids []string) error {
+	err := tx.Model(&models.Attachment{}).Where("note_id IN ? AND purged_at IS NULL", ids).Update("purged_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	dependents := []interface{}{&models.SharedNote{}, &models.NoteTag{}, &models.NoteRevision{}, &models.PublicLink{}}
+	for _, model := range dependents {
+		if err := tx.Where("note_id IN ?", ids).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Where("id IN ?", ids).Delete(&models.Note{}).Error
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// DueWebhookDelivery is a delivery along with the endpoint it goes to
+type DueWebhookDelivery struct {
+	models.WebhookDelivery
+	URL    string
+	Secret string
+}
+
+// CreateWebhook records a new webhook
+func (s *store) CreateWebhook(hook *models.Webhook) error {
+	return s.db.Create(hook).Error
+}
+
+// GetWebhook fetches a webhook of the user
+func (s *store) GetWebhook(userID, id string) (*models.Webhook, error) {
+	var hook models.Webhook
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&hook).Error
+	if err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// ListWebhooks returns the user's webhooks, oldest first
+func (s *store) ListWebhooks(userID string) ([]*models.Webhook, error) {
+	var hooks []*models.Webhook
+	err := s.db.Where("user_id = ?", userID).Order("created_at, id").Find(&hooks).Error
+	return hooks, err
+}
+
+// ListActiveWebhooks returns the webhooks of the given users that are not
+// disabled
+func (s *store) ListActiveWebhooks(userIDs []string) ([]*models.Webhook, error) {
+	var hooks []*models.Webhook
+	err := s.db.Where("user_id IN ? AND disabled_at IS NULL", userIDs).Order("created_at, id").Find(&hooks).Error
+	return hooks, err
+}
+
+// UpdateWebhook saves the settings of a webhook
+func (s *store) UpdateWebhook(hook *models.Webhook) error {
+	return s.db.Save(hook).Error
+}
+
+// DeleteWebhook deletes a webhook of the user along with its deliveries
+func (s *store) DeleteWebhook(userID, id string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&models.Webhook{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Where("webhook_id = ?", id).Delete(&models.WebhookDelivery{}).Error
+	})
+}
+
+// RecordWebhookAttempt counts a delivery attempt towards the webhook's
+// consecutive failures, which a success resets. The webhook is disabled
+// when a failure brings them to disableAfter, in which case disabled is
+// true.
+func (s *store) RecordWebhookAttempt(id string, succeeded bool, disableAfter int, now time.Time) (bool, error) {
+	if succeeded {
+		err := s.db.Model(&models.Webhook{}).Where("id = ? AND consecutive_failures > 0", id).
+			Update("consecutive_failures", 0).Error
+		return false, err
+	}
+
+	disabled := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Webhook{}).Where("id = ?", id).
+			Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error
+		if err != nil {
+			return err
+		}
+		result := tx.Model(&models.Webhook{}).
+			Where("id = ? AND disabled_at IS NULL AND consecutive_failures >= ?", id, disableAfter).
+			Updates(map[string]interface{}{
+				"disabled_at":     now,
+				"disabled_reason": "too many failed deliveries",
+			})
+		disabled = result.RowsAffected > 0
+		return result.Error
+	})
+	return disabled, err
+}
+
+// AddWebhookDeliveries queues deliveries
+func (s *store) AddWebhookDeliveries(deliveries []*models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return s.db.Create(&deliveries).Error
+}
+
+// ListDueWebhookDeliveries returns up to limit pending deliveries to active
+// webhooks whose next attempt is due, oldest first. Each webhook gets at
+// most its perWebhook oldest deliveries in, so that a backlogged one does
+// not crowd out the others, and the webhooks in exclude get none.
+func (s *store) ListDueWebhookDeliveries(now time.Time, exclude []string, perWebhook, limit int) ([]*DueWebhookDelivery, error) {
+	due := s.db.Model(&models.WebhookDelivery{}).
+		Select(`webhook_deliveries.*, webhooks.url, webhooks.secret,
+			ROW_NUMBER() OVER (PARTITION BY webhook_deliveries.webhook_id
+				ORDER BY webhook_deliveries.next_attempt_at, webhook_deliveries.created_at, webhook_deliveries.id) AS due_rank`).
+		Joins("JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id").
+		Where("webhook_deliveries.status = ? AND webhook_deliveries.next_attempt_at <= ? AND webhooks.disabled_at IS NULL", models.WebhookDeliveryPending, now)
+	if len(exclude) > 0 {
+		due = due.Where("webhook_deliveries.webhook_id NOT IN ?", exclude)
+	}
+
+	var deliveries []*DueWebhookDelivery
+	err := s.db.Table("(?) AS due", due).
+		Where("due_rank <= ?", perWebhook).
+		Order("next_attempt_at, created_at, id").
+		Limit(limit).
+		Scan(&deliveries).Error
+	return deliveries, err
+}
+
+// UpdateWebhookDelivery saves the outcome of a delivery attempt
+func (s *store) UpdateWebhookDelivery(delivery *models.WebhookDelivery) error {
+	return s.db.Save(delivery).Error
+}
+
+// ListWebhookDeliveries returns the latest deliveries to a webhook, newest
+// first
+func (s *store) ListWebhookDeliveries(webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	var deliveries []*models.WebhookDelivery
+	err := s.db.Where("webhook_id = ?", webhookID).
+		Order("created_at DESC, id").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
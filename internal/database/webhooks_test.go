@@ -0,0 +1,135 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/models"
+)
+
+func TestListDueWebhookDeliveries(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		now := time.Now()
+
+		hook := func(url string) *models.Webhook {
+			t.Helper()
+			hook := &models.Webhook{UserID: alice.ID, URL: url, Secret: "secret"}
+			if err := s.CreateWebhook(hook); err != nil {
+				t.Fatalf("CreateWebhook: %v", err)
+			}
+			return hook
+		}
+		backlogged, quiet, disabled := hook("http://backlogged"), hook("http://quiet"), hook("http://disabled")
+		disabled.DisabledAt = &now
+		if err := s.UpdateWebhook(disabled); err != nil {
+			t.Fatalf("UpdateWebhook: %v", err)
+		}
+
+		var deliveries []*models.WebhookDelivery
+		queue := func(hook *models.Webhook, eventID uint64, nextAttemptAt time.Time) {
+			deliveries = append(deliveries, &models.WebhookDelivery{
+				WebhookID:     hook.ID,
+				EventID:       eventID,
+				EventType:     "note.created",
+				Payload:       "{}",
+				Status:        models.WebhookDeliveryPending,
+				NextAttemptAt: nextAttemptAt,
+			})
+		}
+		for i := 0; i < 5; i++ {
+			queue(backlogged, uint64(i+1), now.Add(time.Duration(i-10)*time.Second))
+		}
+		queue(quiet, 10, now.Add(-time.Second))
+		queue(quiet, 11, now.Add(time.Hour))
+		queue(disabled, 12, now.Add(-time.Minute))
+		if err := s.AddWebhookDeliveries(deliveries); err != nil {
+			t.Fatalf("AddWebhookDeliveries: %v", err)
+		}
+
+		eventIDs := func(due []*DueWebhookDelivery) []uint64 {
+			var ids []uint64
+			for _, d := range due {
+				ids = append(ids, d.EventID)
+			}
+			return ids
+		}
+		tests := []struct {
+			name       string
+			exclude    []string
+			perWebhook int
+			limit      int
+			want       []uint64
+		}{
+			{"all due", nil, 10, 10, []uint64{1, 2, 3, 4, 5, 10}},
+			{"capped per webhook", nil, 2, 10, []uint64{1, 2, 10}},
+			{"limited", nil, 10, 3, []uint64{1, 2, 3}},
+			{"excluding a webhook", []string{backlogged.ID}, 10, 10, []uint64{10}},
+		}
+		for _, tt := range tests {
+			due, err := s.ListDueWebhookDeliveries(now, tt.exclude, tt.perWebhook, tt.limit)
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			got := eventIDs(due)
+			if len(got) != len(tt.want) {
+				t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+				continue
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("%s: got events %v, want %v", tt.name, got, tt.want)
+					break
+				}
+			}
+		}
+
+		due, err := s.ListDueWebhookDeliveries(now, nil, 1, 10)
+		if err != nil || len(due) != 2 || due[0].URL != "http://backlogged" || due[0].Secret != "secret" {
+			t.Fatalf("due deliveries do not carry the endpoint: %+v, %v", due, err)
+		}
+	})
+}
+
+func TestRecordWebhookAttempt(t *testing.T) {
+	eachStore(t, func(t *testing.T, s Storer) {
+		alice := createUser(t, s, "alice")
+		hook := &models.Webhook{UserID: alice.ID, URL: "http://hook", Secret: "secret"}
+		if err := s.CreateWebhook(hook); err != nil {
+			t.Fatalf("CreateWebhook: %v", err)
+		}
+		record := func(succeeded bool) bool {
+			t.Helper()
+			disabled, err := s.RecordWebhookAttempt(hook.ID, succeeded, 3, time.Now())
+			if err != nil {
+				t.Fatalf("RecordWebhookAttempt: %v", err)
+			}
+			return disabled
+		}
+		failures := func() int {
+			t.Helper()
+			stored, err := s.GetWebhook(alice.ID, hook.ID)
+			if err != nil {
+				t.Fatalf("GetWebhook: %v", err)
+			}
+			return stored.ConsecutiveFailures
+		}
+
+		if record(false) || record(false) || failures() != 2 {
+			t.Fatalf("two failures counted as %d", failures())
+		}
+		if record(true) || failures() != 0 {
+			t.Fatalf("a success left %d failures counted", failures())
+		}
+		if record(false) || record(false) || !record(false) {
+			t.Fatal("webhook not disabled after three failures in a row")
+		}
+		if record(false) {
+			t.Error("a disabled webhook was reported disabled again")
+		}
+		stored, err := s.GetWebhook(alice.ID, hook.ID)
+		if err != nil || stored.DisabledAt == nil {
+			t.Fatalf("webhook not disabled: %+v, %v", stored, err)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+// Package diff computes line based differences between two texts
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Op is the kind of change a line represents
+type Op string
+
+const (
+	Equal  Op = "="
+	Delete Op = "-"
+	Insert Op = "+"
+)
+
+// Line is one line of a diff
+type Line struct {
+	Op   Op     `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the shortest edit script turning a into b, line by line,
+// using Myers' algorithm
+func Lines(a, b string) []Line {
+	x, y := splitLines(a), splitLines(b)
+	n, m := len(x), len(y)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	// v[k+max] is the furthest x reached on diagonal k; trace keeps a copy
+	// of v per edit distance to walk the path back
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var i int
+			if k == -d || (k != d && v[k-1+max] < v[k+1+max]) {
+				i = v[k+1+max]
+			} else {
+				i = v[k-1+max] + 1
+			}
+			j := i - k
+			for i < n && j < m && x[i] == y[j] {
+				i++
+				j++
+			}
+			v[k+max] = i
+			if i >= n && j >= m {
+				done = true
+				break
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	var lines []Line
+	i, j := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := i - j
+		var prevK int
+		if k == -d || (k != d && v[k-1+max] < v[k+1+max]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevI := v[prevK+max]
+		prevJ := prevI - prevK
+		for i > prevI && j > prevJ {
+			i--
+			j--
+			lines = append(lines, Line{Op: Equal, Text: x[i]})
+		}
+		if d > 0 {
+			if i == prevI {
+				j--
+				lines = append(lines, Line{Op: Insert, Text: y[j]})
+			} else {
+				i--
+				lines = append(lines, Line{Op: Delete, Text: x[i]})
+			}
+		}
+	}
+
+	for l, r := 0, len(lines)-1; l < r; l, r = l+1, r-1 {
+		lines[l], lines[r] = lines[r], lines[l]
+	}
+	return lines
+}
+
+// Unified formats a diff in the unified format with the given number of
+// context lines around each change
+func Unified(fromName, toName string, lines []Line, context int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	// position of each line in the old and new text
+	oldPos := make([]int, len(lines)+1)
+	newPos := make([]int, len(lines)+1)
+	for i, line := range lines {
+		oldPos[i+1], newPos[i+1] = oldPos[i], newPos[i]
+		if line.Op != Insert {
+			oldPos[i+1]++
+		}
+		if line.Op != Delete {
+			newPos[i+1]++
+		}
+	}
+
+	for start := 0; start < len(lines); {
+		// find the next change and grow the hunk while changes are close
+		first := start
+		for first < len(lines) && lines[first].Op == Equal {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		from := max(first-context, start)
+		end := first
+		for end < len(lines) {
+			if lines[end].Op != Equal {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].Op == Equal {
+				next++
+			}
+			if next == len(lines) || next-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = next
+		}
+
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldPos[from], oldPos[end]), hunkRange(newPos[from], newPos[end]))
+		for _, line := range lines[from:end] {
+			prefix := " "
+			if line.Op != Equal {
+				prefix = string(line.Op)
+			}
+			sb.WriteString(prefix + line.Text + "\n")
+		}
+		start = end
+	}
+	return sb.String()
+}
+
+// hunkRange formats the 1-based start and length of a hunk side
+func hunkRange(from, to int) string {
+	length := to - from
+	start := from + 1
+	if length == 0 {
+		start = from
+	}
+	if length == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
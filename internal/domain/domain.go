@@ -1,5 +1,14 @@
 package domain
 
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/diff"
+	"github.com/GauravMakhijani/notes/internal/render"
+)
+
 type SignupRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
@@ -11,22 +20,458 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Username    string `json:"username"`
-	AccessToken string `json:"access_token"`
+	Username     string `json:"username"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// TicketResponse is a ticket to open an event stream or WebSocket with,
+// passed in the ticket query parameter
+type TicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+type AuditEventResponse struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Actor     string    `json:"actor,omitempty"`
+	Subject   string    `json:"subject"`
+	IP        string    `json:"ip,omitempty"`
+	Detail    string    `json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type NoteRequest struct {
 	Title string `json:"title"`
 	Body  string `json:"body"`
+	// Tags replaces the tags of the note. Updates leave them unchanged
+	// when omitted.
+	Tags []string `json:"tags"`
+	// Format is plain (the default) or markdown. Updates leave it unchanged
+	// when empty.
+	Format string `json:"format"`
+	// GroupID makes a new note belong to the group and NotebookID files it
+	// in one of the user's notebooks. Both are ignored on updates.
+	GroupID    string `json:"group_id"`
+	NotebookID string `json:"notebook_id"`
 }
 
 type NoteResponse struct {
-	ID        string `json:"id"`
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	CreatedBy string `json:"created_by"`
+	ID         string   `json:"id"`
+	Title      string   `json:"title"`
+	Body       string   `json:"body"`
+	CreatedBy  string   `json:"created_by"`
+	Tags       []string `json:"tags"`
+	Format     string   `json:"format"`
+	Version    int      `json:"version"`
+	GroupID    *string  `json:"group_id,omitempty"`
+	NotebookID *string  `json:"notebook_id,omitempty"`
+	// DeletedAt is only set on notes in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Role is the caller's role on the note: owner, viewer, commenter or
+	// editor. Only set on single note responses.
+	Role string `json:"role,omitempty"`
+	// HTML is the sanitized rendering of the body, only set when asked for
+	// with render=html. Metadata is only set on single note responses.
+	HTML     string        `json:"html,omitempty"`
+	Metadata *NoteMetadata `json:"metadata,omitempty"`
+
+	// Search results only. Highlights are HTML escaped with matches
+	// wrapped in <mark> elements.
+	Score          *float64 `json:"score,omitempty"`
+	TitleHighlight string   `json:"title_highlight,omitempty"`
+	Snippet        string   `json:"snippet,omitempty"`
+}
+
+// NoteMetadata is derived from the body of a note
+type NoteMetadata struct {
+	WordCount int `json:"word_count"`
+	// TOC lists the headings of markdown notes
+	TOC   []render.Heading `json:"toc"`
+	Links []string         `json:"links"`
+}
+
+// ListNotesRequest holds the paging, sorting and filtering options of
+// GET /api/notes and GET /api/search
+type ListNotesRequest struct {
+	Query         string
+	Scope         string
+	GroupID       string
+	NotebookID    string
+	Recursive     bool
+	Sort          string
+	Order         string
+	Limit         int
+	Cursor        string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	Tags          []string
+	TagMode       string
+	IncludeTotal  bool
+}
+
+type NotePageResponse struct {
+	Notes      []NoteResponse `json:"notes"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Total      *int64         `json:"total,omitempty"`
+}
+
+// NoteEvent is the data of an event about a change to a note
+type NoteEvent struct {
+	NoteID string `json:"note_id"`
+	// ActorID is the user who made the change
+	ActorID string `json:"actor_id"`
+	// Note is the note after the change, left out of note.deleted events
+	Note *NoteResponse `json:"note,omitempty"`
+	// Share is set on note.shared events
+	Share *NoteEventShare `json:"share,omitempty"`
+}
+
+type NoteEventShare struct {
+	Usernames []string `json:"usernames"`
+	Role      string   `json:"role"`
+}
+
+// BatchRequest is a list of note operations run in one transaction
+type BatchRequest struct {
+	// Mode is all_or_nothing (the default), which saves nothing when an
+	// operation fails, or best_effort, which saves the operations that
+	// succeed
+	Mode       string           `json:"mode"`
+	Operations []BatchOperation `json:"operations"`
+}
+
+type BatchOperation struct {
+	// ID is chosen by the client to find the result of the operation
+	ID string `json:"id"`
+	// Op is create, update, delete or share
+	Op string `json:"op"`
+	// NoteID is the note to update, delete or share. "$" followed by the ID
+	// of an earlier create operation refers to the note it created.
+	NoteID string `json:"note_id"`
+	// Version is the version of the note an update is based on
+	Version int                `json:"version"`
+	Note    *NoteRequest       `json:"note"`
+	Share   *SharedNoteRequest `json:"share"`
+}
+
+type BatchResponse struct {
+	Mode string `json:"mode"`
+	// Committed tells whether the changes of the successful operations
+	// were saved
+	Committed bool `json:"committed"`
+	// Results maps operation IDs to their results
+	Results map[string]BatchResult `json:"results"`
+}
+
+type BatchResult struct {
+	Op string `json:"op"`
+	// Status is ok, failed, rolled_back for operations undone because
+	// another one failed, or skipped for those not run because of it
+	Status string `json:"status"`
+	// Code is the HTTP status the operation would have had on its own
+	Code  int           `json:"code,omitempty"`
+	Note  *NoteResponse `json:"note,omitempty"`
+	Error string        `json:"error,omitempty"`
+	// Err is the error of a failed operation
+	Err error `json:"-"`
 }
 
 type SharedNoteRequest struct {
 	ToUsersID []string `json:"to_users_id"`
+	// Role is viewer (the default), commenter or editor
+	Role string `json:"role"`
+}
+
+// ShareResponse is a share of a note with a user
+type ShareResponse struct {
+	NoteID    string    `json:"note_id"`
+	NoteTitle string    `json:"note_title"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Role      string    `json:"role"`
+	SharedAt  time.Time `json:"shared_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type PublicLinkRequest struct {
+	// ExpiresAt is when the link stops working, none when empty
+	ExpiresAt *time.Time `json:"expires_at"`
+	// Password is asked for when the link is opened, none when empty
+	Password string `json:"password"`
+	// MaxViews is how often the link may be opened, no limit when empty
+	MaxViews *int `json:"max_views"`
+}
+
+type PublicLinkResponse struct {
+	ID string `json:"id"`
+	// Token and Path are only returned when the link is created
+	Token          string     `json:"token,omitempty"`
+	Path           string     `json:"path,omitempty"`
+	HasPassword    bool       `json:"has_password"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	MaxViews       *int       `json:"max_views,omitempty"`
+	ViewCount      int        `json:"view_count"`
+	LastAccessedAt *time.Time `json:"last_accessed_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// PublicNoteResponse is a note as shown through a public link
+type PublicNoteResponse struct {
+	Title     string    `json:"title"`
+	Body      string    `json:"body"`
+	Format    string    `json:"format"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type NotebookRequest struct {
+	Name string `json:"name"`
+	// ParentID nests the new notebook, which is top level when it is empty
+	ParentID string `json:"parent_id"`
+}
+
+type RenameNotebookRequest struct {
+	Name string `json:"name"`
+}
+
+type MoveNotebookRequest struct {
+	// ParentID is the new parent, null to move the notebook to the top
+	// level
+	ParentID *string `json:"parent_id"`
+}
+
+type MoveNoteRequest struct {
+	// NotebookID is the notebook to file the note in, null for none
+	NotebookID *string `json:"notebook_id"`
+}
+
+type NotebookResponse struct {
+	ID       string  `json:"id"`
+	Name     string  `json:"name"`
+	ParentID *string `json:"parent_id"`
+	// NoteCount counts the notes filed directly in the notebook and
+	// TotalCount those in its descendants too
+	NoteCount  int64              `json:"note_count"`
+	TotalCount int64              `json:"total_count"`
+	Children   []NotebookResponse `json:"children,omitempty"`
+	CreatedAt  time.Time          `json:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at"`
+}
+
+type DeleteNotebookResponse struct {
+	// TrashedNotes is the number of notes moved to the trash
+	TrashedNotes int64 `json:"trashed_notes"`
+}
+
+// AttachmentUpload is a file being attached to a note
+type AttachmentUpload struct {
+	Filename string
+	// ContentType is the type declared by the client, sniffed from the
+	// contents when empty or application/octet-stream
+	ContentType string
+	Body        io.Reader
+}
+
+type AttachmentResponse struct {
+	ID          string `json:"id"`
+	NoteID      string `json:"note_id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Checksum is the hex encoded SHA-256 of the contents
+	Checksum   string    `json:"checksum"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type AttachmentUsageResponse struct {
+	// Used is the total size of the user's attachments, including those of
+	// notes in the trash. Quota is 0 when there is no limit.
+	Used    int64 `json:"used"`
+	Quota   int64 `json:"quota"`
+	MaxSize int64 `json:"max_size"`
+}
+
+// Export is a download of the user's notes, written on demand
+type Export struct {
+	Filename    string
+	ContentType string
+	// Write streams the export. Errors can only be reported by cutting the
+	// download short once it started.
+	Write func(w io.Writer) error
+}
+
+// ImportRequest is a file of notes to import
+type ImportRequest struct {
+	Filename string
+	// Format is zip, enex or json, detected from the file when empty
+	Format string
+	// DryRun checks the notes without creating them
+	DryRun bool
+	// DedupeByTitle skips notes titled like one the user already has
+	DedupeByTitle bool
+	Body          io.Reader
+}
+
+type ImportJobResponse struct {
+	ID            string `json:"id"`
+	Format        string `json:"format"`
+	Filename      string `json:"filename"`
+	DryRun        bool   `json:"dry_run"`
+	DedupeByTitle bool   `json:"dedupe_by_title"`
+	// Status is pending, running, completed or failed
+	Status string `json:"status"`
+	// Error is why the import failed as a whole
+	Error string `json:"error,omitempty"`
+	Total int    `json:"total"`
+	// Created counts the notes created, or in a dry run those that would
+	// have been
+	Created    int                  `json:"created"`
+	Skipped    int                  `json:"skipped"`
+	Failed     int                  `json:"failed"`
+	Items      []ImportItemResponse `json:"items,omitempty"`
+	CreatedAt  time.Time            `json:"created_at"`
+	FinishedAt *time.Time           `json:"finished_at"`
+}
+
+type ImportItemResponse struct {
+	// Name tells the item apart within the file, such as its path in a zip
+	Name  string `json:"name"`
+	Title string `json:"title,omitempty"`
+	// Status is created, valid, skipped or failed
+	Status string  `json:"status"`
+	NoteID *string `json:"note_id,omitempty"`
+	Error  string  `json:"error,omitempty"`
+}
+
+type WebhookRequest struct {
+	URL string `json:"url"`
+	// Events are the event types delivered, all of them when empty
+	Events []string `json:"events"`
+	// Secret signs the deliveries, one is generated when empty
+	Secret string `json:"secret"`
+}
+
+// WebhookUpdateRequest changes the fields it sets
+type WebhookUpdateRequest struct {
+	URL *string `json:"url"`
+	// Events replaces the event types when not null, an empty list
+	// delivering all of them
+	Events []string `json:"events"`
+	// Secret replaces the secret, an empty one generating a new secret
+	Secret *string `json:"secret"`
+	// Active disables the webhook, or enables it again and clears its
+	// failures
+	Active *bool `json:"active"`
+}
+
+type WebhookResponse struct {
+	ID     string   `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret is only returned when it is set
+	Secret              string     `json:"secret,omitempty"`
+	Active              bool       `json:"active"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID        string `json:"id"`
+	EventID   string `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Status is pending, succeeded or failed
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	// NextAttemptAt is set while the delivery is pending
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at,omitempty"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type GroupRequest struct {
+	Name string `json:"name"`
+}
+
+type GroupResponse struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Role is the caller's role in the group
+	Role        string                `json:"role"`
+	MemberCount int64                 `json:"member_count"`
+	Members     []GroupMemberResponse `json:"members,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+}
+
+type GroupMemberRequest struct {
+	Username string `json:"username"`
+	// Role is member (the default) or admin
+	Role string `json:"role"`
+}
+
+type GroupMemberResponse struct {
+	Username string    `json:"username"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type NoteTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type NoteTagsResponse struct {
+	NoteID string   `json:"note_id"`
+	Tags   []string `json:"tags"`
+}
+
+type TagResponse struct {
+	Name      string    `json:"name"`
+	NoteCount int64     `json:"note_count"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type RenameTagRequest struct {
+	Name string `json:"name"`
+}
+
+type MergeTagsRequest struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+type RevisionResponse struct {
+	Number       int       `json:"number"`
+	AuthorID     string    `json:"author_id"`
+	Title        string    `json:"title"`
+	Body         *string   `json:"body,omitempty"`
+	RestoredFrom *int      `json:"restored_from,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type RevisionDiffResponse struct {
+	From      int    `json:"from"`
+	To        int    `json:"to"`
+	TitleFrom string `json:"title_from"`
+	TitleTo   string `json:"title_to"`
+	// Diff is the change to the body in the unified diff format
+	Diff  string      `json:"diff"`
+	Lines []diff.Line `json:"lines"`
 }
@@ -0,0 +1,210 @@
+// Package events carries changes to notes to the users who can see them.
+// Published events go to every matching subscriber and into a bounded log,
+// from which a subscriber that reconnects catches up on what it missed.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	NoteCreated = "note.created"
+	NoteUpdated = "note.updated"
+	NoteDeleted = "note.deleted"
+	NoteShared  = "note.shared"
+	// StreamReset tells a resuming subscriber that some events since the
+	// ID it gave are no longer in the log, so it should reload its notes
+	StreamReset = "stream.reset"
+)
+
+// subscriberBuffer is how many events may wait for a subscriber. A
+// subscriber that falls further behind is dropped and has to resume.
+const subscriberBuffer = 64
+
+// Event is a change delivered to users
+type Event struct {
+	// ID increases with every event, across restarts as long as the clock
+	// does not go back
+	ID   uint64 `json:"id,string"`
+	Type string `json:"type"`
+	// Users are the IDs of the users the event is delivered to
+	Users []string    `json:"-"`
+	Data  interface{} `json:"data"`
+	Time  time.Time   `json:"time"`
+}
+
+// Publisher accepts events for delivery
+type Publisher interface {
+	Publish(event Event)
+}
+
+// Bus delivers events to subscribers and keeps the latest ones in a log
+type Bus struct {
+	mu sync.Mutex
+	// log holds the latest events, oldest first
+	log     []Event
+	logSize int
+	// floor is the ID of the newest event no longer in the log and last
+	// the ID of the newest event published
+	floor       uint64
+	last        uint64
+	subscribers map[*Subscription]bool
+	// handlers are called with every event published
+	handlers []func(Event)
+}
+
+// NewBus creates a bus whose log keeps the latest logSize events
+func NewBus(logSize int) *Bus {
+	// IDs start from the clock so that IDs handed out before a restart
+	// are older than every new one
+	start := uint64(time.Now().UnixMicro())
+	return &Bus{
+		logSize:     logSize,
+		floor:       start,
+		last:        start,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+// OnPublish registers fn to be called with every event published, once it
+// has its ID. fn runs on the publisher's goroutine, after the subscribers
+// were handed the event.
+func (b *Bus) OnPublish(fn func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, fn)
+}
+
+// Publish assigns the event an ID, logs it and hands it to the
+// subscribers it is meant for
+func (b *Bus) Publish(event Event) {
+	if len(event.Users) == 0 {
+		return
+	}
+	event, handlers := b.publish(event)
+	for _, fn := range handlers {
+		fn(event)
+	}
+}
+
+func (b *Bus) publish(event Event) (Event, []func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.last++
+	event.ID = b.last
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.log = append(b.log, event)
+	if len(b.log) > b.logSize {
+		b.floor = b.log[0].ID
+		b.log = b.log[1:]
+	}
+
+	for sub := range b.subscribers {
+		if !event.For(sub.userID) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// the subscriber resumes from its last event once it notices
+			delete(b.subscribers, sub)
+			close(sub.events)
+		}
+	}
+	return event, b.handlers
+}
+
+// Subscribe starts delivering the user's events. When after is not nil the
+// subscription resumes after that event ID: the user's events since then
+// are in Missed, or Gap is set when the log no longer holds all of them.
+func (b *Bus) Subscribe(userID string, after *uint64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription{
+		Latest: b.last,
+		userID: userID,
+		events: make(chan Event, subscriberBuffer),
+		bus:    b,
+	}
+	if after != nil {
+		if *after < b.floor || *after > b.last {
+			sub.Gap = true
+		} else {
+			for _, event := range b.log {
+				if event.ID > *after && event.For(userID) {
+					sub.Missed = append(sub.Missed, event)
+				}
+			}
+		}
+	}
+	b.subscribers[sub] = true
+	return sub
+}
+
+// For reports whether the event is delivered to the user
+func (e Event) For(userID string) bool {
+	for _, user := range e.Users {
+		if user == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription is a stream of a user's events
+type Subscription struct {
+	// Missed are the events published since the ID the subscription
+	// resumed after, oldest first
+	Missed []Event
+	// Gap is set when some events since that ID were dropped from the log
+	Gap bool
+	// Latest is the ID of the newest event when the subscription started,
+	// which a subscriber told of a gap can resume after
+	Latest uint64
+
+	userID string
+	events chan Event
+	bus    *Bus
+}
+
+// Events returns the channel events are delivered on. It is closed when
+// the subscription is closed or falls too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if s.bus.subscribers[s] {
+		delete(s.bus.subscribers, s)
+		close(s.events)
+	}
+}
+
+// Buffer holds events until they are released, such as those of a
+// transaction that may still be rolled back
+type Buffer struct {
+	events []Event
+}
+
+// Publish holds the event
+func (b *Buffer) Publish(event Event) {
+	b.events = append(b.events, event)
+}
+
+// Flush publishes the held events to p and forgets them
+func (b *Buffer) Flush(p Publisher) {
+	for _, event := range b.events {
+		p.Publish(event)
+	}
+	b.events = nil
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func UnlockAccountHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		username := mux.Vars(r)["username"]
+
+		err := service.UnlockAccount(r.Context(), username)
+		if err != nil {
+			http.Error(w, "Failed to unlock account", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Account unlocked successfully"})
+	}
+}
+
+func UnlockIPHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := mux.Vars(r)["ip"]
+
+		err := service.UnlockIP(r.Context(), ip)
+		if err != nil {
+			http.Error(w, "Failed to unlock ip", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "IP unlocked successfully"})
+	}
+}
+
+func ListAuditEventsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		events, err := service.ListAuditEvents(r.Context(), limit)
+		if err != nil {
+			http.Error(w, "Failed to list audit events", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, events)
+	}
+}
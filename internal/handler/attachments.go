@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// UploadAttachmentHandler attaches the file sent in the "file" field of a
+// multipart/form-data body. The body is streamed rather than parsed up
+// front so that large uploads are not held in memory.
+func UploadAttachmentHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				http.Error(w, "Missing file field", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+
+			attachment, err := service.UploadAttachment(r.Context(), noteID, domain.AttachmentUpload{
+				Filename:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Body:        part,
+			})
+			if err != nil {
+				writeError(w, "Failed to upload attachment", err)
+				return
+			}
+			SuccessResponse(r.Context(), w, http.StatusCreated, attachment)
+			return
+		}
+	}
+}
+
+func ListAttachmentsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		attachments, err := service.ListAttachments(r.Context(), noteID)
+		if err != nil {
+			writeError(w, "Failed to list attachments", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, attachments)
+	}
+}
+
+// DownloadAttachmentHandler sends the contents of an attachment. Files are
+// always served as downloads, never rendered in the API's origin.
+func DownloadAttachmentHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		attachment, body, err := service.OpenAttachment(r.Context(), vars["note_id"], vars["attachment_id"])
+		if err != nil {
+			writeError(w, "Failed to download attachment", err)
+			return
+		}
+		defer body.Close()
+
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		w.Header().Set("Content-Type", attachment.ContentType)
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+		w.Header().Set("Content-Disposition", disposition)
+		w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		w.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(w, body); err != nil {
+			logrus.Error("Error writing attachment response", err)
+		}
+	}
+}
+
+func DeleteAttachmentHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := service.DeleteAttachment(r.Context(), vars["note_id"], vars["attachment_id"])
+		if err != nil {
+			writeError(w, "Failed to delete attachment", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Attachment deleted successfully"})
+	}
+}
+
+func AttachmentUsageHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		usage, err := service.GetAttachmentUsage(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to get attachment usage", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, usage)
+	}
+}
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// BatchNotesHandler runs a list of note operations in one transaction. The
+// response is 200 whether or not operations failed; each result carries
+// the status code the operation would have had on its own.
+func BatchNotesHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var batchReq domain.BatchRequest
+		if err := json.NewDecoder(r.Body).Decode(&batchReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		batch, err := service.BatchNotes(r.Context(), batchReq)
+		if err != nil {
+			writeError(w, "Failed to run batch", err)
+			return
+		}
+		for id, result := range batch.Results {
+			result.Code = batchResultStatus(result)
+			// as with writeError, only client errors are spelled out
+			if result.Code == http.StatusInternalServerError {
+				logrus.Errorf("error running batch operation %s\nError: %s", id, result.Error)
+				result.Error = "internal error"
+			}
+			batch.Results[id] = result
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, batch)
+	}
+}
+
+// batchResultStatus is the status code of an operation that ran, 0 for
+// those that were skipped or rolled back
+func batchResultStatus(result domain.BatchResult) int {
+	switch {
+	case result.Err != nil:
+		return errorStatus(result.Err)
+	case result.Status != "ok":
+		return 0
+	case result.Op == "create":
+		return http.StatusCreated
+	case result.Op == "delete":
+		return http.StatusNoContent
+	default:
+		return http.StatusOK
+	}
+}
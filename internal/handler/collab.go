@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/collab"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// maxCollabMessageSize bounds a message from a live editing client
+const maxCollabMessageSize = 1 << 20
+
+// CollabHandler joins the user to the live editing session of the note
+// over a WebSocket, exchanging collab.Message values as JSON. Upgrades are
+// accepted from allowedOrigins and the server's own. The session is pinged
+// every keepAlive.
+func CollabHandler(service service.Service, keepAlive time.Duration, allowedOrigins []string) http.HandlerFunc {
+	upgrader := newUpgrader(allowedOrigins)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			http.Error(w, "Live editing needs a WebSocket", http.StatusUpgradeRequired)
+			return
+		}
+
+		// joined before upgrading so that missing access is an HTTP error
+		client, err := service.JoinCollab(r.Context(), mux.Vars(r)["note_id"])
+		if err != nil {
+			writeError(w, "Failed to join the editing session", err)
+			return
+		}
+		defer client.Leave()
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader has replied
+			return
+		}
+		defer conn.Close()
+		conn.SetReadLimit(maxCollabMessageSize)
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				var msg collab.Message
+				if err := conn.ReadJSON(&msg); err != nil {
+					if _, ok := err.(*websocket.CloseError); !ok {
+						conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, "invalid message"), time.Now().Add(webSocketWriteTimeout))
+					}
+					return
+				}
+				client.Receive(msg)
+			}
+		}()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-closed:
+				return
+			case msg, ok := <-client.Messages():
+				if !ok {
+					conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "dropped from the session"), time.Now().Add(webSocketWriteTimeout))
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+				if err := conn.WriteJSON(msg); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteTimeout)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// errorStatus maps an error returned by the service to an HTTP status code
+func errorStatus(err error) int {
+	var blocked *service.LoginBlockedError
+	var mismatch *service.VersionMismatchError
+	switch {
+	case errors.As(err, &blocked):
+		return http.StatusTooManyRequests
+	case errors.As(err, &mismatch):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidRefreshToken), errors.Is(err, service.ErrInvalidLinkPassword):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrGone):
+		return http.StatusGone
+	case errors.Is(err, service.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, service.ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeError responds with the message and the status the error maps to.
+// The error is only spelled out for the client errors the service reports;
+// anything else may carry database or driver details, so it is logged and
+// the message sent alone.
+func writeError(w http.ResponseWriter, message string, err error) {
+	status := errorStatus(err)
+	if status == http.StatusInternalServerError {
+		logrus.Errorf("%s\nError: %s", message, err.Error())
+		http.Error(w, message, status)
+		return
+	}
+	http.Error(w, message+": "+err.Error(), status)
+}
+
+// setRetryAfter sets the Retry-After header when the error says when the
+// request may be retried
+func setRetryAfter(w http.ResponseWriter, err error) {
+	var blocked *service.LoginBlockedError
+	if errors.As(err, &blocked) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(blocked.RetryAfter.Seconds()))))
+	}
+}
+
+// setCurrentETag sets the ETag header to the current version of the note
+// when the error says the request was based on another one
+func setCurrentETag(w http.ResponseWriter, err error) {
+	var mismatch *service.VersionMismatchError
+	if errors.As(err, &mismatch) {
+		w.Header().Set("ETag", etag(mismatch.CurrentVersion))
+	}
+}
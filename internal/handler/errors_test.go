@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		body   string
+	}{
+		{service.ErrInvalidCredentials, http.StatusUnauthorized, "Failed to login: invalid username or password"},
+		{fmt.Errorf("%w: title is required", service.ErrInvalidInput), http.StatusBadRequest, "Failed to login: invalid input: title is required"},
+		{errors.New(`pq: relation "users" does not exist`), http.StatusInternalServerError, "Failed to login"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeError(w, "Failed to login", tt.err)
+		if body := strings.TrimSpace(w.Body.String()); w.Code != tt.status || body != tt.body {
+			t.Errorf("%v: got %d %q, want %d %q", tt.err, w.Code, body, tt.status, tt.body)
+		}
+	}
+}
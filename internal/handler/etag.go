@@ -0,0 +1,54 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+)
+
+// etag formats a note version as an entity tag
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// renderedETag formats the entity tag of a note version in a render mode.
+// Renderings other than the plain note get their own tag, since their
+// bodies differ and caches must not serve one for the other.
+func renderedETag(version int, render string) string {
+	if render == "" {
+		return etag(version)
+	}
+	return strconv.Quote(strconv.Itoa(version) + "-" + render)
+}
+
+// noneMatch reports whether an If-None-Match header lists the current
+// entity tag, using the weak comparison the header calls for
+func noneMatch(header string, current string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatchVersion returns the note version an If-Match header asks for: 0
+// for "*", which matches any version, and -1, which matches none, when the
+// header is not a single strong entity tag of a version. The tag of the
+// HTML rendering names its version too, so it is accepted as well.
+func ifMatchVersion(header string) int {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0
+	}
+	v, err := strconv.Unquote(header)
+	if err != nil || !strings.HasPrefix(header, `"`) {
+		return -1
+	}
+	v = strings.TrimSuffix(v, "-html")
+	version, err := strconv.Atoi(v)
+	if err != nil || version < 1 {
+		return -1
+	}
+	return version
+}
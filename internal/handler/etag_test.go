@@ -0,0 +1,50 @@
+package handler
+
+import "testing"
+
+func TestRenderedETag(t *testing.T) {
+	plain, html := renderedETag(3, ""), renderedETag(3, "html")
+	if plain != `"3"` || html != `"3-html"` {
+		t.Fatalf("renderedETag = %s and %s, want \"3\" and \"3-html\"", plain, html)
+	}
+
+	tests := []struct {
+		header  string
+		current string
+		want    bool
+	}{
+		{`"3"`, plain, true},
+		{`W/"3"`, plain, true},
+		{`"2", "3"`, plain, true},
+		{`*`, html, true},
+		{`"3"`, html, false},
+		{`"3-html"`, plain, false},
+		{`"3-html"`, html, true},
+	}
+	for _, tt := range tests {
+		if got := noneMatch(tt.header, tt.current); got != tt.want {
+			t.Errorf("noneMatch(%s, %s) = %v, want %v", tt.header, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestIfMatchVersion(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+	}{
+		{`"3"`, 3},
+		{`"3-html"`, 3},
+		{`*`, 0},
+		{`W/"3"`, -1},
+		{`"3-text"`, -1},
+		{`"0"`, -1},
+		{`3`, -1},
+		{`"3", "4"`, -1},
+	}
+	for _, tt := range tests {
+		if got := ifMatchVersion(tt.header); got != tt.want {
+			t.Errorf("ifMatchVersion(%s) = %d, want %d", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// webSocketWriteTimeout bounds how long a write to a WebSocket may block
+const webSocketWriteTimeout = 10 * time.Second
+
+// newUpgrader returns an upgrader to WebSockets that refuses cross-origin
+// upgrades unless the origin is one of allowedOrigins. Requests without an
+// Origin header do not come from a browser page and are let through.
+func newUpgrader(allowedOrigins []string) *websocket.Upgrader {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return &websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				return true
+			}
+			u, err := url.Parse(origin)
+			if err != nil {
+				return false
+			}
+			return strings.EqualFold(u.Host, r.Host) || allowed[strings.ToLower(origin)]
+		},
+	}
+}
+
+// EventsHandler streams events about the notes the user can read as
+// Server-Sent Events, or as JSON messages over a WebSocket when the request
+// asks to upgrade from one of allowedOrigins or the server's own. A
+// Last-Event-ID header, or a last_event_id query parameter since browsers
+// cannot set headers on WebSockets, resumes the stream after that event.
+// Idle streams are written to every keepAlive.
+func EventsHandler(service service.Service, keepAlive time.Duration, allowedOrigins []string) http.HandlerFunc {
+	upgrader := newUpgrader(allowedOrigins)
+	return func(w http.ResponseWriter, r *http.Request) {
+		after, err := lastEventID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if websocket.IsWebSocketUpgrade(r) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				// the upgrader has replied
+				return
+			}
+			defer conn.Close()
+			sub := service.SubscribeEvents(r.Context(), after)
+			defer sub.Close()
+			streamWebSocketEvents(conn, sub, keepAlive)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		sub := service.SubscribeEvents(r.Context(), after)
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		// keeps proxies such as nginx from buffering the stream
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		for _, event := range backlog(sub) {
+			if err := writeServerSentEvent(w, event); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-sub.Events():
+				if !ok {
+					// fell behind; the client reconnects and resumes
+					return
+				}
+				if err := writeServerSentEvent(w, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// streamWebSocketEvents writes the events of the subscription to the
+// WebSocket until either side closes it
+func streamWebSocketEvents(conn *websocket.Conn, sub *events.Subscription, keepAlive time.Duration) {
+	// messages from the client are not expected, but reading is how a
+	// close is noticed
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(event events.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(webSocketWriteTimeout))
+		return conn.WriteJSON(event)
+	}
+	for _, event := range backlog(sub) {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too far behind, resume"), time.Now().Add(webSocketWriteTimeout))
+				return
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(webSocketWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// backlog returns the events to send before new ones: those missed since
+// the resumed event, or a reset when they are no longer all known
+func backlog(sub *events.Subscription) []events.Event {
+	if sub.Gap {
+		return []events.Event{{ID: sub.Latest, Type: events.StreamReset, Time: time.Now()}}
+	}
+	return sub.Missed
+}
+
+func writeServerSentEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		logrus.Error("Error encoding event", err)
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// lastEventID returns the event ID the stream resumes after, nil when it
+// starts afresh
+func lastEventID(r *http.Request) (*uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Last-Event-ID %q", v)
+	}
+	return &id, nil
+}
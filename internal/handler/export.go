@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportNotesHandler streams an export of the user's notes as a download
+func ExportNotesHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		export, err := service.ExportNotes(r.Context(), r.URL.Query().Get("format"))
+		if err != nil {
+			writeError(w, "Failed to export notes", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", export.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": export.Filename}))
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if err := export.Write(w); err != nil {
+			logrus.Error("Error writing export", err)
+		}
+	}
+}
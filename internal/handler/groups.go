@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func CreateGroupHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var groupReq domain.GroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&groupReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		group, err := service.CreateGroup(r.Context(), groupReq)
+		if err != nil {
+			writeError(w, "Failed to create group", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusCreated, group)
+	}
+}
+
+func ListGroupsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groups, err := service.ListGroups(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to list groups", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, groups)
+	}
+}
+
+func GetGroupHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID := mux.Vars(r)["group_id"]
+
+		group, err := service.GetGroup(r.Context(), groupID)
+		if err != nil {
+			writeError(w, "Failed to get group", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, group)
+	}
+}
+
+func AddGroupMemberHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		groupID := mux.Vars(r)["group_id"]
+
+		var memberReq domain.GroupMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&memberReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		group, err := service.AddGroupMember(r.Context(), groupID, memberReq)
+		if err != nil {
+			writeError(w, "Failed to add member", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, group)
+	}
+}
+
+func UpdateGroupMemberHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		var memberReq domain.GroupMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&memberReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		group, err := service.UpdateGroupMember(r.Context(), vars["group_id"], vars["username"], memberReq)
+		if err != nil {
+			writeError(w, "Failed to update member", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, group)
+	}
+}
+
+func RemoveGroupMemberHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := service.RemoveGroupMember(r.Context(), vars["group_id"], vars["username"])
+		if err != nil {
+			writeError(w, "Failed to remove member", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Member removed successfully"})
+	}
+}
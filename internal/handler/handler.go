@@ -3,10 +3,13 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 
 	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/jwt"
 	"github.com/GauravMakhijani/notes/internal/service"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -81,7 +84,8 @@ func LoginHandler(service service.Service) http.HandlerFunc {
 
 		loginResponse, err := service.LoginUser(r.Context(), loginReq)
 		if err != nil {
-			http.Error(w, "Failed to login", http.StatusInternalServerError)
+			setRetryAfter(w, err)
+			writeError(w, "Failed to login", err)
 			return
 		}
 		SuccessResponse(r.Context(), w, http.StatusOK, loginResponse)
@@ -90,6 +94,65 @@ func LoginHandler(service service.Service) http.HandlerFunc {
 
 }
 
+func RefreshTokenHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Parse the request body
+		var refreshReq domain.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&refreshReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		loginResponse, err := service.RefreshToken(r.Context(), refreshReq)
+		if err != nil {
+			http.Error(w, "Failed to refresh token", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, loginResponse)
+	}
+}
+
+func LogoutHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The body is optional, without it only the access token is revoked
+		var logoutReq domain.LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&logoutReq); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		err := service.Logout(r.Context(), logoutReq)
+		if err != nil {
+			http.Error(w, "Failed to logout", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Logged out successfully"})
+	}
+}
+
+// TicketHandler issues a ticket for browsers to open event streams and
+// WebSockets with, since they cannot set an Authorization header there
+func TicketHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ticket, err := service.IssueTicket(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to issue ticket", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, ticket)
+	}
+}
+
+func JWKSHandler(keyring *jwt.Keyring) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.NewEncoder(w).Encode(keyring.JWKS()); err != nil {
+			logrus.Error("Error writing jwks response", err)
+		}
+	}
+}
+
 func CreateNoteHandler(service service.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Parse the request body
@@ -101,9 +164,10 @@ func CreateNoteHandler(service service.Service) http.HandlerFunc {
 
 		note, err := service.CreateNote(r.Context(), noteReq)
 		if err != nil {
-			http.Error(w, "Failed to create note", http.StatusInternalServerError)
+			http.Error(w, "Failed to create note", errorStatus(err))
 			return
 		}
+		w.Header().Set("ETag", etag(note.Version))
 		SuccessResponse(r.Context(), w, http.StatusCreated, note)
 		w.WriteHeader(http.StatusOK)
 	}
@@ -115,9 +179,16 @@ func GetNoteByIDHandler(service service.Service) http.HandlerFunc {
 		//parse the id from the url
 		noteID := mux.Vars(r)["note_id"]
 
-		note, err := service.GetNoteByID(r.Context(), noteID)
+		render := r.URL.Query().Get("render")
+		note, err := service.GetNoteByID(r.Context(), noteID, render)
 		if err != nil {
-			http.Error(w, "Failed to get note", http.StatusInternalServerError)
+			writeError(w, "Failed to get note", err)
+			return
+		}
+		tag := renderedETag(note.Version, render)
+		w.Header().Set("ETag", tag)
+		if inm := r.Header.Get("If-None-Match"); inm != "" && noneMatch(inm, tag) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
 		SuccessResponse(r.Context(), w, http.StatusOK, note)
@@ -128,9 +199,15 @@ func GetNoteByIDHandler(service service.Service) http.HandlerFunc {
 
 func ListNotesHandler(service service.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		notes, err := service.ListNotes(r.Context())
+		listReq, err := parseListNotesRequest(r)
 		if err != nil {
-			http.Error(w, "Failed to list notes", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		notes, err := service.ListNotes(r.Context(), listReq)
+		if err != nil {
+			writeError(w, "Failed to list notes", err)
 			return
 		}
 		SuccessResponse(r.Context(), w, http.StatusOK, notes)
@@ -145,7 +222,7 @@ func DeleteNoteHandler(service service.Service) http.HandlerFunc {
 		noteID := mux.Vars(r)["note_id"]
 		err := service.DeleteNoteByID(r.Context(), noteID)
 		if err != nil {
-			http.Error(w, "Failed to delete note", http.StatusInternalServerError)
+			http.Error(w, "Failed to delete note", errorStatus(err))
 			return
 		}
 		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Note deleted successfully"})
@@ -171,11 +248,21 @@ func UpdateNoteHandler(service service.Service) http.HandlerFunc {
 			return
 		}
 
-		note, err := service.UpdateNoteByID(r.Context(), noteID, noteReq)
+		// updates must name the version they are based on so that
+		// concurrent edits are not silently overwritten
+		ifMatch := r.Header.Get("If-Match")
+		if ifMatch == "" {
+			http.Error(w, "If-Match header with the note's ETag is required", http.StatusPreconditionRequired)
+			return
+		}
+
+		note, err := service.UpdateNoteByID(r.Context(), noteID, ifMatchVersion(ifMatch), noteReq)
 		if err != nil {
-			http.Error(w, "Failed to update note", http.StatusInternalServerError)
+			setCurrentETag(w, err)
+			writeError(w, "Failed to update note", err)
 			return
 		}
+		w.Header().Set("ETag", etag(note.Version))
 		SuccessResponse(r.Context(), w, http.StatusOK, note)
 		w.WriteHeader(http.StatusOK)
 	}
@@ -196,7 +283,7 @@ func ShareNoteHandler(service service.Service) http.HandlerFunc {
 
 		err := service.ShareNoteWithUser(r.Context(), noteID, shareReq)
 		if err != nil {
-			http.Error(w, "Failed to share note", http.StatusInternalServerError)
+			writeError(w, "Failed to share note", err)
 			return
 		}
 		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Note shared successfully"})
@@ -207,11 +294,16 @@ func ShareNoteHandler(service service.Service) http.HandlerFunc {
 
 func SearchNotesHandler(service service.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		//parse the id from the url
-		searchTerm := r.URL.Query().Get("q")
-		notes, err := service.SearchNotes(r.Context(), searchTerm)
+		listReq, err := parseListNotesRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		listReq.Query = r.URL.Query().Get("q")
+
+		notes, err := service.SearchNotes(r.Context(), listReq)
 		if err != nil {
-			http.Error(w, "Failed to search notes", http.StatusInternalServerError)
+			writeError(w, "Failed to search notes", err)
 			return
 		}
 		SuccessResponse(r.Context(), w, http.StatusOK, notes)
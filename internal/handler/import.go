@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// StartImportHandler starts importing the file sent in the "file" field of
+// a multipart/form-data body. The query may set format (zip, enex or
+// json), dry_run and dedupe=title. The job runs in the background; its
+// status is served at the Location returned.
+func StartImportHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		importReq := domain.ImportRequest{Format: query.Get("format")}
+		if v := query.Get("dry_run"); v != "" {
+			dryRun, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, "Invalid dry_run "+strconv.Quote(v), http.StatusBadRequest)
+				return
+			}
+			importReq.DryRun = dryRun
+		}
+		switch v := query.Get("dedupe"); v {
+		case "":
+		case "title":
+			importReq.DedupeByTitle = true
+		default:
+			http.Error(w, "Invalid dedupe "+strconv.Quote(v)+", expected title", http.StatusBadRequest)
+			return
+		}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				http.Error(w, "Missing file field", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+
+			importReq.Filename = part.FileName()
+			importReq.Body = part
+			job, err := service.StartImport(r.Context(), importReq)
+			if err != nil {
+				writeError(w, "Failed to start import", err)
+				return
+			}
+			w.Header().Set("Location", "/api/import/"+job.ID)
+			SuccessResponse(r.Context(), w, http.StatusAccepted, job)
+			return
+		}
+	}
+}
+
+func ListImportJobsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jobs, err := service.ListImportJobs(r.Context())
+		if err != nil {
+			writeError(w, "Failed to list imports", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, jobs)
+	}
+}
+
+// GetImportJobHandler returns the status of an import with the outcome of
+// each item processed so far
+func GetImportJobHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		job, err := service.GetImportJob(r.Context(), mux.Vars(r)["job_id"])
+		if err != nil {
+			writeError(w, "Failed to get import", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, job)
+	}
+}
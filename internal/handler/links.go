@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+// linkPasswordHeader carries the password of a public link on GET requests
+const linkPasswordHeader = "X-Link-Password"
+
+func CreatePublicLinkHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		var linkReq domain.PublicLinkRequest
+		if err := json.NewDecoder(r.Body).Decode(&linkReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		link, err := service.CreatePublicLink(r.Context(), noteID, linkReq)
+		if err != nil {
+			writeError(w, "Failed to create link", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusCreated, link)
+	}
+}
+
+func ListPublicLinksHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		links, err := service.ListPublicLinks(r.Context(), noteID)
+		if err != nil {
+			writeError(w, "Failed to list links", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, links)
+	}
+}
+
+func RevokePublicLinkHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := service.RevokePublicLink(r.Context(), vars["note_id"], vars["link_id"])
+		if err != nil {
+			writeError(w, "Failed to revoke link", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Link revoked successfully"})
+	}
+}
+
+// OpenPublicLinkHandler serves the note behind a public link without
+// authentication. The password, if the link has one, comes in the
+// X-Link-Password header or, on POST, in the body.
+func OpenPublicLinkHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := mux.Vars(r)["token"]
+
+		password := r.Header.Get(linkPasswordHeader)
+		if r.Method == http.MethodPost {
+			var body struct {
+				Password string `json:"password"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			password = body.Password
+		}
+
+		// keep the token out of caches and of referrers sent by the page
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+
+		note, err := service.OpenPublicLink(r.Context(), token, password)
+		if err != nil {
+			writeError(w, "Failed to open link", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, note)
+	}
+}
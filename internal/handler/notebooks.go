@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func CreateNotebookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var notebookReq domain.NotebookRequest
+		if err := json.NewDecoder(r.Body).Decode(&notebookReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		notebook, err := service.CreateNotebook(r.Context(), notebookReq)
+		if err != nil {
+			writeError(w, "Failed to create notebook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusCreated, notebook)
+	}
+}
+
+func ListNotebooksHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notebooks, err := service.ListNotebooks(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to list notebooks", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, notebooks)
+	}
+}
+
+func RenameNotebookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notebookID := mux.Vars(r)["notebook_id"]
+
+		var renameReq domain.RenameNotebookRequest
+		if err := json.NewDecoder(r.Body).Decode(&renameReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		notebook, err := service.RenameNotebook(r.Context(), notebookID, renameReq)
+		if err != nil {
+			writeError(w, "Failed to rename notebook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, notebook)
+	}
+}
+
+func MoveNotebookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notebookID := mux.Vars(r)["notebook_id"]
+
+		var moveReq domain.MoveNotebookRequest
+		if err := json.NewDecoder(r.Body).Decode(&moveReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		notebook, err := service.MoveNotebook(r.Context(), notebookID, moveReq)
+		if err != nil {
+			writeError(w, "Failed to move notebook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, notebook)
+	}
+}
+
+func DeleteNotebookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		notebookID := mux.Vars(r)["notebook_id"]
+
+		deleted, err := service.DeleteNotebook(r.Context(), notebookID)
+		if err != nil {
+			writeError(w, "Failed to delete notebook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, deleted)
+	}
+}
+
+func MoveNoteHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		var moveReq domain.MoveNoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&moveReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		note, err := service.MoveNote(r.Context(), noteID, moveReq)
+		if err != nil {
+			writeError(w, "Failed to move note", err)
+			return
+		}
+		w.Header().Set("ETag", etag(note.Version))
+		SuccessResponse(r.Context(), w, http.StatusOK, note)
+	}
+}
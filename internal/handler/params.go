@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+)
+
+// parseListNotesRequest reads the paging, sorting and filtering query
+// parameters shared by the list and search endpoints
+func parseListNotesRequest(r *http.Request) (domain.ListNotesRequest, error) {
+	query := r.URL.Query()
+	listReq := domain.ListNotesRequest{
+		Scope:      query.Get("scope"),
+		GroupID:    query.Get("group_id"),
+		NotebookID: query.Get("notebook_id"),
+		Sort:       query.Get("sort"),
+		Order:      query.Get("order"),
+		Cursor:     query.Get("cursor"),
+		// tag may be repeated or hold a comma separated list
+		Tags:    splitParam(query["tag"]),
+		TagMode: query.Get("tag_mode"),
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return listReq, fmt.Errorf("invalid limit %q", v)
+		}
+		listReq.Limit = limit
+	}
+
+	if v := query.Get("include_total"); v != "" {
+		includeTotal, err := strconv.ParseBool(v)
+		if err != nil {
+			return listReq, fmt.Errorf("invalid include_total %q", v)
+		}
+		listReq.IncludeTotal = includeTotal
+	}
+
+	// recursive also lists the notes of the notebook's descendants
+	if v := query.Get("recursive"); v != "" {
+		recursive, err := strconv.ParseBool(v)
+		if err != nil {
+			return listReq, fmt.Errorf("invalid recursive %q", v)
+		}
+		listReq.Recursive = recursive
+	}
+
+	for name, dst := range map[string]**time.Time{
+		"created_after":  &listReq.CreatedAfter,
+		"created_before": &listReq.CreatedBefore,
+		"updated_after":  &listReq.UpdatedAfter,
+		"updated_before": &listReq.UpdatedBefore,
+	} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return listReq, fmt.Errorf("invalid %s %q, expected an RFC 3339 timestamp", name, v)
+		}
+		*dst = &t
+	}
+
+	return listReq, nil
+}
+
+// splitParam splits the comma separated values of a repeated query
+// parameter
+func splitParam(values []string) []string {
+	var items []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func ListNoteRevisionsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		revisions, err := service.ListNoteRevisions(r.Context(), noteID)
+		if err != nil {
+			http.Error(w, "Failed to list revisions", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, revisions)
+	}
+}
+
+func GetNoteRevisionHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		number, err := strconv.Atoi(vars["number"])
+		if err != nil {
+			http.Error(w, "Invalid revision number", http.StatusBadRequest)
+			return
+		}
+
+		revision, err := service.GetNoteRevision(r.Context(), vars["note_id"], number)
+		if err != nil {
+			http.Error(w, "Failed to get revision", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, revision)
+	}
+}
+
+func DiffNoteRevisionsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		// both ends are optional and default to the latest change
+		var from, to int
+		for name, dst := range map[string]*int{"from": &from, "to": &to} {
+			v := r.URL.Query().Get(name)
+			if v == "" {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid "+name+" revision number", http.StatusBadRequest)
+				return
+			}
+			*dst = n
+		}
+
+		revisionDiff, err := service.DiffNoteRevisions(r.Context(), noteID, from, to)
+		if err != nil {
+			writeError(w, "Failed to diff revisions", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, revisionDiff)
+	}
+}
+
+func RestoreNoteRevisionHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		number, err := strconv.Atoi(vars["number"])
+		if err != nil {
+			http.Error(w, "Invalid revision number", http.StatusBadRequest)
+			return
+		}
+
+		note, err := service.RestoreNoteRevision(r.Context(), vars["note_id"], number)
+		if err != nil {
+			http.Error(w, "Failed to restore revision", errorStatus(err))
+			return
+		}
+		w.Header().Set("ETag", etag(note.Version))
+		SuccessResponse(r.Context(), w, http.StatusOK, note)
+	}
+}
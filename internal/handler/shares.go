@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func ListNoteSharesHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		shares, err := service.ListNoteShares(r.Context(), noteID)
+		if err != nil {
+			writeError(w, "Failed to list shares", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, shares)
+	}
+}
+
+func RevokeNoteShareHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		err := service.RevokeNoteShare(r.Context(), vars["note_id"], vars["username"])
+		if err != nil {
+			writeError(w, "Failed to revoke share", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Share revoked successfully"})
+	}
+}
+
+func ListIncomingSharesHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shares, err := service.ListIncomingShares(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to list shares", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, shares)
+	}
+}
+
+func ListOutgoingSharesHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		shares, err := service.ListOutgoingShares(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to list shares", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, shares)
+	}
+}
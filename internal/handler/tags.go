@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func AddNoteTagsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		var tagsReq domain.NoteTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&tagsReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tags, err := service.AddNoteTags(r.Context(), noteID, tagsReq)
+		if err != nil {
+			writeError(w, "Failed to tag note", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, tags)
+	}
+}
+
+func RemoveNoteTagHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+
+		tags, err := service.RemoveNoteTag(r.Context(), vars["note_id"], vars["tag"])
+		if err != nil {
+			writeError(w, "Failed to untag note", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, tags)
+	}
+}
+
+func ListTagsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tags, err := service.ListTags(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to list tags", errorStatus(err))
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, tags)
+	}
+}
+
+func RenameTagHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["tag"]
+
+		var renameReq domain.RenameTagRequest
+		if err := json.NewDecoder(r.Body).Decode(&renameReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tag, err := service.RenameTag(r.Context(), name, renameReq)
+		if err != nil {
+			writeError(w, "Failed to rename tag", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, tag)
+	}
+}
+
+func MergeTagsHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mergeReq domain.MergeTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&mergeReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		tag, err := service.MergeTags(r.Context(), mergeReq)
+		if err != nil {
+			writeError(w, "Failed to merge tags", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, tag)
+	}
+}
+
+func DeleteTagHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["tag"]
+
+		err := service.DeleteTag(r.Context(), name)
+		if err != nil {
+			writeError(w, "Failed to delete tag", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Tag deleted successfully"})
+	}
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func ListTrashHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		listReq, err := parseListNotesRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		notes, err := service.ListTrash(r.Context(), listReq)
+		if err != nil {
+			writeError(w, "Failed to list trash", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, notes)
+	}
+}
+
+func RestoreNoteHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		note, err := service.RestoreNote(r.Context(), noteID)
+		if err != nil {
+			writeError(w, "Failed to restore note", err)
+			return
+		}
+		w.Header().Set("ETag", etag(note.Version))
+		SuccessResponse(r.Context(), w, http.StatusOK, note)
+	}
+}
+
+func PurgeNoteHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		noteID := mux.Vars(r)["note_id"]
+
+		err := service.PurgeNote(r.Context(), noteID)
+		if err != nil {
+			writeError(w, "Failed to purge note", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Note permanently deleted"})
+	}
+}
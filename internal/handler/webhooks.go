@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/service"
+	"github.com/gorilla/mux"
+)
+
+func CreateWebhookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var webhookReq domain.WebhookRequest
+		if err := json.NewDecoder(r.Body).Decode(&webhookReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		hook, err := service.CreateWebhook(r.Context(), webhookReq)
+		if err != nil {
+			writeError(w, "Failed to create webhook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusCreated, hook)
+	}
+}
+
+func ListWebhooksHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hooks, err := service.ListWebhooks(r.Context())
+		if err != nil {
+			writeError(w, "Failed to list webhooks", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, hooks)
+	}
+}
+
+func GetWebhookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hook, err := service.GetWebhook(r.Context(), mux.Vars(r)["webhook_id"])
+		if err != nil {
+			writeError(w, "Failed to get webhook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, hook)
+	}
+}
+
+func UpdateWebhookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var updateReq domain.WebhookUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		hook, err := service.UpdateWebhook(r.Context(), mux.Vars(r)["webhook_id"], updateReq)
+		if err != nil {
+			writeError(w, "Failed to update webhook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, hook)
+	}
+}
+
+func DeleteWebhookHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := service.DeleteWebhook(r.Context(), mux.Vars(r)["webhook_id"]); err != nil {
+			writeError(w, "Failed to delete webhook", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, map[string]interface{}{"message": "Webhook deleted successfully"})
+	}
+}
+
+// ListWebhookDeliveriesHandler serves the delivery log of a webhook, the
+// latest limit deliveries, 100 by default
+func ListWebhookDeliveriesHandler(service service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 1000 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		deliveries, err := service.ListWebhookDeliveries(r.Context(), mux.Vars(r)["webhook_id"], limit)
+		if err != nil {
+			writeError(w, "Failed to list webhook deliveries", err)
+			return
+		}
+		SuccessResponse(r.Context(), w, http.StatusOK, deliveries)
+	}
+}
@@ -0,0 +1,391 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	gojwt "github.com/golang-jwt/jwt"
+	"github.com/sirupsen/logrus"
+)
+
+// Supported signing algorithms
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// supportedAlgs are the only algorithms ParseToken accepts
+var supportedAlgs = []string{AlgHS256, AlgRS256, AlgEdDSA}
+
+// Key is a single signing or verification key identified by its kid
+type Key struct {
+	ID     string
+	Method gojwt.SigningMethod
+	// signKey is nil for keys that can only verify tokens
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey creates an HS256 key from a shared secret
+func NewHMACKey(kid string, secret []byte) *Key {
+	return &Key{ID: kid, Method: gojwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// NewRSAKey creates an RS256 signing key. If kid is empty the RFC 7638
+// thumbprint of the public key is used.
+func NewRSAKey(kid string, privateKey *rsa.PrivateKey) *Key {
+	key := &Key{ID: kid, Method: gojwt.SigningMethodRS256, signKey: privateKey, verifyKey: &privateKey.PublicKey}
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key
+}
+
+// NewEd25519Key creates an EdDSA signing key. If kid is empty the RFC 7638
+// thumbprint of the public key is used.
+func NewEd25519Key(kid string, privateKey ed25519.PrivateKey) *Key {
+	key := &Key{ID: kid, Method: gojwt.SigningMethodEdDSA, signKey: privateKey, verifyKey: privateKey.Public()}
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key
+}
+
+// ParseKeyPEM creates a key from a PEM encoded RSA or Ed25519 private or
+// public key. Public keys can only be used for verification.
+func ParseKeyPEM(kid string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var key *Key
+	switch block.Type {
+	case "RSA PRIVATE KEY", "PRIVATE KEY":
+		if privateKey, err := gojwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key = &Key{Method: gojwt.SigningMethodRS256, signKey: privateKey, verifyKey: &privateKey.PublicKey}
+		} else if privateKey, err := gojwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key = &Key{Method: gojwt.SigningMethodEdDSA, signKey: privateKey, verifyKey: privateKey.(ed25519.PrivateKey).Public()}
+		}
+	case "RSA PUBLIC KEY", "PUBLIC KEY":
+		if publicKey, err := gojwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key = &Key{Method: gojwt.SigningMethodRS256, verifyKey: publicKey}
+		} else if publicKey, err := gojwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			key = &Key{Method: gojwt.SigningMethodEdDSA, verifyKey: publicKey}
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unsupported key type %q, expected an RSA or Ed25519 key", block.Type)
+	}
+
+	key.ID = kid
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key, nil
+}
+
+// GenerateKey creates a new random key for the given asymmetric algorithm
+func GenerateKey(alg string) (*Key, error) {
+	switch alg {
+	case AlgRS256:
+		privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return NewRSAKey("", privateKey), nil
+	case AlgEdDSA:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewEd25519Key("", privateKey), nil
+	default:
+		return nil, fmt.Errorf("cannot generate a key for algorithm %q", alg)
+	}
+}
+
+// CanSign reports whether the key holds private material
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// OKP (Ed25519)
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public part of the key, or false for symmetric keys which
+// must never be published
+func (k *Key) JWK() (JWK, bool) {
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Method.Alg(),
+			N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     k.ID,
+			Use:       "sig",
+			Algorithm: k.Method.Alg(),
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(pub),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of the public key
+func (k *Key) thumbprint() string {
+	jwk, ok := k.JWK()
+	if !ok {
+		return ""
+	}
+
+	// members in lexicographic order, as required by the RFC
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Keyring holds the key used to sign new tokens and every key that tokens
+// may still be verified with. Keeping retired keys around for verification
+// lets keys be rotated without invalidating tokens already handed out.
+type Keyring struct {
+	mu      sync.RWMutex
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring creates a keyring that signs with the given key
+func NewKeyring(signing *Key) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*Key)}
+	if err := k.Rotate(signing); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// AddVerificationKey adds a key that tokens may be verified with
+func (k *Keyring) AddVerificationKey(key *Key) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if key.ID == "" {
+		return errors.New("key id must not be empty")
+	}
+	if existing, ok := k.keys[key.ID]; ok && existing != key {
+		return fmt.Errorf("duplicate key id %q", key.ID)
+	}
+	k.keys[key.ID] = key
+	return nil
+}
+
+// Rotate makes key the signing key. The previous signing key stays in the
+// keyring for verification until it is removed.
+func (k *Keyring) Rotate(key *Key) error {
+	if !key.CanSign() {
+		return fmt.Errorf("key %q has no private key and cannot sign", key.ID)
+	}
+	if err := k.AddVerificationKey(key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.signing = key
+	return nil
+}
+
+// Remove drops a verification key. The current signing key cannot be removed.
+func (k *Keyring) Remove(kid string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.signing != nil && k.signing.ID == kid {
+		return fmt.Errorf("key %q is the current signing key", kid)
+	}
+	delete(k.keys, kid)
+	return nil
+}
+
+// SigningKey returns the key new tokens are signed with
+func (k *Keyring) SigningKey() *Key {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.signing
+}
+
+// Lookup returns the verification key with the given kid
+func (k *Keyring) Lookup(kid string) (*Key, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// JWKS returns the public keys of the keyring
+func (k *Keyring) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	// current signing key first, the rest in a stable order
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		if (jwks.Keys[i].KeyID == k.signing.ID) != (jwks.Keys[j].KeyID == k.signing.ID) {
+			return jwks.Keys[i].KeyID == k.signing.ID
+		}
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
+
+// sign signs the claims with the current signing key, setting the kid header
+func (k *Keyring) sign(claims gojwt.Claims) (string, error) {
+	key := k.SigningKey()
+	token := gojwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// keyFunc selects the verification key by the token's kid header and
+// rejects tokens whose algorithm does not match that key
+func (k *Keyring) keyFunc(token *gojwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+	key, ok := k.Lookup(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verifyKey, nil
+}
+
+// LoadKeyring builds a keyring from the configuration, reading keys from
+// disk. When an asymmetric algorithm is configured without a private key
+// file and generate is true, a throwaway key is generated; tokens signed
+// with it stop verifying when the process exits.
+func LoadKeyring(cfg config.JWTConfig, generate bool) (*Keyring, error) {
+	var signing *Key
+	switch {
+	case cfg.Algorithm == AlgHS256:
+		kid := cfg.KeyID
+		if kid == "" {
+			kid = "default"
+		}
+		signing = NewHMACKey(kid, []byte(cfg.SigningKey))
+	case cfg.PrivateKeyFile != "":
+		key, err := readKeyFile(cfg.KeyID, cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key.Method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("%s holds a %s key but the configured algorithm is %s", cfg.PrivateKeyFile, key.Method.Alg(), cfg.Algorithm)
+		}
+		signing = key
+	case generate:
+		key, err := GenerateKey(cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.KeyID != "" {
+			key.ID = cfg.KeyID
+		}
+		logrus.Warnf("no jwt private key file configured, generated a throwaway %s key %s", cfg.Algorithm, key.ID)
+		signing = key
+	default:
+		return nil, fmt.Errorf("a private key file is required for %s", cfg.Algorithm)
+	}
+
+	k, err := NewKeyring(signing)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range cfg.VerificationKeyFiles {
+		kid, path := "", entry
+		if i := strings.Index(entry, "="); i >= 0 {
+			kid, path = entry[:i], entry[i+1:]
+		}
+		key, err := readKeyFile(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.AddVerificationKey(key); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return k, nil
+}
+
+func readKeyFile(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key file: %w", err)
+	}
+	key, err := ParseKeyPEM(kid, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
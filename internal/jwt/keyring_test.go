@@ -0,0 +1,338 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	gojwt "github.com/golang-jwt/jwt"
+)
+
+func testClaims() gojwt.MapClaims {
+	return gojwt.MapClaims{"id": "user-1", "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+// verify parses the token the way ParseToken does, against the keyring
+func verify(k *Keyring, token string) error {
+	parser := &gojwt.Parser{ValidMethods: supportedAlgs}
+	_, err := parser.Parse(token, k.keyFunc)
+	return err
+}
+
+func generateKey(t *testing.T, alg string) *Key {
+	t.Helper()
+	key, err := GenerateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newKeyring(t *testing.T, signing *Key) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(signing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func sign(t *testing.T, k *Keyring) string {
+	t.Helper()
+	token, err := k.sign(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestKeyringVerifies(t *testing.T) {
+	for _, signing := range []*Key{
+		NewHMACKey("hmac", []byte("secret")),
+		generateKey(t, AlgRS256),
+		generateKey(t, AlgEdDSA),
+	} {
+		k := newKeyring(t, signing)
+		if err := verify(k, sign(t, k)); err != nil {
+			t.Errorf("%s token did not verify: %v", signing.Method.Alg(), err)
+		}
+	}
+}
+
+func TestKeyringRejectsKid(t *testing.T) {
+	k := newKeyring(t, NewHMACKey("known", []byte("secret")))
+
+	noKid, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, testClaims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(k, noKid); err == nil {
+		t.Error("token without a kid verified")
+	}
+
+	unknown := gojwt.NewWithClaims(gojwt.SigningMethodHS256, testClaims())
+	unknown.Header["kid"] = "unknown"
+	unknownKid, err := unknown.SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(k, unknownKid); err == nil {
+		t.Error("token with an unknown kid verified")
+	}
+}
+
+func TestKeyringRejectsAlgorithmMismatch(t *testing.T) {
+	rsaKey := generateKey(t, AlgRS256)
+	k := newKeyring(t, rsaKey)
+
+	// the classic confusion: HS256 keyed with the public key, which
+	// anyone can fetch from the JWKS
+	der, err := x509.MarshalPKIXPublicKey(rsaKey.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	forged := gojwt.NewWithClaims(gojwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = rsaKey.ID
+	token, err := forged.SignedString(publicPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(k, token); err == nil {
+		t.Error("HS256 token signed with the RSA public key verified")
+	}
+
+	none := gojwt.NewWithClaims(gojwt.SigningMethodNone, testClaims())
+	none.Header["kid"] = rsaKey.ID
+	token, err = none.SignedString(gojwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(k, token); err == nil {
+		t.Error("unsigned token verified")
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	old := generateKey(t, AlgEdDSA)
+	k := newKeyring(t, old)
+	oldToken := sign(t, k)
+
+	next := generateKey(t, AlgRS256)
+	if err := k.Rotate(next); err != nil {
+		t.Fatal(err)
+	}
+	newToken := sign(t, k)
+	if k.SigningKey() != next {
+		t.Fatal("rotating did not change the signing key")
+	}
+	if err := verify(k, oldToken); err != nil {
+		t.Errorf("token of the previous key stopped verifying on rotation: %v", err)
+	}
+	if err := verify(k, newToken); err != nil {
+		t.Errorf("token of the new key: %v", err)
+	}
+
+	if err := k.Remove(next.ID); err == nil {
+		t.Error("removed the signing key")
+	}
+	if err := k.Remove(old.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(k, oldToken); err == nil {
+		t.Error("token of a removed key verified")
+	}
+	if err := verify(k, newToken); err != nil {
+		t.Errorf("token of the signing key stopped verifying: %v", err)
+	}
+
+	public, _ := ParseKeyPEM("public", publicKeyPEM(t, next))
+	if err := k.Rotate(public); err == nil {
+		t.Error("rotated to a key without private material")
+	}
+	if err := k.AddVerificationKey(NewHMACKey(next.ID, []byte("other"))); err == nil {
+		t.Error("added a second key under an existing kid")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, edKey := generateKey(t, AlgRS256), generateKey(t, AlgEdDSA)
+	k := newKeyring(t, edKey)
+	for _, key := range []*Key{rsaKey, NewHMACKey("hmac", []byte("secret"))} {
+		if err := k.AddVerificationKey(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jwks := k.JWKS()
+	if len(jwks.Keys) != 2 || jwks.Keys[0].KeyID != edKey.ID || jwks.Keys[1].KeyID != rsaKey.ID {
+		t.Fatalf("JWKS = %+v, want the Ed25519 signing key then the RSA key, and no HMAC key", jwks)
+	}
+	data, err := json.Marshal(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Keys []map[string]interface{} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range raw.Keys {
+		// d, p, q, dp, dq and qi are the private RSA members, d the
+		// private OKP one, k a symmetric key
+		for _, private := range []string{"d", "p", "q", "dp", "dq", "qi", "k"} {
+			if _, ok := key[private]; ok {
+				t.Errorf("JWK %v has private member %q", key["kid"], private)
+			}
+		}
+	}
+	if jwks.Keys[1].E != "AQAB" || jwks.Keys[0].Curve != "Ed25519" || jwks.Keys[0].Algorithm != AlgEdDSA {
+		t.Errorf("JWKS = %+v", jwks)
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// the examples of RFC 7638 section 3.1 and RFC 8037 appendix A.3
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := &Key{Method: gojwt.SigningMethodRS256, verifyKey: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}}
+	if got, want := rsaKey.thumbprint(), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("RSA thumbprint = %s, want %s", got, want)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey := &Key{Method: gojwt.SigningMethodEdDSA, verifyKey: ed25519.PublicKey(x)}
+	if got, want := edKey.thumbprint(), "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; got != want {
+		t.Errorf("Ed25519 thumbprint = %s, want %s", got, want)
+	}
+
+	if NewHMACKey("hmac", []byte("secret")).thumbprint() != "" {
+		t.Error("HMAC key has a thumbprint")
+	}
+}
+
+func privateKeyPEM(t *testing.T, key *Key) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key.signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func publicKeyPEM(t *testing.T, key *Key) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaPrivate)})
+	rsaKey, edKey := NewRSAKey("", rsaPrivate), generateKey(t, AlgEdDSA)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		signer  *Key
+		alg     string
+		canSign bool
+	}{
+		{"RSA PKCS#1 private key", pkcs1, rsaKey, AlgRS256, true},
+		{"RSA PKCS#8 private key", privateKeyPEM(t, rsaKey), rsaKey, AlgRS256, true},
+		{"RSA public key", publicKeyPEM(t, rsaKey), rsaKey, AlgRS256, false},
+		{"Ed25519 private key", privateKeyPEM(t, edKey), edKey, AlgEdDSA, true},
+		{"Ed25519 public key", publicKeyPEM(t, edKey), edKey, AlgEdDSA, false},
+	}
+	for _, tt := range tests {
+		key, err := ParseKeyPEM("", tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if key.Method.Alg() != tt.alg || key.CanSign() != tt.canSign {
+			t.Errorf("%s: parsed as %s, can sign %v", tt.name, key.Method.Alg(), key.CanSign())
+		}
+		// kids default to the thumbprint, which the signer has too
+		if key.ID != tt.signer.ID {
+			t.Errorf("%s: kid %s, want the thumbprint %s", tt.name, key.ID, tt.signer.ID)
+		}
+		k := newKeyring(t, tt.signer)
+		k.keys[key.ID] = key
+		if err := verify(k, sign(t, newKeyring(t, tt.signer))); err != nil {
+			t.Errorf("%s: does not verify the signer's tokens: %v", tt.name, err)
+		}
+	}
+
+	if key, err := ParseKeyPEM("mine", publicKeyPEM(t, edKey)); err != nil || key.ID != "mine" {
+		t.Errorf("kid given: got %v, %v", key, err)
+	}
+	for _, invalid := range [][]byte{[]byte("not PEM"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("x")})} {
+		if _, err := ParseKeyPEM("", invalid); err == nil {
+			t.Errorf("parsed %q", invalid)
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	signing, old := generateKey(t, AlgRS256), generateKey(t, AlgEdDSA)
+	privatePath := write("signing.pem", privateKeyPEM(t, signing))
+	oldPath := write("old.pem", publicKeyPEM(t, old))
+
+	k, err := LoadKeyring(config.JWTConfig{
+		Algorithm:            AlgRS256,
+		KeyID:                "current",
+		PrivateKeyFile:       privatePath,
+		VerificationKeyFiles: []string{"previous=" + oldPath},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.SigningKey().ID != "current" {
+		t.Errorf("signing with %s, want current", k.SigningKey().ID)
+	}
+	if key, ok := k.Lookup("previous"); !ok || key.CanSign() {
+		t.Errorf("previous key loaded as %+v, %v", key, ok)
+	}
+
+	if _, err := LoadKeyring(config.JWTConfig{Algorithm: AlgEdDSA, PrivateKeyFile: privatePath}, false); err == nil || !strings.Contains(err.Error(), "RS256") {
+		t.Errorf("loading an RSA key for EdDSA: got %v", err)
+	}
+	if _, err := LoadKeyring(config.JWTConfig{Algorithm: AlgEdDSA}, false); err == nil {
+		t.Error("loaded an EdDSA keyring without a key")
+	}
+	if k, err := LoadKeyring(config.JWTConfig{Algorithm: AlgEdDSA, KeyID: "dev"}, true); err != nil || k.SigningKey().ID != "dev" {
+		t.Errorf("generating a dev key: %v", err)
+	}
+}
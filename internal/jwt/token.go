@@ -1,35 +1,66 @@
 package jwt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"time"
 
 	gojwt "github.com/golang-jwt/jwt"
 	"github.com/sirupsen/logrus"
 )
 
-var signKey = []byte("secret")
+// keyring holds the keys tokens are signed and verified with
+var keyring, _ = NewKeyring(NewHMACKey("default", []byte("secret")))
+
+// accessTokenTTL is how long an access token stays valid after it is issued
+var accessTokenTTL = 15 * time.Minute
+
+// SetKeyring sets the keys used to sign and verify tokens
+func SetKeyring(k *Keyring) {
+	keyring = k
+}
+
+// DefaultKeyring returns the keyring used to sign and verify tokens
+func DefaultKeyring() *Keyring {
+	return keyring
+}
+
+// SetAccessTokenTTL sets the lifetime of newly issued access tokens
+func SetAccessTokenTTL(ttl time.Duration) {
+	accessTokenTTL = ttl
+}
+
+// ticketUse is the use claim of tickets, which sets them apart from access
+// tokens
+const ticketUse = "ticket"
 
 type UserInfo struct {
-	UserID   string
-	UserName string
+	UserID    string
+	UserName  string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+// Token is a signed access token along with the claims needed to track it
+type Token struct {
+	Value     string
+	ID        string
+	ExpiresAt time.Time
 }
 
 // ParseToken validates and parses the given JWT returning the claims
 func ParseToken(tokenString string) (claims gojwt.MapClaims, err error) {
 
-	token, err := gojwt.Parse(tokenString, func(token *gojwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*gojwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return signKey, nil
-	})
+	parser := &gojwt.Parser{ValidMethods: supportedAlgs}
+	token, err := parser.Parse(tokenString, keyring.keyFunc)
 	if err != nil {
 		return gojwt.MapClaims{}, err
 	}
 
 	claims, ok := token.Claims.(gojwt.MapClaims)
 	if !ok || !token.Valid {
-		return gojwt.MapClaims{}, err
+		return gojwt.MapClaims{}, fmt.Errorf("invalid token")
 	}
 
 	return claims, nil
@@ -43,33 +74,115 @@ func GetUserInfoFromToken(tokenString string) (userInfo UserInfo, err error) {
 		return userInfo, err
 	}
 
-	if claims["id"] == nil || claims["username"] == nil {
+	// tickets only authenticate the requests they were issued for
+	if _, ok := claims["use"]; ok {
+		return userInfo, fmt.Errorf("invalid token")
+	}
+
+	return userInfoFromClaims(claims)
+}
+
+// GetUserInfoFromTicket validates a ticket and returns the userInfo of the
+// access token it was issued with
+func GetUserInfoFromTicket(ticket string) (userInfo UserInfo, err error) {
+	claims, err := ParseToken(ticket)
+	if err != nil {
+		logrus.Errorf("error parsing ticket\nError: %s", err.Error())
+		return userInfo, err
+	}
+	if use, _ := claims["use"].(string); use != ticketUse {
+		return userInfo, fmt.Errorf("invalid ticket")
+	}
+
+	return userInfoFromClaims(claims)
+}
+
+func userInfoFromClaims(claims gojwt.MapClaims) (userInfo UserInfo, err error) {
+	userID, _ := claims["id"].(string)
+	username, _ := claims["username"].(string)
+	tokenID, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+	// tokens issued before expiry was introduced carry no exp or jti and
+	// would otherwise be valid forever
+	if userID == "" || username == "" || tokenID == "" || exp == 0 {
 		return userInfo, fmt.Errorf("invalid token")
 	}
 
 	userInfo = UserInfo{
-		UserID:   claims["id"].(string),
-		UserName: claims["username"].(string),
+		UserID:    userID,
+		UserName:  username,
+		TokenID:   tokenID,
+		ExpiresAt: time.Unix(int64(exp), 0),
 	}
 
 	return userInfo, nil
 }
 
-// GenerateToken generates a JWT token for the given user
-func GenerateToken(userID, username string) (tokenString string, err error) {
+// GenerateToken generates a short-lived JWT access token for the given user
+func GenerateToken(userID, username string) (Token, error) {
+	tokenID, err := newTokenID()
+	if err != nil {
+		logrus.Errorf("error generating token id\nError: %s", err.Error())
+		return Token{}, err
+	}
 
+	now := time.Now()
+	expiresAt := now.Add(accessTokenTTL)
 	claims := gojwt.MapClaims{
 		"id":       userID,
 		"username": username,
+		"jti":      tokenID,
+		"iat":      now.Unix(),
+		"exp":      expiresAt.Unix(),
 	}
 
-	token := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims)
-
-	tokenString, err = token.SignedString(signKey)
+	tokenString, err := keyring.sign(claims)
 	if err != nil {
 		logrus.Errorf("error generating token\nError: %s", err.Error())
-		return "", err
+		return Token{}, err
+	}
+
+	return Token{
+		Value:     tokenString,
+		ID:        tokenID,
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0),
+	}, nil
+}
+
+// GenerateTicket generates a ticket valid for ttl that stands for the access
+// token of the given ID. Browsers pass it in the URL of event streams and
+// WebSockets, where they cannot set an Authorization header, so it is kept
+// short-lived. It carries the access token's ID, so that revoking the
+// access token revokes its tickets.
+func GenerateTicket(userID, username, tokenID string, ttl time.Duration) (Token, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := gojwt.MapClaims{
+		"id":       userID,
+		"username": username,
+		"jti":      tokenID,
+		"use":      ticketUse,
+		"iat":      now.Unix(),
+		"exp":      expiresAt.Unix(),
+	}
+
+	ticket, err := keyring.sign(claims)
+	if err != nil {
+		logrus.Errorf("error generating ticket\nError: %s", err.Error())
+		return Token{}, err
 	}
 
-	return tokenString, nil
+	return Token{
+		Value:     ticket,
+		ID:        tokenID,
+		ExpiresAt: time.Unix(expiresAt.Unix(), 0),
+	}, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
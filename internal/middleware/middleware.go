@@ -11,7 +11,6 @@ import (
 	"github.com/GauravMakhijani/notes/internal/jwt"
 	gojwt "github.com/golang-jwt/jwt"
 	"github.com/sirupsen/logrus"
-	"golang.org/x/time/rate"
 )
 
 type Response struct {
@@ -44,43 +43,79 @@ func ErrResponse(ctx context.Context, w http.ResponseWriter, statusCode int, err
 	}
 }
 
-func SetMiddleWareAuthentication(next http.HandlerFunc) http.HandlerFunc {
-	return func(rw http.ResponseWriter, r *http.Request) {
-
-		reqKey := r.Header.Get("Authorization")
+// RevocationChecker reports whether an access token was revoked before it expired
+type RevocationChecker interface {
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+}
 
-		if len(reqKey) > 6 && strings.ToUpper(reqKey[0:7]) == "BEARER " {
-			reqKey = reqKey[7:]
+// SetMiddleWareAuthentication returns a middleware that only lets requests
+// with a valid, unrevoked bearer token through
+func SetMiddleWareAuthentication(checker RevocationChecker) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			userInfo, err := jwt.GetUserInfoFromToken(bearerToken(r))
+			authenticate(checker, next, rw, r, userInfo, err)
 		}
+	}
+}
 
-		userInfo, err := jwt.GetUserInfoFromToken(reqKey)
-		if err != nil {
-			if e, ok := err.(*gojwt.ValidationError); ok && e.Errors == gojwt.ValidationErrorExpired {
-				ErrResponse(r.Context(), rw, http.StatusUnauthorized, 0, errors.New("token expired"))
-				return
+// SetMiddleWareStreamAuthentication returns a middleware for event streams
+// and WebSockets, which browsers open without a way to set headers. Besides
+// a bearer token, it lets requests through with a valid ticket in the
+// ticket query parameter.
+func SetMiddleWareStreamAuthentication(checker RevocationChecker) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(rw http.ResponseWriter, r *http.Request) {
+			var userInfo jwt.UserInfo
+			var err error
+			if ticket := r.URL.Query().Get("ticket"); ticket != "" && r.Header.Get("Authorization") == "" {
+				userInfo, err = jwt.GetUserInfoFromTicket(ticket)
+			} else {
+				userInfo, err = jwt.GetUserInfoFromToken(bearerToken(r))
 			}
-			ErrResponse(r.Context(), rw, http.StatusUnauthorized, 0, errors.New("invalid token"))
-			return
+			authenticate(checker, next, rw, r, userInfo, err)
 		}
+	}
+}
 
-		ctx := r.Context()
-		ctx = context.WithValue(ctx, "user_id", userInfo.UserID)
-		ctx = context.WithValue(ctx, "user_name", userInfo.UserName)
-		requestWithValueContext := r.WithContext(ctx)
-		next(rw, requestWithValueContext)
+// bearerToken returns the token of the Authorization header
+func bearerToken(r *http.Request) string {
+	reqKey := r.Header.Get("Authorization")
+
+	if len(reqKey) > 6 && strings.ToUpper(reqKey[0:7]) == "BEARER " {
+		reqKey = reqKey[7:]
 	}
+	return reqKey
 }
 
-func RateLimiter(next http.Handler) http.Handler {
-	limiter := rate.NewLimiter(10, 20)
-	fmt.Println("limiter", limiter.Limit(), limiter.Burst())
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !limiter.Allow() {
-			fmt.Println("Request rejected: Too many requests")
-			ErrResponse(r.Context(), w, http.StatusTooManyRequests, 0, errors.New("too many requests"))
+// authenticate calls next with the user in the request context if the
+// token they were read from is valid and was not revoked
+func authenticate(checker RevocationChecker, next http.HandlerFunc, rw http.ResponseWriter, r *http.Request, userInfo jwt.UserInfo, err error) {
+	if err != nil {
+		if e, ok := err.(*gojwt.ValidationError); ok && e.Errors&gojwt.ValidationErrorExpired != 0 {
+			ErrResponse(r.Context(), rw, http.StatusUnauthorized, 0, errors.New("token expired"))
 			return
-		} else {
-			next.ServeHTTP(w, r)
 		}
-	})
+		ErrResponse(r.Context(), rw, http.StatusUnauthorized, 0, errors.New("invalid token"))
+		return
+	}
+
+	revoked, err := checker.IsTokenRevoked(r.Context(), userInfo.TokenID)
+	if err != nil {
+		logrus.Errorf("error checking token revocation\nError: %s", err.Error())
+		WriteServerErrorResponse(r.Context(), rw)
+		return
+	}
+	if revoked {
+		ErrResponse(r.Context(), rw, http.StatusUnauthorized, 0, errors.New("token revoked"))
+		return
+	}
+
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, "user_id", userInfo.UserID)
+	ctx = context.WithValue(ctx, "user_name", userInfo.UserName)
+	ctx = context.WithValue(ctx, "token_id", userInfo.TokenID)
+	ctx = context.WithValue(ctx, "token_expires_at", userInfo.ExpiresAt)
+	requestWithValueContext := r.WithContext(ctx)
+	next(rw, requestWithValueContext)
 }
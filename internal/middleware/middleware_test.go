@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/jwt"
+)
+
+// revokedTokens is a RevocationChecker over a fixed set of token IDs
+type revokedTokens map[string]bool
+
+func (r revokedTokens) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return r[tokenID], nil
+}
+
+func TestStreamAuthentication(t *testing.T) {
+	token, err := jwt.GenerateToken("user-1", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticket, err := jwt.GenerateTicket("user-1", "alice", token.ID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedToken, _ := jwt.GenerateToken("user-1", "alice")
+	revokedTicket, _ := jwt.GenerateTicket("user-1", "alice", revokedToken.ID, time.Minute)
+	expiredTicket, _ := jwt.GenerateTicket("user-1", "alice", token.ID, -time.Minute)
+	checker := revokedTokens{revokedToken.ID: true}
+
+	tests := []struct {
+		name   string
+		stream bool
+		bearer string
+		ticket string
+		want   int
+	}{
+		{"bearer token", false, token.Value, "", http.StatusOK},
+		{"bearer token on a stream", true, token.Value, "", http.StatusOK},
+		{"ticket on a stream", true, "", ticket.Value, http.StatusOK},
+		{"ticket elsewhere", false, "", ticket.Value, http.StatusUnauthorized},
+		{"ticket as bearer token", true, ticket.Value, "", http.StatusUnauthorized},
+		{"access token as ticket", true, "", token.Value, http.StatusUnauthorized},
+		{"expired ticket", true, "", expiredTicket.Value, http.StatusUnauthorized},
+		{"ticket of a revoked token", true, "", revokedTicket.Value, http.StatusUnauthorized},
+		{"nothing", true, "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			middleware := SetMiddleWareAuthentication(checker)
+			if tt.stream {
+				middleware = SetMiddleWareStreamAuthentication(checker)
+			}
+			var userID interface{}
+			handler := middleware(func(w http.ResponseWriter, r *http.Request) {
+				userID = r.Context().Value("user_id")
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/api/events?ticket="+tt.ticket, nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && userID != "user-1" {
+				t.Fatalf("user_id = %v, want user-1", userID)
+			}
+		})
+	}
+}
+
+func TestAuthenticationRejectsExpiredTokens(t *testing.T) {
+	jwt.SetAccessTokenTTL(-time.Minute)
+	expired, err := jwt.GenerateToken("user-1", "alice")
+	jwt.SetAccessTokenTTL(15 * time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reached := false
+	handler := SetMiddleWareAuthentication(revokedTokens{})(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	})
+	r := httptest.NewRequest(http.MethodGet, "/api/notes", nil)
+	r.Header.Set("Authorization", "Bearer "+expired.Value)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != http.StatusUnauthorized || reached {
+		t.Errorf("expired token: status %d, handler reached %v, want 401", w.Code, reached)
+	}
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	"github.com/GauravMakhijani/notes/internal/jwt"
+	"golang.org/x/time/rate"
+)
+
+// ClientIP returns a middleware that stores the client's IP address in the
+// request context under "client_ip". Proxy headers are only honoured when
+// trustProxyHeaders is set, otherwise any client could spoof them. Proxies
+// append the address they were connected from to X-Forwarded-For, so with
+// proxyHops proxies in front of the server the client is the entry that
+// many from the right; those further left were sent by the client.
+func ClientIP(trustProxyHeaders bool, proxyHops int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := remoteIP(r)
+			if trustProxyHeaders {
+				if forwarded := forwardedFor(r); len(forwarded) > 0 {
+					// garbage there means a proxy is missing or misconfigured
+					if client := forwarded[max(len(forwarded)-proxyHops, 0)]; net.ParseIP(client) != nil {
+						ip = client
+					}
+				} else if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+					ip = realIP
+				}
+			}
+			ctx := context.WithValue(r.Context(), "client_ip", ip)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// forwardedFor returns the entries of every X-Forwarded-For header, in
+// order
+func forwardedFor(r *http.Request) []string {
+	var entries []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(header, ",") {
+			entries = append(entries, strings.TrimSpace(entry))
+		}
+	}
+	return entries
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// bucket is the token bucket of a single client
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// limiterStore holds one bucket per client and evicts buckets that have
+// been idle for longer than idleTimeout
+type limiterStore struct {
+	mu          sync.Mutex
+	limit       rate.Limit
+	burst       int
+	idleTimeout time.Duration
+	buckets     map[string]*bucket
+	lastSweep   time.Time
+}
+
+func (s *limiterStore) get(key string, now time.Time) *rate.Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// sweeping lazily keeps the store free of background goroutines
+	if now.Sub(s.lastSweep) > s.idleTimeout {
+		for k, b := range s.buckets {
+			if now.Sub(b.lastSeen) > s.idleTimeout {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(s.limit, s.burst)}
+		s.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b.limiter
+}
+
+// RateLimiter returns a middleware that limits each client to the policy's
+// rate. Clients are keyed by the user ID of a valid bearer token, falling
+// back to the IP address stored by ClientIP. Handlers wrapped by the same
+// RateLimiter share its buckets. Every response carries RateLimit-Limit and
+// RateLimit-Remaining headers, and rejected requests get a Retry-After header.
+func RateLimiter(policy config.RateLimitPolicy, idleTimeout time.Duration) func(http.Handler) http.Handler {
+	buckets := &limiterStore{
+		limit:       rate.Limit(policy.RequestsPerSecond),
+		burst:       policy.Burst,
+		idleTimeout: idleTimeout,
+		buckets:     make(map[string]*bucket),
+		lastSweep:   time.Now(),
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+			limiter := buckets.get(rateLimitKey(r), now)
+
+			allowed := limiter.AllowN(now, 1)
+			tokens := limiter.TokensAt(now)
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+
+			if !allowed {
+				wait := (1 - tokens) / policy.RequestsPerSecond
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait))))
+				ErrResponse(r.Context(), w, http.StatusTooManyRequests, 0, errors.New("too many requests"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the client a request is counted against
+func rateLimitKey(r *http.Request) string {
+	reqKey := r.Header.Get("Authorization")
+	if len(reqKey) > 6 && strings.ToUpper(reqKey[0:7]) == "BEARER " {
+		if claims, err := jwt.ParseToken(reqKey[7:]); err == nil {
+			if userID, ok := claims["id"].(string); ok && userID != "" {
+				return "user:" + userID
+			}
+		}
+	}
+
+	ip, _ := r.Context().Value("client_ip").(string)
+	if ip == "" {
+		ip = remoteIP(r)
+	}
+	return "ip:" + ip
+}
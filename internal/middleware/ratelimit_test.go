@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	"github.com/GauravMakhijani/notes/internal/jwt"
+	"golang.org/x/time/rate"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		hops      int
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"headers not trusted", false, 1, []string{"203.0.113.9"}, "203.0.113.8", "192.0.2.1"},
+		{"no headers", true, 1, nil, "", "192.0.2.1"},
+		{"one proxy", true, 1, []string{"203.0.113.9"}, "", "203.0.113.9"},
+		{"one proxy, forged entry", true, 1, []string{"10.0.0.1, 203.0.113.9"}, "", "203.0.113.9"},
+		{"two proxies", true, 2, []string{"10.0.0.1, 203.0.113.9, 198.51.100.7"}, "", "203.0.113.9"},
+		{"two proxies, separate headers", true, 2, []string{"10.0.0.1, 203.0.113.9", "198.51.100.7"}, "", "203.0.113.9"},
+		{"fewer entries than proxies", true, 3, []string{"203.0.113.9, 198.51.100.7"}, "", "203.0.113.9"},
+		{"not an address", true, 1, []string{"203.0.113.9, garbage"}, "", "192.0.2.1"},
+		{"forged garbage", true, 1, []string{"garbage, 203.0.113.9"}, "", "203.0.113.9"},
+		{"real IP", true, 1, nil, "203.0.113.8", "203.0.113.8"},
+		{"forwarded over real IP", true, 1, []string{"203.0.113.9"}, "203.0.113.8", "203.0.113.9"},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		handler := ClientIP(tt.trust, tt.hops)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r.Context().Value("client_ip")
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		for _, forwarded := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if got != tt.want {
+			t.Errorf("%s: client IP %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// limitedRequest sends a request through the rate limited handler, from
+// the IP and, when given, with the access token
+func limitedRequest(handler http.Handler, ip, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/notes", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "client_ip", ip))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimiterHeaders(t *testing.T) {
+	handler := RateLimiter(config.RateLimitPolicy{RequestsPerSecond: 0.5, Burst: 2}, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, remaining := range []string{"1", "0"} {
+		w := limitedRequest(handler, "203.0.113.9", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d", i+1, w.Code)
+		}
+		if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("request %d: limit %s, remaining %s, want 2 and %s", i+1, w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"), remaining)
+		}
+		if w.Header().Get("Retry-After") != "" {
+			t.Errorf("request %d: Retry-After on an allowed request", i+1)
+		}
+	}
+
+	w := limitedRequest(handler, "203.0.113.9", "")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst: status %d, want 429", w.Code)
+	}
+	// a token is back within 2s at 0.5 per second
+	if retryAfter := w.Header().Get("Retry-After"); retryAfter != "2" {
+		t.Errorf("Retry-After %q, want 2", retryAfter)
+	}
+	if w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("remaining %s after a rejection, want 0", w.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	handler := RateLimiter(config.RateLimitPolicy{RequestsPerSecond: 0.001, Burst: 1}, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	alice, err := jwt.GenerateToken("alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _ := jwt.GenerateToken("bob", "bob")
+
+	tests := []struct {
+		name  string
+		ip    string
+		token string
+		want  int
+	}{
+		{"first from an IP", "203.0.113.9", "", http.StatusOK},
+		{"again from the IP", "203.0.113.9", "", http.StatusTooManyRequests},
+		{"another IP", "203.0.113.10", "", http.StatusOK},
+		{"a user, from the exhausted IP", "203.0.113.9", alice.Value, http.StatusOK},
+		{"the user from another IP", "198.51.100.7", alice.Value, http.StatusTooManyRequests},
+		{"another user", "203.0.113.9", bob.Value, http.StatusOK},
+		{"an invalid token counts against the IP", "203.0.113.10", "invalid", http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		if w := limitedRequest(handler, tt.ip, tt.token); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+}
+
+func TestLimiterStoreEvictsIdleBuckets(t *testing.T) {
+	start := time.Now()
+	store := &limiterStore{
+		limit:       rate.Limit(1),
+		burst:       1,
+		idleTimeout: time.Minute,
+		buckets:     make(map[string]*bucket),
+		lastSweep:   start,
+	}
+
+	idle := store.get("ip:idle", start)
+	idle.AllowN(start, 1)
+	store.get("ip:active", start)
+	store.get("ip:active", start.Add(50*time.Second))
+
+	// the sweep runs once the idle timeout passed since the last one
+	now := start.Add(90 * time.Second)
+	store.get("ip:other", now)
+	if _, ok := store.buckets["ip:idle"]; ok {
+		t.Error("idle bucket kept")
+	}
+	if _, ok := store.buckets["ip:active"]; !ok {
+		t.Error("bucket used within the idle timeout evicted")
+	}
+	if store.get("ip:idle", now) == idle {
+		t.Error("evicted bucket reused")
+	}
+	if len(store.buckets) != 3 {
+		t.Errorf("%d buckets, want 3", len(store.buckets))
+	}
+}
@@ -0,0 +1,219 @@
+// Package render turns note text into sanitized HTML and derives metadata
+// from it: the word count, the table of contents and the outbound links.
+//
+// Markdown follows CommonMark with the GitHub extensions (tables,
+// strikethrough, task lists and bare URLs as links). Raw HTML in notes is
+// dropped and the generated HTML is sanitized, so the output is safe to
+// insert into a page.
+package render
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// Heading is an entry of a document's table of contents
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	// ID is the id attribute of the heading in the HTML, for linking to it
+	ID string `json:"id"`
+}
+
+// Document is a rendered note
+type Document struct {
+	HTML      string
+	WordCount int
+	Headings  []Heading
+	// Links are the distinct http and https URLs linked to, in the order
+	// they first appear
+	Links []string
+}
+
+var (
+	markdown = goldmark.New(
+		goldmark.WithExtensions(extension.GFM),
+		goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+	)
+
+	// policy is the sanitizer applied to all generated HTML. On top of
+	// the defaults for user content it keeps heading ids, code block
+	// languages and the disabled checkboxes of task lists.
+	policy = func() *bluemonday.Policy {
+		p := bluemonday.UGCPolicy()
+		p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\w-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+		p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+		p.AllowAttrs("checked", "disabled").OnElements("input")
+		return p
+	}()
+
+	// urlPattern finds URLs in plain text
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+	// paragraphBreak separates the paragraphs of plain text
+	paragraphBreak = regexp.MustCompile(`\n\s*\n`)
+)
+
+// Markdown renders markdown text
+func Markdown(source string) (*Document, error) {
+	src := []byte(source)
+	root := markdown.Parser().Parse(text.NewReader(src))
+
+	doc := &Document{Headings: []Heading{}}
+	links := newLinkSet()
+	var words strings.Builder
+	err := ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		// blocks never run into each other's words
+		if n.Type() == ast.TypeBlock {
+			words.WriteByte(' ')
+		}
+
+		switch n := n.(type) {
+		case *ast.Heading:
+			heading := Heading{Level: n.Level, Text: string(n.Text(src))}
+			if id, ok := n.AttributeString("id"); ok {
+				if id, ok := id.([]byte); ok {
+					heading.ID = string(id)
+				}
+			}
+			doc.Headings = append(doc.Headings, heading)
+		case *ast.Text:
+			words.Write(n.Segment.Value(src))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				words.WriteByte(' ')
+			}
+		case *ast.String:
+			words.Write(n.Value)
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				segment := lines.At(i)
+				words.Write(segment.Value(src))
+			}
+		case *ast.Link:
+			links.add(string(n.Destination))
+		case *ast.AutoLink:
+			if n.AutoLinkType == ast.AutoLinkURL {
+				links.add(string(n.URL(src)))
+			}
+			words.Write(n.Label(src))
+		case *ast.HTMLBlock, *ast.RawHTML:
+			// dropped from the output, so not counted either
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := markdown.Renderer().Render(&out, src, root); err != nil {
+		return nil, err
+	}
+	doc.HTML = policy.Sanitize(out.String())
+	doc.WordCount = countWords(words.String())
+	doc.Links = links.urls
+	return doc, nil
+}
+
+// Plain renders plain text: paragraphs are separated by blank lines, line
+// breaks are kept and URLs become links
+func Plain(source string) *Document {
+	links := newLinkSet()
+	var out strings.Builder
+	paragraphs := paragraphBreak.Split(strings.ReplaceAll(source, "\r\n", "\n"), -1)
+	for _, paragraph := range paragraphs {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		out.WriteString("<p>")
+		lines := strings.Split(paragraph, "\n")
+		for i, line := range lines {
+			if i > 0 {
+				out.WriteString("<br>\n")
+			}
+			out.WriteString(linkify(line, links))
+		}
+		out.WriteString("</p>\n")
+	}
+
+	return &Document{
+		HTML:      policy.Sanitize(out.String()),
+		WordCount: countWords(source),
+		Headings:  []Heading{},
+		Links:     links.urls,
+	}
+}
+
+// linkify escapes a line of plain text, turning the URLs in it into links
+func linkify(line string, links *linkSet) string {
+	var out strings.Builder
+	last := 0
+	for _, loc := range urlPattern.FindAllStringIndex(line, -1) {
+		// punctuation ending a sentence is not part of the URL
+		u := strings.TrimRight(line[loc[0]:loc[1]], ".,:;!?'\")]")
+		end := loc[0] + len(u)
+		out.WriteString(html.EscapeString(line[last:loc[0]]))
+		if links.add(u) {
+			out.WriteString(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(u) + "</a>")
+		} else {
+			out.WriteString(html.EscapeString(u))
+		}
+		last = end
+	}
+	out.WriteString(html.EscapeString(line[last:]))
+	return out.String()
+}
+
+// countWords counts the whitespace separated words of s, ignoring runs of
+// punctuation such as a lone dash
+func countWords(s string) int {
+	count := 0
+	for _, field := range strings.Fields(s) {
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// linkSet collects distinct outbound URLs in order
+type linkSet struct {
+	urls []string
+	seen map[string]bool
+}
+
+func newLinkSet() *linkSet {
+	return &linkSet{urls: []string{}, seen: map[string]bool{}}
+}
+
+// add records the URL if it is an absolute http or https URL, reporting
+// whether it is one
+func (l *linkSet) add(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	if !l.seen[raw] {
+		l.seen[raw] = true
+		l.urls = append(l.urls, raw)
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package render
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustMarkdown(t *testing.T, source string) *Document {
+	t.Helper()
+	doc, err := Markdown(source)
+	if err != nil {
+		t.Fatalf("Markdown(%q): %v", source, err)
+	}
+	return doc
+}
+
+func TestMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		keep   string
+	}{
+		{"script block", "<script>alert(1)</script>\n\nafter", "<p>after</p>"},
+		{"inline script", "before <script>alert(1)</script>", "<p>before alert(1)</p>"},
+		{"event attribute", `text <img src=x onerror="alert(1)">`, "<p>text "},
+		{"event attribute on a block", `<div onclick="alert(1)">hi</div>`, ""},
+		{"event attribute on a link", `<a href="https://example.com" onmouseover="alert(1)">link</a>`, "link"},
+		{"javascript link", "[link](javascript:alert(1))", "<p>link</p>"},
+		{"mixed case javascript link", "[link](JaVaScRiPt:alert(1))", "<p>link</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>javascript:alert(1)</p>"},
+		{"data link", "[link](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)", "<p>link</p>"},
+		{"javascript image", "![alt](javascript:alert(1))", `<img alt="alt">`},
+		{"iframe block", `<iframe src="https://example.com"></iframe>`, ""},
+		{"inline iframe", `text <iframe src="https://example.com"></iframe>`, "<p>text "},
+		{"style block", "<style>body { display: none }</style>", ""},
+		{"inline style", `<span style="position: fixed">text</span>`, "text"},
+		{"code block info string", "```go onclick=alert(1)\ncode\n```", `<code class="language-go">`},
+	}
+	// text left of the dropped markup is harmless, markup and URLs are not
+	forbidden := []string{"<script", "onerror", "onclick", "onmouseover", `="javascript:`, `="data:`, "<iframe", "<style", "style=", "<div"}
+	for _, tt := range tests {
+		html := mustMarkdown(t, tt.source).HTML
+		for _, f := range forbidden {
+			if strings.Contains(strings.ToLower(html), f) {
+				t.Errorf("%s: %q kept in %s", tt.name, f, html)
+			}
+		}
+		if !strings.Contains(html, tt.keep) {
+			t.Errorf("%s: %s, want it to contain %s", tt.name, html, tt.keep)
+		}
+	}
+}
+
+func TestMarkdownKeepsAllowedAttributes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"heading id", "# Hello", `<h1 id="hello">Hello</h1>`},
+		{"code language", "```go\nfmt.Println()\n```", `<pre><code class="language-go">fmt.Println()`},
+		{"checked task", "- [x] done", `<li><input checked="" disabled="" type="checkbox"> done</li>`},
+		{"open task", "- [ ] todo", `<li><input disabled="" type="checkbox"> todo</li>`},
+		{"link", "[link](https://example.com)", `<a href="https://example.com" rel="nofollow">link</a>`},
+		{"table", "| a |\n|---|\n| b |", "<td>b</td>"},
+		{"strikethrough", "~~gone~~", "<del>gone</del>"},
+	}
+	for _, tt := range tests {
+		if html := mustMarkdown(t, tt.source).HTML; !strings.Contains(html, tt.want) {
+			t.Errorf("%s: %s, want it to contain %s", tt.name, html, tt.want)
+		}
+	}
+
+	// attributes are only kept where the policy allows them
+	html := mustMarkdown(t, "<p id=\"x\" class=\"language-go\">raw</p>\n\n`code`").HTML
+	if strings.Contains(html, "id=") || strings.Contains(html, "class=") {
+		t.Errorf("attributes of raw HTML kept: %s", html)
+	}
+}
+
+func TestMarkdownHeadings(t *testing.T) {
+	doc := mustMarkdown(t, "# Shopping list\n\ntext\n\n## Fruit & veg\n\n## Fruit & veg\n\nSetext\n---\n\n### `code` *emphasis*")
+	want := []Heading{
+		{Level: 1, Text: "Shopping list", ID: "shopping-list"},
+		{Level: 2, Text: "Fruit & veg", ID: "fruit--veg"},
+		{Level: 2, Text: "Fruit & veg", ID: "fruit--veg-1"},
+		{Level: 2, Text: "Setext", ID: "setext"},
+		{Level: 3, Text: "code emphasis", ID: "code-emphasis"},
+	}
+	if !reflect.DeepEqual(doc.Headings, want) {
+		t.Fatalf("headings %+v, want %+v", doc.Headings, want)
+	}
+	for _, heading := range want {
+		if !strings.Contains(doc.HTML, `id="`+heading.ID+`"`) {
+			t.Errorf("heading id %s missing from %s", heading.ID, doc.HTML)
+		}
+	}
+
+	if doc := mustMarkdown(t, "no headings"); doc.Headings == nil || len(doc.Headings) != 0 {
+		t.Errorf("headings %#v, want an empty list", doc.Headings)
+	}
+}
+
+func TestMarkdownMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		words  int
+		links  []string
+	}{
+		{"empty", "", 0, []string{}},
+		{"paragraphs", "one two\nthree\n\nfour", 4, []string{}},
+		{"blocks do not join", "# one\ntwo\n- three\n- four", 4, []string{}},
+		{"punctuation", "one - two -- three", 3, []string{}},
+		{"code", "`one`\n\n```\ntwo three\n```", 3, []string{}},
+		{"raw HTML", "one <b>two</b>\n\n<div>\nthree\n</div>", 2, []string{}},
+		{"links", "[one](https://example.com/a) [two](http://example.com/b) [three](https://example.com/a)", 3, []string{"https://example.com/a", "http://example.com/b"}},
+		{"not outbound", "[one](/notes) [two](mailto:a@example.com) [three](#heading)", 3, []string{}},
+		{"bare URLs", "see https://example.com/a and www.example.com", 4, []string{"https://example.com/a", "http://www.example.com"}},
+	}
+	for _, tt := range tests {
+		doc := mustMarkdown(t, tt.source)
+		if doc.WordCount != tt.words {
+			t.Errorf("%s: %d words, want %d", tt.name, doc.WordCount, tt.words)
+		}
+		if !reflect.DeepEqual(doc.Links, tt.links) {
+			t.Errorf("%s: links %#v, want %#v", tt.name, doc.Links, tt.links)
+		}
+	}
+}
+
+func TestPlain(t *testing.T) {
+	doc := Plain("Hello <script>alert(1)</script> & goodbye\r\nsecond line\n\n\n  next paragraph  ")
+	want := "<p>Hello &lt;script&gt;alert(1)&lt;/script&gt; &amp; goodbye<br>\nsecond line</p>\n<p>next paragraph</p>\n"
+	if doc.HTML != want {
+		t.Errorf("HTML %q, want %q", doc.HTML, want)
+	}
+	if doc.WordCount != 7 {
+		t.Errorf("%d words, want 7", doc.WordCount)
+	}
+	if doc.Headings == nil || len(doc.Headings) != 0 || doc.Links == nil || len(doc.Links) != 0 {
+		t.Errorf("headings %#v and links %#v, want empty lists", doc.Headings, doc.Links)
+	}
+}
+
+func TestLinkify(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"no links", "no links"},
+		{"see https://example.com.", `see <a href="https://example.com">https://example.com</a>.`},
+		{"(https://example.com/a?b=1&c=2)", `(<a href="https://example.com/a?b=1&amp;c=2">https://example.com/a?b=1&amp;c=2</a>)`},
+		{`"http://example.com/<b>"`, `&#34;<a href="http://example.com/">http://example.com/</a>&lt;b&gt;&#34;`},
+		{"https://example.com, https://example.org!", `<a href="https://example.com">https://example.com</a>, <a href="https://example.org">https://example.org</a>!`},
+		{"javascript:alert(1) ftp://example.com", "javascript:alert(1) ftp://example.com"},
+		{"https://", "https://"},
+	}
+	for _, tt := range tests {
+		links := newLinkSet()
+		if got := linkify(tt.line, links); got != tt.want {
+			t.Errorf("linkify(%q) = %s, want %s", tt.line, got, tt.want)
+		}
+	}
+
+	links := newLinkSet()
+	linkify("https://example.com/a https://example.com/b", links)
+	linkify("again https://example.com/a", links)
+	if want := []string{"https://example.com/a", "https://example.com/b"}; !reflect.DeepEqual(links.urls, want) {
+		t.Errorf("links %v, want %v", links.urls, want)
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"   \n\t ", 0},
+		{"one", 1},
+		{"one two\nthree\tfour", 4},
+		{"one - two — three", 3},
+		{"e-mail it's", 2},
+		{"... !!! 42", 1},
+		{"naïve café 日本語", 3},
+	}
+	for _, tt := range tests {
+		if got := countWords(tt.s); got != tt.want {
+			t.Errorf("countWords(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
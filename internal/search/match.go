@@ -0,0 +1,195 @@
+package search
+
+import (
+	"html"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Highlight markers wrap matched text in highlights until RenderHighlight
+// turns them into HTML. Control characters are used so that they cannot
+// collide with note text; any found in the text are dropped.
+const (
+	MarkStart = "\x02"
+	MarkEnd   = "\x03"
+)
+
+var stripMarks = strings.NewReplacer(MarkStart, "", MarkEnd, "")
+
+// Weights of matches in the title and the content, mirroring the A and B
+// weights of the Postgres search vector
+const (
+	titleWeight   = 1.0
+	contentWeight = 0.4
+)
+
+// word is a word of a text along with its byte offsets in the text
+type word struct {
+	text       string
+	start, end int
+}
+
+func splitWords(text string) []word {
+	var words []word
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			words = append(words, word{strings.ToLower(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		words = append(words, word{strings.ToLower(text[start:]), start, len(text)})
+	}
+	return words
+}
+
+// matchAt reports whether the term matches the words starting at index i
+func (t Term) matchAt(words []word, i int) bool {
+	if i+len(t.Words) > len(words) {
+		return false
+	}
+	for j, w := range t.Words {
+		got := words[i+j].text
+		if t.Prefix && j == len(t.Words)-1 {
+			if !strings.HasPrefix(got, w) {
+				return false
+			}
+		} else if got != w {
+			return false
+		}
+	}
+	return true
+}
+
+func (t Term) count(words []word) int {
+	n := 0
+	for i := range words {
+		if t.matchAt(words, i) {
+			n++
+		}
+	}
+	return n
+}
+
+// Match evaluates the query against a note, returning its relevance rank
+// and whether it matches. Unlike Postgres no stemming is applied.
+func (q *Query) Match(title, content string) (float64, bool) {
+	titleWords, contentWords := splitWords(title), splitWords(content)
+
+	score := 0.0
+	for _, group := range q.Groups {
+		matched := false
+		for _, term := range group {
+			titleHits, contentHits := term.count(titleWords), term.count(contentWords)
+			found := titleHits+contentHits > 0
+			if term.Negated {
+				matched = matched || !found
+				continue
+			}
+			if found {
+				matched = true
+				score += titleWeight*float64(titleHits) + contentWeight*float64(contentHits)
+			}
+		}
+		if !matched {
+			return 0, false
+		}
+	}
+
+	// longer notes need more hits for the same rank
+	return score / (1 + math.Log(1+float64(len(titleWords)+len(contentWords)))), true
+}
+
+// spans returns the word index ranges matched by the positive terms
+func (q *Query) spans(words []word) [][2]int {
+	var spans [][2]int
+	for i := range words {
+		for _, group := range q.Groups {
+			for _, term := range group {
+				if !term.Negated && term.matchAt(words, i) {
+					spans = append(spans, [2]int{i, i + len(term.Words) - 1})
+				}
+			}
+		}
+	}
+	return spans
+}
+
+// Highlight wraps the matches of the query in text with highlight markers
+func (q *Query) Highlight(text string) string {
+	words := splitWords(text)
+	return mark(text, words, q.spans(words), 0, len(text))
+}
+
+// Snippet returns an excerpt of about maxWords words of text around the
+// first match, with the matches highlighted
+func (q *Query) Snippet(text string, maxWords int) string {
+	words := splitWords(text)
+	if len(words) == 0 {
+		return ""
+	}
+	spans := q.spans(words)
+
+	first := 0
+	if len(spans) > 0 {
+		first = spans[0][0]
+	}
+	from := first - maxWords/3
+	if from < 0 {
+		from = 0
+	}
+	to := from + maxWords - 1
+	if to >= len(words) {
+		to = len(words) - 1
+	}
+
+	start, end := words[from].start, words[to].end
+	if from == 0 {
+		start = 0
+	}
+	if to == len(words)-1 {
+		end = len(text)
+	}
+
+	snippet := mark(text, words, spans, start, end)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(text) {
+		snippet += "…"
+	}
+	return strings.TrimSpace(snippet)
+}
+
+// mark returns text[start:end] with the spans wrapped in highlight markers
+func mark(text string, words []word, spans [][2]int, start, end int) string {
+	var b strings.Builder
+	pos := start
+	for _, span := range spans {
+		from, to := words[span[0]].start, words[span[1]].end
+		if from < pos || to > end {
+			continue
+		}
+		stripMarks.WriteString(&b, text[pos:from])
+		b.WriteString(MarkStart)
+		b.WriteString(text[from:to])
+		b.WriteString(MarkEnd)
+		pos = to
+	}
+	stripMarks.WriteString(&b, text[pos:end])
+	return b.String()
+}
+
+// RenderHighlight escapes highlighted text for HTML and turns the
+// highlight markers into <mark> elements
+func RenderHighlight(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, MarkStart, "<mark>")
+	return strings.ReplaceAll(text, MarkEnd, "</mark>")
+}
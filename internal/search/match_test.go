@@ -0,0 +1,104 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func mustParse(t *testing.T, input string) *Query {
+	t.Helper()
+	q, err := Parse(input)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", input, err)
+	}
+	return q
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		query   string
+		title   string
+		content string
+		want    bool
+	}{
+		{"milk", "Groceries", "Buy milk.", true},
+		{"MILK", "Groceries", "buy Milk", true},
+		{"milk", "Groceries", "buy milkshake", false},
+		{"milk*", "Groceries", "buy milkshake", true},
+		{"milk eggs", "Groceries", "milk", false},
+		{"milk OR eggs", "Groceries", "eggs", true},
+		{`"oat milk"`, "Groceries", "milk, oat", false},
+		{`"oat milk"`, "Groceries", "Oat-milk", true},
+		{"-milk", "Groceries", "eggs", true},
+		{"groceries -milk", "Groceries", "milk", false},
+		{`groceries -"oat milk"`, "Groceries", "oat and milk", true},
+		{"milk OR -eggs", "Groceries", "bread", true},
+	}
+	for _, tt := range tests {
+		if _, got := mustParse(t, tt.query).Match(tt.title, tt.content); got != tt.want {
+			t.Errorf("%q matching %q / %q = %v, want %v", tt.query, tt.title, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRanking(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		better, worse [2]string
+	}{
+		{"title over content", "milk", [2]string{"Milk", "buy eggs"}, [2]string{"Eggs", "buy milk"}},
+		{"more hits", "milk", [2]string{"List", "milk and milk"}, [2]string{"List", "milk and eggs"}},
+		{"shorter note", "milk", [2]string{"List", "buy milk"}, [2]string{"List", "buy milk and eggs and bread and butter"}},
+		{"more terms", "milk OR eggs", [2]string{"List", "milk eggs"}, [2]string{"List", "milk bread"}},
+	}
+	for _, tt := range tests {
+		q := mustParse(t, tt.query)
+		better, _ := q.Match(tt.better[0], tt.better[1])
+		worse, _ := q.Match(tt.worse[0], tt.worse[1])
+		if better <= worse {
+			t.Errorf("%s: ranked %v for %q, %v for %q", tt.name, better, tt.better, worse, tt.worse)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+		want  string
+	}{
+		{"milk", "Buy Milk and milkshakes", "Buy <mark>Milk</mark> and milkshakes"},
+		{"milk*", "Buy Milk and milkshakes", "Buy <mark>Milk</mark> and <mark>milkshakes</mark>"},
+		{`"oat milk" -eggs`, "oat milk, not eggs", "<mark>oat milk</mark>, not eggs"},
+		{"milk", `<b onclick="x">milk</b> & <script>alert(1)</script>`, `&lt;b onclick=&#34;x&#34;&gt;<mark>milk</mark>&lt;/b&gt; &amp; &lt;script&gt;alert(1)&lt;/script&gt;`},
+		{"script", "<script>", "&lt;<mark>script</mark>&gt;"},
+		{"milk", "no \x02match\x03 but milk", "no match but <mark>milk</mark>"},
+	}
+	for _, tt := range tests {
+		if got := RenderHighlight(mustParse(t, tt.query).Highlight(tt.text)); got != tt.want {
+			t.Errorf("%q highlighted in %q = %s, want %s", tt.query, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	q := mustParse(t, "milk")
+	text := "one two three four five six seven eight nine milk ten eleven twelve thirteen fourteen"
+
+	if got, want := q.Snippet(text, 6), "…eight nine "+MarkStart+"milk"+MarkEnd+" ten eleven twelve…"; got != want {
+		t.Errorf("Snippet = %q, want %q", got, want)
+	}
+	if got, want := q.Snippet("buy milk.", 6), "buy "+MarkStart+"milk"+MarkEnd+"."; got != want {
+		t.Errorf("Snippet of a short text = %q, want %q", got, want)
+	}
+	if got := q.Snippet(text[:30], 3); got != "one two three…" {
+		t.Errorf("Snippet without a match = %q, want the start of the text", got)
+	}
+	if got := RenderHighlight(q.Snippet("<i>milk</i> "+strings.Repeat("word ", 20), 4)); got != "&lt;i&gt;<mark>milk</mark>&lt;/i&gt; word…" {
+		t.Errorf("rendered snippet = %s", got)
+	}
+	if got := q.Snippet("", 6); got != "" {
+		t.Errorf("Snippet of an empty text = %q", got)
+	}
+}
@@ -0,0 +1,165 @@
+// Package search parses the note search query syntax and evaluates it.
+//
+// A query is a list of terms that must all match. Supported syntax:
+//
+//	word        the word must appear
+//	wor*        a word starting with "wor" must appear
+//	"a phrase"  the words must appear next to each other, in order
+//	-word       the word must not appear (also -"a phrase")
+//	a OR b      either a or b must appear
+//
+// Queries are rendered as a Postgres tsquery for indexed search, and can
+// also be evaluated directly against text for backends without full-text
+// search support.
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// ErrEmptyQuery is returned when a query contains no searchable terms
+var ErrEmptyQuery = errors.New("search query has no terms")
+
+// Term is a single word or phrase of a query
+type Term struct {
+	// Words are the lower-cased words of the term; more than one for phrases
+	Words []string
+	// Prefix matches words starting with the last word
+	Prefix bool
+	// Negated terms must not appear
+	Negated bool
+}
+
+// Query is a conjunction of groups, each of which is a disjunction of terms
+type Query struct {
+	Groups [][]Term
+}
+
+// Parse parses a search query. An unterminated quote runs to the end of
+// the query.
+func Parse(input string) (*Query, error) {
+	tokens := tokenize(input)
+
+	q := &Query{}
+	joinNext := false
+	for _, tok := range tokens {
+		if tok.or {
+			// OR only joins when there is a term on its left
+			joinNext = len(q.Groups) > 0
+			continue
+		}
+		if joinNext {
+			last := len(q.Groups) - 1
+			q.Groups[last] = append(q.Groups[last], tok.term)
+		} else {
+			q.Groups = append(q.Groups, []Term{tok.term})
+		}
+		joinNext = false
+	}
+
+	if len(q.Groups) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	return q, nil
+}
+
+type token struct {
+	term Term
+	or   bool
+}
+
+func tokenize(input string) []token {
+	var tokens []token
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		negated := false
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			negated = true
+			i++
+		}
+
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			words := Words(string(runes[i+1 : end]))
+			if len(words) > 0 {
+				tokens = append(tokens, token{term: Term{Words: words, Negated: negated}})
+			}
+			i = end + 1
+			continue
+		}
+
+		end := i
+		for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+			end++
+		}
+		raw := string(runes[i:end])
+		i = end
+
+		if raw == "OR" && !negated {
+			tokens = append(tokens, token{or: true})
+			continue
+		}
+
+		// punctuated words such as "e-mail" become a phrase of their parts
+		words := Words(raw)
+		if len(words) == 0 {
+			continue
+		}
+		tokens = append(tokens, token{term: Term{Words: words, Prefix: strings.HasSuffix(raw, "*"), Negated: negated}})
+	}
+	return tokens
+}
+
+// Words splits text into lower-cased words of letters and digits
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// TSQuery renders the query in Postgres to_tsquery syntax
+func (q *Query) TSQuery() string {
+	groups := make([]string, 0, len(q.Groups))
+	for _, group := range q.Groups {
+		terms := make([]string, 0, len(group))
+		for _, term := range group {
+			terms = append(terms, term.tsquery())
+		}
+		if len(terms) == 1 {
+			groups = append(groups, terms[0])
+		} else {
+			groups = append(groups, "("+strings.Join(terms, " | ")+")")
+		}
+	}
+	return strings.Join(groups, " & ")
+}
+
+func (t Term) tsquery() string {
+	words := make([]string, len(t.Words))
+	for i, word := range t.Words {
+		// words only hold letters and digits, so quoting is enough
+		words[i] = "'" + word + "'"
+	}
+	if t.Prefix {
+		words[len(words)-1] += ":*"
+	}
+
+	s := strings.Join(words, " <-> ")
+	if len(words) > 1 {
+		s = "(" + s + ")"
+	}
+	if t.Negated {
+		s = "!" + s
+	}
+	return s
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  [][]Term
+	}{
+		{"milk", [][]Term{{{Words: []string{"milk"}}}}},
+		{"Milk EGGS", [][]Term{{{Words: []string{"milk"}}}, {{Words: []string{"eggs"}}}}},
+		{"gro*", [][]Term{{{Words: []string{"gro"}, Prefix: true}}}},
+		{`"shopping list"`, [][]Term{{{Words: []string{"shopping", "list"}}}}},
+		{`"shopping list`, [][]Term{{{Words: []string{"shopping", "list"}}}}},
+		{"-milk", [][]Term{{{Words: []string{"milk"}, Negated: true}}}},
+		{`-"oat milk"`, [][]Term{{{Words: []string{"oat", "milk"}, Negated: true}}}},
+		{"e-mail", [][]Term{{{Words: []string{"e", "mail"}}}}},
+		{"milk OR eggs bread", [][]Term{{{Words: []string{"milk"}}, {Words: []string{"eggs"}}}, {{Words: []string{"bread"}}}}},
+		{"milk or eggs", [][]Term{{{Words: []string{"milk"}}}, {{Words: []string{"or"}}}, {{Words: []string{"eggs"}}}}},
+		{"OR milk OR", [][]Term{{{Words: []string{"milk"}}}}},
+		{"milk - -eggs", [][]Term{{{Words: []string{"milk"}}}, {{Words: []string{"eggs"}, Negated: true}}}},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(q.Groups, tt.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.input, q.Groups, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "   ", `""`, "- * !", "OR"} {
+		if _, err := Parse(input); !errors.Is(err, ErrEmptyQuery) {
+			t.Errorf("Parse(%q): got %v, want ErrEmptyQuery", input, err)
+		}
+	}
+}
+
+func TestTSQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"milk eggs", "'milk' & 'eggs'"},
+		{"gro*", "'gro':*"},
+		{`"shopping list"`, "('shopping' <-> 'list')"},
+		{`"shopping li*"`, "('shopping' <-> 'li')"},
+		{"-milk", "!'milk'"},
+		{`-"oat milk"`, "!('oat' <-> 'milk')"},
+		{"milk OR eggs -bread", "('milk' | 'eggs') & !'bread'"},
+		{"it's", "('it' <-> 's')"},
+		{"a:b", "('a' <-> 'b')"},
+		{"milk:*A", "('milk' <-> 'a')"},
+		{`\'milk`, "'milk'"},
+		{"Crème brûlée", "'crème' & 'brûlée'"},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.input, err)
+			continue
+		}
+		if got := q.TSQuery(); got != tt.want {
+			t.Errorf("TSQuery of %q = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+}
+
+// tsqueryToken matches the lexemes and operators TSQuery may produce
+var tsqueryToken = regexp.MustCompile(`^(?:'[\p{L}\p{N}]+'(?::\*)?|[()!&|]|<->| )`)
+
+func TestTSQueryIsWellFormed(t *testing.T) {
+	inputs := []string{
+		`'`, `''`, `'milk'`, `milk'`, `\`, `\\'`, `:`, `:*`, `a:*b`, `milk:AB`,
+		`&`, `|`, `!`, `(`, `)`, `<->`, `<2>`, `milk & eggs`, `milk | !eggs`,
+		`!(milk`, `(milk))`, `-"&|!()"`, `"milk' | 'eggs"`, `OR OR milk`,
+		`milk OR`, `-OR`, `*`, `milk**`, "tab\tand\nnewline", `日本語 テキスト`,
+	}
+	for _, input := range inputs {
+		q, err := Parse(input)
+		if errors.Is(err, ErrEmptyQuery) {
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", input, err)
+			continue
+		}
+		tsquery := q.TSQuery()
+		depth := 0
+		for rest := tsquery; rest != ""; {
+			token := tsqueryToken.FindString(rest)
+			if token == "" {
+				t.Errorf("TSQuery of %q = %s, unexpected %q", input, tsquery, rest)
+				break
+			}
+			switch token {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if depth < 0 {
+				t.Errorf("TSQuery of %q = %s, unbalanced parentheses", input, tsquery)
+				break
+			}
+			rest = rest[len(token):]
+		}
+		if depth != 0 {
+			t.Errorf("TSQuery of %q = %s, unbalanced parentheses", input, tsquery)
+		}
+	}
+}
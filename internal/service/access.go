@@ -0,0 +1,93 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// roleOwner is the role of a note's owner, above every share role
+const roleOwner = "owner"
+
+// roleRanks orders the roles by privilege
+var roleRanks = map[string]int{
+	models.RoleViewer:    1,
+	models.RoleCommenter: 2,
+	models.RoleEditor:    3,
+	roleOwner:            4,
+}
+
+// groupNoteRoles maps group roles to the role members have on the group's
+// notes
+var groupNoteRoles = map[string]string{
+	models.GroupRoleOwner:  roleOwner,
+	models.GroupRoleAdmin:  roleOwner,
+	models.GroupRoleMember: models.RoleEditor,
+}
+
+// validShareRole checks the role given for a share, defaulting to viewer
+func validShareRole(role string) (string, error) {
+	switch role {
+	case "":
+		return models.RoleViewer, nil
+	case models.RoleViewer, models.RoleCommenter, models.RoleEditor:
+		return role, nil
+	default:
+		return "", fmt.Errorf("%w: role must be viewer, commenter or editor", ErrInvalidInput)
+	}
+}
+
+// authorizeNote fetches the note and checks that the user holds at least
+// the given role on it, returning the note and the user's role. Notes the
+// user has no access to are reported as not found so that their existence
+// is not revealed.
+func (s *service) authorizeNote(userID, noteID, minRole string) (*models.Note, string, error) {
+	note, err := s.store.GetNote(noteID)
+	if err != nil {
+		return nil, "", notFound(err)
+	}
+
+	role, err := s.noteRole(userID, note)
+	if err != nil {
+		return nil, "", notFound(err)
+	}
+
+	if roleRanks[role] < roleRanks[minRole] {
+		return nil, "", fmt.Errorf("%w: this action needs the %s role on the note", ErrForbidden, minRole)
+	}
+	return note, role, nil
+}
+
+// noteRole is the user's role on the note. Group notes are owned by the
+// group's owner and admins and edited by its members, so that leaving the
+// group ends access to them, even for their writer. A share can give a
+// user more access than their membership does.
+func (s *service) noteRole(userID string, note *models.Note) (string, error) {
+	role := ""
+	switch {
+	case note.GroupID != nil:
+		membership, err := s.store.GetMembership(*note.GroupID, userID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+		if membership != nil {
+			role = groupNoteRoles[membership.Role]
+		}
+	case note.UserID == userID:
+		return roleOwner, nil
+	}
+
+	share, err := s.store.GetNoteShare(note.ID, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	if share != nil && roleRanks[share.Role] > roleRanks[role] {
+		role = share.Role
+	}
+	if role == "" {
+		return "", gorm.ErrRecordNotFound
+	}
+	return role, nil
+}
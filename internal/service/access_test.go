@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+func createNote(t *testing.T, store database.Storer, writer *models.User, group *models.Group) *models.Note {
+	t.Helper()
+	note := &models.Note{Title: "Note", UserID: writer.ID}
+	if group != nil {
+		note.GroupID = &group.ID
+	}
+	note, err := store.CreateNewNote(note)
+	if err != nil {
+		t.Fatalf("CreateNewNote: %v", err)
+	}
+	return note
+}
+
+func share(t *testing.T, store database.Storer, note *models.Note, from, to *models.User, role string) {
+	t.Helper()
+	if err := store.ShareNoteWithUser(note.ID, from.ID, []string{to.Username}, role); err != nil {
+		t.Fatalf("ShareNoteWithUser: %v", err)
+	}
+}
+
+func TestNoteAccess(t *testing.T) {
+	s, store := newTestService(t, nil)
+	users := make(map[string]*models.User)
+	for _, name := range []string{
+		"alice", "viewer", "commenter", "editor", "stranger",
+		"gowner", "gadmin", "gmember", "gmembershared", "outsidershared", "writer",
+	} {
+		users[name] = createUser(t, store, name)
+	}
+
+	group := &models.Group{Name: "Team"}
+	if err := store.CreateGroup(group, users["gowner"].ID); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	for name, role := range map[string]string{
+		"gadmin":        models.GroupRoleAdmin,
+		"gmember":       models.GroupRoleMember,
+		"gmembershared": models.GroupRoleMember,
+	} {
+		if err := store.AddGroupMember(group.ID, users[name].ID, role); err != nil {
+			t.Fatalf("AddGroupMember: %v", err)
+		}
+	}
+
+	personal := createNote(t, store, users["alice"], nil)
+	share(t, store, personal, users["alice"], users["viewer"], models.RoleViewer)
+	share(t, store, personal, users["alice"], users["commenter"], models.RoleCommenter)
+	share(t, store, personal, users["alice"], users["editor"], models.RoleEditor)
+
+	// written by a user who is not, or no longer, a member
+	groupNote := createNote(t, store, users["writer"], group)
+	share(t, store, groupNote, users["gowner"], users["gmembershared"], models.RoleViewer)
+	share(t, store, groupNote, users["gowner"], users["outsidershared"], models.RoleEditor)
+
+	tests := []struct {
+		name string
+		user string
+		note *models.Note
+		want string // empty when the user has no access
+	}{
+		{"owner", "alice", personal, roleOwner},
+		{"viewer share", "viewer", personal, models.RoleViewer},
+		{"commenter share", "commenter", personal, models.RoleCommenter},
+		{"editor share", "editor", personal, models.RoleEditor},
+		{"no access", "stranger", personal, ""},
+		{"group member on a personal note", "gmember", personal, ""},
+		{"group owner", "gowner", groupNote, roleOwner},
+		{"group admin", "gadmin", groupNote, roleOwner},
+		{"group member", "gmember", groupNote, models.RoleEditor},
+		{"share below the membership", "gmembershared", groupNote, models.RoleEditor},
+		{"share to a non-member", "outsidershared", groupNote, models.RoleEditor},
+		{"writer outside the group", "writer", groupNote, ""},
+		{"no access to a group note", "stranger", groupNote, ""},
+	}
+	ranked := []string{models.RoleViewer, models.RoleCommenter, models.RoleEditor, roleOwner}
+	for _, tt := range tests {
+		userID := users[tt.user].ID
+		role, err := s.noteRole(userID, tt.note)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: role %s, want no access", tt.name, role)
+			}
+		} else if err != nil || role != tt.want {
+			t.Errorf("%s: role %q, %v, want %s", tt.name, role, err, tt.want)
+		}
+
+		// authorizeNote allows the roles up to the user's, forbids those
+		// above it and hides the note from users without access
+		for _, minRole := range ranked {
+			note, role, err := s.authorizeNote(userID, tt.note.ID, minRole)
+			switch {
+			case tt.want == "":
+				if !errors.Is(err, ErrNotFound) {
+					t.Errorf("%s: authorizing %s: got %v, want ErrNotFound", tt.name, minRole, err)
+				}
+			case roleRanks[minRole] > roleRanks[tt.want]:
+				if !errors.Is(err, ErrForbidden) {
+					t.Errorf("%s: authorizing %s: got %v, want ErrForbidden", tt.name, minRole, err)
+				}
+			default:
+				if err != nil || note.ID != tt.note.ID || role != tt.want {
+					t.Errorf("%s: authorizing %s: got role %q, %v, want %s", tt.name, minRole, role, err, tt.want)
+				}
+			}
+		}
+	}
+
+	if _, _, err := s.authorizeNote(users["alice"].ID, models.NewID(), models.RoleViewer); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing note: got %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,292 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// maxFilenameLength is the longest attachment filename accepted, in
+	// bytes
+	maxFilenameLength = 255
+
+	// purgedAttachmentBatch is how many deleted attachments are removed
+	// from the blob store per query
+	purgedAttachmentBatch = 100
+)
+
+// UploadAttachment stores a file and attaches it to the note, which takes
+// the editor role
+func (s *service) UploadAttachment(ctx context.Context, noteID string, upload domain.AttachmentUpload) (domain.AttachmentResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	note, _, err := s.authorizeNote(userID, noteID, models.RoleEditor)
+	if err != nil {
+		return domain.AttachmentResponse{}, err
+	}
+	attachment, err := s.storeAttachment(ctx, userID, note.ID, upload)
+	if err != nil {
+		return domain.AttachmentResponse{}, err
+	}
+	return attachmentResponse(attachment), nil
+}
+
+// storeAttachment checks an upload against the limits, stores it in the
+// blob store and records it as an attachment of the note. The upload is
+// spooled to a temporary file so that its size and type are known before
+// it reaches the blob store.
+func (s *service) storeAttachment(ctx context.Context, userID, noteID string, upload domain.AttachmentUpload) (*models.Attachment, error) {
+	limits := s.cfg.Attachments
+
+	filename, err := attachmentFilename(upload.Filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp("", "notes-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(upload.Body, limits.MaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: reading upload: %s", ErrInvalidInput, err)
+	}
+	if size > limits.MaxSize {
+		return nil, fmt.Errorf("%w: attachments are limited to %d bytes", ErrTooLarge, limits.MaxSize)
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidInput)
+	}
+
+	head := make([]byte, 512)
+	n, err := tmp.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	contentType, err := s.attachmentContentType(upload.ContentType, head[:n])
+	if err != nil {
+		return nil, err
+	}
+
+	// checked again when the attachment is recorded; this only saves
+	// uploading a blob that cannot be kept
+	if limits.Quota > 0 {
+		used, err := s.store.AttachmentUsage(userID)
+		if err != nil {
+			return nil, err
+		}
+		if used+size > limits.Quota {
+			return nil, errQuotaExceeded(limits.Quota)
+		}
+	}
+
+	attachment := &models.Attachment{
+		ID:          models.NewID(),
+		NoteID:      noteID,
+		UserID:      userID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		Checksum:    hex.EncodeToString(hash.Sum(nil)),
+	}
+	attachment.StorageKey = noteID + "/" + attachment.ID
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := s.blobs.Put(ctx, attachment.StorageKey, tmp, size, contentType); err != nil {
+		return nil, fmt.Errorf("storing attachment: %w", err)
+	}
+	if err := s.store.CreateAttachment(attachment, limits.Quota); err != nil {
+		if deleteErr := s.blobs.Delete(ctx, attachment.StorageKey); deleteErr != nil {
+			logrus.Errorf("error deleting unrecorded attachment blob %s\nError: %s", attachment.StorageKey, deleteErr.Error())
+		}
+		if errors.Is(err, database.ErrQuotaExceeded) {
+			return nil, errQuotaExceeded(limits.Quota)
+		}
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// ListAttachments lists the attachments of a note the user may read
+func (s *service) ListAttachments(ctx context.Context, noteID string) ([]domain.AttachmentResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	attachments, err := s.store.ListAttachments(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]domain.AttachmentResponse, 0, len(attachments))
+	for _, attachment := range attachments {
+		responses = append(responses, attachmentResponse(attachment))
+	}
+	return responses, nil
+}
+
+// OpenAttachment returns an attachment of a note the user may read along
+// with its contents, which the caller closes
+func (s *service) OpenAttachment(ctx context.Context, noteID, id string) (domain.AttachmentResponse, io.ReadCloser, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, models.RoleViewer); err != nil {
+		return domain.AttachmentResponse{}, nil, err
+	}
+	attachment, err := s.store.GetAttachment(noteID, id)
+	if err != nil {
+		return domain.AttachmentResponse{}, nil, notFound(err)
+	}
+	body, err := s.blobs.Get(ctx, attachment.StorageKey)
+	if err != nil {
+		return domain.AttachmentResponse{}, nil, fmt.Errorf("reading attachment: %w", err)
+	}
+	return attachmentResponse(attachment), body, nil
+}
+
+// DeleteAttachment removes an attachment from a note, which takes the
+// editor role
+func (s *service) DeleteAttachment(ctx context.Context, noteID, id string) error {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, models.RoleEditor); err != nil {
+		return err
+	}
+	if err := s.store.PurgeAttachment(noteID, id, time.Now()); err != nil {
+		return notFound(err)
+	}
+	s.removePurgedAttachments(ctx)
+	return nil
+}
+
+// GetAttachmentUsage returns how much of their attachment quota the user
+// has used
+func (s *service) GetAttachmentUsage(ctx context.Context) (domain.AttachmentUsageResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	used, err := s.store.AttachmentUsage(userID)
+	if err != nil {
+		return domain.AttachmentUsageResponse{}, err
+	}
+	return domain.AttachmentUsageResponse{
+		Used:    used,
+		Quota:   s.cfg.Attachments.Quota,
+		MaxSize: s.cfg.Attachments.MaxSize,
+	}, nil
+}
+
+// RemovePurgedAttachments deletes the blobs of the attachments that were
+// deleted or whose notes were purged, and then their records, returning
+// how many were removed
+func (s *service) RemovePurgedAttachments(ctx context.Context) (int, error) {
+	removed := 0
+	for {
+		attachments, err := s.store.ListPurgedAttachments(purgedAttachmentBatch)
+		if err != nil {
+			return removed, err
+		}
+		for _, attachment := range attachments {
+			if err := s.blobs.Delete(ctx, attachment.StorageKey); err != nil {
+				return removed, err
+			}
+			if err := s.store.DeletePurgedAttachment(attachment.ID); err != nil {
+				return removed, err
+			}
+			removed++
+		}
+		if len(attachments) < purgedAttachmentBatch {
+			return removed, nil
+		}
+	}
+}
+
+// removePurgedAttachments removes deleted attachments right after they
+// were deleted. Failures are only logged since the records are kept for
+// the next attempt.
+func (s *service) removePurgedAttachments(ctx context.Context) {
+	if _, err := s.RemovePurgedAttachments(ctx); err != nil {
+		logrus.Errorf("error removing deleted attachments\nError: %s", err.Error())
+	}
+}
+
+// attachmentFilename keeps the last element of the uploaded file's path
+// and checks that it is usable as a name
+func attachmentFilename(name string) (string, error) {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		return "", fmt.Errorf("%w: the file needs a name", ErrInvalidInput)
+	}
+	if len(name) > maxFilenameLength || !utf8.ValidString(name) || strings.ContainsFunc(name, isControl) {
+		return "", fmt.Errorf("%w: file names must be valid UTF-8 of at most %d bytes without control characters", ErrInvalidInput, maxFilenameLength)
+	}
+	return name, nil
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// attachmentContentType returns the media type of an upload, checking that
+// it is accepted. The declared type is used unless it is missing or
+// generic, in which case the type is sniffed from the first bytes.
+func (s *service) attachmentContentType(declared string, head []byte) (string, error) {
+	var contentType string
+	if declared != "" {
+		if mediaType, _, err := mime.ParseMediaType(declared); err == nil {
+			contentType = strings.ToLower(mediaType)
+		}
+	}
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	}
+
+	major, _, _ := strings.Cut(contentType, "/")
+	for _, accepted := range s.cfg.Attachments.ContentTypes {
+		if accepted == contentType || accepted == major+"/*" {
+			return contentType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s files cannot be attached", ErrUnsupportedType, contentType)
+}
+
+func errQuotaExceeded(quota int64) error {
+	return fmt.Errorf("%w: the attachment quota of %d bytes would be exceeded", ErrTooLarge, quota)
+}
+
+func attachmentResponse(attachment *models.Attachment) domain.AttachmentResponse {
+	return domain.AttachmentResponse{
+		ID:          attachment.ID,
+		NoteID:      attachment.NoteID,
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Size:        attachment.Size,
+		Checksum:    attachment.Checksum,
+		UploadedBy:  attachment.UserID,
+		CreatedAt:   attachment.CreatedAt,
+	}
+}
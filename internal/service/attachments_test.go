@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/storage"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// pngHeader is the start of a PNG file, enough to be sniffed as one
+const pngHeader = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+// newAttachmentService returns a service keeping blobs in a temporary
+// directory, which is returned along with it, with 20 byte attachments
+// and a quota of 50 bytes
+func newAttachmentService(t *testing.T) (*service, database.Storer, string) {
+	s, store := newTestService(t, func(cfg *config.Config) {
+		cfg.Attachments.MaxSize = 20
+		cfg.Attachments.Quota = 50
+	})
+	root := t.TempDir()
+	blobs, err := storage.NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.blobs = blobs
+	return s, store, root
+}
+
+func upload(s *service, ctx context.Context, noteID, contentType, content string) (domain.AttachmentResponse, error) {
+	return s.UploadAttachment(ctx, noteID, domain.AttachmentUpload{
+		Filename:    "file",
+		ContentType: contentType,
+		Body:        strings.NewReader(content),
+	})
+}
+
+// blobCount counts the blobs below the root of a local store
+func blobCount(t *testing.T, root string) int {
+	t.Helper()
+	n := 0
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			n++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUploadAttachment(t *testing.T) {
+	s, store, _ := newAttachmentService(t)
+	alice := createUser(t, store, "alice")
+	note := createNote(t, store, alice, nil)
+	ctx := userContext(alice)
+
+	attachment, err := s.UploadAttachment(ctx, note.ID, domain.AttachmentUpload{
+		Filename:    `C:\Users\alice\notes.txt`,
+		ContentType: "text/plain; charset=utf-8",
+		Body:        strings.NewReader("hello"),
+	})
+	if err != nil {
+		t.Fatalf("UploadAttachment: %v", err)
+	}
+	sum := sha256.Sum256([]byte("hello"))
+	if attachment.Filename != "notes.txt" || attachment.ContentType != "text/plain" || attachment.Size != 5 || attachment.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("attachment %+v", attachment)
+	}
+
+	_, body, err := s.OpenAttachment(ctx, note.ID, attachment.ID)
+	if err != nil {
+		t.Fatalf("OpenAttachment: %v", err)
+	}
+	defer body.Close()
+	if content, _ := io.ReadAll(body); string(content) != "hello" {
+		t.Errorf("attachment reads %q", content)
+	}
+
+	// attaching takes the editor role
+	viewer := createUser(t, store, "viewer")
+	share(t, store, note, alice, viewer, models.RoleViewer)
+	if _, err := upload(s, userContext(viewer), note.ID, "text/plain", "hello"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("upload by a viewer: got %v, want ErrForbidden", err)
+	}
+}
+
+func TestUploadAttachmentSizeLimit(t *testing.T) {
+	s, store, root := newAttachmentService(t)
+	alice := createUser(t, store, "alice")
+	note := createNote(t, store, alice, nil)
+	ctx := userContext(alice)
+
+	if _, err := upload(s, ctx, note.ID, "text/plain", strings.Repeat("x", 20)); err != nil {
+		t.Fatalf("upload of the largest size: %v", err)
+	}
+	if _, err := upload(s, ctx, note.ID, "text/plain", strings.Repeat("x", 21)); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("upload over the size limit: got %v, want ErrTooLarge", err)
+	}
+	if _, err := upload(s, ctx, note.ID, "text/plain", ""); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("empty upload: got %v, want ErrInvalidInput", err)
+	}
+	if n := blobCount(t, root); n != 1 {
+		t.Errorf("%d blobs stored, want only the accepted one", n)
+	}
+}
+
+func TestAttachmentContentType(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	tests := []struct {
+		name     string
+		declared string
+		content  string
+		want     string // empty when the upload is refused
+	}{
+		{"declared", "image/png", "anything", "image/png"},
+		{"declared with parameters", "Text/Plain; charset=utf-8", "hello", "text/plain"},
+		{"sniffed when missing", "", pngHeader, "image/png"},
+		{"sniffed when generic", "application/octet-stream", "%PDF-1.4\n", "application/pdf"},
+		{"sniffed when malformed", "image/", "hello", "text/plain"},
+		{"declared HTML", "text/html", "hello", ""},
+		{"declared SVG", "image/svg+xml", "<svg></svg>", ""},
+		{"sniffed HTML", "", "<html><script>alert(1)</script></html>", ""},
+		{"sniffed binary", "application/octet-stream", "\x00\x01\x02\x03", ""},
+	}
+	for _, tt := range tests {
+		got, err := s.attachmentContentType(tt.declared, []byte(tt.content))
+		if tt.want == "" {
+			if !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("%s: got %q, %v, want ErrUnsupportedType", tt.name, got, err)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %s", tt.name, got, err, tt.want)
+		}
+	}
+
+	// a wildcard accepts all subtypes
+	s.cfg.Attachments.ContentTypes = []string{"image/*"}
+	if got, err := s.attachmentContentType("image/svg+xml", nil); err != nil || got != "image/svg+xml" {
+		t.Errorf("image/* accepting image/svg+xml: got %q, %v", got, err)
+	}
+	if _, err := s.attachmentContentType("text/plain", nil); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("image/* accepting text/plain: got %v", err)
+	}
+}
+
+func TestUploadAttachmentUnsupportedType(t *testing.T) {
+	s, store, root := newAttachmentService(t)
+	alice := createUser(t, store, "alice")
+	note := createNote(t, store, alice, nil)
+
+	if _, err := upload(s, userContext(alice), note.ID, "", "<html>hi"); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("HTML upload: got %v, want ErrUnsupportedType", err)
+	}
+	if n := blobCount(t, root); n != 0 {
+		t.Errorf("%d blobs stored for a refused upload", n)
+	}
+}
+
+func TestAttachmentQuota(t *testing.T) {
+	s, store, root := newAttachmentService(t)
+	alice := createUser(t, store, "alice")
+	bob := createUser(t, store, "bob")
+	note := createNote(t, store, alice, nil)
+	other := createNote(t, store, alice, nil)
+	ctx := userContext(alice)
+
+	// the quota spans the user's notes
+	var first domain.AttachmentResponse
+	for i, noteID := range []string{note.ID, other.ID} {
+		attachment, err := upload(s, ctx, noteID, "text/plain", strings.Repeat("x", 20))
+		if err != nil {
+			t.Fatalf("upload %d: %v", i+1, err)
+		}
+		if i == 0 {
+			first = attachment
+		}
+	}
+	if _, err := upload(s, ctx, note.ID, "text/plain", strings.Repeat("x", 11)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("upload over the quota: got %v, want ErrTooLarge", err)
+	}
+	if _, err := upload(s, ctx, note.ID, "text/plain", strings.Repeat("x", 10)); err != nil {
+		t.Fatalf("upload filling the quota: %v", err)
+	}
+	if usage, err := s.GetAttachmentUsage(ctx); err != nil || usage.Used != 50 || usage.Quota != 50 || usage.MaxSize != 20 {
+		t.Errorf("usage %+v, %v, want 50 of 50 used", usage, err)
+	}
+	if _, err := upload(s, userContext(bob), createNote(t, store, bob, nil).ID, "text/plain", "x"); err != nil {
+		t.Errorf("upload by another user: %v", err)
+	}
+
+	// deleting frees its share of the quota and its blob
+	if err := s.DeleteAttachment(ctx, note.ID, first.ID); err != nil {
+		t.Fatalf("DeleteAttachment: %v", err)
+	}
+	if _, err := upload(s, ctx, note.ID, "text/plain", strings.Repeat("x", 20)); err != nil {
+		t.Fatalf("upload after a delete: %v", err)
+	}
+	if n := blobCount(t, root); n != 4 {
+		t.Errorf("%d blobs stored, want 4", n)
+	}
+}
+
+// racingStore records other attachments between the quota check and the
+// attachment being recorded, as a concurrent upload would
+type racingStore struct {
+	database.Storer
+	race func()
+}
+
+func (r racingStore) CreateAttachment(attachment *models.Attachment, quota int64) error {
+	r.race()
+	return r.Storer.CreateAttachment(attachment, quota)
+}
+
+func TestAttachmentQuotaRace(t *testing.T) {
+	s, store, root := newAttachmentService(t)
+	alice := createUser(t, store, "alice")
+	note := createNote(t, store, alice, nil)
+	s.store = racingStore{store, func() {
+		concurrent := &models.Attachment{NoteID: note.ID, UserID: alice.ID, Filename: "other", Size: 40, StorageKey: "elsewhere"}
+		if err := store.CreateAttachment(concurrent, 0); err != nil {
+			t.Fatal(err)
+		}
+	}}
+
+	if _, err := upload(s, userContext(alice), note.ID, "text/plain", strings.Repeat("x", 20)); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("upload beaten to the quota: got %v, want ErrTooLarge", err)
+	}
+	if n := blobCount(t, root); n != 0 {
+		t.Errorf("blob of the refused upload kept")
+	}
+}
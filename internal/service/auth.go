@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/jwt"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// issueTokens generates an access token and a refresh token belonging to
+// the given refresh token family
+func (s *service) issueTokens(user *models.User, familyID string) (domain.LoginResponse, error) {
+	accessToken, err := jwt.GenerateToken(user.ID, user.Username)
+	if err != nil {
+		return domain.LoginResponse{}, err
+	}
+
+	refreshToken, err := newSecretToken()
+	if err != nil {
+		return domain.LoginResponse{}, err
+	}
+	err = s.store.CreateRefreshToken(&models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashSecretToken(refreshToken),
+		ExpiresAt: time.Now().Add(s.cfg.JWT.RefreshTokenTTL),
+	})
+	if err != nil {
+		return domain.LoginResponse{}, err
+	}
+
+	return domain.LoginResponse{
+		Username:     user.Username,
+		AccessToken:  accessToken.Value,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(time.Until(accessToken.ExpiresAt).Round(time.Second).Seconds()),
+	}, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token can be used once; presenting one that was
+// already rotated is treated as theft and revokes the whole family.
+func (s *service) RefreshToken(ctx context.Context, refreshReq domain.RefreshRequest) (domain.LoginResponse, error) {
+	if refreshReq.RefreshToken == "" {
+		return domain.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	token, err := s.store.GetRefreshTokenByHash(hashSecretToken(refreshReq.RefreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return domain.LoginResponse{}, ErrInvalidRefreshToken
+		}
+		return domain.LoginResponse{}, err
+	}
+
+	if token.RevokedAt != nil {
+		logrus.Warnf("refresh token reuse detected for user %s, revoking token family %s", token.UserID, token.FamilyID)
+		if err := s.store.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+			return domain.LoginResponse{}, err
+		}
+		return domain.LoginResponse{}, ErrInvalidRefreshToken
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return domain.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	// only one concurrent refresh with the same token may rotate it
+	rotated, err := s.store.RevokeRefreshToken(token.ID)
+	if err != nil {
+		return domain.LoginResponse{}, err
+	}
+	if !rotated {
+		if err := s.store.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+			return domain.LoginResponse{}, err
+		}
+		return domain.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.store.GetUserByID(token.UserID)
+	if err != nil {
+		return domain.LoginResponse{}, err
+	}
+
+	return s.issueTokens(user, token.FamilyID)
+}
+
+// Logout revokes the caller's access token and, when given, the family of
+// the refresh token issued alongside it
+func (s *service) Logout(ctx context.Context, logoutReq domain.LogoutRequest) error {
+	userID := ctx.Value("user_id").(string)
+	tokenID := ctx.Value("token_id").(string)
+	expiresAt := ctx.Value("token_expires_at").(time.Time)
+
+	if logoutReq.RefreshToken != "" {
+		token, err := s.store.GetRefreshTokenByHash(hashSecretToken(logoutReq.RefreshToken))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if token.UserID != userID {
+			return ErrInvalidRefreshToken
+		}
+		if err := s.store.RevokeRefreshTokenFamily(token.FamilyID); err != nil {
+			return err
+		}
+	}
+
+	return s.store.RevokeAccessToken(tokenID, expiresAt)
+}
+
+// IssueTicket issues a ticket standing for the access token the request
+// was made with, for browsers to open event streams and WebSockets with. It
+// expires with the access token, if that is sooner than the ticket TTL, so
+// that it is covered by the access token's revocation.
+func (s *service) IssueTicket(ctx context.Context) (domain.TicketResponse, error) {
+	userID := ctx.Value("user_id").(string)
+	username := ctx.Value("user_name").(string)
+	tokenID := ctx.Value("token_id").(string)
+	expiresAt := ctx.Value("token_expires_at").(time.Time)
+
+	ttl := min(s.cfg.JWT.TicketTTL, time.Until(expiresAt))
+	ticket, err := jwt.GenerateTicket(userID, username, tokenID, ttl)
+	if err != nil {
+		return domain.TicketResponse{}, err
+	}
+
+	return domain.TicketResponse{
+		Ticket:    ticket.Value,
+		ExpiresIn: int64(time.Until(ticket.ExpiresAt).Round(time.Second).Seconds()),
+	}, nil
+}
+
+// IsTokenRevoked reports whether the access token with the given jti was revoked
+func (s *service) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	return s.store.IsAccessTokenRevoked(tokenID)
+}
+
+// newSecretToken returns a random, URL safe token for refresh tokens and
+// public links
+func newSecretToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecretToken is the form in which secret tokens are stored
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/middleware"
+)
+
+// login signs the user up and logs them in
+func login(t *testing.T, s *service, username string) domain.LoginResponse {
+	t.Helper()
+	ctx := context.Background()
+	creds := domain.SignupRequest{Username: username, Password: "password"}
+	if err := s.CreateNewUser(ctx, creds); err != nil {
+		t.Fatalf("CreateNewUser: %v", err)
+	}
+	tokens, err := s.LoginUser(ctx, domain.LoginRequest{Username: creds.Username, Password: creds.Password})
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	return tokens
+}
+
+// authenticate passes the access token through the authentication
+// middleware, checking revocations with the service, and returns the
+// status and the context the request reached the handler with
+func authenticate(s *service, accessToken string) (int, context.Context) {
+	var ctx context.Context
+	handler := middleware.SetMiddleWareAuthentication(s)(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	})
+	r := httptest.NewRequest(http.MethodGet, "/api/notes", nil)
+	r.Header.Set("Authorization", "Bearer "+accessToken)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code, ctx
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	ctx := context.Background()
+	first := login(t, s, "alice")
+
+	second, err := s.RefreshToken(ctx, domain.RefreshRequest{RefreshToken: first.RefreshToken})
+	if err != nil {
+		t.Fatalf("refreshing: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == first.AccessToken {
+		t.Fatal("refreshing did not rotate the tokens")
+	}
+	if status, _ := authenticate(s, second.AccessToken); status != http.StatusOK {
+		t.Fatalf("refreshed access token: status %d", status)
+	}
+
+	// replaying the rotated token is taken as theft: it is refused and
+	// takes the rest of its family with it
+	if _, err := s.RefreshToken(ctx, domain.RefreshRequest{RefreshToken: first.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("replaying a rotated refresh token: got %v, want ErrInvalidRefreshToken", err)
+	}
+	if _, err := s.RefreshToken(ctx, domain.RefreshRequest{RefreshToken: second.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("refreshing after a replay: got %v, want the family revoked", err)
+	}
+
+	// other logins are families of their own
+	other, err := s.LoginUser(ctx, domain.LoginRequest{Username: "alice", Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RefreshToken(ctx, domain.RefreshRequest{RefreshToken: other.RefreshToken}); err != nil {
+		t.Fatalf("refreshing another login: %v", err)
+	}
+
+	for _, token := range []string{"", "unknown"} {
+		if _, err := s.RefreshToken(ctx, domain.RefreshRequest{RefreshToken: token}); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refreshing with %q: got %v, want ErrInvalidRefreshToken", token, err)
+		}
+	}
+}
+
+func TestLogout(t *testing.T) {
+	s, _ := newTestService(t, nil)
+	tokens := login(t, s, "alice")
+	status, ctx := authenticate(s, tokens.AccessToken)
+	if status != http.StatusOK {
+		t.Fatalf("access token: status %d", status)
+	}
+	tokenID := ctx.Value("token_id").(string)
+
+	if err := s.Logout(ctx, domain.LogoutRequest{RefreshToken: tokens.RefreshToken}); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if revoked, err := s.IsTokenRevoked(ctx, tokenID); err != nil || !revoked {
+		t.Fatalf("IsTokenRevoked after logout = %v, %v", revoked, err)
+	}
+	if status, _ := authenticate(s, tokens.AccessToken); status != http.StatusUnauthorized {
+		t.Errorf("access token after logout: status %d, want 401", status)
+	}
+	if _, err := s.RefreshToken(ctx, domain.RefreshRequest{RefreshToken: tokens.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing after logout: got %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// a refresh token of another user is not the caller's to revoke
+	other := login(t, s, "bob")
+	_, ctx = authenticate(s, login(t, s, "carol").AccessToken)
+	if err := s.Logout(ctx, domain.LogoutRequest{RefreshToken: other.RefreshToken}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("logging out with another user's refresh token: got %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+)
+
+// Batch modes
+const (
+	batchAllOrNothing = "all_or_nothing"
+	batchBestEffort   = "best_effort"
+)
+
+// Batch operations
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+	batchShare  = "share"
+)
+
+// Batch operation statuses
+const (
+	batchOK         = "ok"
+	batchFailed     = "failed"
+	batchRolledBack = "rolled_back"
+	batchSkipped    = "skipped"
+)
+
+// maxBatchOperations bounds the operations of one batch
+const maxBatchOperations = 100
+
+// errBatchFailed rolls back an all or nothing batch once an operation
+// failed
+var errBatchFailed = errors.New("batch operation failed")
+
+// BatchNotes runs the operations in order in a single transaction. Each
+// operation is checked as if it were its own request. In all or nothing
+// mode the first failure undoes the operations before it and skips those
+// after it; in best effort mode only the failed operations are undone.
+func (s *service) BatchNotes(ctx context.Context, batchReq domain.BatchRequest) (domain.BatchResponse, error) {
+	mode := batchReq.Mode
+	if mode == "" {
+		mode = batchAllOrNothing
+	}
+	if err := validateBatch(mode, batchReq.Operations); err != nil {
+		return domain.BatchResponse{}, err
+	}
+
+	response := domain.BatchResponse{Mode: mode, Results: make(map[string]domain.BatchResult, len(batchReq.Operations))}
+	// events are held back until the transaction commits, and those of
+	// failed operations dropped
+	var published events.Buffer
+	err := s.store.Transaction(func(tx database.Storer) error {
+		// created maps the IDs of create operations to their notes
+		created := make(map[string]string)
+		failed := false
+		for _, op := range batchReq.Operations {
+			if failed && mode == batchAllOrNothing {
+				response.Results[op.ID] = domain.BatchResult{Op: op.Op, Status: batchSkipped}
+				continue
+			}
+
+			var result domain.BatchResult
+			var opEvents events.Buffer
+			// each operation gets its own savepoint so that a failure
+			// leaves the transaction usable
+			err := tx.Transaction(func(opTx database.Storer) error {
+				opService := s.withStore(opTx)
+				opService.events = &opEvents
+				var err error
+				result, err = opService.batchOperation(ctx, op, created)
+				return err
+			})
+			if err != nil {
+				failed = true
+				result = domain.BatchResult{Op: op.Op, Status: batchFailed, Error: err.Error(), Err: err}
+			} else {
+				opEvents.Flush(&published)
+			}
+			response.Results[op.ID] = result
+		}
+		if failed && mode == batchAllOrNothing {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBatchFailed) {
+		return domain.BatchResponse{}, err
+	}
+
+	response.Committed = err == nil
+	if response.Committed {
+		published.Flush(s.events)
+	} else {
+		for id, result := range response.Results {
+			if result.Status == batchOK {
+				response.Results[id] = domain.BatchResult{Op: result.Op, Status: batchRolledBack}
+			}
+		}
+	}
+	return response, nil
+}
+
+// batchOperation runs one operation of a batch
+func (s *service) batchOperation(ctx context.Context, op domain.BatchOperation, created map[string]string) (domain.BatchResult, error) {
+	result := domain.BatchResult{Op: op.Op, Status: batchOK}
+
+	noteID := op.NoteID
+	if ref, ok := strings.CutPrefix(noteID, "$"); ok {
+		if noteID, ok = created[ref]; !ok {
+			return result, fmt.Errorf("%w: operation %q did not create a note", ErrInvalidInput, ref)
+		}
+	}
+
+	switch op.Op {
+	case batchCreate:
+		if op.Note == nil || op.Note.Title == "" || op.Note.Body == "" {
+			return result, fmt.Errorf("%w: a title and body are required", ErrInvalidInput)
+		}
+		note, err := s.CreateNote(ctx, *op.Note)
+		if err != nil {
+			return result, err
+		}
+		created[op.ID] = note.ID
+		result.Note = &note
+	case batchUpdate:
+		if op.Note == nil || op.Note.Title == "" || op.Note.Body == "" {
+			return result, fmt.Errorf("%w: a title and body are required", ErrInvalidInput)
+		}
+		// as with If-Match, updates name the version they are based on
+		if op.Version < 1 {
+			return result, fmt.Errorf("%w: the version the update is based on is required", ErrInvalidInput)
+		}
+		note, err := s.UpdateNoteByID(ctx, noteID, op.Version, *op.Note)
+		if err != nil {
+			return result, err
+		}
+		result.Note = &note
+	case batchDelete:
+		if err := s.DeleteNoteByID(ctx, noteID); err != nil {
+			return result, err
+		}
+	case batchShare:
+		if op.Share == nil {
+			return result, fmt.Errorf("%w: share is required", ErrInvalidInput)
+		}
+		if err := s.ShareNoteWithUser(ctx, noteID, *op.Share); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// validateBatch checks the shape of a batch before anything runs
+func validateBatch(mode string, ops []domain.BatchOperation) error {
+	if mode != batchAllOrNothing && mode != batchBestEffort {
+		return fmt.Errorf("%w: mode must be %s or %s", ErrInvalidInput, batchAllOrNothing, batchBestEffort)
+	}
+	if len(ops) == 0 || len(ops) > maxBatchOperations {
+		return fmt.Errorf("%w: a batch holds 1 to %d operations", ErrInvalidInput, maxBatchOperations)
+	}
+	seen := make(map[string]bool, len(ops))
+	for i, op := range ops {
+		if op.ID == "" {
+			return fmt.Errorf("%w: operation %d has no id", ErrInvalidInput, i)
+		}
+		if seen[op.ID] {
+			return fmt.Errorf("%w: operation id %q is used more than once", ErrInvalidInput, op.ID)
+		}
+		seen[op.ID] = true
+
+		switch op.Op {
+		case batchCreate:
+		case batchUpdate, batchDelete, batchShare:
+			if op.NoteID == "" {
+				return fmt.Errorf("%w: operation %q needs a note_id", ErrInvalidInput, op.ID)
+			}
+		default:
+			return fmt.Errorf("%w: operation %q must be %s, %s, %s or %s", ErrInvalidInput, op.ID, batchCreate, batchUpdate, batchDelete, batchShare)
+		}
+	}
+	return nil
+}
+
+// withStore returns a copy of the service working on another store, such
+// as a transaction
+func (s *service) withStore(store database.Storer) *service {
+	copied := *s
+	copied.store = store
+	return &copied
+}
@@ -0,0 +1,247 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// watchedStore reports whether one of its transactions is open
+type watchedStore struct {
+	database.Storer
+	inTransaction *bool
+}
+
+func (w watchedStore) Transaction(fn func(tx database.Storer) error) error {
+	*w.inTransaction = true
+	defer func() { *w.inTransaction = false }()
+	return w.Storer.Transaction(fn)
+}
+
+var errShareFailed = errors.New("share failed")
+
+// halfSharingStore fails shares with carol after they were written, as a
+// statement failing after an earlier one of the same operation would
+type halfSharingStore struct {
+	database.Storer
+}
+
+func (h halfSharingStore) Transaction(fn func(tx database.Storer) error) error {
+	return h.Storer.Transaction(func(tx database.Storer) error {
+		return fn(halfSharingStore{tx})
+	})
+}
+
+func (h halfSharingStore) ShareNoteWithUser(noteID string, fromUserID string, toUsers []string, role string) error {
+	if err := h.Storer.ShareNoteWithUser(noteID, fromUserID, toUsers, role); err != nil {
+		return err
+	}
+	for _, username := range toUsers {
+		if username == "carol" {
+			return errShareFailed
+		}
+	}
+	return nil
+}
+
+// eventRecorder records the published events, failing the test for those
+// published while a transaction is open
+type eventRecorder struct {
+	t             *testing.T
+	inTransaction *bool
+	events        []events.Event
+}
+
+func (r *eventRecorder) Publish(event events.Event) {
+	if *r.inTransaction {
+		r.t.Errorf("%s event published before the transaction ended", event.Type)
+	}
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) types() []string {
+	types := make([]string, len(r.events))
+	for i, event := range r.events {
+		types[i] = event.Type + " " + event.Data.(domain.NoteEvent).Note.Title
+	}
+	return types
+}
+
+// eachBatchStore runs the test against a service over each store backend,
+// with tagging and shares with carol failing and the events recorded
+func eachBatchStore(t *testing.T, test func(t *testing.T, s *service, store database.Storer, published *eventRecorder)) {
+	backends := map[string]func() database.Storer{
+		"memory": database.NewMemoryStore,
+		"sqlite": func() database.Storer { return database.NewSQLiteStore(":memory:") },
+	}
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			store := open()
+			if err := store.AutoMigrate(); err != nil {
+				t.Fatalf("migrating: %v", err)
+			}
+			s, _ := newTestService(t, nil)
+			inTransaction := false
+			s.store = tagFailingStore{halfSharingStore{watchedStore{store, &inTransaction}}}
+			published := &eventRecorder{t: t, inTransaction: &inTransaction}
+			s.events = published
+			test(t, s, store, published)
+		})
+	}
+}
+
+// noteTitles returns the titles of the user's notes, in order
+func noteTitles(t *testing.T, store database.Storer, user *models.User) []string {
+	t.Helper()
+	page, err := store.ListNotes(database.NoteQuery{UserID: user.ID, Scope: database.ScopeOwned, Sort: database.SortTitle, Order: database.OrderAsc, Limit: 100})
+	if err != nil {
+		t.Fatalf("ListNotes: %v", err)
+	}
+	titles := make([]string, len(page.Notes))
+	for i, note := range page.Notes {
+		titles[i] = note.Title
+	}
+	return titles
+}
+
+func checkStatuses(t *testing.T, response domain.BatchResponse, want map[string]string) {
+	t.Helper()
+	for id, status := range want {
+		if got := response.Results[id].Status; got != status {
+			t.Errorf("operation %s is %s (%s), want %s", id, got, response.Results[id].Error, status)
+		}
+	}
+}
+
+func batchNote(title string, tags ...string) *domain.NoteRequest {
+	return &domain.NoteRequest{Title: title, Body: "body of " + title, Tags: tags}
+}
+
+func TestBatchAllOrNothing(t *testing.T) {
+	eachBatchStore(t, func(t *testing.T, s *service, store database.Storer, published *eventRecorder) {
+		alice := createUser(t, store, "alice")
+		bob := createUser(t, store, "bob")
+		existing := createNote(t, store, alice, nil)
+
+		response, err := s.BatchNotes(userContext(alice), domain.BatchRequest{Operations: []domain.BatchOperation{
+			{ID: "create", Op: batchCreate, Note: batchNote("created")},
+			{ID: "update", Op: batchUpdate, NoteID: existing.ID, Version: existing.Version, Note: batchNote("updated")},
+			{ID: "share", Op: batchShare, NoteID: "$create", Share: &domain.SharedNoteRequest{ToUsersID: []string{"bob"}}},
+			{ID: "conflict", Op: batchUpdate, NoteID: existing.ID, Version: existing.Version, Note: batchNote("conflicting")},
+			{ID: "after", Op: batchCreate, Note: batchNote("after")},
+		}})
+		if err != nil {
+			t.Fatalf("BatchNotes: %v", err)
+		}
+		if response.Committed || response.Mode != batchAllOrNothing {
+			t.Errorf("%s batch committed: %v", response.Mode, response.Committed)
+		}
+		checkStatuses(t, response, map[string]string{
+			"create":   batchRolledBack,
+			"update":   batchRolledBack,
+			"share":    batchRolledBack,
+			"conflict": batchFailed,
+			"after":    batchSkipped,
+		})
+		var mismatch *VersionMismatchError
+		if !errors.As(response.Results["conflict"].Err, &mismatch) {
+			t.Errorf("conflict failed with %v, want a version mismatch", response.Results["conflict"].Err)
+		}
+
+		if titles := noteTitles(t, store, alice); strings.Join(titles, ",") != existing.Title {
+			t.Errorf("notes after the rollback: %v, want only %s", titles, existing.Title)
+		}
+		if stored, err := store.GetNote(existing.ID); err != nil || stored.Version != existing.Version {
+			t.Errorf("updated note kept at version %d, %v", stored.Version, err)
+		}
+		if page, err := store.ListNotes(database.NoteQuery{UserID: bob.ID, Scope: database.ScopeShared, Sort: database.SortTitle, Order: database.OrderAsc, Limit: 10}); err != nil || len(page.Notes) != 0 {
+			t.Errorf("notes shared with bob after the rollback: %d, %v", len(page.Notes), err)
+		}
+		if len(published.events) != 0 {
+			t.Errorf("events %v published for a rolled back batch", published.types())
+		}
+	})
+}
+
+func TestBatchBestEffort(t *testing.T) {
+	eachBatchStore(t, func(t *testing.T, s *service, store database.Storer, published *eventRecorder) {
+		alice := createUser(t, store, "alice")
+		createUser(t, store, "bob")
+		carol := createUser(t, store, "carol")
+		existing := createNote(t, store, alice, nil)
+
+		response, err := s.BatchNotes(userContext(alice), domain.BatchRequest{Mode: batchBestEffort, Operations: []domain.BatchOperation{
+			{ID: "create", Op: batchCreate, Note: batchNote("created")},
+			// written, then undone when tagging fails
+			{ID: "update", Op: batchUpdate, NoteID: existing.ID, Version: existing.Version, Note: batchNote("updated", "home")},
+			{ID: "tagged", Op: batchCreate, Note: batchNote("tagged", "home")},
+			{ID: "share", Op: batchShare, NoteID: "$create", Share: &domain.SharedNoteRequest{ToUsersID: []string{"bob"}}},
+			{ID: "half share", Op: batchShare, NoteID: existing.ID, Share: &domain.SharedNoteRequest{ToUsersID: []string{"carol"}}},
+			{ID: "missing", Op: batchDelete, NoteID: "$tagged"},
+			{ID: "rename", Op: batchUpdate, NoteID: "$create", Version: 1, Note: batchNote("renamed")},
+		}})
+		if err != nil {
+			t.Fatalf("BatchNotes: %v", err)
+		}
+		if !response.Committed {
+			t.Error("best effort batch not committed")
+		}
+		checkStatuses(t, response, map[string]string{
+			"create":     batchOK,
+			"update":     batchFailed,
+			"tagged":     batchFailed,
+			"share":      batchOK,
+			"half share": batchFailed,
+			"missing":    batchFailed,
+			"rename":     batchOK,
+		})
+		if err := response.Results["half share"].Err; !errors.Is(err, errShareFailed) {
+			t.Errorf("half share failed with %v", err)
+		}
+
+		if titles := noteTitles(t, store, alice); strings.Join(titles, ",") != existing.Title+",renamed" {
+			t.Errorf("notes after the batch: %v, want %s and renamed", titles, existing.Title)
+		}
+		if stored, err := store.GetNote(existing.ID); err != nil || stored.Version != existing.Version || stored.Title != existing.Title {
+			t.Errorf("failed update left the note at %q, version %d, %v", stored.Title, stored.Version, err)
+		}
+
+		if share, err := store.GetNoteShare(existing.ID, carol.ID); err == nil {
+			t.Errorf("share %+v of a failed operation kept", share)
+		}
+
+		// only the events of the successful operations, once committed
+		want := []string{"note.created created", "note.shared created", "note.updated renamed"}
+		if got := published.types(); strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("events %v, want %v", got, want)
+		}
+	})
+}
+
+func TestBatchValidation(t *testing.T) {
+	s, store := newTestService(t, nil)
+	ctx := userContext(createUser(t, store, "alice"))
+
+	tests := []struct {
+		name  string
+		batch domain.BatchRequest
+	}{
+		{"unknown mode", domain.BatchRequest{Mode: "some", Operations: []domain.BatchOperation{{ID: "a", Op: batchCreate}}}},
+		{"no operations", domain.BatchRequest{}},
+		{"too many operations", domain.BatchRequest{Operations: make([]domain.BatchOperation, maxBatchOperations+1)}},
+		{"no id", domain.BatchRequest{Operations: []domain.BatchOperation{{Op: batchCreate}}}},
+		{"repeated id", domain.BatchRequest{Operations: []domain.BatchOperation{{ID: "a", Op: batchCreate}, {ID: "a", Op: batchCreate}}}},
+		{"unknown operation", domain.BatchRequest{Operations: []domain.BatchOperation{{ID: "a", Op: "rename"}}}},
+		{"no note", domain.BatchRequest{Operations: []domain.BatchOperation{{ID: "a", Op: batchDelete}}}},
+	}
+	for _, tt := range tests {
+		if _, err := s.BatchNotes(ctx, tt.batch); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: got %v, want ErrInvalidInput", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/GauravMakhijani/notes/internal/collab"
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+// JoinCollab joins the user to the live editing session of the note. Anyone
+// who can read the note may follow the session, but only editors and owners
+// may change it. The caller leaves the session.
+func (s *service) JoinCollab(ctx context.Context, noteID string) (*collab.Client, error) {
+	userID := ctx.Value("user_id").(string)
+
+	_, role, err := s.authorizeNote(userID, noteID, models.RoleViewer)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.store.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	participant := collab.Participant{
+		UserID:   userID,
+		Username: user.Username,
+		CanEdit:  roleRanks[role] >= roleRanks[models.RoleEditor],
+	}
+	client, err := s.collab.Join(noteID, participant, &collabStore{service: s, noteID: noteID})
+	if errors.Is(err, collab.ErrGone) {
+		return nil, ErrNotFound
+	}
+	return client, err
+}
+
+// collabStore gives a live editing session access to its note
+type collabStore struct {
+	service *service
+	noteID  string
+}
+
+func (c *collabStore) Load() (collab.Snapshot, error) {
+	note, err := c.service.store.GetNote(c.noteID)
+	if err != nil {
+		return collab.Snapshot{}, collabError(err)
+	}
+	return collab.Snapshot{Content: note.Content, Version: note.Version}, nil
+}
+
+// Save writes the session's text as an update by the author, which like any
+// other update becomes a revision and is published. Notes always have a
+// body, as when written through the API, so an emptied note is left as it
+// was until there is text again.
+func (c *collabStore) Save(authorID, content string, version int) (collab.Snapshot, error) {
+	if content == "" {
+		return collab.Snapshot{Content: content, Version: version}, nil
+	}
+
+	note, err := c.service.store.UpdateNoteByID(authorID, c.noteID, version, &models.Note{Content: content})
+	if errors.Is(err, database.ErrVersionConflict) {
+		return collab.Snapshot{}, collab.ErrStale
+	}
+	if err != nil {
+		return collab.Snapshot{}, collabError(err)
+	}
+	c.service.pruneRevisions(c.noteID)
+	c.service.publishNoteEvent(events.NoteUpdated, authorID, note, nil)
+	return collab.Snapshot{Content: note.Content, Version: note.Version}, nil
+}
+
+// Access checks the user's role on the note again, since shares and group
+// memberships change while sessions last
+func (c *collabStore) Access(userID string) (bool, error) {
+	_, role, err := c.service.authorizeNote(userID, c.noteID, models.RoleViewer)
+	if errors.Is(err, ErrNotFound) {
+		return false, collab.ErrNoAccess
+	}
+	if err != nil {
+		return false, err
+	}
+	return roleRanks[role] >= roleRanks[models.RoleEditor], nil
+}
+
+// collabError reports a note that no longer exists, or is in the trash,
+// as gone
+func collabError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return collab.ErrGone
+	}
+	return err
+}
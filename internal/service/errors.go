@@ -0,0 +1,56 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidCredentials is returned when a login uses an unknown
+	// username or a wrong password
+	ErrInvalidCredentials = errors.New("invalid username or password")
+
+	// ErrInvalidInput is wrapped by errors caused by invalid request values
+	ErrInvalidInput = errors.New("invalid input")
+
+	// ErrForbidden is returned when the caller may not perform an action
+	ErrForbidden = errors.New("forbidden")
+
+	// ErrNotFound is returned when the requested resource does not exist or
+	// is not visible to the caller
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is wrapped by errors caused by a request clashing with
+	// the current state of a resource
+	ErrConflict = errors.New("conflict")
+
+	// ErrGone is returned when a resource existed but can no longer be
+	// used, such as an expired public link
+	ErrGone = errors.New("gone")
+
+	// ErrTooLarge is wrapped by errors caused by an upload exceeding the
+	// size limit or the uploader's quota
+	ErrTooLarge = errors.New("too large")
+
+	// ErrUnsupportedType is wrapped by errors caused by an upload of a
+	// content type that is not accepted
+	ErrUnsupportedType = errors.New("unsupported content type")
+
+	// ErrInvalidLinkPassword is returned when a public link is opened
+	// without its password or with a wrong one
+	ErrInvalidLinkPassword = errors.New("invalid link password")
+
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown,
+	// expired, revoked or belongs to another user
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+)
+
+// VersionMismatchError is returned when a note update is based on a version
+// other than the note's current one
+type VersionMismatchError struct {
+	CurrentVersion int
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("note was modified, current version is %d", e.CurrentVersion)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+)
+
+// SubscribeEvents starts the stream of events about notes the user can
+// read, resuming after the given event ID when it is not nil. The caller
+// closes the subscription.
+func (s *service) SubscribeEvents(ctx context.Context, after *uint64) *events.Subscription {
+	userID := ctx.Value("user_id").(string)
+	return s.bus.Subscribe(userID, after)
+}
+
+// publishNoteEvent tells the users who can read the note about a change
+// to it
+func (s *service) publishNoteEvent(eventType, actorID string, note *models.Note, share *domain.NoteEventShare) {
+	if event, ok := s.noteEvent(eventType, actorID, note, share); ok {
+		s.events.Publish(event)
+	}
+}
+
+// noteEvent builds the event about a change to the note, addressed to the
+// users who can read it. Events are best effort, so failures are only
+// logged and leave ok false.
+func (s *service) noteEvent(eventType, actorID string, note *models.Note, share *domain.NoteEventShare) (events.Event, bool) {
+	users, err := s.noteAudience(note)
+	if err != nil {
+		logrus.Errorf("error finding the users to notify of a change to note %s\nError: %s", note.ID, err.Error())
+		return events.Event{}, false
+	}
+
+	data := domain.NoteEvent{NoteID: note.ID, ActorID: actorID, Share: share}
+	if eventType != events.NoteDeleted {
+		response := noteResponse(note)
+		data.Note = &response
+	}
+	return events.Event{Type: eventType, Users: users, Data: data}, true
+}
+
+// noteAudience returns the IDs of the users who can read the note: its
+// owner or the members of its group, and those it is shared with
+func (s *service) noteAudience(note *models.Note) ([]string, error) {
+	seen := make(map[string]bool)
+	var users []string
+	add := func(userID string) {
+		if !seen[userID] {
+			seen[userID] = true
+			users = append(users, userID)
+		}
+	}
+
+	if note.GroupID != nil {
+		members, err := s.store.ListGroupMembers(*note.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			add(member.UserID)
+		}
+	} else {
+		add(note.UserID)
+	}
+
+	shares, err := s.store.ListNoteShares(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range shares {
+		add(share.ToUserID)
+	}
+	return users, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/archive"
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// Export formats
+const (
+	exportFormatJSON     = "json"
+	exportFormatMarkdown = "zip"
+)
+
+// exportPageSize is how many notes are read from the store at a time while
+// exporting
+const exportPageSize = 100
+
+// ExportNotes prepares an export of the user's own notes, oldest first, as
+// a JSON document or as a zip of Markdown files. Notes are read page by
+// page while the export is written, so large exports are never held in
+// memory.
+func (s *service) ExportNotes(ctx context.Context, format string) (domain.Export, error) {
+	userID := ctx.Value("user_id").(string)
+	now := time.Now().UTC()
+	name := "notes-export-" + now.Format("20060102-150405")
+
+	switch format {
+	case "", exportFormatJSON:
+		return domain.Export{
+			Filename:    name + ".json",
+			ContentType: "application/json",
+			Write: func(w io.Writer) error {
+				out, err := archive.NewJSONWriter(w, now)
+				if err != nil {
+					return err
+				}
+				return s.writeExport(ctx, userID, out)
+			},
+		}, nil
+	case exportFormatMarkdown:
+		return domain.Export{
+			Filename:    name + ".zip",
+			ContentType: "application/zip",
+			Write: func(w io.Writer) error {
+				return s.writeExport(ctx, userID, archive.NewMarkdownWriter(w))
+			},
+		}, nil
+	default:
+		return domain.Export{}, fmt.Errorf("%w: format must be %s or %s", ErrInvalidInput, exportFormatJSON, exportFormatMarkdown)
+	}
+}
+
+// writeExport writes the user's notes to the export and finishes it
+func (s *service) writeExport(ctx context.Context, userID string, out archive.Writer) error {
+	query := database.NoteQuery{
+		UserID: userID,
+		Scope:  database.ScopeOwned,
+		Sort:   database.SortCreatedAt,
+		Order:  database.OrderAsc,
+		Limit:  exportPageSize,
+	}
+	for {
+		page, err := s.store.ListNotes(query)
+		if err != nil {
+			return err
+		}
+		for _, note := range page.Notes {
+			exported, err := s.exportNote(ctx, note)
+			if err != nil {
+				return err
+			}
+			if err := out.WriteNote(exported); err != nil {
+				return err
+			}
+		}
+		if page.Next == nil {
+			return out.Close()
+		}
+		query.After = page.Next
+	}
+}
+
+// exportNote gathers a note's share recipients and attachments. The
+// contents of the attachments are only read when they are written.
+func (s *service) exportNote(ctx context.Context, note *models.Note) (*archive.Note, error) {
+	exported := &archive.Note{
+		ID:        note.ID,
+		Title:     note.Title,
+		Body:      note.Content,
+		Format:    note.Format,
+		CreatedAt: note.CreatedAt,
+		UpdatedAt: note.UpdatedAt,
+		Tags:      tagNames(note.Tags),
+	}
+
+	shares, err := s.store.ListNoteShares(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, share := range shares {
+		exported.SharedWith = append(exported.SharedWith, archive.Share{Username: share.ToUsername, Role: share.Role})
+	}
+
+	attachments, err := s.store.ListAttachments(note.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		key := attachment.StorageKey
+		exported.Attachments = append(exported.Attachments, archive.Attachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			Checksum:    attachment.Checksum,
+			Open: func() (io.ReadCloser, error) {
+				return s.blobs.Get(ctx, key)
+			},
+		})
+	}
+	return exported, nil
+}
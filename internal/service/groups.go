@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// maxGroupNameLength is the longest group name accepted, in characters
+const maxGroupNameLength = 100
+
+// groupRoleRanks orders the group roles by privilege
+var groupRoleRanks = map[string]int{
+	models.GroupRoleMember: 1,
+	models.GroupRoleAdmin:  2,
+	models.GroupRoleOwner:  3,
+}
+
+// groupRole checks that the user holds at least the given role in the
+// group and returns their role. Groups the user is not a member of are
+// reported as not found.
+func (s *service) groupRole(userID, groupID, minRole string) (string, error) {
+	membership, err := s.store.GetMembership(groupID, userID)
+	if err != nil {
+		return "", notFound(err)
+	}
+	if groupRoleRanks[membership.Role] < groupRoleRanks[minRole] {
+		return "", fmt.Errorf("%w: this action needs the %s role in the group", ErrForbidden, minRole)
+	}
+	return membership.Role, nil
+}
+
+// CreateGroup creates a group owned by the user
+func (s *service) CreateGroup(ctx context.Context, groupReq domain.GroupRequest) (domain.GroupResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	name := strings.TrimSpace(groupReq.Name)
+	if name == "" || len([]rune(name)) > maxGroupNameLength {
+		return domain.GroupResponse{}, fmt.Errorf("%w: group name must be 1 to %d characters", ErrInvalidInput, maxGroupNameLength)
+	}
+
+	group := &models.Group{Name: name, CreatedBy: userID}
+	if err := s.store.CreateGroup(group, userID); err != nil {
+		return domain.GroupResponse{}, err
+	}
+	return s.groupResponse(group, models.GroupRoleOwner)
+}
+
+// ListGroups lists the groups the user is a member of
+func (s *service) ListGroups(ctx context.Context) ([]domain.GroupResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	groups, err := s.store.ListUserGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]domain.GroupResponse, 0, len(groups))
+	for _, group := range groups {
+		response = append(response, domain.GroupResponse{
+			ID:          group.ID,
+			Name:        group.Name,
+			Role:        group.Role,
+			MemberCount: group.MemberCount,
+			CreatedAt:   group.CreatedAt,
+		})
+	}
+	return response, nil
+}
+
+// GetGroup fetches a group the user is a member of along with its members
+func (s *service) GetGroup(ctx context.Context, groupID string) (domain.GroupResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	role, err := s.groupRole(userID, groupID, models.GroupRoleMember)
+	if err != nil {
+		return domain.GroupResponse{}, err
+	}
+	group, err := s.store.GetGroup(groupID)
+	if err != nil {
+		return domain.GroupResponse{}, notFound(err)
+	}
+	return s.groupResponse(group, role)
+}
+
+// AddGroupMember adds a user to the group. Admins may add members but only
+// the owner may add admins.
+func (s *service) AddGroupMember(ctx context.Context, groupID string, memberReq domain.GroupMemberRequest) (domain.GroupResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	role, err := validMemberRole(memberReq.Role)
+	if err != nil {
+		return domain.GroupResponse{}, err
+	}
+	minRole := models.GroupRoleAdmin
+	if role == models.GroupRoleAdmin {
+		minRole = models.GroupRoleOwner
+	}
+	if _, err := s.groupRole(userID, groupID, minRole); err != nil {
+		return domain.GroupResponse{}, err
+	}
+
+	user, err := s.store.GetUserByUsername(memberReq.Username)
+	if err != nil {
+		return domain.GroupResponse{}, fmt.Errorf("%w: no user named %s", ErrInvalidInput, memberReq.Username)
+	}
+	err = s.store.AddGroupMember(groupID, user.ID, role)
+	if errors.Is(err, database.ErrMemberExists) {
+		return domain.GroupResponse{}, fmt.Errorf("%w: %s is already a member", ErrConflict, memberReq.Username)
+	}
+	if err != nil {
+		return domain.GroupResponse{}, err
+	}
+	return s.GetGroup(ctx, groupID)
+}
+
+// UpdateGroupMember changes the role of a member. Only the owner may
+// change roles and their own role cannot be changed.
+func (s *service) UpdateGroupMember(ctx context.Context, groupID, username string, memberReq domain.GroupMemberRequest) (domain.GroupResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	role, err := validMemberRole(memberReq.Role)
+	if err != nil {
+		return domain.GroupResponse{}, err
+	}
+	if _, err := s.groupRole(userID, groupID, models.GroupRoleOwner); err != nil {
+		return domain.GroupResponse{}, err
+	}
+	member, err := s.groupMember(groupID, username)
+	if err != nil {
+		return domain.GroupResponse{}, err
+	}
+	if member.Role == models.GroupRoleOwner {
+		return domain.GroupResponse{}, fmt.Errorf("%w: the role of the group owner cannot be changed", ErrInvalidInput)
+	}
+
+	if err := s.store.UpdateGroupMember(groupID, member.UserID, role); err != nil {
+		return domain.GroupResponse{}, notFound(err)
+	}
+	return s.GetGroup(ctx, groupID)
+}
+
+// RemoveGroupMember removes a user from the group, ending their access to
+// its notes. Members may leave, admins may remove members and the owner
+// may remove anyone but themselves.
+func (s *service) RemoveGroupMember(ctx context.Context, groupID, username string) error {
+	userID := ctx.Value("user_id").(string)
+
+	role, err := s.groupRole(userID, groupID, models.GroupRoleMember)
+	if err != nil {
+		return err
+	}
+	member, err := s.groupMember(groupID, username)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case member.Role == models.GroupRoleOwner:
+		return fmt.Errorf("%w: the group owner cannot be removed", ErrInvalidInput)
+	case member.UserID == userID:
+	case groupRoleRanks[role] <= groupRoleRanks[member.Role]:
+		return fmt.Errorf("%w: you cannot remove this member", ErrForbidden)
+	}
+	return notFound(s.store.RemoveGroupMember(groupID, member.UserID))
+}
+
+// groupMember fetches the membership of the user with the given username
+func (s *service) groupMember(groupID, username string) (*models.Membership, error) {
+	user, err := s.store.GetUserByUsername(username)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	membership, err := s.store.GetMembership(groupID, user.ID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return membership, nil
+}
+
+// validMemberRole checks the role given to a member, defaulting to member
+func validMemberRole(role string) (string, error) {
+	switch role {
+	case "":
+		return models.GroupRoleMember, nil
+	case models.GroupRoleMember, models.GroupRoleAdmin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("%w: role must be member or admin", ErrInvalidInput)
+	}
+}
+
+// groupResponse converts a group to its API representation with its
+// members
+func (s *service) groupResponse(group *models.Group, role string) (domain.GroupResponse, error) {
+	members, err := s.store.ListGroupMembers(group.ID)
+	if err != nil {
+		return domain.GroupResponse{}, err
+	}
+
+	response := domain.GroupResponse{
+		ID:          group.ID,
+		Name:        group.Name,
+		Role:        role,
+		MemberCount: int64(len(members)),
+		Members:     make([]domain.GroupMemberResponse, 0, len(members)),
+		CreatedAt:   group.CreatedAt,
+	}
+	for _, member := range members {
+		response.Members = append(response.Members, domain.GroupMemberResponse{
+			Username: member.Username,
+			Role:     member.Role,
+			JoinedAt: member.CreatedAt,
+		})
+	}
+	return response, nil
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/archive"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Import formats
+const (
+	importFormatMarkdown = "zip"
+	importFormatENEX     = "enex"
+	importFormatJSON     = "json"
+)
+
+// importFlushSize is how many items are processed between saving the
+// progress of an import
+const importFlushSize = 50
+
+// StartImport spools an import file and starts importing the notes it
+// holds in the background, returning the pending job. At most the
+// configured number of imports run at a time.
+func (s *service) StartImport(ctx context.Context, importReq domain.ImportRequest) (domain.ImportJobResponse, error) {
+	userID := ctx.Value("user_id").(string)
+	maxSize := s.cfg.Import.MaxSize
+
+	tmp, err := os.CreateTemp("", "notes-import-*")
+	if err != nil {
+		return domain.ImportJobResponse{}, err
+	}
+	started := false
+	defer func() {
+		tmp.Close()
+		if !started {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	size, err := io.Copy(tmp, io.LimitReader(importReq.Body, maxSize+1))
+	if err != nil {
+		return domain.ImportJobResponse{}, fmt.Errorf("%w: reading upload: %s", ErrInvalidInput, err)
+	}
+	if size > maxSize {
+		return domain.ImportJobResponse{}, fmt.Errorf("%w: imports are limited to %d bytes", ErrTooLarge, maxSize)
+	}
+	if size == 0 {
+		return domain.ImportJobResponse{}, fmt.Errorf("%w: the file is empty", ErrInvalidInput)
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	format, err := importFormat(importReq.Format, importReq.Filename, head[:n])
+	if err != nil {
+		return domain.ImportJobResponse{}, err
+	}
+	if format == importFormatMarkdown {
+		if _, err := zip.NewReader(tmp, size); err != nil {
+			return domain.ImportJobResponse{}, fmt.Errorf("%w: not a valid zip file: %s", ErrInvalidInput, err)
+		}
+	}
+
+	job := &models.ImportJob{
+		UserID:        userID,
+		Format:        format,
+		Filename:      filepath.Base(strings.ReplaceAll(importReq.Filename, "\\", "/")),
+		DryRun:        importReq.DryRun,
+		DedupeByTitle: importReq.DedupeByTitle,
+		Status:        models.ImportPending,
+	}
+	if err := s.store.CreateImportJob(job); err != nil {
+		return domain.ImportJobResponse{}, err
+	}
+
+	started = true
+	go s.runImport(job, tmp.Name(), size)
+	return importJobResponse(job, nil), nil
+}
+
+// GetImportJob returns an import job of the user with the outcome of each
+// item processed so far
+func (s *service) GetImportJob(ctx context.Context, id string) (domain.ImportJobResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	job, err := s.store.GetImportJob(userID, id)
+	if err != nil {
+		return domain.ImportJobResponse{}, notFound(err)
+	}
+	items, err := s.store.ListImportItems(job.ID)
+	if err != nil {
+		return domain.ImportJobResponse{}, err
+	}
+	return importJobResponse(job, items), nil
+}
+
+// ListImportJobs lists the user's import jobs, newest first, without their
+// items
+func (s *service) ListImportJobs(ctx context.Context) ([]domain.ImportJobResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	jobs, err := s.store.ListImportJobs(userID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]domain.ImportJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		responses = append(responses, importJobResponse(job, nil))
+	}
+	return responses, nil
+}
+
+// RecoverImportJobs fails the import jobs a previous run of the server left
+// unfinished, whose files are gone, and returns how many there were
+func (s *service) RecoverImportJobs(ctx context.Context) (int64, error) {
+	return s.store.FailInterruptedImportJobs(time.Now())
+}
+
+// runImport imports the notes of the spooled file once a worker is free,
+// then removes the file
+func (s *service) runImport(job *models.ImportJob, path string, size int64) {
+	defer os.Remove(path)
+
+	s.imports <- struct{}{}
+	defer func() { <-s.imports }()
+
+	run := &importRun{service: s, ctx: context.Background(), job: job, titles: map[string]bool{}}
+	err := run.start()
+	if err == nil {
+		err = run.read(path, size)
+	}
+	if flushErr := run.flush(); err == nil {
+		err = flushErr
+	}
+
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.Status = models.ImportCompleted
+	if err != nil {
+		job.Status = models.ImportFailed
+		job.Error = err.Error()
+	}
+	if err := s.store.UpdateImportJob(job); err != nil {
+		logrus.Errorf("error finishing import job %s\nError: %s", job.ID, err.Error())
+	}
+}
+
+// importRun holds the state of an import while it runs
+type importRun struct {
+	service *service
+	ctx     context.Context
+	job     *models.ImportJob
+	// titles are the lowercased titles of the user's notes, including
+	// those imported so far, when deduplicating by title
+	titles map[string]bool
+	// pending are the items processed since the progress was last saved
+	pending []*models.ImportItem
+}
+
+func (r *importRun) start() error {
+	r.job.Status = models.ImportRunning
+	if err := r.service.store.UpdateImportJob(r.job); err != nil {
+		return err
+	}
+	if !r.job.DedupeByTitle {
+		return nil
+	}
+	titles, err := r.service.store.ListNoteTitles(r.job.UserID)
+	if err != nil {
+		return err
+	}
+	for _, title := range titles {
+		r.titles[titleKey(title)] = true
+	}
+	return nil
+}
+
+// read hands each entry of the file to add
+func (r *importRun) read(path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch r.job.Format {
+	case importFormatMarkdown:
+		return archive.ReadMarkdownZip(f, size, r.add)
+	case importFormatENEX:
+		return archive.ReadENEX(bufio.NewReader(f), r.add)
+	default:
+		return archive.ReadJSON(bufio.NewReader(f), r.add)
+	}
+}
+
+// add imports an entry and records its outcome, saving the progress every
+// importFlushSize items
+func (r *importRun) add(entry archive.Item) error {
+	item := r.importItem(entry)
+	item.JobID = r.job.ID
+	item.Position = r.job.Total
+	r.job.Total++
+	switch item.Status {
+	case models.ImportItemCreated, models.ImportItemValid:
+		r.job.Created++
+	case models.ImportItemSkipped:
+		r.job.Skipped++
+	default:
+		r.job.Failed++
+	}
+
+	r.pending = append(r.pending, item)
+	if len(r.pending) < importFlushSize {
+		return nil
+	}
+	return r.flush()
+}
+
+// flush saves the items processed since the last flush and the job's
+// counts
+func (r *importRun) flush() error {
+	if err := r.service.store.AddImportItems(r.pending); err != nil {
+		return err
+	}
+	r.pending = r.pending[:0]
+	return r.service.store.UpdateImportJob(r.job)
+}
+
+// importItem creates the note of an entry, or in a dry run only checks
+// it. Attachments that cannot be stored are reported without failing the
+// note.
+func (r *importRun) importItem(entry archive.Item) *models.ImportItem {
+	item := &models.ImportItem{Name: entry.Name, Status: models.ImportItemFailed}
+	if entry.Err != nil {
+		item.Error = entry.Err.Error()
+		return item
+	}
+	imported := entry.Note
+	item.Title = strings.TrimSpace(imported.Title)
+	if item.Title == "" {
+		item.Error = "the note has no title"
+		return item
+	}
+
+	format := models.NoteFormatPlain
+	if imported.Format != "" {
+		var err error
+		if format, err = validNoteFormat(imported.Format); err != nil {
+			item.Error = err.Error()
+			return item
+		}
+	}
+	tags, err := normalizeTags(imported.Tags)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+
+	if r.job.DedupeByTitle {
+		key := titleKey(item.Title)
+		if r.titles[key] {
+			item.Status = models.ImportItemSkipped
+			item.Error = "a note with this title already exists"
+			return item
+		}
+		r.titles[key] = true
+	}
+	if r.job.DryRun {
+		item.Status = models.ImportItemValid
+		return item
+	}
+
+	note := &models.Note{
+		Title:     item.Title,
+		Content:   imported.Body,
+		Format:    format,
+		UserID:    r.job.UserID,
+		CreatedAt: imported.CreatedAt,
+		UpdatedAt: imported.UpdatedAt,
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = note.CreatedAt
+	}
+	note, err = r.service.store.CreateNewNote(note)
+	if err != nil {
+		logrus.Errorf("error importing note %q of import job %s\nError: %s", item.Name, r.job.ID, err.Error())
+		item.Error = "the note could not be saved"
+		return item
+	}
+	item.NoteID = &note.ID
+	item.Status = models.ImportItemCreated
+
+	var problems []string
+	if len(tags) > 0 {
+		if note.Tags, err = r.service.store.SetNoteTags(r.job.UserID, note.ID, tags); err != nil {
+			logrus.Errorf("error tagging imported note %s\nError: %s", note.ID, err.Error())
+			problems = append(problems, "the tags could not be saved")
+		}
+	}
+	r.service.publishNoteEvent(events.NoteCreated, r.job.UserID, note, nil)
+	for i := range imported.Attachments {
+		attachment := &imported.Attachments[i]
+		if err := r.importAttachment(note.ID, attachment); err != nil {
+			problems = append(problems, fmt.Sprintf("attachment %s: %s", attachment.Filename, err.Error()))
+		}
+	}
+	item.Error = strings.Join(problems, "; ")
+	return item
+}
+
+func (r *importRun) importAttachment(noteID string, attachment *archive.Attachment) error {
+	body, err := attachment.Contents()
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	_, err = r.service.storeAttachment(r.ctx, r.job.UserID, noteID, domain.AttachmentUpload{
+		Filename:    attachment.Filename,
+		ContentType: attachment.ContentType,
+		Body:        body,
+	})
+	return err
+}
+
+// importFormat returns the format of an import file: the one requested, or
+// else the one its extension or first bytes tell
+func importFormat(format, filename string, head []byte) (string, error) {
+	switch format {
+	case importFormatMarkdown, importFormatENEX, importFormatJSON:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("%w: format must be %s, %s or %s", ErrInvalidInput, importFormatMarkdown, importFormatENEX, importFormatJSON)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".zip":
+		return importFormatMarkdown, nil
+	case ".enex":
+		return importFormatENEX, nil
+	case ".json":
+		return importFormatJSON, nil
+	}
+
+	head = bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return importFormatMarkdown, nil
+	case bytes.HasPrefix(head, []byte("{")):
+		return importFormatJSON, nil
+	case bytes.HasPrefix(head, []byte("<")):
+		return importFormatENEX, nil
+	}
+	return "", fmt.Errorf("%w: the format of the file is not recognized, set format to %s, %s or %s", ErrUnsupportedType, importFormatMarkdown, importFormatENEX, importFormatJSON)
+}
+
+// titleKey is how titles are compared when deduplicating by title
+func titleKey(title string) string {
+	return strings.ToLower(strings.TrimSpace(title))
+}
+
+func importJobResponse(job *models.ImportJob, items []*models.ImportItem) domain.ImportJobResponse {
+	response := domain.ImportJobResponse{
+		ID:            job.ID,
+		Format:        job.Format,
+		Filename:      job.Filename,
+		DryRun:        job.DryRun,
+		DedupeByTitle: job.DedupeByTitle,
+		Status:        job.Status,
+		Error:         job.Error,
+		Total:         job.Total,
+		Created:       job.Created,
+		Skipped:       job.Skipped,
+		Failed:        job.Failed,
+		CreatedAt:     job.CreatedAt,
+		FinishedAt:    job.FinishedAt,
+	}
+	for _, item := range items {
+		response.Items = append(response.Items, domain.ImportItemResponse{
+			Name:   item.Name,
+			Title:  item.Title,
+			Status: item.Status,
+			NoteID: item.NoteID,
+			Error:  item.Error,
+		})
+	}
+	return response
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxLinkPasswordLength is the longest password bcrypt takes into account
+const maxLinkPasswordLength = 72
+
+// publicLinkPath is where a public link with the given token is served
+func publicLinkPath(token string) string {
+	return "/p/" + token
+}
+
+// CreatePublicLink creates a link through which anyone can read the note.
+// Only the owner may create links.
+func (s *service) CreatePublicLink(ctx context.Context, noteID string, linkReq domain.PublicLinkRequest) (domain.PublicLinkResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if linkReq.ExpiresAt != nil && !linkReq.ExpiresAt.After(time.Now()) {
+		return domain.PublicLinkResponse{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidInput)
+	}
+	if linkReq.MaxViews != nil && *linkReq.MaxViews < 1 {
+		return domain.PublicLinkResponse{}, fmt.Errorf("%w: max_views must be at least 1", ErrInvalidInput)
+	}
+	if len(linkReq.Password) > maxLinkPasswordLength {
+		return domain.PublicLinkResponse{}, fmt.Errorf("%w: password must be at most %d bytes", ErrInvalidInput, maxLinkPasswordLength)
+	}
+	if _, _, err := s.authorizeNote(userID, noteID, roleOwner); err != nil {
+		return domain.PublicLinkResponse{}, err
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return domain.PublicLinkResponse{}, err
+	}
+	link := &models.PublicLink{
+		NoteID:    noteID,
+		UserID:    userID,
+		TokenHash: hashSecretToken(token),
+		ExpiresAt: linkReq.ExpiresAt,
+		MaxViews:  linkReq.MaxViews,
+	}
+	if linkReq.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(linkReq.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return domain.PublicLinkResponse{}, err
+		}
+		link.PasswordHash = string(hash)
+	}
+	if err := s.store.CreatePublicLink(link); err != nil {
+		return domain.PublicLinkResponse{}, err
+	}
+
+	response := publicLinkResponse(link)
+	response.Token = token
+	response.Path = publicLinkPath(token)
+	return response, nil
+}
+
+// ListPublicLinks lists the links to the note that can still be opened.
+// Only the owner may see them.
+func (s *service) ListPublicLinks(ctx context.Context, noteID string) ([]domain.PublicLinkResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, roleOwner); err != nil {
+		return nil, err
+	}
+	links, err := s.store.ListPublicLinks(noteID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]domain.PublicLinkResponse, 0, len(links))
+	for _, link := range links {
+		response = append(response, publicLinkResponse(link))
+	}
+	return response, nil
+}
+
+// RevokePublicLink stops a link to the note from working
+func (s *service) RevokePublicLink(ctx context.Context, noteID, linkID string) error {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, roleOwner); err != nil {
+		return err
+	}
+	return notFound(s.store.RevokePublicLink(noteID, linkID, time.Now()))
+}
+
+// OpenPublicLink returns the note behind a public link and counts the
+// view. Unknown and revoked links are not found while expired and used up
+// ones are gone.
+func (s *service) OpenPublicLink(ctx context.Context, token, password string) (domain.PublicNoteResponse, error) {
+	now := time.Now()
+
+	link, err := s.store.GetPublicLinkByHash(hashSecretToken(token))
+	if err != nil {
+		return domain.PublicNoteResponse{}, notFound(err)
+	}
+	if link.RevokedAt != nil {
+		return domain.PublicNoteResponse{}, ErrNotFound
+	}
+	if (link.ExpiresAt != nil && !link.ExpiresAt.After(now)) || (link.MaxViews != nil && link.ViewCount >= *link.MaxViews) {
+		return domain.PublicNoteResponse{}, fmt.Errorf("%w: this link has expired", ErrGone)
+	}
+	if link.PasswordHash != "" {
+		if password == "" {
+			return domain.PublicNoteResponse{}, fmt.Errorf("%w: this link needs a password", ErrInvalidLinkPassword)
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)); err != nil {
+			return domain.PublicNoteResponse{}, ErrInvalidLinkPassword
+		}
+	}
+
+	note, err := s.store.GetNote(link.NoteID)
+	if err != nil {
+		return domain.PublicNoteResponse{}, notFound(err)
+	}
+	// the view limit may have been reached since the link was read
+	counted, err := s.store.RecordPublicLinkView(link.ID, now)
+	if err != nil {
+		return domain.PublicNoteResponse{}, err
+	}
+	if !counted {
+		return domain.PublicNoteResponse{}, fmt.Errorf("%w: this link has expired", ErrGone)
+	}
+
+	return domain.PublicNoteResponse{
+		Title:     note.Title,
+		Body:      note.Content,
+		Format:    note.Format,
+		UpdatedAt: note.UpdatedAt,
+	}, nil
+}
+
+// publicLinkResponse converts a public link to its API representation,
+// without the token
+func publicLinkResponse(link *models.PublicLink) domain.PublicLinkResponse {
+	return domain.PublicLinkResponse{
+		ID:             link.ID,
+		HasPassword:    link.PasswordHash != "",
+		ExpiresAt:      link.ExpiresAt,
+		MaxViews:       link.MaxViews,
+		ViewCount:      link.ViewCount,
+		LastAccessedAt: link.LastAccessedAt,
+		CreatedAt:      link.CreatedAt,
+	}
+}
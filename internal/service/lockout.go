@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// LoginBlockedError is returned when a login is refused because of earlier
+// failures, either during the backoff delay or while the key is locked out
+type LoginBlockedError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginBlockedError) Error() string {
+	// round up so that we never tell the client to retry in 0s
+	retryAfter := (e.RetryAfter + time.Second - 1).Truncate(time.Second)
+	if e.Locked {
+		return fmt.Sprintf("too many failed logins, locked for %s", retryAfter)
+	}
+	return fmt.Sprintf("too many failed logins, retry in %s", retryAfter)
+}
+
+func userLockoutKey(username string) string {
+	return "user:" + username
+}
+
+func ipLockoutKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginKeys returns the lockout keys a login attempt is counted against
+func loginKeys(ctx context.Context, username string) []string {
+	keys := []string{userLockoutKey(username)}
+	if ip, _ := ctx.Value("client_ip").(string); ip != "" {
+		keys = append(keys, ipLockoutKey(ip))
+	}
+	return keys
+}
+
+// checkLoginAllowed refuses the attempt while any of its keys is locked or
+// still inside its backoff delay
+func (s *service) checkLoginAllowed(keys []string, now time.Time) error {
+	for _, key := range keys {
+		attempt, err := s.lockouts.GetLoginAttempt(key)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			return err
+		}
+
+		if attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil) {
+			return &LoginBlockedError{RetryAfter: attempt.LockedUntil.Sub(now), Locked: true}
+		}
+		if now.Sub(attempt.LastFailureAt) > s.cfg.Auth.Lockout.Window {
+			continue
+		}
+		if wait := attempt.LastFailureAt.Add(s.backoff(attempt.Failures)).Sub(now); wait > 0 {
+			return &LoginBlockedError{RetryAfter: wait}
+		}
+	}
+	return nil
+}
+
+// backoff is the delay enforced after the given number of consecutive
+// failures, doubling with each failure
+func (s *service) backoff(failures int) time.Duration {
+	lockout := s.cfg.Auth.Lockout
+	if failures < 1 || lockout.BackoffBase == 0 {
+		return 0
+	}
+	delay := lockout.BackoffBase
+	for i := 1; i < failures && delay < lockout.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > lockout.BackoffMax {
+		delay = lockout.BackoffMax
+	}
+	return delay
+}
+
+// recordLoginFailure counts the failure against every key and locks the
+// keys that reached their limit
+func (s *service) recordLoginFailure(ctx context.Context, keys []string, now time.Time) {
+	lockout := s.cfg.Auth.Lockout
+	for _, key := range keys {
+		attempt, err := s.lockouts.RecordLoginFailure(key, now, lockout.Window)
+		if err != nil {
+			logrus.Errorf("error recording login failure\nError: %s", err.Error())
+			continue
+		}
+
+		limit, eventType := lockout.MaxFailures, models.AuditAccountLocked
+		if strings.HasPrefix(key, "ip:") {
+			limit, eventType = lockout.MaxFailuresPerIP, models.AuditIPLocked
+		}
+		if attempt.Failures < limit || (attempt.LockedUntil != nil && now.Before(*attempt.LockedUntil)) {
+			continue
+		}
+
+		until := now.Add(lockout.Duration)
+		if err := s.lockouts.LockLoginKey(key, until); err != nil {
+			logrus.Errorf("error locking login key\nError: %s", err.Error())
+			continue
+		}
+		s.audit(ctx, eventType, "", strings.SplitN(key, ":", 2)[1],
+			fmt.Sprintf("%d failed logins, locked until %s", attempt.Failures, until.Format(time.RFC3339)))
+	}
+}
+
+// audit records a security event in the audit log
+func (s *service) audit(ctx context.Context, eventType, actor, subject, detail string) {
+	ip, _ := ctx.Value("client_ip").(string)
+	logrus.WithFields(logrus.Fields{
+		"event":   eventType,
+		"actor":   actor,
+		"subject": subject,
+		"ip":      ip,
+	}).Warn(detail)
+
+	err := s.store.CreateAuditEvent(&models.AuditEvent{
+		Type:    eventType,
+		Actor:   actor,
+		Subject: subject,
+		IP:      ip,
+		Detail:  detail,
+	})
+	if err != nil {
+		logrus.Errorf("error writing audit event\nError: %s", err.Error())
+	}
+}
+
+// requireAdmin returns the calling user if they are an admin
+func (s *service) requireAdmin(ctx context.Context) (*models.User, error) {
+	userID := ctx.Value("user_id").(string)
+	user, err := s.store.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrForbidden
+		}
+		return nil, err
+	}
+	if user.IsAdmin {
+		return user, nil
+	}
+	for _, admin := range s.cfg.Auth.AdminUsers {
+		if admin == user.Username {
+			return user, nil
+		}
+	}
+	return nil, ErrForbidden
+}
+
+// UnlockAccount clears the failed logins and any lockout of the username
+func (s *service) UnlockAccount(ctx context.Context, username string) error {
+	admin, err := s.requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.lockouts.ClearLoginAttempts(userLockoutKey(username)); err != nil {
+		return err
+	}
+	s.audit(ctx, models.AuditAccountUnlocked, admin.Username, username, "account unlocked by admin")
+	return nil
+}
+
+// UnlockIP clears the failed logins and any lockout of the client IP
+func (s *service) UnlockIP(ctx context.Context, ip string) error {
+	admin, err := s.requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.lockouts.ClearLoginAttempts(ipLockoutKey(ip)); err != nil {
+		return err
+	}
+	s.audit(ctx, models.AuditIPUnlocked, admin.Username, ip, "ip unlocked by admin")
+	return nil
+}
+
+// ListAuditEvents returns the most recent audit events
+func (s *service) ListAuditEvents(ctx context.Context, limit int) ([]domain.AuditEventResponse, error) {
+	if _, err := s.requireAdmin(ctx); err != nil {
+		return nil, err
+	}
+
+	events, err := s.store.ListAuditEvents(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]domain.AuditEventResponse, 0, len(events))
+	for _, event := range events {
+		responses = append(responses, domain.AuditEventResponse{
+			ID:        event.ID,
+			Type:      event.Type,
+			Actor:     event.Actor,
+			Subject:   event.Subject,
+			IP:        event.IP,
+			Detail:    event.Detail,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return responses, nil
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// newLockoutService returns a service that locks usernames after 3
+// failed logins and IPs after 5, without backoff delays between them
+func newLockoutService(t *testing.T) (*service, database.Storer) {
+	return newTestService(t, func(cfg *config.Config) {
+		cfg.Auth.AdminUsers = []string{"admin"}
+		cfg.Auth.Lockout.MaxFailures = 3
+		cfg.Auth.Lockout.MaxFailuresPerIP = 5
+		cfg.Auth.Lockout.BackoffBase = 0
+	})
+}
+
+func ipContext(ip string) context.Context {
+	return context.WithValue(context.Background(), "client_ip", ip)
+}
+
+func attemptLogin(s *service, ctx context.Context, username, password string) error {
+	_, err := s.LoginUser(ctx, domain.LoginRequest{Username: username, Password: password})
+	return err
+}
+
+func signup(t *testing.T, s *service, username string) {
+	t.Helper()
+	if err := s.CreateNewUser(context.Background(), domain.SignupRequest{Username: username, Password: "password"}); err != nil {
+		t.Fatalf("CreateNewUser: %v", err)
+	}
+}
+
+func isLocked(err error) bool {
+	var blocked *LoginBlockedError
+	return errors.As(err, &blocked) && blocked.Locked
+}
+
+// auditTypes returns the types of the audit events, oldest first
+func auditTypes(t *testing.T, store database.Storer) []string {
+	t.Helper()
+	events, err := store.ListAuditEvents(100)
+	if err != nil {
+		t.Fatalf("ListAuditEvents: %v", err)
+	}
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[len(events)-1-i] = event.Type
+	}
+	return types
+}
+
+func TestLoginBackoff(t *testing.T) {
+	s, _ := newTestService(t, func(cfg *config.Config) {
+		cfg.Auth.Lockout.BackoffBase = time.Second
+		cfg.Auth.Lockout.BackoffMax = 10 * time.Second
+	})
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := s.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff after %d failures = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+
+	keys := loginKeys(ipContext("203.0.113.9"), "alice")
+	now := time.Now()
+	s.recordLoginFailure(context.Background(), keys, now)
+	s.recordLoginFailure(context.Background(), keys, now)
+	var blocked *LoginBlockedError
+	if err := s.checkLoginAllowed(keys, now.Add(time.Second)); !errors.As(err, &blocked) || blocked.Locked || blocked.RetryAfter != time.Second {
+		t.Fatalf("1s into a 2s backoff: got %v, want a retry in 1s", err)
+	}
+	if err := s.checkLoginAllowed(keys, now.Add(2*time.Second)); err != nil {
+		t.Fatalf("after the backoff: %v", err)
+	}
+	// failures older than the window no longer count
+	if err := s.checkLoginAllowed(keys, now.Add(s.cfg.Auth.Lockout.Window+time.Second)); err != nil {
+		t.Fatalf("after the window: %v", err)
+	}
+}
+
+func TestLockoutPerUser(t *testing.T) {
+	s, store := newLockoutService(t)
+	signup(t, s, "alice")
+	signup(t, s, "bob")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if err := attemptLogin(s, ctx, "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d: got %v, want ErrInvalidCredentials", i+1, err)
+		}
+	}
+	if err := attemptLogin(s, ctx, "alice", "password"); !isLocked(err) {
+		t.Fatalf("right password on a locked account: got %v, want it locked", err)
+	}
+	if err := attemptLogin(s, ctx, "bob", "password"); err != nil {
+		t.Fatalf("another account: %v", err)
+	}
+	// unknown usernames are locked like existing ones
+	for i := 0; i < 3; i++ {
+		attemptLogin(s, ctx, "nobody", "wrong")
+	}
+	if err := attemptLogin(s, ctx, "nobody", "wrong"); !isLocked(err) {
+		t.Fatalf("unknown username: got %v, want it locked", err)
+	}
+
+	types := auditTypes(t, store)
+	if len(types) != 2 || types[0] != models.AuditAccountLocked || types[1] != models.AuditAccountLocked {
+		t.Fatalf("audit events %v, want two account lockouts", types)
+	}
+	events, _ := store.ListAuditEvents(1)
+	if events[0].Subject != "nobody" {
+		t.Errorf("lockout recorded for %q, want nobody", events[0].Subject)
+	}
+}
+
+func TestLockoutPerIP(t *testing.T) {
+	s, store := newLockoutService(t)
+	signup(t, s, "alice")
+	attacker := ipContext("203.0.113.9")
+
+	// spread over usernames, so that none of them is locked
+	for _, username := range []string{"a", "b", "c", "d", "e"} {
+		if err := attemptLogin(s, attacker, username, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure for %s: got %v", username, err)
+		}
+	}
+	if err := attemptLogin(s, attacker, "alice", "password"); !isLocked(err) {
+		t.Fatalf("login from a locked IP: got %v, want it locked", err)
+	}
+	if err := attemptLogin(s, ipContext("198.51.100.7"), "alice", "password"); err != nil {
+		t.Fatalf("login from another IP: %v", err)
+	}
+
+	events, err := store.ListAuditEvents(10)
+	if err != nil || len(events) != 1 || events[0].Type != models.AuditIPLocked || events[0].Subject != "203.0.113.9" || events[0].IP != "203.0.113.9" {
+		t.Fatalf("audit events %+v, %v, want the IP lockout", events, err)
+	}
+}
+
+func TestSuccessfulLoginResetsFailures(t *testing.T) {
+	s, _ := newLockoutService(t)
+	signup(t, s, "alice")
+	ctx := context.Background()
+
+	for round := 0; round < 3; round++ {
+		attemptLogin(s, ctx, "alice", "wrong")
+		attemptLogin(s, ctx, "alice", "wrong")
+		if err := attemptLogin(s, ctx, "alice", "password"); err != nil {
+			t.Fatalf("round %d: login after 2 failures: %v", round+1, err)
+		}
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	s, store := newLockoutService(t)
+	signup(t, s, "alice")
+	attacker := ipContext("203.0.113.9")
+	// locks alice, then the IP
+	for _, username := range []string{"alice", "alice", "alice", "x", "y"} {
+		attemptLogin(s, attacker, username, "wrong")
+	}
+
+	alice, err := store.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the configured admin, and one flagged in the store
+	admin := createUser(t, store, "admin")
+	flagged := &models.User{Username: "root", PasswordHash: "hash", IsAdmin: true}
+	if err := store.CreateNewUser(flagged); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.UnlockAccount(userContext(alice), "alice"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("unlock by a user: got %v, want ErrForbidden", err)
+	}
+	if _, err := s.ListAuditEvents(userContext(alice), 10); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("audit log read by a user: got %v, want ErrForbidden", err)
+	}
+
+	if err := s.UnlockAccount(userContext(admin), "alice"); err != nil {
+		t.Fatalf("UnlockAccount: %v", err)
+	}
+	if err := attemptLogin(s, ipContext("198.51.100.7"), "alice", "password"); err != nil {
+		t.Fatalf("login after the account was unlocked: %v", err)
+	}
+	if err := attemptLogin(s, attacker, "alice", "password"); !isLocked(err) {
+		t.Fatalf("login from the IP still locked: got %v", err)
+	}
+	if err := s.UnlockIP(userContext(flagged), "203.0.113.9"); err != nil {
+		t.Fatalf("UnlockIP: %v", err)
+	}
+	if err := attemptLogin(s, attacker, "alice", "password"); err != nil {
+		t.Fatalf("login after the IP was unlocked: %v", err)
+	}
+
+	events, err := s.ListAuditEvents(userContext(admin), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []domain.AuditEventResponse{
+		{Type: models.AuditIPUnlocked, Actor: "root", Subject: "203.0.113.9"},
+		{Type: models.AuditAccountUnlocked, Actor: "admin", Subject: "alice"},
+		{Type: models.AuditIPLocked, Subject: "203.0.113.9"},
+		{Type: models.AuditAccountLocked, Subject: "alice"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("audit events %+v, want %d", events, len(want))
+	}
+	for i, event := range events {
+		if event.Type != want[i].Type || event.Actor != want[i].Actor || event.Subject != want[i].Subject {
+			t.Errorf("audit event %d is %s by %q of %q, want %s by %q of %q", i, event.Type, event.Actor, event.Subject, want[i].Type, want[i].Actor, want[i].Subject)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// maxNotebookNameLength is the longest notebook name accepted, in
+// characters
+const maxNotebookNameLength = 100
+
+// errGroupNoteInNotebook is returned when filing a group note in a
+// notebook, which belongs to a single user
+var errGroupNoteInNotebook = fmt.Errorf("%w: group notes cannot be filed in notebooks", ErrInvalidInput)
+
+// normalizeNotebookName trims the name and checks its length
+func normalizeNotebookName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len([]rune(name)) > maxNotebookNameLength {
+		return "", fmt.Errorf("%w: notebook name must be 1 to %d characters", ErrInvalidInput, maxNotebookNameLength)
+	}
+	return name, nil
+}
+
+// notebookError converts store errors about notebooks to service errors
+func notebookError(err error) error {
+	if errors.Is(err, database.ErrNotebookCycle) {
+		return fmt.Errorf("%w: a notebook cannot be moved into itself or one of its notebooks", ErrInvalidInput)
+	}
+	return notFound(err)
+}
+
+// notebookFilter returns the IDs of the notebooks whose notes are listed:
+// the user's notebook and, when recursive, its descendants
+func (s *service) notebookFilter(userID, id string, recursive bool) ([]string, error) {
+	if _, err := s.store.GetNotebook(userID, id); err != nil {
+		return nil, notFound(err)
+	}
+	if !recursive {
+		return []string{id}, nil
+	}
+	return s.store.NotebookSubtree(userID, id)
+}
+
+// CreateNotebook creates a notebook, nested in another of the user's
+// notebooks when a parent is given
+func (s *service) CreateNotebook(ctx context.Context, notebookReq domain.NotebookRequest) (domain.NotebookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	name, err := normalizeNotebookName(notebookReq.Name)
+	if err != nil {
+		return domain.NotebookResponse{}, err
+	}
+	notebook := &models.Notebook{UserID: userID, Name: name}
+	if notebookReq.ParentID != "" {
+		if _, err := s.store.GetNotebook(userID, notebookReq.ParentID); err != nil {
+			return domain.NotebookResponse{}, notFound(err)
+		}
+		notebook.ParentID = &notebookReq.ParentID
+	}
+
+	if err := s.store.CreateNotebook(notebook); err != nil {
+		return domain.NotebookResponse{}, err
+	}
+	return notebookResponse(notebook), nil
+}
+
+// ListNotebooks returns the user's notebooks as a tree, top level
+// notebooks first, with their note counts
+func (s *service) ListNotebooks(ctx context.Context) ([]domain.NotebookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	notebooks, err := s.store.ListNotebooks(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[string][]*database.NotebookCount, len(notebooks))
+	var roots []*database.NotebookCount
+	for _, nb := range notebooks {
+		if nb.ParentID == nil {
+			roots = append(roots, nb)
+		} else {
+			children[*nb.ParentID] = append(children[*nb.ParentID], nb)
+		}
+	}
+
+	// build turns a notebook and its descendants, already sorted by name,
+	// into a response, summing up the note counts
+	var build func(nb *database.NotebookCount) domain.NotebookResponse
+	build = func(nb *database.NotebookCount) domain.NotebookResponse {
+		response := notebookResponse(&nb.Notebook)
+		response.NoteCount = nb.NoteCount
+		response.TotalCount = nb.NoteCount
+		for _, child := range children[nb.ID] {
+			childResponse := build(child)
+			response.TotalCount += childResponse.TotalCount
+			response.Children = append(response.Children, childResponse)
+		}
+		return response
+	}
+
+	tree := make([]domain.NotebookResponse, 0, len(roots))
+	for _, root := range roots {
+		tree = append(tree, build(root))
+	}
+	return tree, nil
+}
+
+// RenameNotebook renames one of the user's notebooks
+func (s *service) RenameNotebook(ctx context.Context, id string, renameReq domain.RenameNotebookRequest) (domain.NotebookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	name, err := normalizeNotebookName(renameReq.Name)
+	if err != nil {
+		return domain.NotebookResponse{}, err
+	}
+	notebook, err := s.store.RenameNotebook(userID, id, name)
+	if err != nil {
+		return domain.NotebookResponse{}, notebookError(err)
+	}
+	return notebookResponse(notebook), nil
+}
+
+// MoveNotebook moves one of the user's notebooks under another or to the
+// top level
+func (s *service) MoveNotebook(ctx context.Context, id string, moveReq domain.MoveNotebookRequest) (domain.NotebookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	notebook, err := s.store.MoveNotebook(userID, id, moveReq.ParentID)
+	if err != nil {
+		return domain.NotebookResponse{}, notebookError(err)
+	}
+	return notebookResponse(notebook), nil
+}
+
+// DeleteNotebook deletes one of the user's notebooks and the notebooks in
+// it, moving their notes to the trash
+func (s *service) DeleteNotebook(ctx context.Context, id string) (domain.DeleteNotebookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	trashed, err := s.store.DeleteNotebook(userID, id)
+	if err != nil {
+		return domain.DeleteNotebookResponse{}, notebookError(err)
+	}
+	return domain.DeleteNotebookResponse{TrashedNotes: trashed}, nil
+}
+
+// MoveNote files one of the user's notes in one of their notebooks, or
+// takes it out of its notebook
+func (s *service) MoveNote(ctx context.Context, noteID string, moveReq domain.MoveNoteRequest) (domain.NoteResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	note, role, err := s.authorizeNote(userID, noteID, roleOwner)
+	if err != nil {
+		return domain.NoteResponse{}, err
+	}
+	if note.GroupID != nil {
+		return domain.NoteResponse{}, errGroupNoteInNotebook
+	}
+	if moveReq.NotebookID != nil {
+		if _, err := s.store.GetNotebook(userID, *moveReq.NotebookID); err != nil {
+			return domain.NoteResponse{}, notFound(err)
+		}
+	}
+
+	note, err = s.store.MoveNote(noteID, moveReq.NotebookID)
+	if err != nil {
+		return domain.NoteResponse{}, notFound(err)
+	}
+	response := noteResponse(note)
+	response.Role = role
+	return response, nil
+}
+
+// notebookResponse converts a notebook to its API representation, without
+// counts or children
+func notebookResponse(notebook *models.Notebook) domain.NotebookResponse {
+	return domain.NotebookResponse{
+		ID:        notebook.ID,
+		Name:      notebook.Name,
+		ParentID:  notebook.ParentID,
+		CreatedAt: notebook.CreatedAt,
+		UpdatedAt: notebook.UpdatedAt,
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+var errTagging = errors.New("tagging failed")
+
+// tagFailingStore is a store, along with its transactions, on which
+// tagging notes fails
+type tagFailingStore struct {
+	database.Storer
+}
+
+func (s tagFailingStore) Transaction(fn func(tx database.Storer) error) error {
+	return s.Storer.Transaction(func(tx database.Storer) error {
+		return fn(tagFailingStore{tx})
+	})
+}
+
+func (s tagFailingStore) SetNoteTags(userID, noteID string, names []string) ([]models.Tag, error) {
+	return nil, errTagging
+}
+
+func TestCreateNoteWithTags(t *testing.T) {
+	s, store := newTestService(t, nil)
+	user := createUser(t, store, "alice")
+
+	note, err := s.CreateNote(userContext(user), domain.NoteRequest{Title: "Groceries", Tags: []string{"Home", "todo"}})
+	if err != nil {
+		t.Fatalf("CreateNote: %v", err)
+	}
+	if len(note.Tags) != 2 {
+		t.Fatalf("note created with tags %v, want 2", note.Tags)
+	}
+	stored, err := store.GetNoteByID(user.ID, note.ID)
+	if err != nil || len(stored.Tags) != 2 {
+		t.Fatalf("stored note %+v, %v, want it with 2 tags", stored, err)
+	}
+}
+
+func TestCreateNoteRollsBackWhenTaggingFails(t *testing.T) {
+	s, store := newTestService(t, nil)
+	user := createUser(t, store, "alice")
+	s.store = tagFailingStore{store}
+	sub := s.bus.Subscribe(user.ID, nil)
+	defer sub.Close()
+
+	if _, err := s.CreateNote(userContext(user), domain.NoteRequest{Title: "Groceries", Tags: []string{"home"}}); !errors.Is(err, errTagging) {
+		t.Fatalf("CreateNote: got %v, want the tagging error", err)
+	}
+	page, err := store.ListNotes(database.NoteQuery{UserID: user.ID, Limit: 10})
+	if err != nil || len(page.Notes) != 0 {
+		t.Fatalf("notes after a failed create: %d, %v, want none", len(page.Notes), err)
+	}
+	select {
+	case event := <-sub.Events():
+		t.Fatalf("event %s published for a failed create", event.Type)
+	default:
+	}
+}
+
+func TestUpdateNoteRollsBackWhenTaggingFails(t *testing.T) {
+	s, store := newTestService(t, nil)
+	user := createUser(t, store, "alice")
+	note := createNote(t, store, user, nil)
+	s.store = tagFailingStore{store}
+
+	_, err := s.UpdateNoteByID(userContext(user), note.ID, note.Version, domain.NoteRequest{Title: "Changed", Body: "changed", Tags: []string{"home"}})
+	if !errors.Is(err, errTagging) {
+		t.Fatalf("UpdateNoteByID: got %v, want the tagging error", err)
+	}
+	stored, err := store.GetNote(note.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != note.Title || stored.Version != note.Version {
+		t.Errorf("note changed to %q, version %d, by a failed update", stored.Title, stored.Version)
+	}
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/search"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// cursorToken is the JSON payload of an opaque page cursor. The sort and
+// order are included so a cursor cannot be replayed against a different
+// ordering.
+type cursorToken struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(c *database.Cursor, query database.NoteQuery) string {
+	data, _ := json.Marshal(cursorToken{Sort: query.Sort, Order: query.Order, Value: c.Value, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string, query database.NoteQuery) (*database.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	var token cursorToken
+	if err := json.Unmarshal(data, &token); err != nil || token.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	if token.Sort != query.Sort || token.Order != query.Order {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidInput)
+	}
+	return &database.Cursor{Value: token.Value, ID: token.ID}, nil
+}
+
+// noteQuery validates the list request and converts it to a store query
+func (s *service) noteQuery(userID string, listReq domain.ListNotesRequest) (database.NoteQuery, error) {
+	query := database.NoteQuery{
+		UserID:        userID,
+		Scope:         listReq.Scope,
+		GroupID:       listReq.GroupID,
+		Sort:          listReq.Sort,
+		Order:         listReq.Order,
+		Limit:         listReq.Limit,
+		CreatedAfter:  listReq.CreatedAfter,
+		CreatedBefore: listReq.CreatedBefore,
+		UpdatedAfter:  listReq.UpdatedAfter,
+		UpdatedBefore: listReq.UpdatedBefore,
+		TagMode:       listReq.TagMode,
+		WithTotal:     listReq.IncludeTotal,
+	}
+
+	if query.GroupID != "" {
+		if _, err := s.groupRole(userID, query.GroupID, models.GroupRoleMember); err != nil {
+			return query, err
+		}
+	}
+
+	if listReq.NotebookID != "" {
+		ids, err := s.notebookFilter(userID, listReq.NotebookID, listReq.Recursive)
+		if err != nil {
+			return query, err
+		}
+		query.NotebookIDs = ids
+	}
+
+	tags, err := normalizeTags(listReq.Tags)
+	if err != nil {
+		return query, err
+	}
+	query.Tags = tags
+
+	switch query.TagMode {
+	case "":
+		query.TagMode = database.TagModeAll
+	case database.TagModeAll, database.TagModeAny:
+	default:
+		return query, fmt.Errorf("%w: tag_mode must be and or or", ErrInvalidInput)
+	}
+
+	switch query.Scope {
+	case "":
+		query.Scope = database.ScopeAll
+	case database.ScopeAll, database.ScopeOwned, database.ScopeShared, database.ScopeGroups:
+	default:
+		return query, fmt.Errorf("%w: scope must be all, owned, shared or groups", ErrInvalidInput)
+	}
+
+	switch query.Sort {
+	case "":
+		query.Sort = database.SortUpdatedAt
+	case database.SortCreatedAt, database.SortUpdatedAt, database.SortTitle:
+	case database.SortRelevance:
+		if listReq.Query == "" {
+			return query, fmt.Errorf("%w: sort by relevance needs a search query", ErrInvalidInput)
+		}
+	default:
+		return query, fmt.Errorf("%w: sort must be created_at, updated_at, title or, when searching, relevance", ErrInvalidInput)
+	}
+
+	switch query.Order {
+	case "":
+		// newest or best first, but alphabetical for titles
+		query.Order = database.OrderDesc
+		if query.Sort == database.SortTitle {
+			query.Order = database.OrderAsc
+		}
+	case database.OrderAsc, database.OrderDesc:
+	default:
+		return query, fmt.Errorf("%w: order must be asc or desc", ErrInvalidInput)
+	}
+
+	switch {
+	case query.Limit == 0:
+		query.Limit = defaultPageSize
+	case query.Limit < 0 || query.Limit > maxPageSize:
+		return query, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidInput, maxPageSize)
+	}
+
+	if listReq.Cursor != "" {
+		after, err := decodeCursor(listReq.Cursor, query)
+		if err != nil {
+			return query, err
+		}
+		query.After = after
+	}
+
+	return query, nil
+}
+
+// notePageResponse converts a page of notes to its API representation
+func notePageResponse(page *database.NotePage, query database.NoteQuery) domain.NotePageResponse {
+	response := domain.NotePageResponse{
+		Notes: make([]domain.NoteResponse, 0, len(page.Notes)),
+		Total: page.Total,
+	}
+	for i, note := range page.Notes {
+		noteResp := noteResponse(note)
+		if page.Hits != nil {
+			hit := page.Hits[i]
+			noteResp.Score = &hit.Rank
+			noteResp.TitleHighlight = search.RenderHighlight(hit.TitleHighlight)
+			noteResp.Snippet = search.RenderHighlight(hit.Snippet)
+		}
+		response.Notes = append(response.Notes, noteResp)
+	}
+	if page.Next != nil {
+		response.NextCursor = encodeCursor(page.Next, query)
+	}
+	return response
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/GauravMakhijani/notes/internal/render"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// renderHTML is the render option asking for the HTML of a note
+const renderHTML = "html"
+
+// validNoteFormat checks that format is a known note format
+func validNoteFormat(format string) (string, error) {
+	switch format {
+	case models.NoteFormatPlain, models.NoteFormatMarkdown:
+		return format, nil
+	default:
+		return "", fmt.Errorf("%w: format must be %s or %s", ErrInvalidInput, models.NoteFormatPlain, models.NoteFormatMarkdown)
+	}
+}
+
+// renderNote renders the body of the note according to its format. Notes
+// written before formats existed are plain text.
+func renderNote(note *models.Note) (*render.Document, error) {
+	if note.Format == models.NoteFormatMarkdown {
+		return render.Markdown(note.Content)
+	}
+	return render.Plain(note.Content), nil
+}
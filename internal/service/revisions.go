@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/diff"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// notFound converts a missing record to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// revisionResponse converts a revision to its API representation. The
+// body is left out of listings.
+func revisionResponse(revision *models.NoteRevision, withBody bool) domain.RevisionResponse {
+	response := domain.RevisionResponse{
+		Number:       revision.Number,
+		AuthorID:     revision.AuthorID,
+		Title:        revision.Title,
+		RestoredFrom: revision.RestoredFrom,
+		CreatedAt:    revision.CreatedAt,
+	}
+	if withBody {
+		response.Body = &revision.Content
+	}
+	return response
+}
+
+// ListNoteRevisions lists the revisions of a note the user may read,
+// newest first
+func (s *service) ListNoteRevisions(ctx context.Context, noteID string) ([]domain.RevisionResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, models.RoleViewer); err != nil {
+		return nil, err
+	}
+	revisions, err := s.store.ListNoteRevisions(noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := make([]domain.RevisionResponse, 0, len(revisions))
+	for _, revision := range revisions {
+		response = append(response, revisionResponse(revision, false))
+	}
+	return response, nil
+}
+
+// GetNoteRevision fetches a revision of a note the user may read
+func (s *service) GetNoteRevision(ctx context.Context, noteID string, number int) (domain.RevisionResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, models.RoleViewer); err != nil {
+		return domain.RevisionResponse{}, err
+	}
+	revision, err := s.store.GetNoteRevision(noteID, number)
+	if err != nil {
+		return domain.RevisionResponse{}, notFound(err)
+	}
+	return revisionResponse(revision, true), nil
+}
+
+// DiffNoteRevisions compares two revisions of a note the user may read. A
+// zero to is the latest revision and a zero from the one before to.
+func (s *service) DiffNoteRevisions(ctx context.Context, noteID string, from, to int) (domain.RevisionDiffResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, models.RoleViewer); err != nil {
+		return domain.RevisionDiffResponse{}, err
+	}
+	if to == 0 {
+		revisions, err := s.store.ListNoteRevisions(noteID)
+		if err != nil {
+			return domain.RevisionDiffResponse{}, err
+		}
+		if len(revisions) == 0 {
+			return domain.RevisionDiffResponse{}, ErrNotFound
+		}
+		to = revisions[0].Number
+	}
+	if from == 0 {
+		from = to - 1
+	}
+	if from < 1 || to < 1 {
+		return domain.RevisionDiffResponse{}, fmt.Errorf("%w: revisions are numbered from 1", ErrInvalidInput)
+	}
+
+	fromRevision, err := s.store.GetNoteRevision(noteID, from)
+	if err != nil {
+		return domain.RevisionDiffResponse{}, notFound(err)
+	}
+	toRevision, err := s.store.GetNoteRevision(noteID, to)
+	if err != nil {
+		return domain.RevisionDiffResponse{}, notFound(err)
+	}
+
+	lines := diff.Lines(fromRevision.Content, toRevision.Content)
+	if lines == nil {
+		lines = []diff.Line{}
+	}
+	return domain.RevisionDiffResponse{
+		From:      from,
+		To:        to,
+		TitleFrom: fromRevision.Title,
+		TitleTo:   toRevision.Title,
+		Diff:      diff.Unified(fmt.Sprintf("revision %d", from), fmt.Sprintf("revision %d", to), lines, diffContext),
+		Lines:     lines,
+	}, nil
+}
+
+// RestoreNoteRevision brings back the title and content of an earlier
+// revision of a note the user may edit as a new revision
+func (s *service) RestoreNoteRevision(ctx context.Context, noteID string, number int) (domain.NoteResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	_, role, err := s.authorizeNote(userID, noteID, models.RoleEditor)
+	if err != nil {
+		return domain.NoteResponse{}, err
+	}
+
+	note, err := s.store.RestoreNoteRevision(userID, noteID, number)
+	if err != nil {
+		return domain.NoteResponse{}, notFound(err)
+	}
+	s.pruneRevisions(noteID)
+	s.publishNoteEvent(events.NoteUpdated, userID, note, nil)
+
+	response := noteResponse(note)
+	response.Role = role
+	return response, nil
+}
+
+// PruneRevisions applies the revision retention limits to all notes
+func (s *service) PruneRevisions(ctx context.Context) (int64, error) {
+	return s.store.PruneNoteRevisions("", s.cfg.Revisions.MaxCount, s.revisionCutoff())
+}
+
+// pruneRevisions applies the revision retention limits to a note after it
+// changed. Failures are only logged since the change itself succeeded.
+func (s *service) pruneRevisions(noteID string) {
+	if _, err := s.store.PruneNoteRevisions(noteID, s.cfg.Revisions.MaxCount, s.revisionCutoff()); err != nil {
+		logrus.Errorf("error pruning note revisions\nError: %s", err.Error())
+	}
+}
+
+// revisionCutoff is the creation time before which revisions are pruned,
+// zero when they are kept regardless of age
+func (s *service) revisionCutoff() time.Time {
+	if s.cfg.Revisions.MaxAge == 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(-s.cfg.Revisions.MaxAge)
+}
@@ -2,39 +2,177 @@ package service
 
 import (
 	"context"
-
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/collab"
+	"github.com/GauravMakhijani/notes/internal/config"
 	"github.com/GauravMakhijani/notes/internal/database"
 	"github.com/GauravMakhijani/notes/internal/domain"
-	"github.com/GauravMakhijani/notes/internal/jwt"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/internal/search"
+	"github.com/GauravMakhijani/notes/internal/storage"
+	"github.com/GauravMakhijani/notes/internal/webhook"
 	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type Service interface {
 	// User related methods
 	CreateNewUser(ctx context.Context, signupReq domain.SignupRequest) error
 	LoginUser(ctx context.Context, loginReq domain.LoginRequest) (domain.LoginResponse, error)
+	RefreshToken(ctx context.Context, refreshReq domain.RefreshRequest) (domain.LoginResponse, error)
+	Logout(ctx context.Context, logoutReq domain.LogoutRequest) error
+	IssueTicket(ctx context.Context) (domain.TicketResponse, error)
+	IsTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+
+	// Admin related methods
+	UnlockAccount(ctx context.Context, username string) error
+	UnlockIP(ctx context.Context, ip string) error
+	ListAuditEvents(ctx context.Context, limit int) ([]domain.AuditEventResponse, error)
 
 	// Note related methods
 	CreateNote(ctx context.Context, noteReq domain.NoteRequest) (domain.NoteResponse, error)
-	GetNoteByID(ctx context.Context, id string) (domain.NoteResponse, error)
-	ListNotes(ctx context.Context) ([]domain.NoteResponse, error)
+	GetNoteByID(ctx context.Context, id string, render string) (domain.NoteResponse, error)
+	ListNotes(ctx context.Context, listReq domain.ListNotesRequest) (domain.NotePageResponse, error)
 	DeleteNoteByID(ctx context.Context, id string) error
-	UpdateNoteByID(ctx context.Context, id string, noteReq domain.NoteRequest) (domain.NoteResponse, error)
+	UpdateNoteByID(ctx context.Context, id string, version int, noteReq domain.NoteRequest) (domain.NoteResponse, error)
+	BatchNotes(ctx context.Context, batchReq domain.BatchRequest) (domain.BatchResponse, error)
+
+	// Event related methods
+	SubscribeEvents(ctx context.Context, after *uint64) *events.Subscription
+
+	// Live editing related methods
+	JoinCollab(ctx context.Context, noteID string) (*collab.Client, error)
+
+	// Trash related methods
+	ListTrash(ctx context.Context, listReq domain.ListNotesRequest) (domain.NotePageResponse, error)
+	RestoreNote(ctx context.Context, id string) (domain.NoteResponse, error)
+	PurgeNote(ctx context.Context, id string) error
+	PurgeTrash(ctx context.Context) (int64, error)
 
 	// Share related methods
 	ShareNoteWithUser(ctx context.Context, noteID string, shareReq domain.SharedNoteRequest) error
-	SearchNotes(ctx context.Context, query string) ([]domain.NoteResponse, error)
+	ListNoteShares(ctx context.Context, noteID string) ([]domain.ShareResponse, error)
+	RevokeNoteShare(ctx context.Context, noteID, username string) error
+	ListIncomingShares(ctx context.Context) ([]domain.ShareResponse, error)
+	ListOutgoingShares(ctx context.Context) ([]domain.ShareResponse, error)
+
+	// Notebook related methods
+	CreateNotebook(ctx context.Context, notebookReq domain.NotebookRequest) (domain.NotebookResponse, error)
+	ListNotebooks(ctx context.Context) ([]domain.NotebookResponse, error)
+	RenameNotebook(ctx context.Context, id string, renameReq domain.RenameNotebookRequest) (domain.NotebookResponse, error)
+	MoveNotebook(ctx context.Context, id string, moveReq domain.MoveNotebookRequest) (domain.NotebookResponse, error)
+	DeleteNotebook(ctx context.Context, id string) (domain.DeleteNotebookResponse, error)
+	MoveNote(ctx context.Context, noteID string, moveReq domain.MoveNoteRequest) (domain.NoteResponse, error)
+
+	// Attachment related methods
+	UploadAttachment(ctx context.Context, noteID string, upload domain.AttachmentUpload) (domain.AttachmentResponse, error)
+	ListAttachments(ctx context.Context, noteID string) ([]domain.AttachmentResponse, error)
+	OpenAttachment(ctx context.Context, noteID, id string) (domain.AttachmentResponse, io.ReadCloser, error)
+	DeleteAttachment(ctx context.Context, noteID, id string) error
+	GetAttachmentUsage(ctx context.Context) (domain.AttachmentUsageResponse, error)
+	RemovePurgedAttachments(ctx context.Context) (int, error)
+
+	// Export related methods
+	ExportNotes(ctx context.Context, format string) (domain.Export, error)
+
+	// Import related methods
+	StartImport(ctx context.Context, importReq domain.ImportRequest) (domain.ImportJobResponse, error)
+	GetImportJob(ctx context.Context, id string) (domain.ImportJobResponse, error)
+	ListImportJobs(ctx context.Context) ([]domain.ImportJobResponse, error)
+	RecoverImportJobs(ctx context.Context) (int64, error)
+
+	// Webhook related methods
+	CreateWebhook(ctx context.Context, webhookReq domain.WebhookRequest) (domain.WebhookResponse, error)
+	ListWebhooks(ctx context.Context) ([]domain.WebhookResponse, error)
+	GetWebhook(ctx context.Context, id string) (domain.WebhookResponse, error)
+	UpdateWebhook(ctx context.Context, id string, updateReq domain.WebhookUpdateRequest) (domain.WebhookResponse, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	ListWebhookDeliveries(ctx context.Context, id string, limit int) ([]domain.WebhookDeliveryResponse, error)
+	DeliverWebhooks(ctx context.Context) (int, error)
+
+	// Group related methods
+	CreateGroup(ctx context.Context, groupReq domain.GroupRequest) (domain.GroupResponse, error)
+	ListGroups(ctx context.Context) ([]domain.GroupResponse, error)
+	GetGroup(ctx context.Context, groupID string) (domain.GroupResponse, error)
+	AddGroupMember(ctx context.Context, groupID string, memberReq domain.GroupMemberRequest) (domain.GroupResponse, error)
+	UpdateGroupMember(ctx context.Context, groupID, username string, memberReq domain.GroupMemberRequest) (domain.GroupResponse, error)
+	RemoveGroupMember(ctx context.Context, groupID, username string) error
+
+	// Public link related methods
+	CreatePublicLink(ctx context.Context, noteID string, linkReq domain.PublicLinkRequest) (domain.PublicLinkResponse, error)
+	ListPublicLinks(ctx context.Context, noteID string) ([]domain.PublicLinkResponse, error)
+	RevokePublicLink(ctx context.Context, noteID, linkID string) error
+	OpenPublicLink(ctx context.Context, token, password string) (domain.PublicNoteResponse, error)
+	SearchNotes(ctx context.Context, listReq domain.ListNotesRequest) (domain.NotePageResponse, error)
+
+	// Tag related methods
+	AddNoteTags(ctx context.Context, noteID string, tagsReq domain.NoteTagsRequest) (domain.NoteTagsResponse, error)
+	RemoveNoteTag(ctx context.Context, noteID, name string) (domain.NoteTagsResponse, error)
+	ListTags(ctx context.Context) ([]domain.TagResponse, error)
+	RenameTag(ctx context.Context, name string, renameReq domain.RenameTagRequest) (domain.TagResponse, error)
+	MergeTags(ctx context.Context, mergeReq domain.MergeTagsRequest) (domain.TagResponse, error)
+	DeleteTag(ctx context.Context, name string) error
+
+	// Revision related methods
+	ListNoteRevisions(ctx context.Context, noteID string) ([]domain.RevisionResponse, error)
+	GetNoteRevision(ctx context.Context, noteID string, number int) (domain.RevisionResponse, error)
+	DiffNoteRevisions(ctx context.Context, noteID string, from, to int) (domain.RevisionDiffResponse, error)
+	RestoreNoteRevision(ctx context.Context, noteID string, number int) (domain.NoteResponse, error)
+	PruneRevisions(ctx context.Context) (int64, error)
 }
 
 type service struct {
-	store database.Storer
+	store    database.Storer
+	lockouts database.LockoutStore
+	blobs    storage.BlobStore
+	cfg      *config.Config
+	// imports holds a slot for each import running
+	imports chan struct{}
+	// bus delivers note events to subscribers. They are published through
+	// events, which holds them back within transactions.
+	bus    *events.Bus
+	events events.Publisher
+	// collab holds the live editing sessions
+	collab *collab.Hub
+	// webhooks sends webhook deliveries
+	webhooks   *webhook.Sender
+	delivering *busyWebhooks
 }
 
-func NewService(store database.Storer) Service {
-	return &service{store: store}
+func NewService(store database.Storer, blobs storage.BlobStore, bus *events.Bus, cfg *config.Config) Service {
+	var lockouts database.LockoutStore = store
+	if cfg.Auth.Lockout.Store == "memory" {
+		lockouts = database.NewMemoryLockoutStore()
+	}
+	s := &service{
+		store:      store,
+		lockouts:   lockouts,
+		blobs:      blobs,
+		cfg:        cfg,
+		imports:    make(chan struct{}, cfg.Import.Workers),
+		bus:        bus,
+		events:     bus,
+		collab:     collab.NewHub(cfg.Collab.SaveInterval),
+		webhooks:   webhook.NewSender(cfg.Webhooks.Timeout, cfg.Webhooks.Networks()),
+		delivering: &busyWebhooks{ids: make(map[string]bool)},
+	}
+	// webhooks are queued once events are published, and so only for
+	// changes that were committed
+	bus.OnPublish(s.enqueueWebhooks)
+	return s
 }
 
+// dummyPasswordHash is compared against when the username does not exist so
+// that failed logins take the same time whether or not the user exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
 func (s *service) CreateNewUser(ctx context.Context, signupReq domain.SignupRequest) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(signupReq.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -50,23 +188,32 @@ func (s *service) CreateNewUser(ctx context.Context, signupReq domain.SignupRequ
 }
 
 func (s *service) LoginUser(ctx context.Context, loginReq domain.LoginRequest) (domain.LoginResponse, error) {
-	user, err := s.store.GetUserByUsername(loginReq.Username)
-	if err != nil {
+	now := time.Now()
+	keys := loginKeys(ctx, loginReq.Username)
+	if err := s.checkLoginAllowed(keys, now); err != nil {
 		return domain.LoginResponse{}, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginReq.Password))
-	if err != nil {
+	passwordHash := dummyPasswordHash
+	user, err := s.store.GetUserByUsername(loginReq.Username)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return domain.LoginResponse{}, err
 	}
+	if user != nil {
+		passwordHash = []byte(user.PasswordHash)
+	}
 
-	// Generate JWT token
-	accessToken, err := jwt.GenerateToken(user.ID, user.Username)
+	err = bcrypt.CompareHashAndPassword(passwordHash, []byte(loginReq.Password))
+	if err != nil || user == nil {
+		s.recordLoginFailure(ctx, keys, now)
+		return domain.LoginResponse{}, ErrInvalidCredentials
+	}
 
-	return domain.LoginResponse{
-		Username:    user.Username,
-		AccessToken: accessToken,
-	}, nil
+	if err := s.lockouts.ClearLoginAttempts(userLockoutKey(user.Username)); err != nil {
+		logrus.Errorf("error clearing login attempts\nError: %s", err.Error())
+	}
+
+	return s.issueTokens(user, models.NewID())
 }
 
 // Note related methods
@@ -74,114 +221,269 @@ func (s *service) CreateNote(ctx context.Context, noteReq domain.NoteRequest) (d
 
 	userId := ctx.Value("user_id").(string)
 
+	tags, err := normalizeTags(noteReq.Tags)
+	if err != nil {
+		return domain.NoteResponse{}, err
+	}
+	format := models.NoteFormatPlain
+	if noteReq.Format != "" {
+		if format, err = validNoteFormat(noteReq.Format); err != nil {
+			return domain.NoteResponse{}, err
+		}
+	}
+
 	note := &models.Note{
 		Title:   noteReq.Title,
 		Content: noteReq.Body,
+		Format:  format,
 		UserID:  userId,
 	}
+	if noteReq.GroupID != "" {
+		// any member may write notes for the group
+		if _, err := s.groupRole(userId, noteReq.GroupID, models.GroupRoleMember); err != nil {
+			return domain.NoteResponse{}, err
+		}
+		note.GroupID = &noteReq.GroupID
+	}
+	if noteReq.NotebookID != "" {
+		if note.GroupID != nil {
+			return domain.NoteResponse{}, errGroupNoteInNotebook
+		}
+		if _, err := s.store.GetNotebook(userId, noteReq.NotebookID); err != nil {
+			return domain.NoteResponse{}, notFound(err)
+		}
+		note.NotebookID = &noteReq.NotebookID
+	}
 
-	note, err := s.store.CreateNewNote(note)
+	// the note is only created along with its tags
+	err = s.store.Transaction(func(tx database.Storer) error {
+		created, err := tx.CreateNewNote(note)
+		if err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if created.Tags, err = tx.SetNoteTags(userId, created.ID, tags); err != nil {
+				return err
+			}
+		}
+		note = created
+		return nil
+	})
 	if err != nil {
 		return domain.NoteResponse{}, err
 	}
-	return domain.NoteResponse{
-		ID:        note.ID,
-		Title:     note.Title,
-		Body:      note.Content,
-		CreatedBy: note.UserID,
-	}, nil
+	s.publishNoteEvent(events.NoteCreated, userId, note, nil)
+	return noteResponse(note), nil
 
 }
 
-func (s *service) GetNoteByID(ctx context.Context, id string) (domain.NoteResponse, error) {
+// GetNoteByID returns the note with metadata derived from its body, and
+// its HTML rendering when render is "html"
+func (s *service) GetNoteByID(ctx context.Context, id string, render string) (domain.NoteResponse, error) {
 
 	userId := ctx.Value("user_id").(string)
 
-	note, err := s.store.GetNoteByID(userId, id)
+	if render != "" && render != renderHTML {
+		return domain.NoteResponse{}, fmt.Errorf("%w: render must be %q", ErrInvalidInput, renderHTML)
+	}
+
+	note, role, err := s.authorizeNote(userId, id, models.RoleViewer)
 	if err != nil {
 		return domain.NoteResponse{}, err
 	}
 
-	return domain.NoteResponse{
-		ID:        note.ID,
-		Title:     note.Title,
-		Body:      note.Content,
-		CreatedBy: note.UserID,
-	}, nil
+	doc, err := renderNote(note)
+	if err != nil {
+		return domain.NoteResponse{}, err
+	}
+
+	response := noteResponse(note)
+	response.Role = role
+	response.Metadata = &domain.NoteMetadata{
+		WordCount: doc.WordCount,
+		TOC:       doc.Headings,
+		Links:     doc.Links,
+	}
+	if render == renderHTML {
+		response.HTML = doc.HTML
+	}
+	return response, nil
 }
 
-func (s *service) ListNotes(ctx context.Context) ([]domain.NoteResponse, error) {
+func (s *service) ListNotes(ctx context.Context, listReq domain.ListNotesRequest) (domain.NotePageResponse, error) {
 
 	userId := ctx.Value("user_id").(string)
 
-	notes, err := s.store.ListNotes(userId)
+	query, err := s.noteQuery(userId, listReq)
 	if err != nil {
-		return []domain.NoteResponse{}, err
+		return domain.NotePageResponse{}, err
 	}
 
-	noteResponses := make([]domain.NoteResponse, 0)
-	for _, note := range notes {
-		noteResponses = append(noteResponses, domain.NoteResponse{
-			ID:        note.ID,
-			Title:     note.Title,
-			Body:      note.Content,
-			CreatedBy: note.UserID,
-		})
+	page, err := s.store.ListNotes(query)
+	if err != nil {
+		return domain.NotePageResponse{}, err
 	}
 
-	return noteResponses, nil
+	return notePageResponse(page, query), nil
 }
 
 func (s *service) DeleteNoteByID(ctx context.Context, id string) error {
 
 	userId := ctx.Value("user_id").(string)
-	return s.store.DeleteNoteByID(userId, id)
+	note, _, err := s.authorizeNote(userId, id, roleOwner)
+	if err != nil {
+		return err
+	}
+	// addressed before the note is gone from its readers' shares
+	event, notify := s.noteEvent(events.NoteDeleted, userId, note, nil)
+	if err := s.store.DeleteNoteByID(id); err != nil {
+		return err
+	}
+	if notify {
+		s.events.Publish(event)
+	}
+	return nil
 }
 
-func (s *service) UpdateNoteByID(ctx context.Context, id string, noteReq domain.NoteRequest) (domain.NoteResponse, error) {
+// UpdateNoteByID updates the note if it is still at the given version, or
+// regardless of its version when version is 0. Owners and editors may
+// update a note but only owners may change its tags.
+func (s *service) UpdateNoteByID(ctx context.Context, id string, version int, noteReq domain.NoteRequest) (domain.NoteResponse, error) {
 	userID := ctx.Value("user_id").(string)
 
+	current, role, err := s.authorizeNote(userID, id, models.RoleEditor)
+	if err != nil {
+		return domain.NoteResponse{}, err
+	}
+
+	var tags []string
+	if noteReq.Tags != nil {
+		if tags, err = normalizeTags(noteReq.Tags); err != nil {
+			return domain.NoteResponse{}, err
+		}
+		// editors may send back the tags they read as long as they are
+		// unchanged
+		if role != roleOwner {
+			if !sameTags(tags, current.Tags) {
+				return domain.NoteResponse{}, fmt.Errorf("%w: only the owner can change the tags of a note", ErrForbidden)
+			}
+			tags = nil
+		}
+	}
+
 	note := &models.Note{
 		Title:   noteReq.Title,
 		Content: noteReq.Body,
 	}
+	if noteReq.Format != "" {
+		if note.Format, err = validNoteFormat(noteReq.Format); err != nil {
+			return domain.NoteResponse{}, err
+		}
+	}
 
-	note, err := s.store.UpdateNoteByID(userID, id, note)
+	// the note is only updated along with its tags
+	err = s.store.Transaction(func(tx database.Storer) error {
+		updated, err := tx.UpdateNoteByID(userID, id, version, note)
+		if err != nil {
+			return err
+		}
+		if tags != nil {
+			if updated.Tags, err = tx.SetNoteTags(updated.UserID, id, tags); err != nil {
+				return err
+			}
+		}
+		note = updated
+		return nil
+	})
+	if errors.Is(err, database.ErrVersionConflict) {
+		current, err := s.store.GetNote(id)
+		if err != nil {
+			return domain.NoteResponse{}, notFound(err)
+		}
+		return domain.NoteResponse{}, &VersionMismatchError{CurrentVersion: current.Version}
+	}
 	if err != nil {
-		return domain.NoteResponse{}, err
+		return domain.NoteResponse{}, notFound(err)
 	}
+	s.pruneRevisions(id)
+	s.publishNoteEvent(events.NoteUpdated, userID, note, nil)
 
-	return domain.NoteResponse{
-		ID:        note.ID,
-		Title:     note.Title,
-		Body:      note.Content,
-		CreatedBy: note.UserID,
-	}, nil
+	response := noteResponse(note)
+	response.Role = role
+	return response, nil
 }
 
-// ShareNoteWithUser shares the note with the given user
+// ShareNoteWithUser shares the note with the given users. Only the owner
+// may share a note.
 func (s *service) ShareNoteWithUser(ctx context.Context, noteID string, shareReq domain.SharedNoteRequest) error {
 	fromID := ctx.Value("user_id").(string)
-	return s.store.ShareNoteWithUser(noteID, fromID, shareReq.ToUsersID)
+
+	role, err := validShareRole(shareReq.Role)
+	if err != nil {
+		return err
+	}
+	if len(shareReq.ToUsersID) == 0 {
+		return fmt.Errorf("%w: no users given", ErrInvalidInput)
+	}
+	note, _, err := s.authorizeNote(fromID, noteID, roleOwner)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.ShareNoteWithUser(noteID, fromID, shareReq.ToUsersID, role)
+	var unknown *database.UnknownUsersError
+	if errors.As(err, &unknown) {
+		return fmt.Errorf("%w: no users named %s", ErrInvalidInput, strings.Join(unknown.Usernames, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	s.publishNoteEvent(events.NoteShared, fromID, note, &domain.NoteEventShare{Usernames: shareReq.ToUsersID, Role: role})
+	return nil
 }
 
-func (s *service) SearchNotes(ctx context.Context, query string) ([]domain.NoteResponse, error) {
+func (s *service) SearchNotes(ctx context.Context, listReq domain.ListNotesRequest) (domain.NotePageResponse, error) {
 	userId := ctx.Value("user_id").(string)
 
-	notes, err := s.store.SearchNotes(userId, query)
+	var parsed *search.Query
+	if strings.TrimSpace(listReq.Query) != "" {
+		var err error
+		parsed, err = search.Parse(listReq.Query)
+		if err != nil {
+			return domain.NotePageResponse{}, fmt.Errorf("%w: %s", ErrInvalidInput, err.Error())
+		}
+		// rank matches unless another order was asked for
+		if listReq.Sort == "" {
+			listReq.Sort = database.SortRelevance
+		}
+	}
+
+	query, err := s.noteQuery(userId, listReq)
 	if err != nil {
-		return []domain.NoteResponse{}, err
+		return domain.NotePageResponse{}, err
 	}
+	query.Search = parsed
 
-	noteResponses := make([]domain.NoteResponse, 0)
-	for _, note := range notes {
-		noteResponses = append(noteResponses, domain.NoteResponse{
-			ID:        note.ID,
-			Title:     note.Title,
-			Body:      note.Content,
-			CreatedBy: note.UserID,
-		})
+	page, err := s.store.SearchNotes(query)
+	if err != nil {
+		return domain.NotePageResponse{}, err
 	}
 
-	return noteResponses, nil
+	return notePageResponse(page, query), nil
+}
+
+// noteResponse converts a note to its API representation
+func noteResponse(note *models.Note) domain.NoteResponse {
+	return domain.NoteResponse{
+		ID:         note.ID,
+		Title:      note.Title,
+		Body:       note.Content,
+		CreatedBy:  note.UserID,
+		Tags:       tagNames(note.Tags),
+		Format:     note.Format,
+		Version:    note.Version,
+		GroupID:    note.GroupID,
+		NotebookID: note.NotebookID,
+		DeletedAt:  note.DeletedAt,
+	}
 }
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// newTestService returns a service over a memory store with the default
+// configuration, changed by configure when it is not nil
+func newTestService(t *testing.T, configure func(cfg *config.Config)) (*service, database.Storer) {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Env = config.EnvDev
+	if configure != nil {
+		configure(cfg)
+	}
+	store := database.NewMemoryStore()
+	return NewService(store, nil, events.NewBus(16), cfg).(*service), store
+}
+
+// createUser adds a user straight to the store
+func createUser(t *testing.T, store database.Storer, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, PasswordHash: "hash"}
+	if err := store.CreateNewUser(user); err != nil {
+		t.Fatalf("creating user %s: %v", username, err)
+	}
+	return user
+}
+
+// userContext is the context of a request made by the user, as the
+// authentication middleware sets it up
+func userContext(user *models.User) context.Context {
+	ctx := context.WithValue(context.Background(), "user_id", user.ID)
+	return context.WithValue(ctx, "user_name", user.Username)
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// ListNoteShares lists who the note is shared with. Only the owner may see
+// the shares of a note.
+func (s *service) ListNoteShares(ctx context.Context, noteID string) ([]domain.ShareResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, _, err := s.authorizeNote(userID, noteID, roleOwner); err != nil {
+		return nil, err
+	}
+	shares, err := s.store.ListNoteShares(noteID)
+	if err != nil {
+		return nil, err
+	}
+	return shareResponses(shares), nil
+}
+
+// RevokeNoteShare stops sharing the note with the user. The owner may
+// revoke any share and a recipient their own.
+func (s *service) RevokeNoteShare(ctx context.Context, noteID, username string) error {
+	userID := ctx.Value("user_id").(string)
+
+	_, role, err := s.authorizeNote(userID, noteID, models.RoleViewer)
+	if err != nil {
+		return err
+	}
+	if role != roleOwner {
+		user, err := s.store.GetUserByID(userID)
+		if err != nil {
+			return err
+		}
+		if user.Username != username {
+			return ErrForbidden
+		}
+	}
+	return notFound(s.store.RevokeNoteShare(noteID, username))
+}
+
+// ListIncomingShares lists the notes shared with the user
+func (s *service) ListIncomingShares(ctx context.Context) ([]domain.ShareResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	shares, err := s.store.ListIncomingShares(userID)
+	if err != nil {
+		return nil, err
+	}
+	return shareResponses(shares), nil
+}
+
+// ListOutgoingShares lists the shares of the user's notes
+func (s *service) ListOutgoingShares(ctx context.Context) ([]domain.ShareResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	shares, err := s.store.ListOutgoingShares(userID)
+	if err != nil {
+		return nil, err
+	}
+	return shareResponses(shares), nil
+}
+
+// shareResponses converts shares to their API representation
+func shareResponses(shares []*database.ShareDetail) []domain.ShareResponse {
+	response := make([]domain.ShareResponse, 0, len(shares))
+	for _, share := range shares {
+		response = append(response, domain.ShareResponse{
+			NoteID:    share.NoteID,
+			NoteTitle: share.NoteTitle,
+			From:      share.FromUsername,
+			To:        share.ToUsername,
+			Role:      share.Role,
+			SharedAt:  share.CreatedAt,
+			UpdatedAt: share.UpdatedAt,
+		})
+	}
+	return response
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/models"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTagLength = 64
+	// maxTagsPerRequest bounds the tags given in one request
+	maxTagsPerRequest = 50
+)
+
+// normalizeTag trims and lower cases a tag name so that "Work" and " work"
+// are the same tag
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	switch {
+	case name == "":
+		return "", fmt.Errorf("%w: tag names must not be empty", ErrInvalidInput)
+	case utf8.RuneCountInString(name) > maxTagLength:
+		return "", fmt.Errorf("%w: tag names must be at most %d characters", ErrInvalidInput, maxTagLength)
+	case strings.Contains(name, ","):
+		return "", fmt.Errorf("%w: tag names must not contain commas", ErrInvalidInput)
+	}
+	return name, nil
+}
+
+// normalizeTags normalizes the tag names and drops duplicates
+func normalizeTags(names []string) ([]string, error) {
+	if len(names) > maxTagsPerRequest {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidInput, maxTagsPerRequest)
+	}
+	seen := make(map[string]bool, len(names))
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name, err := normalizeTag(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+// tagNames returns the names of the tags
+func tagNames(tags []models.Tag) []string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return names
+}
+
+// sameTags reports whether the normalized names are exactly the tags
+func sameTags(names []string, tags []models.Tag) bool {
+	if len(names) != len(tags) {
+		return false
+	}
+	current := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		current[tag.Name] = true
+	}
+	for _, name := range names {
+		if !current[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// tagError converts store errors of the tag methods to service errors
+func tagError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, database.ErrTagExists):
+		return fmt.Errorf("%w: %s, merge the tags instead", ErrConflict, err.Error())
+	default:
+		return err
+	}
+}
+
+// AddNoteTags tags one of the user's notes
+func (s *service) AddNoteTags(ctx context.Context, noteID string, tagsReq domain.NoteTagsRequest) (domain.NoteTagsResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	names, err := normalizeTags(tagsReq.Tags)
+	if err != nil {
+		return domain.NoteTagsResponse{}, err
+	}
+	if len(names) == 0 {
+		return domain.NoteTagsResponse{}, fmt.Errorf("%w: no tags given", ErrInvalidInput)
+	}
+	note, _, err := s.authorizeNote(userID, noteID, roleOwner)
+	if err != nil {
+		return domain.NoteTagsResponse{}, err
+	}
+
+	// tags belong to whoever wrote the note, which for group notes may be
+	// another member
+	tags, err := s.store.AddNoteTags(note.UserID, noteID, names)
+	if err != nil {
+		return domain.NoteTagsResponse{}, tagError(err)
+	}
+	return domain.NoteTagsResponse{NoteID: noteID, Tags: tagNames(tags)}, nil
+}
+
+// RemoveNoteTag removes a tag from one of the user's notes
+func (s *service) RemoveNoteTag(ctx context.Context, noteID, name string) (domain.NoteTagsResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	name, err := normalizeTag(name)
+	if err != nil {
+		return domain.NoteTagsResponse{}, err
+	}
+	note, _, err := s.authorizeNote(userID, noteID, roleOwner)
+	if err != nil {
+		return domain.NoteTagsResponse{}, err
+	}
+
+	tags, err := s.store.RemoveNoteTags(note.UserID, noteID, []string{name})
+	if err != nil {
+		return domain.NoteTagsResponse{}, tagError(err)
+	}
+	return domain.NoteTagsResponse{NoteID: noteID, Tags: tagNames(tags)}, nil
+}
+
+// ListTags lists the user's tags with the number of notes carrying each
+func (s *service) ListTags(ctx context.Context) ([]domain.TagResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	usage, err := s.store.ListTags(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]domain.TagResponse, 0, len(usage))
+	for _, u := range usage {
+		tags = append(tags, domain.TagResponse{Name: u.Name, NoteCount: u.NoteCount, CreatedAt: u.CreatedAt})
+	}
+	return tags, nil
+}
+
+// RenameTag renames one of the user's tags on all of their notes
+func (s *service) RenameTag(ctx context.Context, name string, renameReq domain.RenameTagRequest) (domain.TagResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	name, err := normalizeTag(name)
+	if err != nil {
+		return domain.TagResponse{}, err
+	}
+	newName, err := normalizeTag(renameReq.Name)
+	if err != nil {
+		return domain.TagResponse{}, err
+	}
+
+	tag, err := s.store.RenameTag(userID, name, newName)
+	if err != nil {
+		return domain.TagResponse{}, tagError(err)
+	}
+	return s.tagResponse(userID, tag)
+}
+
+// MergeTags replaces the source tags with the target tag on all of the
+// user's notes
+func (s *service) MergeTags(ctx context.Context, mergeReq domain.MergeTagsRequest) (domain.TagResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	sources, err := normalizeTags(mergeReq.Sources)
+	if err != nil {
+		return domain.TagResponse{}, err
+	}
+	if len(sources) == 0 {
+		return domain.TagResponse{}, fmt.Errorf("%w: no source tags given", ErrInvalidInput)
+	}
+	target, err := normalizeTag(mergeReq.Target)
+	if err != nil {
+		return domain.TagResponse{}, err
+	}
+
+	tag, err := s.store.MergeTags(userID, sources, target)
+	if err != nil {
+		return domain.TagResponse{}, tagError(err)
+	}
+	return s.tagResponse(userID, tag)
+}
+
+// DeleteTag removes one of the user's tags from all of their notes
+func (s *service) DeleteTag(ctx context.Context, name string) error {
+	userID := ctx.Value("user_id").(string)
+
+	name, err := normalizeTag(name)
+	if err != nil {
+		return err
+	}
+	return tagError(s.store.DeleteTag(userID, name))
+}
+
+// tagResponse converts a tag to its API representation, with its usage
+func (s *service) tagResponse(userID string, tag *models.Tag) (domain.TagResponse, error) {
+	usage, err := s.store.ListTags(userID)
+	if err != nil {
+		return domain.TagResponse{}, err
+	}
+	for _, u := range usage {
+		if u.ID == tag.ID {
+			return domain.TagResponse{Name: u.Name, NoteCount: u.NoteCount, CreatedAt: u.CreatedAt}, nil
+		}
+	}
+	return domain.TagResponse{Name: tag.Name, CreatedAt: tag.CreatedAt}, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// authorizeDeletedNote fetches a note in the trash and checks that the
+// user may restore or purge it, which takes the owner role
+func (s *service) authorizeDeletedNote(userID, noteID string) (*models.Note, error) {
+	note, err := s.store.GetDeletedNote(noteID)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	role, err := s.noteRole(userID, note)
+	if err != nil || role != roleOwner {
+		// users who could see the note before it was deleted learn
+		// nothing more from a not found
+		return nil, ErrNotFound
+	}
+	return note, nil
+}
+
+// ListTrash lists the deleted notes the user may restore or purge, most
+// recently deleted first by default
+func (s *service) ListTrash(ctx context.Context, listReq domain.ListNotesRequest) (domain.NotePageResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	query, err := s.noteQuery(userID, listReq)
+	if err != nil {
+		return domain.NotePageResponse{}, err
+	}
+	query.Trashed = true
+
+	page, err := s.store.ListNotes(query)
+	if err != nil {
+		return domain.NotePageResponse{}, err
+	}
+	return notePageResponse(page, query), nil
+}
+
+// RestoreNote takes a note out of the trash
+func (s *service) RestoreNote(ctx context.Context, id string) (domain.NoteResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, err := s.authorizeDeletedNote(userID, id); err != nil {
+		return domain.NoteResponse{}, err
+	}
+	note, err := s.store.RestoreNote(id)
+	if err != nil {
+		return domain.NoteResponse{}, notFound(err)
+	}
+	// clients treat the note reappearing like any other change to it
+	s.publishNoteEvent(events.NoteUpdated, userID, note, nil)
+
+	response := noteResponse(note)
+	response.Role = roleOwner
+	return response, nil
+}
+
+// PurgeNote permanently deletes a note in the trash along with its
+// attachments
+func (s *service) PurgeNote(ctx context.Context, id string) error {
+	userID := ctx.Value("user_id").(string)
+
+	if _, err := s.authorizeDeletedNote(userID, id); err != nil {
+		return err
+	}
+	if err := s.store.PurgeNote(id); err != nil {
+		return notFound(err)
+	}
+	s.removePurgedAttachments(ctx)
+	return nil
+}
+
+// PurgeTrash permanently deletes the notes that have been in the trash for
+// longer than the retention period
+func (s *service) PurgeTrash(ctx context.Context) (int64, error) {
+	if s.cfg.Trash.Retention == 0 {
+		return 0, nil
+	}
+	purged, err := s.store.PurgeDeletedNotes(time.Now().Add(-s.cfg.Trash.Retention))
+	if purged > 0 {
+		s.removePurgedAttachments(ctx)
+	}
+	return purged, err
+}
@@ -0,0 +1,425 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/internal/domain"
+	"github.com/GauravMakhijani/notes/internal/events"
+	"github.com/GauravMakhijani/notes/internal/webhook"
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/sirupsen/logrus"
+)
+
+// maxWebhooks bounds the webhooks of a user
+const maxWebhooks = 20
+
+// minWebhookSecretLength is the shortest secret a user may choose
+const minWebhookSecretLength = 16
+
+// maxWebhookURLLength bounds the URL of a webhook
+const maxWebhookURLLength = 2048
+
+// webhookBatchSize is how many due deliveries are started at a time, and
+// webhookBatchPerEndpoint how many of them may go to the same endpoint, so
+// that a backlogged endpoint does not crowd out the others
+const (
+	webhookBatchSize        = 100
+	webhookBatchPerEndpoint = 10
+)
+
+// busyWebhooks holds the IDs of the webhooks being sent deliveries
+type busyWebhooks struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// webhookEvents are the event types webhooks can be registered for
+var webhookEvents = []string{events.NoteCreated, events.NoteUpdated, events.NoteDeleted, events.NoteShared}
+
+// CreateWebhook registers an endpoint to be sent the events about the
+// notes the user can read
+func (s *service) CreateWebhook(ctx context.Context, webhookReq domain.WebhookRequest) (domain.WebhookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if err := s.validWebhookURL(webhookReq.URL); err != nil {
+		return domain.WebhookResponse{}, err
+	}
+	eventTypes, err := validWebhookEvents(webhookReq.Events)
+	if err != nil {
+		return domain.WebhookResponse{}, err
+	}
+	secret, err := webhookSecret(webhookReq.Secret)
+	if err != nil {
+		return domain.WebhookResponse{}, err
+	}
+
+	hooks, err := s.store.ListWebhooks(userID)
+	if err != nil {
+		return domain.WebhookResponse{}, err
+	}
+	if len(hooks) >= maxWebhooks {
+		return domain.WebhookResponse{}, fmt.Errorf("%w: at most %d webhooks can be registered", ErrConflict, maxWebhooks)
+	}
+
+	hook := &models.Webhook{
+		UserID: userID,
+		URL:    webhookReq.URL,
+		Secret: secret,
+		Events: eventTypes,
+	}
+	if err := s.store.CreateWebhook(hook); err != nil {
+		return domain.WebhookResponse{}, err
+	}
+
+	response := webhookResponse(hook)
+	response.Secret = secret
+	return response, nil
+}
+
+// ListWebhooks lists the user's webhooks without their secrets
+func (s *service) ListWebhooks(ctx context.Context) ([]domain.WebhookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	hooks, err := s.store.ListWebhooks(userID)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]domain.WebhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		responses = append(responses, webhookResponse(hook))
+	}
+	return responses, nil
+}
+
+func (s *service) GetWebhook(ctx context.Context, id string) (domain.WebhookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	hook, err := s.store.GetWebhook(userID, id)
+	if err != nil {
+		return domain.WebhookResponse{}, notFound(err)
+	}
+	return webhookResponse(hook), nil
+}
+
+// UpdateWebhook changes the settings of a webhook. Enabling a disabled
+// webhook clears its failures, and the deliveries still pending resume.
+func (s *service) UpdateWebhook(ctx context.Context, id string, updateReq domain.WebhookUpdateRequest) (domain.WebhookResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	hook, err := s.store.GetWebhook(userID, id)
+	if err != nil {
+		return domain.WebhookResponse{}, notFound(err)
+	}
+
+	if updateReq.URL != nil {
+		if err := s.validWebhookURL(*updateReq.URL); err != nil {
+			return domain.WebhookResponse{}, err
+		}
+		hook.URL = *updateReq.URL
+	}
+	if updateReq.Events != nil {
+		if hook.Events, err = validWebhookEvents(updateReq.Events); err != nil {
+			return domain.WebhookResponse{}, err
+		}
+	}
+	secret := ""
+	if updateReq.Secret != nil {
+		if secret, err = webhookSecret(*updateReq.Secret); err != nil {
+			return domain.WebhookResponse{}, err
+		}
+		hook.Secret = secret
+	}
+	if updateReq.Active != nil {
+		switch {
+		case *updateReq.Active:
+			hook.DisabledAt = nil
+			hook.DisabledReason = ""
+			hook.ConsecutiveFailures = 0
+		case hook.DisabledAt == nil:
+			now := time.Now()
+			hook.DisabledAt = &now
+			hook.DisabledReason = "disabled by its owner"
+		}
+	}
+
+	if err := s.store.UpdateWebhook(hook); err != nil {
+		return domain.WebhookResponse{}, err
+	}
+	response := webhookResponse(hook)
+	response.Secret = secret
+	return response, nil
+}
+
+// DeleteWebhook removes a webhook, dropping its pending deliveries
+func (s *service) DeleteWebhook(ctx context.Context, id string) error {
+	userID := ctx.Value("user_id").(string)
+	return notFound(s.store.DeleteWebhook(userID, id))
+}
+
+// ListWebhookDeliveries returns the latest deliveries to a webhook, newest
+// first, with the outcome of their last attempt
+func (s *service) ListWebhookDeliveries(ctx context.Context, id string, limit int) ([]domain.WebhookDeliveryResponse, error) {
+	userID := ctx.Value("user_id").(string)
+
+	if _, err := s.store.GetWebhook(userID, id); err != nil {
+		return nil, notFound(err)
+	}
+	deliveries, err := s.store.ListWebhookDeliveries(id, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]domain.WebhookDeliveryResponse, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response := domain.WebhookDeliveryResponse{
+			ID:             delivery.ID,
+			EventID:        strconv.FormatUint(delivery.EventID, 10),
+			EventType:      delivery.EventType,
+			Status:         delivery.Status,
+			Attempts:       delivery.Attempts,
+			LastAttemptAt:  delivery.LastAttemptAt,
+			ResponseStatus: delivery.ResponseStatus,
+			Error:          delivery.Error,
+			Payload:        json.RawMessage(delivery.Payload),
+			CreatedAt:      delivery.CreatedAt,
+		}
+		if delivery.Status == models.WebhookDeliveryPending {
+			nextAttemptAt := delivery.NextAttemptAt
+			response.NextAttemptAt = &nextAttemptAt
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+// DeliverWebhooks starts attempting the webhook deliveries that are due
+// and returns how many there were. Each endpoint is sent its deliveries in
+// the order they were queued, on a goroutine of its own that is not waited
+// for, so that a slow endpoint only holds up itself. Endpoints still being
+// sent earlier deliveries are skipped until they are done. Retried
+// deliveries arrive after those queued later.
+func (s *service) DeliverWebhooks(ctx context.Context) (int, error) {
+	s.delivering.mu.Lock()
+	defer s.delivering.mu.Unlock()
+
+	busy := make([]string, 0, len(s.delivering.ids))
+	for id := range s.delivering.ids {
+		busy = append(busy, id)
+	}
+	due, err := s.store.ListDueWebhookDeliveries(time.Now(), busy, webhookBatchPerEndpoint, webhookBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	byWebhook := make(map[string][]*database.DueWebhookDelivery)
+	for _, delivery := range due {
+		byWebhook[delivery.WebhookID] = append(byWebhook[delivery.WebhookID], delivery)
+	}
+	for id, deliveries := range byWebhook {
+		s.delivering.ids[id] = true
+		go func(id string, deliveries []*database.DueWebhookDelivery) {
+			defer func() {
+				s.delivering.mu.Lock()
+				delete(s.delivering.ids, id)
+				s.delivering.mu.Unlock()
+			}()
+			for _, delivery := range deliveries {
+				if disabled := s.deliverWebhook(ctx, delivery); disabled {
+					return
+				}
+			}
+		}(id, deliveries)
+	}
+	return len(due), nil
+}
+
+// deliverWebhook attempts a delivery and records the outcome, scheduling
+// the next attempt after a failure. It returns whether the failure got the
+// webhook disabled.
+func (s *service) deliverWebhook(ctx context.Context, due *database.DueWebhookDelivery) bool {
+	delivery := &due.WebhookDelivery
+	status, sendErr := s.webhooks.Send(ctx, webhook.Request{
+		URL:        due.URL,
+		Secret:     due.Secret,
+		Event:      delivery.EventType,
+		DeliveryID: delivery.ID,
+		Body:       []byte(delivery.Payload),
+	})
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDeliverySucceeded
+	case delivery.Attempts >= s.cfg.Webhooks.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.Error = sendErr.Error()
+	default:
+		delivery.Error = sendErr.Error()
+		delivery.NextAttemptAt = now.Add(s.webhookRetryDelay(delivery.Attempts))
+	}
+	if err := s.store.UpdateWebhookDelivery(delivery); err != nil {
+		logrus.Errorf("error recording webhook delivery %s\nError: %s", delivery.ID, err.Error())
+	}
+
+	disabled, err := s.store.RecordWebhookAttempt(delivery.WebhookID, sendErr == nil, s.cfg.Webhooks.DisableAfter, now)
+	if err != nil {
+		logrus.Errorf("error recording attempt of webhook %s\nError: %s", delivery.WebhookID, err.Error())
+	}
+	if disabled {
+		logrus.Warnf("disabled webhook %s after %d failed deliveries in a row", delivery.WebhookID, s.cfg.Webhooks.DisableAfter)
+	}
+	return disabled
+}
+
+// webhookRetryDelay is the wait after the given number of failed attempts:
+// the base delay, doubled for every attempt after the first, up to the
+// maximum
+func (s *service) webhookRetryDelay(attempts int) time.Duration {
+	delay := s.cfg.Webhooks.RetryBase
+	for i := 1; i < attempts && delay < s.cfg.Webhooks.RetryMax; i++ {
+		delay *= 2
+	}
+	return min(delay, s.cfg.Webhooks.RetryMax)
+}
+
+// enqueueWebhooks queues the event for the active webhooks of the users it
+// is meant for that were registered for its type. The change the event is
+// about already happened, so failures are only logged.
+func (s *service) enqueueWebhooks(event events.Event) {
+	hooks, err := s.store.ListActiveWebhooks(event.Users)
+	if err != nil {
+		logrus.Errorf("error finding the webhooks for event %d\nError: %s", event.ID, err.Error())
+		return
+	}
+
+	var payload []byte
+	var deliveries []*models.WebhookDelivery
+	for _, hook := range hooks {
+		if !webhookWants(hook, event.Type) {
+			continue
+		}
+		// the body is the event as streamed on /api/events
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				logrus.Errorf("error encoding event %d\nError: %s", event.ID, err.Error())
+				return
+			}
+		}
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       string(payload),
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: event.Time,
+		})
+	}
+	if err := s.store.AddWebhookDeliveries(deliveries); err != nil {
+		logrus.Errorf("error queueing webhook deliveries of event %d\nError: %s", event.ID, err.Error())
+	}
+}
+
+// webhookWants reports whether the webhook was registered for the event
+// type
+func webhookWants(hook *models.Webhook, eventType string) bool {
+	if hook.Events == "" {
+		return true
+	}
+	for _, t := range strings.Split(hook.Events, ",") {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// validWebhookURL checks that the URL is an absolute http or https URL.
+// Hosts that are not allowed to be called back are refused here when they
+// are addresses or localhost; names resolving to them are refused when
+// delivered to.
+func (s *service) validWebhookURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("%w: url is required", ErrInvalidInput)
+	}
+	if len(raw) > maxWebhookURLLength {
+		return fmt.Errorf("%w: url must be at most %d bytes", ErrInvalidInput, maxWebhookURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidInput)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	ip := net.ParseIP(host)
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		ip = net.IPv6loopback
+	}
+	if ip != nil && !s.webhooks.Allowed(ip) {
+		return fmt.Errorf("%w: url must not point to a loopback, private or link-local address", ErrInvalidInput)
+	}
+	return nil
+}
+
+// validWebhookEvents checks the event types a webhook is registered for,
+// returning them in the form they are stored in
+func validWebhookEvents(eventTypes []string) (string, error) {
+	known := make(map[string]bool, len(webhookEvents))
+	for _, eventType := range webhookEvents {
+		known[eventType] = true
+	}
+
+	seen := make(map[string]bool, len(eventTypes))
+	var valid []string
+	for _, eventType := range eventTypes {
+		if !known[eventType] {
+			return "", fmt.Errorf("%w: unknown event type %q, expected one of %s", ErrInvalidInput, eventType, strings.Join(webhookEvents, ", "))
+		}
+		if !seen[eventType] {
+			seen[eventType] = true
+			valid = append(valid, eventType)
+		}
+	}
+	return strings.Join(valid, ","), nil
+}
+
+// webhookSecret checks a secret chosen by the user, or generates one when
+// none was given
+func webhookSecret(secret string) (string, error) {
+	if secret == "" {
+		return newSecretToken()
+	}
+	if len(secret) < minWebhookSecretLength {
+		return "", fmt.Errorf("%w: secret must be at least %d bytes", ErrInvalidInput, minWebhookSecretLength)
+	}
+	return secret, nil
+}
+
+func webhookResponse(hook *models.Webhook) domain.WebhookResponse {
+	eventTypes := []string{}
+	if hook.Events != "" {
+		eventTypes = strings.Split(hook.Events, ",")
+	}
+	return domain.WebhookResponse{
+		ID:                  hook.ID,
+		URL:                 hook.URL,
+		Events:              eventTypes,
+		Active:              hook.DisabledAt == nil,
+		ConsecutiveFailures: hook.ConsecutiveFailures,
+		DisabledAt:          hook.DisabledAt,
+		DisabledReason:      hook.DisabledReason,
+		CreatedAt:           hook.CreatedAt,
+		UpdatedAt:           hook.UpdatedAt,
+	}
+}
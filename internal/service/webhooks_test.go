@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GauravMakhijani/notes/internal/config"
+	"github.com/GauravMakhijani/notes/internal/database"
+	"github.com/GauravMakhijani/notes/models"
+)
+
+// endpoint is a webhook receiver responding with the status it is set to
+type endpoint struct {
+	*httptest.Server
+	status   atomic.Int32
+	received atomic.Int32
+}
+
+func newEndpoint(t *testing.T) *endpoint {
+	e := &endpoint{}
+	e.status.Store(http.StatusOK)
+	e.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.received.Add(1)
+		w.WriteHeader(int(e.status.Load()))
+	}))
+	t.Cleanup(e.Close)
+	return e
+}
+
+// newWebhookService returns a service over a memory store that may deliver
+// to the httptest servers, which listen on loopback
+func newWebhookService(t *testing.T) (*service, database.Storer) {
+	return newTestService(t, func(cfg *config.Config) {
+		cfg.Webhooks.Timeout = time.Second
+		cfg.Webhooks.MaxAttempts = 3
+		cfg.Webhooks.RetryBase = time.Minute
+		cfg.Webhooks.RetryMax = 10 * time.Minute
+		cfg.Webhooks.DisableAfter = 4
+		cfg.Webhooks.AllowedNetworks = []string{"127.0.0.0/8", "::1/128"}
+	})
+}
+
+func createWebhook(t *testing.T, store database.Storer, url string) *models.Webhook {
+	t.Helper()
+	user := createUser(t, store, "alice")
+	hook := &models.Webhook{UserID: user.ID, URL: url, Secret: "secret"}
+	if err := store.CreateWebhook(hook); err != nil {
+		t.Fatalf("CreateWebhook: %v", err)
+	}
+	return hook
+}
+
+func queueDeliveries(t *testing.T, store database.Storer, hook *models.Webhook, n int) {
+	t.Helper()
+	var deliveries []*models.WebhookDelivery
+	for i := 0; i < n; i++ {
+		deliveries = append(deliveries, &models.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       uint64(i + 1),
+			EventType:     "note.created",
+			Payload:       "{}",
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: time.Now().Add(time.Duration(i-n) * time.Second),
+		})
+	}
+	if err := store.AddWebhookDeliveries(deliveries); err != nil {
+		t.Fatalf("AddWebhookDeliveries: %v", err)
+	}
+}
+
+// nextDue returns the webhook's oldest pending delivery, however far its
+// next attempt is
+func nextDue(t *testing.T, store database.Storer) *database.DueWebhookDelivery {
+	t.Helper()
+	due, err := store.ListDueWebhookDeliveries(time.Now().Add(24*time.Hour), nil, 1, 1)
+	if err != nil || len(due) != 1 {
+		t.Fatalf("ListDueWebhookDeliveries = %d deliveries, %v, want 1", len(due), err)
+	}
+	return due[0]
+}
+
+func storedDelivery(t *testing.T, store database.Storer, hook *models.Webhook, id string) *models.WebhookDelivery {
+	t.Helper()
+	deliveries, err := store.ListWebhookDeliveries(hook.ID, 100)
+	if err != nil {
+		t.Fatalf("ListWebhookDeliveries: %v", err)
+	}
+	for _, delivery := range deliveries {
+		if delivery.ID == id {
+			return delivery
+		}
+	}
+	t.Fatalf("delivery %s not found", id)
+	return nil
+}
+
+func storedWebhook(t *testing.T, store database.Storer, hook *models.Webhook) *models.Webhook {
+	t.Helper()
+	stored, err := store.GetWebhook(hook.UserID, hook.ID)
+	if err != nil {
+		t.Fatalf("GetWebhook: %v", err)
+	}
+	return stored
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	s, _ := newWebhookService(t)
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := s.webhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("delay after %d attempts = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverWebhookRetries(t *testing.T) {
+	s, store := newWebhookService(t)
+	receiver := newEndpoint(t)
+	hook := createWebhook(t, store, receiver.URL)
+	queueDeliveries(t, store, hook, 1)
+	ctx := context.Background()
+
+	// failed attempts are retried later, each after twice the wait
+	receiver.status.Store(http.StatusServiceUnavailable)
+	for attempt := 1; attempt < s.cfg.Webhooks.MaxAttempts; attempt++ {
+		due := nextDue(t, store)
+		before := time.Now()
+		if disabled := s.deliverWebhook(ctx, due); disabled {
+			t.Fatal("webhook disabled before failing often enough")
+		}
+		delivery := storedDelivery(t, store, hook, due.ID)
+		if delivery.Status != models.WebhookDeliveryPending || delivery.Attempts != attempt {
+			t.Fatalf("after %d failed attempts the delivery is %s after %d", attempt, delivery.Status, delivery.Attempts)
+		}
+		if delivery.ResponseStatus != http.StatusServiceUnavailable || delivery.Error == "" {
+			t.Errorf("failed attempt recorded with status %d and error %q", delivery.ResponseStatus, delivery.Error)
+		}
+		delay := s.webhookRetryDelay(attempt)
+		if delivery.NextAttemptAt.Before(before.Add(delay)) || delivery.NextAttemptAt.After(time.Now().Add(delay)) {
+			t.Errorf("attempt %d retried at %s, want %s after it", attempt, delivery.NextAttemptAt, delay)
+		}
+		if due, err := store.ListDueWebhookDeliveries(time.Now(), nil, 10, 10); err != nil || len(due) != 0 {
+			t.Fatalf("delivery due again before its retry: %d, %v", len(due), err)
+		}
+	}
+
+	// the last attempt allowed fails the delivery for good
+	due := nextDue(t, store)
+	s.deliverWebhook(ctx, due)
+	delivery := storedDelivery(t, store, hook, due.ID)
+	if delivery.Status != models.WebhookDeliveryFailed || delivery.Attempts != s.cfg.Webhooks.MaxAttempts {
+		t.Fatalf("after the last attempt the delivery is %s after %d attempts", delivery.Status, delivery.Attempts)
+	}
+	if due, err := store.ListDueWebhookDeliveries(time.Now().Add(24*time.Hour), nil, 10, 10); err != nil || len(due) != 0 {
+		t.Fatalf("failed delivery still due: %d, %v", len(due), err)
+	}
+	if got := receiver.received.Load(); got != int32(s.cfg.Webhooks.MaxAttempts) {
+		t.Errorf("endpoint received %d attempts, want %d", got, s.cfg.Webhooks.MaxAttempts)
+	}
+}
+
+func TestDeliverWebhookSucceeds(t *testing.T) {
+	s, store := newWebhookService(t)
+	receiver := newEndpoint(t)
+	hook := createWebhook(t, store, receiver.URL)
+	queueDeliveries(t, store, hook, 1)
+
+	receiver.status.Store(http.StatusInternalServerError)
+	due := nextDue(t, store)
+	s.deliverWebhook(context.Background(), due)
+	receiver.status.Store(http.StatusNoContent)
+	s.deliverWebhook(context.Background(), nextDue(t, store))
+
+	delivery := storedDelivery(t, store, hook, due.ID)
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 2 {
+		t.Fatalf("delivery is %s after %d attempts, want succeeded after 2", delivery.Status, delivery.Attempts)
+	}
+	if delivery.ResponseStatus != http.StatusNoContent || delivery.Error != "" || delivery.LastAttemptAt == nil {
+		t.Errorf("successful attempt recorded with status %d, error %q and time %v", delivery.ResponseStatus, delivery.Error, delivery.LastAttemptAt)
+	}
+}
+
+func TestDeliverWebhookDisables(t *testing.T) {
+	s, store := newWebhookService(t)
+	receiver := newEndpoint(t)
+	hook := createWebhook(t, store, receiver.URL)
+	queueDeliveries(t, store, hook, 8)
+	ctx := context.Background()
+	disableAfter := s.cfg.Webhooks.DisableAfter
+
+	fail := func(n int) {
+		t.Helper()
+		receiver.status.Store(http.StatusInternalServerError)
+		for i := 0; i < n; i++ {
+			if disabled := s.deliverWebhook(ctx, nextDue(t, store)); disabled {
+				t.Fatalf("webhook disabled after %d failures in a row, want %d", i+1, disableAfter)
+			}
+		}
+	}
+
+	// a success resets the failures counted
+	fail(disableAfter - 1)
+	if got := storedWebhook(t, store, hook).ConsecutiveFailures; got != disableAfter-1 {
+		t.Fatalf("webhook counted %d failures, want %d", got, disableAfter-1)
+	}
+	receiver.status.Store(http.StatusOK)
+	s.deliverWebhook(ctx, nextDue(t, store))
+	if got := storedWebhook(t, store, hook).ConsecutiveFailures; got != 0 {
+		t.Fatalf("webhook counted %d failures after a success, want 0", got)
+	}
+
+	fail(disableAfter - 1)
+	if disabled := s.deliverWebhook(ctx, nextDue(t, store)); !disabled {
+		t.Fatalf("webhook not disabled after %d failures in a row", disableAfter)
+	}
+	stored := storedWebhook(t, store, hook)
+	if stored.DisabledAt == nil || stored.DisabledReason == "" {
+		t.Fatalf("webhook not disabled: %+v", stored)
+	}
+	if due, err := store.ListDueWebhookDeliveries(time.Now().Add(24*time.Hour), nil, 10, 10); err != nil || len(due) != 0 {
+		t.Fatalf("deliveries to a disabled webhook still due: %d, %v", len(due), err)
+	}
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	s, store := newWebhookService(t)
+	receiver := newEndpoint(t)
+	hook := createWebhook(t, store, receiver.URL)
+	queueDeliveries(t, store, hook, 3)
+
+	n, err := s.DeliverWebhooks(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("DeliverWebhooks = %d, %v, want 3", n, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		deliveries, err := store.ListWebhookDeliveries(hook.ID, 10)
+		if err != nil {
+			t.Fatalf("ListWebhookDeliveries: %v", err)
+		}
+		succeeded := 0
+		for _, delivery := range deliveries {
+			if delivery.Status == models.WebhookDeliverySucceeded {
+				succeeded++
+			}
+		}
+		if succeeded == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of 3 deliveries succeeded", succeeded)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
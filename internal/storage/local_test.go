@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newLocalStore(t *testing.T) (*localStore, string) {
+	t.Helper()
+	root := filepath.Join(t.TempDir(), "attachments")
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store.(*localStore), root
+}
+
+func TestLocalStore(t *testing.T) {
+	store, _ := newLocalStore(t)
+	testBlobStore(t, store, "test")
+}
+
+func TestLocalStoreRejectsKeysOutsideRoot(t *testing.T) {
+	store, root := newLocalStore(t)
+	// a file next to the root a key could reach
+	outside := filepath.Join(filepath.Dir(root), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	keys := []string{
+		"", "../secret", "note/../../secret", "note/../attachment", "/secret",
+		"./note/attachment", "note//attachment", "note/attachment/", "..",
+		`..\secret`, `note\..\..\secret`,
+	}
+	for _, key := range keys {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) accepted", key)
+		}
+		if r, err := store.Get(ctx, key); err == nil || errors.Is(err, ErrNotFound) {
+			if r != nil {
+				r.Close()
+			}
+			t.Errorf("Get(%q): got %v, want the key refused", key, err)
+		}
+		if err := store.Delete(ctx, key); err == nil {
+			t.Errorf("Delete(%q) accepted", key)
+		}
+	}
+
+	if content, err := os.ReadFile(outside); err != nil || string(content) != "secret" {
+		t.Fatalf("file outside the root changed: %q, %v", content, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(root)); len(entries) != 2 {
+		t.Errorf("%d entries next to the root, want the root and the secret", len(entries))
+	}
+}
+
+// failingReader fails after returning some of the blob
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestLocalStorePutIsAtomic(t *testing.T) {
+	store, root := newLocalStore(t)
+	ctx := context.Background()
+	put(t, store, "note/attachment", "original")
+
+	// an upload that breaks off, or is shorter or longer than announced,
+	// leaves the stored blob alone
+	uploads := []struct {
+		name string
+		r    io.Reader
+		size int64
+	}{
+		{"broken off", &failingReader{strings.NewReader("partial")}, 20},
+		{"short", strings.NewReader("short"), 20},
+		{"long", strings.NewReader("longer than announced"), 4},
+	}
+	for _, upload := range uploads {
+		if err := store.Put(ctx, "note/attachment", upload.r, upload.size, "text/plain"); err == nil {
+			t.Errorf("%s upload accepted", upload.name)
+		}
+		if got := read(t, store, "note/attachment"); got != "original" {
+			t.Errorf("after a %s upload the blob reads %q", upload.name, got)
+		}
+	}
+	if err := store.Put(ctx, "other/attachment", &failingReader{strings.NewReader("partial")}, 20, "text/plain"); err == nil {
+		t.Error("broken off upload of a new blob accepted")
+	}
+	if _, err := store.Get(ctx, "other/attachment"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a broken off new blob: got %v, want ErrNotFound", err)
+	}
+
+	// no temporary files are left behind
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && path != filepath.Join(root, "note", "attachment") {
+			t.Errorf("file %s left behind", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLocalStoreDeleteRemovesEmptyDirectories(t *testing.T) {
+	store, root := newLocalStore(t)
+	ctx := context.Background()
+	put(t, store, "note/one", "1")
+	put(t, store, "note/two", "2")
+
+	if err := store.Delete(ctx, "note/one"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, store, "note/two"); got != "2" {
+		t.Fatalf("remaining blob reads %q", got)
+	}
+	if err := store.Delete(ctx, "note/two"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "note")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("empty note directory kept: %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Errorf("root removed: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/GauravMakhijani/notes/models"
+	"github.com/minio/minio-go/v7"
+)
+
+// TestS3Store runs against the S3 compatible store at
+// NOTES_TEST_S3_ENDPOINT, e.g. a local MinIO on localhost:9000, with the
+// credentials in NOTES_TEST_S3_ACCESS_KEY_ID and
+// NOTES_TEST_S3_SECRET_ACCESS_KEY. It creates and removes its own bucket.
+func TestS3Store(t *testing.T) {
+	endpoint := os.Getenv("NOTES_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("NOTES_TEST_S3_ENDPOINT not set")
+	}
+	ctx := context.Background()
+	opts := S3Options{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          "notes-test-" + models.NewID(),
+		AccessKeyID:     os.Getenv("NOTES_TEST_S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("NOTES_TEST_S3_SECRET_ACCESS_KEY"),
+		UseSSL:          os.Getenv("NOTES_TEST_S3_USE_SSL") == "true",
+	}
+	store, err := NewS3Store(ctx, opts)
+	if err != nil {
+		t.Fatalf("NewS3Store: %v", err)
+	}
+	client := store.(*s3Store).client
+	t.Cleanup(func() {
+		if err := client.RemoveBucketWithOptions(ctx, opts.Bucket, minio.RemoveBucketOptions{ForceDelete: true}); err != nil {
+			t.Errorf("removing bucket %s: %v", opts.Bucket, err)
+		}
+	})
+
+	testBlobStore(t, store, "test")
+
+	// connecting again finds the existing bucket
+	if _, err := NewS3Store(ctx, opts); err != nil {
+		t.Fatalf("NewS3Store with an existing bucket: %v", err)
+	}
+}
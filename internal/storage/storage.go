@@ -0,0 +1,25 @@
+// Package storage keeps the contents of note attachments in a blob store,
+// either on the local filesystem or in an S3 compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore stores blobs by key. Keys are slash separated paths made of
+// IDs, e.g. note-id/attachment-id.
+type BlobStore interface {
+	// Put stores size bytes read from r under the key, replacing any blob
+	// already there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under the key. Callers close the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under the key. Deleting a missing
+	// blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
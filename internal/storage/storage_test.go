@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func put(t *testing.T, store BlobStore, key, content string) {
+	t.Helper()
+	if err := store.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Put(%s): %v", key, err)
+	}
+}
+
+// read returns the blob stored under the key
+func read(t *testing.T, store BlobStore, key string) string {
+	t.Helper()
+	r, err := store.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%s): %v", key, err)
+	}
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %s: %v", key, err)
+	}
+	return string(content)
+}
+
+// testBlobStore checks the behaviour every blob store shares, using keys
+// below prefix
+func testBlobStore(t *testing.T, store BlobStore, prefix string) {
+	ctx := context.Background()
+	key := prefix + "/note/attachment"
+
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing blob: got %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of a missing blob: %v", err)
+	}
+
+	put(t, store, key, "first")
+	if got := read(t, store, key); got != "first" {
+		t.Fatalf("stored %q, want first", got)
+	}
+	put(t, store, key, "second version")
+	if got := read(t, store, key); got != "second version" {
+		t.Fatalf("replaced blob reads %q", got)
+	}
+
+	content := bytes.Repeat([]byte("0123456789"), 100_000)
+	if err := store.Put(ctx, prefix+"/note/large", bytes.NewReader(content), int64(len(content)), "application/octet-stream"); err != nil {
+		t.Fatalf("Put of a large blob: %v", err)
+	}
+	if got := read(t, store, prefix+"/note/large"); got != string(content) {
+		t.Fatalf("large blob reads %d bytes, want %d", len(got), len(content))
+	}
+
+	for _, k := range []string{key, prefix + "/note/large"} {
+		if err := store.Delete(ctx, k); err != nil {
+			t.Fatalf("Delete(%s): %v", k, err)
+		}
+		if _, err := store.Get(ctx, k); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Get of a deleted blob: got %v, want ErrNotFound", err)
+		}
+	}
+}
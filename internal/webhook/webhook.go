@@ -0,0 +1,188 @@
+// Package webhook sends signed HTTP callbacks. Each request carries an
+// HMAC-SHA256 signature of its timestamp and body, which receivers check
+// with the secret they share with the sender before trusting the body.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Request headers
+const (
+	// SignatureHeader holds "sha256=" followed by the hex encoded
+	// HMAC-SHA256, keyed with the secret, of the timestamp, a dot and the
+	// body
+	SignatureHeader = "X-Notes-Signature"
+	// TimestampHeader holds the Unix time the request was signed at, which
+	// receivers can use to reject replayed requests
+	TimestampHeader = "X-Notes-Timestamp"
+	// EventHeader holds the type of the event delivered
+	EventHeader = "X-Notes-Event"
+	// DeliveryHeader holds the ID of the delivery, the same for every
+	// attempt, so that receivers can drop duplicates
+	DeliveryHeader = "X-Notes-Delivery"
+)
+
+// ErrForbiddenAddress is returned when a callback would reach an address
+// that is not allowed
+var ErrForbiddenAddress = errors.New("callbacks to this address are not allowed")
+
+// reservedNetworks are not reachable on the internet, besides the ranges
+// the net.IP methods check for
+var reservedNetworks = parseCIDRs(
+	"0.0.0.0/8",      // "this" network
+	"100.64.0.0/10",  // carrier-grade NAT
+	"192.0.0.0/24",   // IETF protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved
+	"64:ff9b::/96",   // NAT64, which maps IPv4 addresses
+	"64:ff9b:1::/48", // local-use NAT64
+	"2001:db8::/32",  // documentation
+)
+
+// Request is a callback to send
+type Request struct {
+	URL        string
+	Secret     string
+	Event      string
+	DeliveryID string
+	Body       []byte
+}
+
+// Sender sends callbacks with its client
+type Sender struct {
+	Client *http.Client
+	// allowed are the networks that may be reached although they are not
+	// public
+	allowed []*net.IPNet
+}
+
+// NewSender creates a sender whose requests time out after timeout.
+// Callbacks only reach public addresses, or those within allowedNetworks,
+// so that they cannot be pointed at the network the server runs in. The
+// address is checked once resolved, when it is connected to, and
+// redirects are not followed, so that neither DNS nor the endpoint can
+// lead a callback elsewhere.
+func NewSender(timeout time.Duration, allowedNetworks []*net.IPNet) *Sender {
+	s := &Sender{allowed: allowedNetworks}
+	dialer := &net.Dialer{Timeout: timeout, Control: s.checkAddress}
+	s.Client = &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// no proxy, since the proxy's address would be checked instead
+			// of the endpoint's
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return s
+}
+
+// Allowed reports whether callbacks may be sent to the address: a public
+// one, or one within the allowed networks
+func (s *Sender) Allowed(ip net.IP) bool {
+	for _, network := range s.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkAddress refuses connections to addresses that are not allowed. It
+// runs as the dialer's Control, with the address resolved.
+func (s *Sender) checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !s.Allowed(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+// Send posts the callback, signed at the current time. Any response but a
+// 2xx is an error; status is 0 when no response was received. Errors do not
+// include the body of the response, which is not the sender's to reveal.
+func (s *Sender) Send(ctx context.Context, req Request) (status int, err error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "notes-webhook/1")
+	httpReq.Header.Set(TimestampHeader, timestamp)
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, timestamp, req.Body))
+	httpReq.Header.Set(EventHeader, req.Event)
+	httpReq.Header.Set(DeliveryHeader, req.DeliveryID)
+
+	resp, err := s.Client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// drained so that the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the signature of a body sent at the timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether the signature matches the body and timestamp, in
+// constant time
+func Verify(secret, timestamp, signature string, body []byte) bool {
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
+
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loopback allows the httptest servers, which listen on it
+var loopback = parseCIDRs("127.0.0.0/8", "::1/128")
+
+func TestSendSigns(t *testing.T) {
+	body := []byte(`{"type":"note.created"}`)
+	received := make(chan *http.Request, 1)
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedBody, _ = io.ReadAll(r.Body)
+		received <- r
+	}))
+	defer server.Close()
+
+	sender := NewSender(time.Second, loopback)
+	before := time.Now().Unix()
+	status, err := sender.Send(context.Background(), Request{
+		URL:        server.URL,
+		Secret:     "secret",
+		Event:      "note.created",
+		DeliveryID: "delivery",
+		Body:       body,
+	})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Send = %d, %v", status, err)
+	}
+	r := <-received
+
+	timestamp := r.Header.Get(TimestampHeader)
+	sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || sentAt < before || sentAt > time.Now().Unix() {
+		t.Errorf("timestamp %q is not the time of sending", timestamp)
+	}
+	signature := r.Header.Get(SignatureHeader)
+	if !Verify("secret", timestamp, signature, receivedBody) {
+		t.Errorf("signature %q does not verify", signature)
+	}
+	if Verify("other secret", timestamp, signature, receivedBody) {
+		t.Error("signature verifies with another secret")
+	}
+	if Verify("secret", strconv.FormatInt(sentAt+1, 10), signature, receivedBody) {
+		t.Error("signature verifies with another timestamp")
+	}
+	if string(receivedBody) != string(body) {
+		t.Errorf("received %s, want %s", receivedBody, body)
+	}
+	if r.Header.Get(EventHeader) != "note.created" || r.Header.Get(DeliveryHeader) != "delivery" {
+		t.Errorf("got event %q and delivery %q", r.Header.Get(EventHeader), r.Header.Get(DeliveryHeader))
+	}
+}
+
+func TestSendFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/", http.StatusFound)
+		default:
+			http.Error(w, "internal detail", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	sender := NewSender(time.Second, loopback)
+
+	status, err := sender.Send(context.Background(), Request{URL: server.URL, Secret: "secret"})
+	if status != http.StatusInternalServerError || err == nil {
+		t.Fatalf("Send = %d, %v, want a 500 error", status, err)
+	}
+	if strings.Contains(err.Error(), "internal detail") {
+		t.Errorf("error %q reveals the response body", err)
+	}
+
+	status, err = sender.Send(context.Background(), Request{URL: server.URL + "/redirect", Secret: "secret"})
+	if status != http.StatusFound || err == nil {
+		t.Errorf("Send = %d, %v, want the redirect not followed", status, err)
+	}
+
+	status, err = NewSender(time.Second, nil).Send(context.Background(), Request{URL: server.URL, Secret: "secret"})
+	if status != 0 || !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("Send to loopback = %d, %v, want it refused", status, err)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	sender := NewSender(time.Second, nil)
+	for _, tt := range tests {
+		if got := sender.Allowed(net.ParseIP(tt.ip)); got != tt.allowed {
+			t.Errorf("Allowed(%s) = %v, want %v", tt.ip, got, tt.allowed)
+		}
+	}
+
+	sender = NewSender(time.Second, parseCIDRs("10.0.0.0/8"))
+	if !sender.Allowed(net.ParseIP("10.1.2.3")) || sender.Allowed(net.ParseIP("192.168.1.1")) {
+		t.Error("allowed networks are not reachable alone")
+	}
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Attachment is a file uploaded to a note. The bytes live in the blob store
+// under StorageKey.
+type Attachment struct {
+	ID     string `gorm:"type:uuid;primary_key"`
+	NoteID string `gorm:"type:uuid;not null;index"`
+	// UserID is the uploader, whose quota the attachment counts against
+	UserID      string `gorm:"type:uuid;not null;index"`
+	Filename    string `gorm:"not null"`
+	ContentType string `gorm:"not null"`
+	Size        int64  `gorm:"not null"`
+	// Checksum is the hex encoded SHA-256 of the contents
+	Checksum   string `gorm:"not null"`
+	StorageKey string `gorm:"not null"`
+	CreatedAt  time.Time
+	// PurgedAt is set when the attachment or its note is permanently
+	// deleted. The row is removed once the blob is.
+	PurgedAt *time.Time `gorm:"index"`
+}
+
+// BeforeCreate assigns an ID to the attachment if one was not provided
+func (a *Attachment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == "" {
+		a.ID = NewID()
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audit event types
+const (
+	AuditAccountLocked   = "account.locked"
+	AuditAccountUnlocked = "account.unlocked"
+	AuditIPLocked        = "ip.locked"
+	AuditIPUnlocked      = "ip.unlocked"
+)
+
+// AuditEvent records a security relevant event such as an account lockout
+type AuditEvent struct {
+	ID        string `gorm:"type:uuid;primary_key"`
+	Type      string `gorm:"not null;index"`
+	Actor     string
+	Subject   string
+	IP        string
+	Detail    string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// BeforeCreate assigns an ID to the audit event if one was not provided
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = NewID()
+	}
+	return nil
+}
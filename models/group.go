@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Group roles, from least to most privileged
+const (
+	GroupRoleMember = "member"
+	GroupRoleAdmin  = "admin"
+	GroupRoleOwner  = "owner"
+)
+
+// Group is a team workspace. Notes with its GroupID belong to the group
+// rather than to the user who wrote them.
+type Group struct {
+	ID        string `gorm:"type:uuid;primary_key"`
+	Name      string `gorm:"not null"`
+	CreatedBy string `gorm:"type:uuid;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Membership gives a user a role in a group
+type Membership struct {
+	GroupID   string `gorm:"type:uuid;primaryKey"`
+	UserID    string `gorm:"type:uuid;primaryKey;index"`
+	Role      string `gorm:"not null;default:member"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeCreate assigns an ID to the group if one was not provided
+func (g *Group) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == "" {
+		g.ID = NewID()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// NewID generates a random (version 4) UUID string
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// BeforeCreate assigns an ID to the user if one was not provided.
+// IDs are generated in Go rather than by the database so that every
+// backend (postgres, sqlite, memory) produces the same kind of key.
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == "" {
+		u.ID = NewID()
+	}
+	return nil
+}
+
+// BeforeCreate assigns an ID to the note if one was not provided and
+// starts it at version 1
+func (n *Note) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == "" {
+		n.ID = NewID()
+	}
+	if n.Version == 0 {
+		n.Version = 1
+	}
+	return nil
+}
+
+// BeforeCreate assigns an ID to the shared note if one was not provided
+func (s *SharedNote) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = NewID()
+	}
+	return nil
+}
+
+// BeforeCreate assigns an ID to the tag if one was not provided
+func (t *Tag) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = NewID()
+	}
+	return nil
+}
+
+// BeforeCreate assigns an ID to the revision if one was not provided
+func (r *NoteRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == "" {
+		r.ID = NewID()
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Import job statuses
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// Import item statuses
+const (
+	ImportItemCreated = "created"
+	// ImportItemValid marks an item a dry run would have imported
+	ImportItemValid   = "valid"
+	ImportItemSkipped = "skipped"
+	ImportItemFailed  = "failed"
+)
+
+// ImportJob is a bulk import of notes, run in the background
+type ImportJob struct {
+	ID            string `gorm:"type:uuid;primary_key"`
+	UserID        string `gorm:"type:uuid;not null;index"`
+	Format        string `gorm:"not null"`
+	Filename      string
+	DryRun        bool   `gorm:"not null;default:false"`
+	DedupeByTitle bool   `gorm:"not null;default:false"`
+	Status        string `gorm:"not null;default:pending"`
+	// Error is why the whole import failed, as opposed to single items
+	Error      string
+	Total      int `gorm:"not null;default:0"`
+	Created    int `gorm:"not null;default:0"`
+	Skipped    int `gorm:"not null;default:0"`
+	Failed     int `gorm:"not null;default:0"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+// ImportItem is the outcome of importing one entry of an import job
+type ImportItem struct {
+	ID    string `gorm:"type:uuid;primary_key"`
+	JobID string `gorm:"type:uuid;not null;index"`
+	// Position orders the items as they appeared in the import
+	Position int    `gorm:"not null"`
+	Name     string `gorm:"not null"`
+	Title    string
+	Status   string  `gorm:"not null"`
+	NoteID   *string `gorm:"type:uuid"`
+	Error    string
+}
+
+// BeforeCreate assigns an ID to the import job if one was not provided
+func (j *ImportJob) BeforeCreate(tx *gorm.DB) error {
+	if j.ID == "" {
+		j.ID = NewID()
+	}
+	return nil
+}
+
+// BeforeCreate assigns an ID to the import item if one was not provided
+func (i *ImportItem) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == "" {
+		i.ID = NewID()
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginAttempt tracks consecutive failed logins for a key, which is either
+// a username ("user:<name>") or a client IP ("ip:<addr>")
+type LoginAttempt struct {
+	Key           string `gorm:"primary_key"`
+	Failures      int    `gorm:"not null;default:0"`
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+	UpdatedAt     time.Time
+}
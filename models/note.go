@@ -4,14 +4,32 @@ import (
 	"time"
 )
 
+// Note formats, telling how the content is rendered
+const (
+	NoteFormatPlain    = "plain"
+	NoteFormatMarkdown = "markdown"
+)
+
 type Note struct {
-	ID          string `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	UserID      string `gorm:"type:uuid;not null"`
-	Title       string `gorm:"not null"`
-	Content     string
-	Shared      bool `gorm:"default:false"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	IsDeleted   bool         `gorm:"type:boolean;default:false"`
+	ID     string `gorm:"type:uuid;primary_key"`
+	UserID string `gorm:"type:uuid;not null"`
+	// GroupID is set when the note belongs to a group, UserID then being
+	// the member who wrote it
+	GroupID *string `gorm:"type:uuid;index"`
+	// NotebookID is the notebook the note is filed in, nil for none
+	NotebookID *string `gorm:"type:uuid;index"`
+	Title      string  `gorm:"not null"`
+	Content    string
+	Format     string `gorm:"not null;default:plain"`
+	Shared     bool   `gorm:"default:false"`
+	// Version counts the changes to the note, starting at 1
+	Version   int `gorm:"not null;default:1"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// DeletedAt is when the note was moved to the trash, nil for notes
+	// that are not deleted
+	DeletedAt   *time.Time   `gorm:"index"`
 	SharedNotes []SharedNote `gorm:"foreignKey:NoteID"`
+	// Tags is filled in by the store when the note is read
+	Tags []Tag `gorm:"-"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notebook is a folder for a user's notes. Notebooks nest through ParentID,
+// nil for top level notebooks.
+type Notebook struct {
+	ID        string  `gorm:"type:uuid;primary_key"`
+	UserID    string  `gorm:"type:uuid;not null;index"`
+	ParentID  *string `gorm:"type:uuid;index"`
+	Name      string  `gorm:"not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeCreate assigns an ID to the notebook if one was not provided
+func (n *Notebook) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == "" {
+		n.ID = NewID()
+	}
+	return nil
+}
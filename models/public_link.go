@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PublicLink lets anyone holding its token read a note without an account.
+// Only the SHA-256 hash of the token is stored.
+type PublicLink struct {
+	ID        string `gorm:"type:uuid;primary_key"`
+	NoteID    string `gorm:"type:uuid;not null;index"`
+	UserID    string `gorm:"type:uuid;not null"`
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	// PasswordHash is the bcrypt hash of the link password, empty when the
+	// link has none
+	PasswordHash string
+	ExpiresAt    *time.Time
+	// MaxViews is the number of times the link may be opened, nil for no
+	// limit
+	MaxViews       *int
+	ViewCount      int `gorm:"not null;default:0"`
+	LastAccessedAt *time.Time
+	RevokedAt      *time.Time
+	CreatedAt      time.Time
+}
+
+// BeforeCreate assigns an ID to the public link if one was not provided
+func (l *PublicLink) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == "" {
+		l.ID = NewID()
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// NoteRevision is an immutable snapshot of a note's title and content,
+// written on every change. Numbers count up from 1 for each note.
+type NoteRevision struct {
+	ID       string `gorm:"type:uuid;primary_key"`
+	NoteID   string `gorm:"type:uuid;not null;uniqueIndex:idx_note_revisions_note_number"`
+	Number   int    `gorm:"not null;uniqueIndex:idx_note_revisions_note_number"`
+	AuthorID string `gorm:"type:uuid;not null"`
+	Title    string `gorm:"not null"`
+	Content  string
+	// RestoredFrom is the number of the revision this one restored
+	RestoredFrom *int
+	CreatedAt    time.Time
+}
@@ -6,11 +6,20 @@ import (
 	"time"
 )
 
+// Share roles, from least to most privileged
+const (
+	RoleViewer    = "viewer"
+	RoleCommenter = "commenter"
+	RoleEditor    = "editor"
+)
+
 type SharedNote struct {
-	ID         string `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	NoteID     string `gorm:"type:uuid;not null"`
+	ID         string `gorm:"type:uuid;primary_key"`
+	NoteID     string `gorm:"type:uuid;not null;uniqueIndex:idx_shared_notes_note_user"`
 	FromUserID string `gorm:"type:uuid;not null"`
-	ToUserID   string `gorm:"type:uuid;not null"`
-	CreatedAt  time.Time
-	UpdatedAt  time.Time
+	ToUserID   string `gorm:"type:uuid;not null;uniqueIndex:idx_shared_notes_note_user;index"`
+	// Role is what the recipient may do with the note
+	Role      string `gorm:"not null;default:viewer"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
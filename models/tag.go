@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Tag is a label a user attaches to their notes. Names are unique per user.
+type Tag struct {
+	ID        string `gorm:"type:uuid;primary_key"`
+	UserID    string `gorm:"type:uuid;not null;uniqueIndex:idx_tags_user_name"`
+	Name      string `gorm:"not null;uniqueIndex:idx_tags_user_name"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// NoteTag links a note to one of its tags
+type NoteTag struct {
+	NoteID    string `gorm:"type:uuid;primaryKey"`
+	TagID     string `gorm:"type:uuid;primaryKey;index"`
+	CreatedAt time.Time
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken is a server-side record of an issued refresh token. Only the
+// SHA-256 hash of the token is stored. Tokens rotated from the same login
+// share a FamilyID so the whole chain can be revoked at once.
+type RefreshToken struct {
+	ID        string    `gorm:"type:uuid;primary_key"`
+	UserID    string    `gorm:"type:uuid;not null;index"`
+	FamilyID  string    `gorm:"type:uuid;not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// RevokedToken is a denylist entry for an access token that was revoked
+// before it expired. Entries can be dropped once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `gorm:"primary_key"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// BeforeCreate assigns an ID to the refresh token if one was not provided
+func (t *RefreshToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = NewID()
+	}
+	return nil
+}
@@ -5,10 +5,11 @@ import (
 )
 
 type User struct {
-	ID           string `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	ID           string `gorm:"type:uuid;primary_key"`
 	CreatedAt    time.Time
 	Username     string       `gorm:"unique;not null"`
 	PasswordHash string       `gorm:"not null"`
+	IsAdmin      bool         `gorm:"not null;default:false"`
 	Notes        []Note       `gorm:"foreignKey:UserID"`
 	SharedNotes  []SharedNote `gorm:"foreignKey:ToUserID"`
 }
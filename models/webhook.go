@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint a user registered to be called when their notes
+// change
+type Webhook struct {
+	ID     string `gorm:"type:uuid;primary_key"`
+	UserID string `gorm:"type:uuid;not null;index"`
+	URL    string `gorm:"not null"`
+	// Secret signs the deliveries. It is kept in the clear since signing
+	// needs it.
+	Secret string `gorm:"not null"`
+	// Events is a comma separated list of the event types delivered, empty
+	// for all of them
+	Events string
+	// ConsecutiveFailures counts the failed delivery attempts since the
+	// last one that succeeded
+	ConsecutiveFailures int `gorm:"not null;default:0"`
+	// DisabledAt is when the webhook was disabled, by its user or after
+	// failing too often, nil while it is active
+	DisabledAt     *time.Time
+	DisabledReason string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// WebhookDelivery is an event queued for, or delivered to, a webhook
+type WebhookDelivery struct {
+	ID        string `gorm:"type:uuid;primary_key"`
+	WebhookID string `gorm:"type:uuid;not null;index"`
+	EventID   uint64 `gorm:"not null"`
+	EventType string `gorm:"not null"`
+	// Payload is the JSON body sent
+	Payload  string `gorm:"type:text;not null"`
+	Status   string `gorm:"not null;default:pending;index"`
+	Attempts int    `gorm:"not null;default:0"`
+	// NextAttemptAt is when a pending delivery is attempted next
+	NextAttemptAt time.Time `gorm:"not null"`
+	LastAttemptAt *time.Time
+	// ResponseStatus is the HTTP status of the last attempt, 0 when the
+	// endpoint could not be reached
+	ResponseStatus int
+	// Error is why the last attempt failed
+	Error     string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// BeforeCreate assigns an ID to the webhook if one was not provided
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == "" {
+		w.ID = NewID()
+	}
+	return nil
+}
+
+// BeforeCreate assigns an ID to the delivery if one was not provided
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = NewID()
+	}
+	return nil
+}